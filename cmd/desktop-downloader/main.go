@@ -1,7 +1,10 @@
 package main
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -14,21 +17,34 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/pikpak"
 )
 
 type manifestResponse struct {
 	FolderID   string          `json:"folder_id"`
 	FolderName string          `json:"folder_name"`
+	SnapshotID string          `json:"snapshot_id"`
 	TotalFiles int             `json:"total_files"`
 	Items      []manifestEntry `json:"items"`
+
+	// Only set for delta responses (?since=<snapshot>).
+	Since    string          `json:"since"`
+	Added    []manifestEntry `json:"added"`
+	Modified []manifestEntry `json:"modified"`
+	Removed  []manifestEntry `json:"removed"`
 }
 
+var errSnapshotGone = errors.New("snapshot kedaluwarsa di server")
+
 type manifestEntry struct {
 	FileID         string `json:"file_id"`
 	Name           string `json:"name"`
 	RelativePath   string `json:"relative_path"`
 	Size           string `json:"size"`
 	WebContentLink string `json:"web_content_link"`
+	Hash           string `json:"hash"`
+	MD5Checksum    string `json:"md5_checksum"`
 }
 
 type fileState struct {
@@ -37,12 +53,14 @@ type fileState struct {
 	Error     string `json:"error,omitempty"`
 	UpdatedAt string `json:"updated_at"`
 	Path      string `json:"path,omitempty"`
+	Checksum  string `json:"checksum,omitempty"` // verified digest, "md5:<hex>" or "gcid:<hex>"
 }
 
 type stateStore struct {
-	FolderID   string               `json:"folder_id"`
-	FolderName string               `json:"folder_name"`
-	UpdatedAt  string               `json:"updated_at"`
+	FolderID   string                `json:"folder_id"`
+	FolderName string                `json:"folder_name"`
+	SnapshotID string                `json:"snapshot_id,omitempty"` // set only after a run without failures
+	UpdatedAt  string                `json:"updated_at"`
 	Files      map[string]*fileState `json:"files"`
 }
 
@@ -50,6 +68,17 @@ type downloadJob struct {
 	Entry       manifestEntry
 	Destination string
 	Expected    int64
+	Verify      bool
+}
+
+type checksumMismatchError struct {
+	Algo     string
+	Got      string
+	Expected string
+}
+
+func (e *checksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch (%s): got=%s expected=%s", e.Algo, e.Got, e.Expected)
 }
 
 func main() {
@@ -62,6 +91,8 @@ func main() {
 		workers    = flag.Int("workers", 4, "Jumlah worker download paralel")
 		retries    = flag.Int("retries", 3, "Retry per file")
 		timeoutSec = flag.Int("timeout", 180, "Timeout HTTP download (detik)")
+		verify     = flag.Bool("verify", true, "Verifikasi checksum (md5/gcid) dari manifest")
+		full       = flag.Bool("full", false, "Abaikan snapshot sebelumnya, ambil manifest penuh")
 	)
 	flag.Parse()
 
@@ -78,15 +109,11 @@ func main() {
 		*retries = 1
 	}
 
-	manifest, err := fetchManifest(*serverURL, *sessionID, *folderID, *folderName)
-	if err != nil {
-		fatal("gagal ambil manifest: %v", err)
+	displayName := strings.TrimSpace(*folderName)
+	if displayName == "" {
+		displayName = *folderID
 	}
-	if manifest.FolderName == "" {
-		manifest.FolderName = *folderID
-	}
-
-	baseDir := filepath.Join(*outDir, sanitizeName(manifest.FolderName))
+	baseDir := filepath.Join(*outDir, sanitizeName(displayName))
 	if err := os.MkdirAll(baseDir, 0o755); err != nil {
 		fatal("gagal membuat folder output: %v", err)
 	}
@@ -96,16 +123,46 @@ func main() {
 	if state.Files == nil {
 		state.Files = map[string]*fileState{}
 	}
+
+	since := ""
+	if !*full && state.FolderID == *folderID {
+		since = state.SnapshotID
+	}
+	manifest, err := fetchManifest(*serverURL, *sessionID, *folderID, *folderName, since)
+	if errors.Is(err, errSnapshotGone) {
+		fmt.Println("Snapshot lama sudah kedaluwarsa, ambil manifest penuh.")
+		manifest, err = fetchManifest(*serverURL, *sessionID, *folderID, *folderName, "")
+	}
+	if err != nil {
+		fatal("gagal ambil manifest: %v", err)
+	}
+	if manifest.FolderName == "" {
+		manifest.FolderName = *folderID
+	}
 	state.FolderID = manifest.FolderID
 	state.FolderName = manifest.FolderName
 
-	jobs := prepareJobs(manifest.Items, baseDir, state)
+	items := manifest.Items
+	if manifest.Since != "" {
+		items = applyManifestDelta(manifest, state)
+		fmt.Printf("Delta sejak snapshot %s: +%d ~%d -%d\n", manifest.Since, len(manifest.Added), len(manifest.Modified), len(manifest.Removed))
+	}
+
+	jobs, skipped := prepareJobs(items, baseDir, state, *verify)
 	if len(jobs) == 0 {
-		fmt.Println("Semua file sudah selesai. Tidak ada job baru.")
+		if skipped == 0 {
+			state.SnapshotID = manifest.SnapshotID
+			saveState(statePath, state)
+			fmt.Println("Semua file sudah selesai. Tidak ada job baru.")
+			return
+		}
+		state.SnapshotID = ""
+		saveState(statePath, state)
+		fmt.Printf("Tidak ada job baru. %d file belum punya link unduhan, jalankan lagi nanti.\n", skipped)
 		return
 	}
 
-	fmt.Printf("Manifest: %d file | Pending: %d | Output: %s\n", len(manifest.Items), len(jobs), baseDir)
+	fmt.Printf("Manifest: %d file | Pending: %d | Output: %s\n", manifest.TotalFiles, len(jobs), baseDir)
 
 	httpClient := &http.Client{Timeout: time.Duration(*timeoutSec) * time.Second}
 	jobsCh := make(chan downloadJob)
@@ -116,7 +173,7 @@ func main() {
 	for i := 0; i < *workers; i++ {
 		go func() {
 			for job := range jobsCh {
-				err := downloadWithRetry(httpClient, job, *retries)
+				checksum, err := downloadWithRetry(httpClient, job, *retries)
 
 				mu.Lock()
 				fs := state.Files[job.Entry.FileID]
@@ -135,6 +192,7 @@ func main() {
 				} else {
 					fs.Status = "done"
 					fs.Error = ""
+					fs.Checksum = checksum
 					atomic.AddInt64(&completed, 1)
 					fmt.Printf("[DONE]   %s\n", job.Entry.RelativePath)
 				}
@@ -159,10 +217,35 @@ func main() {
 		time.Sleep(400 * time.Millisecond)
 	}
 
-	fmt.Printf("Selesai. Success=%d Failed=%d State=%s\n", completed, failed, statePath)
+	// A delta only lists changed files, so failed ones and those without a
+	// link yet would be skipped on the next run; keep the snapshot only when
+	// everything finished.
+	if failed == 0 && skipped == 0 {
+		state.SnapshotID = manifest.SnapshotID
+	} else {
+		state.SnapshotID = ""
+	}
+	saveState(statePath, state)
+
+	fmt.Printf("Selesai. Success=%d Failed=%d Tanpa link=%d State=%s\n", completed, failed, skipped, statePath)
 }
 
-func fetchManifest(serverURL, sessionID, folderID, folderName string) (*manifestResponse, error) {
+// applyManifestDelta updates the state for a delta response and returns the
+// entries that need to be checked for download. Removed files stay on disk.
+func applyManifestDelta(manifest *manifestResponse, state *stateStore) []manifestEntry {
+	for _, item := range manifest.Modified {
+		delete(state.Files, item.FileID)
+	}
+	for _, item := range manifest.Removed {
+		delete(state.Files, item.FileID)
+		fmt.Printf("[REMOVED] %s (file lokal tidak dihapus)\n", item.RelativePath)
+	}
+	items := make([]manifestEntry, 0, len(manifest.Added)+len(manifest.Modified))
+	items = append(items, manifest.Added...)
+	return append(items, manifest.Modified...)
+}
+
+func fetchManifest(serverURL, sessionID, folderID, folderName, since string) (*manifestResponse, error) {
 	base := strings.TrimRight(serverURL, "/") + "/api/folder/manifest"
 	q := url.Values{}
 	q.Set("folder_id", folderID)
@@ -170,6 +253,9 @@ func fetchManifest(serverURL, sessionID, folderID, folderName string) (*manifest
 		q.Set("folder_name", folderName)
 	}
 	q.Set("format", "json")
+	if since != "" {
+		q.Set("since", since)
+	}
 	urlWithQuery := base + "?" + q.Encode()
 
 	req, err := http.NewRequest(http.MethodGet, urlWithQuery, nil)
@@ -186,6 +272,9 @@ func fetchManifest(serverURL, sessionID, folderID, folderName string) (*manifest
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusGone && since != "" {
+		return nil, errSnapshotGone
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("status=%d body=%s", resp.StatusCode, string(body))
 	}
@@ -197,10 +286,24 @@ func fetchManifest(serverURL, sessionID, folderID, folderName string) (*manifest
 	return &out, nil
 }
 
-func prepareJobs(items []manifestEntry, baseDir string, state *stateStore) []downloadJob {
+// prepareJobs returns the downloads still to do and how many entries were
+// skipped because the server had no link for them yet; those are kept as
+// failed so the next run picks them up.
+func prepareJobs(items []manifestEntry, baseDir string, state *stateStore, verify bool) ([]downloadJob, int) {
 	jobs := make([]downloadJob, 0, len(items))
+	skipped := 0
 	for _, item := range items {
 		if strings.TrimSpace(item.WebContentLink) == "" {
+			if st, ok := state.Files[item.FileID]; ok && st != nil && st.Status == "done" {
+				continue
+			}
+			skipped++
+			state.Files[item.FileID] = &fileState{
+				Status:    "failed",
+				Error:     "link unduhan belum tersedia",
+				UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+				Path:      item.RelativePath,
+			}
 			continue
 		}
 		if st, ok := state.Files[item.FileID]; ok && st != nil && st.Status == "done" {
@@ -213,37 +316,97 @@ func prepareJobs(items []manifestEntry, baseDir string, state *stateStore) []dow
 
 		if expected > 0 {
 			if fi, err := os.Stat(dest); err == nil && fi.Size() == expected {
+				checksum, verr := verifyExistingFile(dest, item, expected, verify)
+				if verr == nil {
+					state.Files[item.FileID] = &fileState{
+						Status:    "done",
+						Attempts:  0,
+						UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+						Path:      item.RelativePath,
+						Checksum:  checksum,
+					}
+					continue
+				}
+				fmt.Printf("[VERIFY] %s -> %v, download ulang\n", item.RelativePath, verr)
 				state.Files[item.FileID] = &fileState{
-					Status:    "done",
-					Attempts:  0,
+					Status:    "failed",
+					Error:     verr.Error(),
 					UpdatedAt: time.Now().UTC().Format(time.RFC3339),
 					Path:      item.RelativePath,
 				}
-				continue
 			}
 		}
 
-		jobs = append(jobs, downloadJob{Entry: item, Destination: dest, Expected: expected})
+		jobs = append(jobs, downloadJob{Entry: item, Destination: dest, Expected: expected, Verify: verify})
 	}
-	return jobs
+	return jobs, skipped
 }
 
-func downloadWithRetry(client *http.Client, job downloadJob, retries int) error {
+func downloadWithRetry(client *http.Client, job downloadJob, retries int) (string, error) {
 	var lastErr error
 	for i := 0; i < retries; i++ {
-		if err := downloadOne(client, job); err == nil {
-			return nil
+		if checksum, err := downloadOne(client, job); err == nil {
+			return checksum, nil
 		} else {
 			lastErr = err
 			time.Sleep(time.Duration(i+1) * 700 * time.Millisecond)
 		}
 	}
-	return lastErr
+	return "", lastErr
+}
+
+// fileDigest picks the strongest checksum available in the manifest entry.
+// PikPak only fills md5_checksum for some files, the GCID hash is almost always present.
+// The GCID block size depends on the file size, so without a size only MD5 is checked.
+type fileDigest struct {
+	algo     string
+	expected string
+	writer   io.Writer
+	sum      func() string
+}
+
+func newFileDigest(entry manifestEntry, size int64) *fileDigest {
+	if md5sum := strings.ToLower(strings.TrimSpace(entry.MD5Checksum)); md5sum != "" {
+		h := md5.New()
+		return &fileDigest{algo: "md5", expected: md5sum, writer: h, sum: func() string { return hex.EncodeToString(h.Sum(nil)) }}
+	}
+	if gcid := strings.ToUpper(strings.TrimSpace(entry.Hash)); gcid != "" && size > 0 {
+		h := pikpak.NewGCIDHasher(size)
+		return &fileDigest{algo: "gcid", expected: gcid, writer: h, sum: h.HexSum}
+	}
+	return nil
+}
+
+func (d *fileDigest) check() (string, error) {
+	got := d.sum()
+	if !strings.EqualFold(got, d.expected) {
+		return "", &checksumMismatchError{Algo: d.algo, Got: got, Expected: d.expected}
+	}
+	return d.algo + ":" + strings.ToLower(got), nil
+}
+
+func verifyExistingFile(dest string, entry manifestEntry, size int64, verify bool) (string, error) {
+	if !verify {
+		return "", nil
+	}
+	digest := newFileDigest(entry, size)
+	if digest == nil {
+		return "", nil
+	}
+	f, err := os.Open(dest)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(digest.writer, f); err != nil {
+		return "", err
+	}
+	return digest.check()
 }
 
-func downloadOne(client *http.Client, job downloadJob) error {
+func downloadOne(client *http.Client, job downloadJob) (string, error) {
 	if err := os.MkdirAll(filepath.Dir(job.Destination), 0o755); err != nil {
-		return err
+		return "", err
 	}
 
 	tmpPath := job.Destination + ".part"
@@ -254,7 +417,7 @@ func downloadOne(client *http.Client, job downloadJob) error {
 
 	req, err := http.NewRequest(http.MethodGet, job.Entry.WebContentLink, nil)
 	if err != nil {
-		return err
+		return "", err
 	}
 	if existing > 0 {
 		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", existing))
@@ -262,13 +425,13 @@ func downloadOne(client *http.Client, job downloadJob) error {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
 	}
 
 	flag := os.O_CREATE | os.O_WRONLY
@@ -279,33 +442,68 @@ func downloadOne(client *http.Client, job downloadJob) error {
 		existing = 0
 	}
 
+	var digest *fileDigest
+	if job.Verify {
+		digest = newFileDigest(job.Entry, job.Expected)
+	}
+	// When resuming, the bytes already in .part must go through the digest first.
+	if digest != nil && existing > 0 {
+		if err := hashFilePrefix(tmpPath, existing, digest.writer); err != nil {
+			return "", err
+		}
+	}
+
 	f, err := os.OpenFile(tmpPath, flag, 0o644)
 	if err != nil {
-		return err
+		return "", err
+	}
+	var dst io.Writer = f
+	if digest != nil {
+		dst = io.MultiWriter(f, digest.writer)
 	}
-	_, copyErr := io.Copy(f, resp.Body)
+	_, copyErr := io.Copy(dst, resp.Body)
 	closeErr := f.Close()
 	if copyErr != nil {
-		return copyErr
+		return "", copyErr
 	}
 	if closeErr != nil {
-		return closeErr
+		return "", closeErr
 	}
 
 	if job.Expected > 0 {
 		fi, err := os.Stat(tmpPath)
 		if err != nil {
-			return err
+			return "", err
 		}
 		if fi.Size() != job.Expected {
-			return fmt.Errorf("size mismatch: got=%d expected=%d", fi.Size(), job.Expected)
+			return "", fmt.Errorf("size mismatch: got=%d expected=%d", fi.Size(), job.Expected)
+		}
+	}
+
+	checksum := ""
+	if digest != nil {
+		checksum, err = digest.check()
+		if err != nil {
+			// Corrupted data cannot be resumed, start the next attempt from zero.
+			_ = os.Remove(tmpPath)
+			return "", err
 		}
 	}
 
 	if err := os.Rename(tmpPath, job.Destination); err != nil {
+		return "", err
+	}
+	return checksum, nil
+}
+
+func hashFilePrefix(path string, n int64, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
 		return err
 	}
-	return nil
+	defer f.Close()
+	_, err = io.CopyN(w, f, n)
+	return err
 }
 
 func parseSize(sizeStr string) int64 {
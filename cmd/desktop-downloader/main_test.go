@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNewFileDigest(t *testing.T) {
+	const (
+		content = "hello world"
+		md5sum  = "5eb63bbbe01eeed093cb22bb8f5acdc3"
+		gcid    = "67BECF85308ACF0261750DA1075681EE5C412F05"
+	)
+	tests := []struct {
+		name     string
+		entry    manifestEntry
+		size     int64
+		wantAlgo string // "" means no verification
+	}{
+		{"md5 first", manifestEntry{MD5Checksum: md5sum, Hash: gcid}, 11, "md5"},
+		{"md5 without size", manifestEntry{MD5Checksum: md5sum, Hash: gcid}, 0, "md5"},
+		{"gcid", manifestEntry{Hash: strings.ToLower(gcid)}, 11, "gcid"},
+		{"gcid without size", manifestEntry{Hash: gcid}, 0, ""},
+		{"nothing", manifestEntry{}, 11, ""},
+	}
+	for _, tt := range tests {
+		d := newFileDigest(tt.entry, tt.size)
+		if tt.wantAlgo == "" {
+			if d != nil {
+				t.Errorf("%s: got %s digest, want none", tt.name, d.algo)
+			}
+			continue
+		}
+		if d == nil || d.algo != tt.wantAlgo {
+			t.Errorf("%s: got %+v, want %s", tt.name, d, tt.wantAlgo)
+			continue
+		}
+		io.WriteString(d.writer, content)
+		if got, err := d.check(); err != nil || got != tt.wantAlgo+":"+strings.ToLower(d.expected) {
+			t.Errorf("%s: check = %q, %v", tt.name, got, err)
+		}
+	}
+
+	d := newFileDigest(manifestEntry{Hash: gcid}, 11)
+	io.WriteString(d.writer, "hello worle")
+	var mismatch *checksumMismatchError
+	if _, err := d.check(); !errors.As(err, &mismatch) {
+		t.Fatalf("corrupted file: err %v, want checksum mismatch", err)
+	}
+}
+
+func TestPrepareJobsCountsEntriesWithoutLink(t *testing.T) {
+	state := &stateStore{Files: map[string]*fileState{"done": {Status: "done"}}}
+	items := []manifestEntry{
+		{FileID: "a", RelativePath: "a.bin", WebContentLink: "https://dl.example.com/a"},
+		{FileID: "b", RelativePath: "b.bin"},
+		{FileID: "done", RelativePath: "done.bin"},
+	}
+
+	jobs, skipped := prepareJobs(items, t.TempDir(), state, false)
+	if len(jobs) != 1 || skipped != 1 {
+		t.Fatalf("got %d jobs and %d skipped, want 1 and 1", len(jobs), skipped)
+	}
+	if st := state.Files["b"]; st == nil || st.Status != "failed" {
+		t.Fatalf("entry without link: state %+v, want failed", st)
+	}
+}
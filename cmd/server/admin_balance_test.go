@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+)
+
+func TestAdminBalanceChangesAreAdjustments(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "adjust@example.com", 10000)
+
+	for _, balance := range []int64{25000, 5000} {
+		rec := httptest.NewRecorder()
+		body := strings.NewReader(fmt.Sprintf(`{"user_id":%d,"balance":%d}`, user.ID, balance))
+		handleAdminUserBalance(rec, httptest.NewRequest(http.MethodPost, "/api/admin/users/balance", body))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("set balance %d: status %d: %s", balance, rec.Code, rec.Body)
+		}
+	}
+
+	var rows []database.Transaction
+	database.DB.Where("user_id = ?", user.ID).Order("id asc").Find(&rows)
+	if len(rows) != 2 {
+		t.Fatalf("%d transactions, want 2", len(rows))
+	}
+	for i, want := range []int64{15000, -20000} {
+		if rows[i].Type != "adjustment" || rows[i].Amount != want || rows[i].InvoiceNo != nil {
+			t.Errorf("row %d: type %q, amount %d, invoice %v; want an adjustment of %d", i, rows[i].Type, rows[i].Amount, rows[i].InvoiceNo, want)
+		}
+	}
+}
+
+func TestMigrationRelabelsLegacyAdminTopups(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "legacy@example.com", 0)
+	legacy := database.Transaction{UserID: user.ID, Amount: 5000, Type: "topup", Description: "Admin set balance: 0 -> 5000"}
+	real := database.Transaction{UserID: user.ID, Amount: 50000, Type: "topup", Description: "Top Up (bca)"}
+	database.DB.Create(&legacy)
+	database.DB.Create(&real)
+
+	if err := database.AutoMigrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := backfillInvoiceNumbers(); err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+	database.DB.First(&legacy, legacy.ID)
+	database.DB.First(&real, real.ID)
+	if legacy.Type != "adjustment" || legacy.InvoiceNo != nil {
+		t.Errorf("legacy admin row: type %q, invoice %v", legacy.Type, legacy.InvoiceNo)
+	}
+	if real.Type != "topup" || real.InvoiceNo == nil {
+		t.Errorf("real top up: type %q, invoice %v", real.Type, real.InvoiceNo)
+	}
+}
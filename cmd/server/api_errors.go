@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/youming-ai/pikpak-downloader/internal/apierror"
+	"github.com/youming-ai/pikpak-downloader/internal/debrid"
+)
+
+// codedError is a business error with a machine-readable code for the JSON
+// error envelope, e.g. voucher_expired or insufficient_balance.
+type codedError struct {
+	code    string
+	message string // user-facing, Indonesian
+}
+
+func (e *codedError) Error() string { return e.code }
+
+var (
+	errInsufficientBalance = &codedError{"insufficient_balance", "Saldo tidak mencukupi"}
+	errSubscriptionActive  = &codedError{"subscription_active", "Masih ada paket aktif. Matikan perpanjangan otomatis dan tunggu periodenya berakhir untuk ganti paket."}
+
+	errVoucherNotFound      = &codedError{"voucher_not_found", "Kode voucher tidak ditemukan"}
+	errVoucherInactive      = &codedError{"voucher_inactive", "Voucher sedang tidak aktif"}
+	errVoucherNotApplicable = &codedError{"voucher_not_applicable", "Voucher tidak berlaku untuk layanan ini"}
+	errVoucherNotStarted    = &codedError{"voucher_not_started", "Voucher belum mulai berlaku"}
+	errVoucherExpired       = &codedError{"voucher_expired", "Voucher sudah kedaluwarsa"}
+	errVoucherLimitReached  = &codedError{"voucher_limit_reached", "Kuota voucher sudah habis"}
+	errVoucherMinOrder      = &codedError{"voucher_min_order", "Nominal belum memenuhi syarat minimal voucher"}
+)
+
+var voucherErrors = []*codedError{
+	errVoucherNotFound, errVoucherInactive, errVoucherNotApplicable, errVoucherNotStarted,
+	errVoucherExpired, errVoucherLimitReached, errVoucherMinOrder,
+}
+
+// isVoucherError reports whether err comes from applyVoucherInTx's checks.
+func isVoucherError(err error) bool {
+	for _, v := range voucherErrors {
+		if errors.Is(err, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// voucherErrorMessage returns the user message of a voucher error.
+func voucherErrorMessage(err error) string {
+	var ce *codedError
+	if errors.As(err, &ce) && isVoucherError(ce) {
+		return ce.message
+	}
+	return "Voucher tidak valid"
+}
+
+// statusErrorCodes is the fallback code when the error itself has none.
+var statusErrorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusPaymentRequired:       "payment_required",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusRequestTimeout:        "timeout",
+	http.StatusConflict:              "conflict",
+	http.StatusGone:                  "gone",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusBadGateway:            "bad_gateway",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+// errorCode picks the envelope code: business errors keep their own code,
+// provider errors become debrid_<kind> or upstream_<category>, everything else
+// falls back to the HTTP status.
+func errorCode(status int, err error) string {
+	var ce *codedError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+	if debrid.ProviderOf(err) != "" {
+		return "debrid_" + debrid.KindOf(err).String()
+	}
+	if cat := apierror.CategoryOf(err); cat != apierror.CategoryUnknown {
+		return "upstream_" + string(cat)
+	}
+	if code, ok := statusErrorCodes[status]; ok {
+		return code
+	}
+	return "error"
+}
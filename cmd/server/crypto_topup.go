@@ -0,0 +1,466 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/auth"
+	"github.com/youming-ai/pikpak-downloader/internal/chain"
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// cryptoExplorers verifies USDT deposits per network. Payment methods on a
+// network without an explorer are not offered.
+var cryptoExplorers = map[string]chain.Explorer{}
+
+// cryptoVerifyMu keeps the watcher and user requests from checking the same
+// deposit at once.
+var cryptoVerifyMu sync.Mutex
+
+var (
+	errCryptoTxUsed = errors.New("hash transaksi sudah pernah dipakai")
+	errTopupExpired = errors.New("topup expired")
+)
+
+// cryptoTxNotFoundTimeout is how long a submitted hash may stay unknown to
+// the explorer before the deposit is rejected.
+const cryptoTxNotFoundTimeout = time.Hour
+
+// loadCryptoExplorers reads USDT_EXPLORER (fake for development) and the
+// explorer API keys from .env. BEP20 needs BSCSCAN_API_KEY.
+func loadCryptoExplorers() map[string]chain.Explorer {
+	explorers := map[string]chain.Explorer{}
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("USDT_EXPLORER")), "fake") {
+		log.Println("⚠️ Explorer USDT aktif: fake (hanya untuk development)")
+		explorers[chain.NetworkTRC20] = chain.NewFake(chain.NetworkTRC20)
+		explorers[chain.NetworkBEP20] = chain.NewFake(chain.NetworkBEP20)
+		return explorers
+	}
+	explorers[chain.NetworkTRC20] = chain.NewTronscan(strings.TrimSpace(os.Getenv("TRONSCAN_API_KEY")))
+	if key := strings.TrimSpace(os.Getenv("BSCSCAN_API_KEY")); key != "" {
+		explorers[chain.NetworkBEP20] = chain.NewBscScan(key)
+	}
+	return explorers
+}
+
+// usdtToken is the USDT contract for network, overridable with
+// USDT_TRC20_CONTRACT / USDT_BEP20_CONTRACT (e.g. for a testnet).
+func usdtToken(network string) chain.Token {
+	token := chain.USDT[network]
+	if c := strings.TrimSpace(os.Getenv("USDT_" + strings.ToUpper(network) + "_CONTRACT")); c != "" {
+		token.Contract = c
+	}
+	return token
+}
+
+// usdtMinConfirmations is USDT_TRC20_CONFIRMATIONS (default 20) or
+// USDT_BEP20_CONFIRMATIONS (default 15).
+func usdtMinConfirmations(network string) int64 {
+	def := 20
+	if network == chain.NetworkBEP20 {
+		def = 15
+	}
+	return int64(envInt("USDT_"+strings.ToUpper(network)+"_CONFIRMATIONS", def))
+}
+
+// usdtToIDR converts an amount in the token's smallest unit at rate IDR/USDT,
+// rounding down.
+func usdtToIDR(amount *big.Int, decimals int, rate int64) int64 {
+	idr := new(big.Int).Mul(amount, big.NewInt(rate))
+	idr.Quo(idr, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	return idr.Int64()
+}
+
+// topupNetwork is the chain a USDT top up is paid on, or "" for other top
+// ups. The method is looked up even if it was deactivated since.
+func topupNetwork(topup database.TopUpRequest) string {
+	if topup.CryptoAmount == "" {
+		return ""
+	}
+	var pm database.PaymentMethod
+	database.DB.Where("code = ?", topup.PaymentMethod).First(&pm)
+	return pm.Network
+}
+
+// createCryptoTopup quotes the payable amount in USDT at the method rate,
+// rounded up to the cent, plus 0.0001-0.0099 USDT so the quote is unique for
+// the deposit address. Verification requires exactly this amount, which is
+// what ties an on-chain transfer to one top up.
+func createCryptoTopup(topup *database.TopUpRequest, method database.PaymentMethod) error {
+	if method.Rate <= 0 {
+		return errPaymentMethodUnavailable
+	}
+	cents := (topup.PayableAmount()*100 + method.Rate - 1) / method.Rate
+	topup.CryptoRate = method.Rate
+	return createTopupWithCode(topup, func() (string, error) {
+		var taken []string
+		database.DB.Model(&database.TopUpRequest{}).
+			Where("payment_account = ? AND crypto_amount <> ''", topup.PaymentAccount).
+			Where("status IN ? OR (status IN ? AND created_at >= ?)",
+				[]string{"awaiting_payment", "pending"},
+				[]string{"expired", "cancelled"},
+				time.Now().Add(-topupReconcileWindow())).
+			Pluck("crypto_amount", &taken)
+
+		used := make(map[string]bool, len(taken))
+		for _, v := range taken {
+			used[v] = true
+		}
+		var free []string
+		for k := int64(1); k <= 99; k++ {
+			units := cents*100 + k // 1/10000 USDT
+			if quote := fmt.Sprintf("%d.%04d", units/10000, units%10000); !used[quote] {
+				free = append(free, quote)
+			}
+		}
+		if len(free) == 0 {
+			return "", errUniqueCodesExhausted
+		}
+		topup.CryptoAmount = free[rand.IntN(len(free))]
+		return "usdt:" + topup.PaymentAccount + ":" + topup.CryptoAmount, nil
+	})
+}
+
+// matchCryptoTransfer checks tx against the top up and fills the received
+// amount on dep. It returns why the transaction can never be accepted, or ""
+// if it matches.
+func matchCryptoTransfer(dep *database.CryptoDeposit, topup database.TopUpRequest, tx chain.Tx) string {
+	if !tx.Success {
+		return "transaksi gagal di jaringan"
+	}
+	if !tx.Time.IsZero() && tx.Time.Before(topup.CreatedAt.Add(-10*time.Minute)) {
+		return "transaksi lebih lama dari top up"
+	}
+
+	token := usdtToken(dep.Network)
+	received := new(big.Int)
+	for _, tr := range tx.Transfers {
+		if chain.SameAddress(dep.Network, tr.Contract, token.Contract) && chain.SameAddress(dep.Network, tr.To, topup.PaymentAccount) {
+			received.Add(received, tr.Amount)
+			dep.FromAddress = tr.From
+		}
+	}
+	if received.Sign() == 0 {
+		return "tidak ada transfer USDT ke alamat tujuan"
+	}
+	want, err := chain.ParseUnits(topup.CryptoAmount, token.Decimals)
+	if err != nil {
+		return "jumlah tagihan tidak valid"
+	}
+	dep.Amount = chain.FormatUnits(received, token.Decimals)
+	dep.AmountIDR = usdtToIDR(received, token.Decimals, topup.CryptoRate)
+	if received.Cmp(want) != 0 {
+		return fmt.Sprintf("jumlah diterima %s USDT, seharusnya tepat %s USDT", dep.Amount, topup.CryptoAmount)
+	}
+	return ""
+}
+
+// verifyCryptoDeposit checks a pending deposit with the explorer. Once the
+// transfer has enough confirmations the top up is approved through
+// applyTopupDecision. A transaction that can never match is removed and the
+// top up goes back to awaiting_payment; rejected is the reason then.
+func verifyCryptoDeposit(id uint) (dep database.CryptoDeposit, rejected string, err error) {
+	cryptoVerifyMu.Lock()
+	defer cryptoVerifyMu.Unlock()
+
+	if err := database.DB.First(&dep, id).Error; err != nil {
+		return dep, "", err
+	}
+	if dep.Status != "pending" {
+		return dep, "", nil
+	}
+	var topup database.TopUpRequest
+	if err := database.DB.First(&topup, dep.TopUpID).Error; err != nil {
+		return dep, "", err
+	}
+
+	now := time.Now()
+	if topup.Status != "pending" {
+		// An admin decided the top up in the meantime.
+		if topup.Status == "approved" {
+			dep.Status, dep.ConfirmedAt = "confirmed", &now
+			return dep, "", database.DB.Save(&dep).Error
+		}
+		database.DB.Delete(&dep)
+		return dep, "top up sudah " + topup.Status, nil
+	}
+
+	explorer := cryptoExplorers[dep.Network]
+	if explorer == nil {
+		return dep, "", fmt.Errorf("explorer %s tidak aktif", dep.Network)
+	}
+	dep.CheckedAt = &now
+	tx, err := explorer.GetTx(dep.TxHash)
+	switch {
+	case errors.Is(err, chain.ErrTxNotFound):
+		if now.Sub(dep.CreatedAt) > cryptoTxNotFoundTimeout {
+			return dep, rejectCryptoDeposit(dep, topup, "transaksi tidak ditemukan di jaringan"), nil
+		}
+		dep.LastError = "transaksi belum terlihat di explorer"
+		return dep, "", database.DB.Save(&dep).Error
+	case err != nil:
+		dep.LastError = err.Error()
+		database.DB.Save(&dep)
+		return dep, "", err
+	}
+
+	if reason := matchCryptoTransfer(&dep, topup, tx); reason != "" {
+		return dep, rejectCryptoDeposit(dep, topup, reason), nil
+	}
+	dep.Confirmations = tx.Confirmations
+	dep.LastError = ""
+	if tx.Confirmations < usdtMinConfirmations(dep.Network) {
+		return dep, "", database.DB.Save(&dep).Error
+	}
+
+	note := fmt.Sprintf("USDT %s %s USDT (Rp %d) tx %s", strings.ToUpper(dep.Network), dep.Amount, dep.AmountIDR, dep.TxHash)
+	if _, err := applyTopupDecision(topup.ID, "approved", note); err != nil {
+		dep.LastError = err.Error()
+		database.DB.Save(&dep)
+		return dep, "", err
+	}
+	dep.Status, dep.ConfirmedAt = "confirmed", &now
+	if err := database.DB.Save(&dep).Error; err != nil {
+		return dep, "", err
+	}
+	_ = sendTelegramAdminMessage(fmt.Sprintf("✅ Top up %s (%s) Rp %d lunas via USDT %s: %s USDT, tx %s",
+		topup.Serial, topup.Username, topup.Amount, strings.ToUpper(dep.Network), dep.Amount, dep.TxHash))
+	return dep, "", nil
+}
+
+// rejectCryptoDeposit drops a deposit that cannot match so the hash is not
+// kept against the top up, and lets the user submit another one.
+func rejectCryptoDeposit(dep database.CryptoDeposit, topup database.TopUpRequest, reason string) string {
+	log.Printf("usdt: tx %s untuk top up %s ditolak: %s", dep.TxHash, topup.Serial, reason)
+	database.DB.Delete(&dep)
+	database.DB.Model(&database.TopUpRequest{}).
+		Where("id = ? AND status = ?", topup.ID, "pending").
+		Updates(map[string]any{"status": "awaiting_payment", "paid_at": nil})
+	database.DB.Create(&database.Notification{
+		UserID:  topup.UserID,
+		Title:   "Transaksi USDT tidak valid",
+		Message: fmt.Sprintf("Hash %s untuk top up %s ditolak: %s. Kirim hash yang benar sebelum waktu top up habis.", dep.TxHash, topup.Serial, reason),
+	})
+	return reason
+}
+
+// checkPendingCryptoDeposits rechecks every pending deposit until it has
+// enough confirmations. It runs as the usdt_deposits scheduler job.
+func checkPendingCryptoDeposits() (string, error) {
+	var ids []uint
+	if err := database.DB.Model(&database.CryptoDeposit{}).Where("status = ?", "pending").Pluck("id", &ids).Error; err != nil {
+		return "", err
+	}
+	confirmed, rejected, failed := 0, 0, 0
+	for _, id := range ids {
+		dep, reason, err := verifyCryptoDeposit(id)
+		switch {
+		case err != nil:
+			failed++
+			log.Printf("usdt: cek deposit %d gagal: %v", id, err)
+		case reason != "":
+			rejected++
+		case dep.Status == "confirmed":
+			confirmed++
+		}
+	}
+	return fmt.Sprintf("%d dicek, %d disetujui, %d ditolak, %d gagal", len(ids), confirmed, rejected, failed), nil
+}
+
+// cryptoTopupStatus is the response of /api/topups/usdt.
+func cryptoTopupStatus(topupID uint, rejected string) map[string]any {
+	var topup database.TopUpRequest
+	database.DB.First(&topup, topupID)
+	resp := map[string]any{
+		"topup":             topup,
+		"deposit":           nil,
+		"network":           "",
+		"min_confirmations": 0,
+	}
+	if network := topupNetwork(topup); network != "" {
+		resp["network"] = network
+		resp["min_confirmations"] = usdtMinConfirmations(network)
+	}
+	var dep database.CryptoDeposit
+	if database.DB.Where("top_up_id = ?", topupID).First(&dep).Error == nil {
+		resp["deposit"] = dep
+	}
+	if rejected != "" {
+		resp["rejected_reason"] = rejected
+	}
+	return resp
+}
+
+// handleTopupUSDT submits (POST {id, tx_hash}) or checks (GET ?id=) the
+// on-chain transaction of a USDT top up.
+func handleTopupUSDT(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSessionFromRequest(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		id, _ := strconv.Atoi(strings.TrimSpace(r.URL.Query().Get("id")))
+		var topup database.TopUpRequest
+		if id <= 0 || database.DB.First(&topup, id).Error != nil {
+			writeJSONError(w, http.StatusNotFound, "Topup request not found", nil)
+			return
+		}
+		if topup.UserID != session.UserID && session.Role != "admin" {
+			writeJSONError(w, http.StatusForbidden, "Forbidden", nil)
+			return
+		}
+
+		// Polling drives the check too, throttled so the explorer is not hammered.
+		rejected := ""
+		var dep database.CryptoDeposit
+		if database.DB.Where("top_up_id = ? AND status = ?", topup.ID, "pending").First(&dep).Error == nil &&
+			(dep.CheckedAt == nil || time.Since(*dep.CheckedAt) > 15*time.Second) {
+			_, rejected, _ = verifyCryptoDeposit(dep.ID)
+		}
+		writeJSON(w, http.StatusOK, cryptoTopupStatus(topup.ID, rejected))
+		return
+
+	case http.MethodPost:
+		var req struct {
+			ID     uint   `json:"id"`
+			TxHash string `json:"tx_hash"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		var topup database.TopUpRequest
+		if err := database.DB.First(&topup, req.ID).Error; err != nil {
+			writeJSONError(w, http.StatusNotFound, "Topup request not found", nil)
+			return
+		}
+		if topup.UserID != session.UserID {
+			writeJSONError(w, http.StatusForbidden, "Forbidden", nil)
+			return
+		}
+		network := topupNetwork(topup)
+		if network == "" {
+			writeJSONError(w, http.StatusBadRequest, "Top up ini bukan top up USDT", nil)
+			return
+		}
+		hash, err := chain.NormalizeHash(network, req.TxHash)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Hash transaksi tidak valid", nil)
+			return
+		}
+
+		now := time.Now()
+		var dep database.CryptoDeposit
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&topup, topup.ID).Error; err != nil {
+				return err
+			}
+			if topup.Status != "awaiting_payment" {
+				return errTopupAlreadyDecided
+			}
+			if !topup.ExpiresAt.IsZero() && topup.ExpiresAt.Before(now) {
+				return errTopupExpired
+			}
+			var used int64
+			tx.Model(&database.CryptoDeposit{}).Where("network = ? AND tx_hash = ?", network, hash).Count(&used)
+			if used > 0 {
+				return errCryptoTxUsed
+			}
+			dep = database.CryptoDeposit{TopUpID: topup.ID, Network: network, TxHash: hash, Status: "pending"}
+			if err := tx.Create(&dep).Error; err != nil {
+				return err
+			}
+			topup.Status = "pending"
+			topup.PaidAt = &now
+			return tx.Save(&topup).Error
+		})
+		switch {
+		case errors.Is(err, errTopupAlreadyDecided):
+			writeJSONError(w, http.StatusBadRequest, "Topup is not in awaiting_payment", nil)
+			return
+		case errors.Is(err, errTopupExpired):
+			writeJSONError(w, http.StatusBadRequest, "Topup expired", nil)
+			return
+		case errors.Is(err, errCryptoTxUsed):
+			writeJSONError(w, http.StatusConflict, "Hash transaksi sudah pernah dipakai", nil)
+			return
+		case err != nil:
+			writeJSONError(w, http.StatusInternalServerError, "Gagal menyimpan hash transaksi", err)
+			return
+		}
+
+		database.DB.Create(&database.Notification{
+			UserID:  session.UserID,
+			Title:   "Hash transaksi diterima",
+			Message: fmt.Sprintf("Transaksi USDT untuk top up %s sedang diverifikasi. Saldo masuk otomatis setelah %d konfirmasi.", topup.Serial, usdtMinConfirmations(network)),
+		})
+		_, rejected, err := verifyCryptoDeposit(dep.ID)
+		if err != nil {
+			log.Printf("usdt: cek awal %s gagal: %v", hash, err)
+		}
+		writeJSON(w, http.StatusOK, cryptoTopupStatus(topup.ID, rejected))
+		return
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+}
+
+// handleFakeUSDTSend simulates sending the quoted USDT for a top up when the
+// fake explorer is active and returns the transaction hash to submit.
+func handleFakeUSDTSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	var req struct {
+		ID     uint   `json:"id"`
+		Amount string `json:"amount"` // optional, defaults to the quote
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+		return
+	}
+
+	session := auth.GetSessionFromRequest(r)
+	var topup database.TopUpRequest
+	if err := database.DB.First(&topup, req.ID).Error; err != nil {
+		writeJSONError(w, http.StatusNotFound, "Topup request not found", nil)
+		return
+	}
+	if topup.UserID != session.UserID && session.Role != "admin" {
+		writeJSONError(w, http.StatusForbidden, "Forbidden", nil)
+		return
+	}
+	network := topupNetwork(topup)
+	if network == "" {
+		writeJSONError(w, http.StatusBadRequest, "Top up ini bukan top up USDT", nil)
+		return
+	}
+	fake, ok := cryptoExplorers[network].(*chain.Fake)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "Fake explorer USDT tidak aktif", nil)
+		return
+	}
+
+	token := usdtToken(network)
+	amount, err := chain.ParseUnits(firstNonEmpty(req.Amount, topup.CryptoAmount), token.Decimals)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	hash := fake.Send(token.Contract, "fake-sender", topup.PaymentAccount, amount, 0)
+	writeJSON(w, http.StatusOK, map[string]any{"tx_hash": hash})
+}
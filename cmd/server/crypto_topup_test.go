@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/chain"
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+)
+
+const testDepositAddress = "TXYZopYRdj2D9XRtbG411XZZ3kM5VkAeBf"
+
+// useFakeExplorer installs a fake TRC20 explorer for the test.
+func useFakeExplorer(t *testing.T) *chain.Fake {
+	t.Helper()
+	fake := chain.NewFake(chain.NetworkTRC20)
+	prev := cryptoExplorers
+	cryptoExplorers = map[string]chain.Explorer{chain.NetworkTRC20: fake}
+	t.Cleanup(func() { cryptoExplorers = prev })
+	return fake
+}
+
+func usdtUnits(t *testing.T, amount string) *big.Int {
+	t.Helper()
+	n, err := chain.ParseUnits(amount, chain.USDT[chain.NetworkTRC20].Decimals)
+	if err != nil {
+		t.Fatalf("parse %s: %v", amount, err)
+	}
+	return n
+}
+
+func TestVerifyCryptoDeposit(t *testing.T) {
+	t.Setenv("USDT_TRC20_CONFIRMATIONS", "20")
+	contract := chain.USDT[chain.NetworkTRC20].Contract
+
+	cases := []struct {
+		name          string
+		contract      string
+		to            string
+		amount        string
+		confirmations int64
+		wantDeposit   string // deposit status, "" when it was rejected
+		wantTopup     string
+		wantReason    string
+	}{
+		{"exact amount, confirmed", contract, testDepositAddress, "3.2701", 25, "confirmed", "approved", ""},
+		{"not enough confirmations", contract, testDepositAddress, "3.2701", 3, "pending", "pending", ""},
+		{"other token", "TXLAQ63Xg1NAzckPwKHvzw7CSEmLMEqcdj", testDepositAddress, "3.2701", 25, "", "awaiting_payment", "tidak ada transfer USDT"},
+		{"other address", contract, "TNPeeaaFB7K9cmo4uQpcU32zGK8G1NYqeL", "3.2701", 25, "", "awaiting_payment", "tidak ada transfer USDT"},
+		{"without the unique part", contract, testDepositAddress, "3.27", 25, "", "awaiting_payment", "seharusnya tepat 3.2701"},
+		{"more than quoted", contract, testDepositAddress, "3.2702", 25, "", "awaiting_payment", "seharusnya tepat 3.2701"},
+	}
+	for i, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			newTestDB(t)
+			fake := useFakeExplorer(t)
+			user := newTestUser(t, fmt.Sprintf("usdt%d@example.com", i), 0)
+
+			topup := database.TopUpRequest{UserID: user.ID, Serial: fmt.Sprintf("USD-%d", i), Amount: 50000, PaymentMethod: "usdt_trc20",
+				PaymentAccount: testDepositAddress, Status: "pending", CryptoAmount: "3.2701", CryptoRate: 15300}
+			database.DB.Create(&topup)
+			fake.Put(chain.Tx{Hash: strings.Repeat("ab", 32), Success: true, Confirmations: tc.confirmations, Time: time.Now(),
+				Transfers: []chain.Transfer{{Contract: tc.contract, From: "sender", To: tc.to, Amount: usdtUnits(t, tc.amount)}}})
+			dep := database.CryptoDeposit{TopUpID: topup.ID, Network: chain.NetworkTRC20, TxHash: strings.Repeat("ab", 32), Status: "pending"}
+			database.DB.Create(&dep)
+
+			got, reason, err := verifyCryptoDeposit(dep.ID)
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if tc.wantReason == "" && reason != "" || !strings.Contains(reason, tc.wantReason) {
+				t.Errorf("reason %q, want %q", reason, tc.wantReason)
+			}
+
+			var stored database.CryptoDeposit
+			if database.DB.First(&stored, dep.ID).Error != nil {
+				stored.Status = ""
+			}
+			database.DB.First(&topup, topup.ID)
+			if stored.Status != tc.wantDeposit || topup.Status != tc.wantTopup {
+				t.Fatalf("deposit %q, top up %q; want %q and %q", stored.Status, topup.Status, tc.wantDeposit, tc.wantTopup)
+			}
+			if tc.wantDeposit == "pending" && got.Confirmations != tc.confirmations {
+				t.Errorf("confirmations %d, want %d", got.Confirmations, tc.confirmations)
+			}
+
+			var balance database.User
+			database.DB.First(&balance, user.ID)
+			want := int64(0)
+			if tc.wantTopup == "approved" {
+				want = topup.Amount
+			}
+			if balance.Balance != want {
+				t.Errorf("balance %d, want %d", balance.Balance, want)
+			}
+		})
+	}
+}
+
+func TestTopupUSDTRejectsUsedHash(t *testing.T) {
+	newTestDB(t)
+	useFakeExplorer(t)
+	database.DB.Create(&database.PaymentMethod{Code: "usdt_trc20", Label: "USDT TRC20", Account: testDepositAddress, SerialPrefix: "USD",
+		Network: chain.NetworkTRC20, Rate: 15300, IsActive: true})
+	user := newTestUser(t, "usdt-dup@example.com", 0)
+
+	hash := strings.Repeat("cd", 32)
+	paid := database.TopUpRequest{UserID: user.ID, Serial: "USD-1", Amount: 50000, PaymentMethod: "usdt_trc20",
+		PaymentAccount: testDepositAddress, Status: "approved", CryptoAmount: "3.2701", CryptoRate: 15300}
+	database.DB.Create(&paid)
+	database.DB.Create(&database.CryptoDeposit{TopUpID: paid.ID, Network: chain.NetworkTRC20, TxHash: hash, Status: "confirmed"})
+
+	topup := database.TopUpRequest{UserID: user.ID, Serial: "USD-2", Amount: 50000, PaymentMethod: "usdt_trc20",
+		PaymentAccount: testDepositAddress, Status: "awaiting_payment", CryptoAmount: "3.2702", CryptoRate: 15300,
+		ExpiresAt: time.Now().Add(time.Hour)}
+	database.DB.Create(&topup)
+
+	// The same hash, in upper case with a 0x prefix, is still the same transaction.
+	body := strings.NewReader(fmt.Sprintf(`{"id":%d,"tx_hash":"0x%s"}`, topup.ID, strings.ToUpper(hash)))
+	rec := httptest.NewRecorder()
+	handleTopupUSDT(rec, withSession(httptest.NewRequest(http.MethodPost, "/api/topups/usdt", body), user))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status %d, want 409: %s", rec.Code, rec.Body)
+	}
+	database.DB.First(&topup, topup.ID)
+	if topup.Status != "awaiting_payment" {
+		t.Fatalf("top up %q, want awaiting_payment", topup.Status)
+	}
+}
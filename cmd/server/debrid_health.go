@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/debrid"
+	"github.com/youming-ai/pikpak-downloader/internal/realdebrid"
+)
+
+// rdHealthMu keeps the ticker and the admin "check now" button from running together.
+var rdHealthMu sync.Mutex
+
+// debridHealthDegraded reports whether a health status should take the
+// provider out of automatic premium requests.
+func debridHealthDegraded(status string) bool {
+	return status == "expired" || status == "exhausted" || status == "invalid"
+}
+
+// checkRealDebridHealth reads /user and /traffic, stores the result in
+// DebridAccountHealth and applies it to debridProviders. Admins get a Telegram
+// message whenever the status changes.
+func checkRealDebridHealth() (database.DebridAccountHealth, error) {
+	rdHealthMu.Lock()
+	defer rdHealthMu.Unlock()
+
+	health := database.DebridAccountHealth{Provider: "realdebrid", Status: "ok", CheckedAt: time.Now()}
+	if strings.TrimSpace(rdClient.APIKey) == "" {
+		return health, fmt.Errorf("REALDEBRID_API_KEY belum diatur")
+	}
+
+	var previous database.DebridAccountHealth
+	database.DB.Where("provider = ?", health.Provider).First(&previous)
+
+	var exhaustedHosts []string
+	user, err := rdClient.GetUser()
+	if err != nil {
+		health.Status, health.Reason = classifyHealthError(err)
+	} else {
+		health.Username = user.Username
+		health.AccountType = user.Type
+		health.PremiumUntil = user.ExpiresAt()
+
+		warnDays := envInt("RD_EXPIRY_WARN_DAYS", 3)
+		switch {
+		case !user.IsPremium():
+			health.Status, health.Reason = "expired", "Akun Real-Debrid tidak lagi premium"
+		case user.Premium < int64(warnDays)*24*3600:
+			health.Status = "expiring"
+			health.Reason = fmt.Sprintf("Premium Real-Debrid habis dalam %.1f hari", float64(user.Premium)/86400)
+		}
+
+		traffic, tErr := rdClient.GetTraffic()
+		if tErr != nil {
+			if status, reason := classifyHealthError(tErr); debridHealthDegraded(status) && health.Status != "expired" {
+				health.Status, health.Reason = status, reason
+			} else {
+				log.Printf("rd health: gagal membaca traffic: %v", tErr)
+			}
+		} else {
+			for domain, t := range traffic {
+				if t.Exhausted() {
+					exhaustedHosts = append(exhaustedHosts, domain)
+				}
+			}
+			sort.Strings(exhaustedHosts)
+			if raw, jErr := json.Marshal(traffic); jErr == nil {
+				health.Traffic = string(raw)
+			}
+		}
+	}
+
+	if debridHealthDegraded(health.Status) {
+		debridProviders.SetDisabled(health.Provider, health.Reason)
+	} else {
+		debridProviders.SetDisabled(health.Provider, "")
+	}
+	debridProviders.SetExhaustedHosts(health.Provider, exhaustedHosts)
+
+	health.ID = previous.ID
+	if err := database.DB.Save(&health).Error; err != nil {
+		return health, err
+	}
+
+	if previous.Status != health.Status && (health.Status != "ok" || previous.ID != 0) {
+		_ = sendTelegramAdminMessage(debridHealthAlert(health, previous.Status, exhaustedHosts))
+	}
+	return health, nil
+}
+
+// classifyHealthError maps a failed /user or /traffic call to a health status.
+func classifyHealthError(err error) (status, reason string) {
+	var apiErr *realdebrid.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case realdebrid.ErrCodeTrafficExhausted, realdebrid.ErrCodeFairUsageLimit:
+			return "exhausted", "Traffic Real-Debrid habis"
+		}
+	}
+	switch debrid.KindOf(err) {
+	case debrid.KindAuth:
+		return "invalid", "API key Real-Debrid tidak valid atau kedaluwarsa"
+	case debrid.KindForbidden:
+		return "invalid", "IP server tidak diizinkan oleh Real-Debrid"
+	case debrid.KindQuota:
+		return "exhausted", "Traffic Real-Debrid habis"
+	}
+	return "error", "Gagal cek akun Real-Debrid: " + err.Error()
+}
+
+func debridHealthAlert(h database.DebridAccountHealth, previous string, exhaustedHosts []string) string {
+	var b strings.Builder
+	switch {
+	case debridHealthDegraded(h.Status):
+		fmt.Fprintf(&b, "🚨 Real-Debrid %s: %s\nRequest premium dialihkan ke mode manual sampai akun pulih.", h.Status, h.Reason)
+	case h.Status == "ok" && debridHealthDegraded(previous):
+		b.WriteString("✅ Akun Real-Debrid pulih. Request premium kembali diproses otomatis.")
+	case h.Status == "ok":
+		b.WriteString("✅ Akun Real-Debrid normal kembali.")
+	default:
+		fmt.Fprintf(&b, "⚠️ Real-Debrid %s: %s", h.Status, h.Reason)
+	}
+	if h.PremiumUntil != nil {
+		fmt.Fprintf(&b, "\nPremium sampai: %s", h.PremiumUntil.Format("02 Jan 2006 15:04"))
+	}
+	if len(exhaustedHosts) > 0 {
+		fmt.Fprintf(&b, "\nTraffic habis: %s", strings.Join(exhaustedHosts, ", "))
+	}
+	return b.String()
+}
+
+// startDebridHealthCheck runs checkRealDebridHealth every
+// RD_HEALTH_INTERVAL_MINUTES (default 15, 0 disables it).
+func startDebridHealthCheck() {
+	interval := envInt("RD_HEALTH_INTERVAL_MINUTES", 15)
+	if interval <= 0 || strings.TrimSpace(rdClient.APIKey) == "" {
+		return
+	}
+	go func() {
+		for {
+			if h, err := checkRealDebridHealth(); err != nil {
+				log.Printf("rd health check gagal: %v", err)
+			} else if h.Status != "ok" {
+				log.Printf("rd health: %s (%s)", h.Status, h.Reason)
+			}
+			time.Sleep(time.Duration(interval) * time.Minute)
+		}
+	}()
+	log.Printf("✅ Cek kesehatan akun Real-Debrid aktif (setiap %d menit)", interval)
+}
+
+// handleAdminDebridHealth shows the stored account health (GET) or checks
+// the Real-Debrid account right away (POST).
+func handleAdminDebridHealth(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var rows []database.DebridAccountHealth
+		if err := database.DB.Order("provider asc").Find(&rows).Error; err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Gagal mengambil status akun provider", err)
+			return
+		}
+		accounts := make([]map[string]any, 0, len(rows))
+		for _, row := range rows {
+			traffic := map[string]realdebrid.HostTraffic{}
+			if row.Traffic != "" {
+				_ = json.Unmarshal([]byte(row.Traffic), &traffic)
+			}
+			accounts = append(accounts, map[string]any{
+				"provider":      row.Provider,
+				"username":      row.Username,
+				"account_type":  row.AccountType,
+				"premium_until": row.PremiumUntil,
+				"status":        row.Status,
+				"reason":        row.Reason,
+				"traffic":       traffic,
+				"checked_at":    row.CheckedAt,
+			})
+		}
+
+		providers := make([]map[string]any, 0)
+		if debridProviders.Enabled() {
+			for _, p := range debridProviders.Providers() {
+				reason, disabled := debridProviders.Disabled(p.Name())
+				providers = append(providers, map[string]any{
+					"name":     p.Name(),
+					"disabled": disabled,
+					"reason":   reason,
+				})
+			}
+		}
+		mode := "manual"
+		if debridProviders.Available() {
+			mode = "automatic"
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"premium_mode": mode,
+			"providers":    providers,
+			"accounts":     accounts,
+		})
+	case http.MethodPost:
+		health, err := checkRealDebridHealth()
+		if err != nil {
+			writeJSONError(w, http.StatusBadGateway, "Cek akun Real-Debrid gagal", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, health)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/youming-ai/pikpak-downloader/internal/alldebrid"
+	"github.com/youming-ai/pikpak-downloader/internal/debrid"
+)
+
+// debridProviders serves automatic premium-host requests. It is empty when no
+// provider API key is set, which keeps premium requests in manual mode.
+var debridProviders *debrid.Manager
+
+// loadDebridProviders builds the provider list from .env. DEBRID_PROVIDERS sets
+// the default order, DEBRID_HOST_PROVIDERS overrides it per host, e.g.
+// "rapidgator.net=alldebrid,realdebrid;mega.nz=realdebrid".
+func loadDebridProviders() *debrid.Manager {
+	available := map[string]debrid.Provider{}
+	if strings.TrimSpace(rdClient.APIKey) != "" {
+		available["realdebrid"] = debrid.NewRealDebrid(rdClient)
+	}
+	if key := strings.TrimSpace(os.Getenv("ALLDEBRID_API_KEY")); key != "" {
+		available["alldebrid"] = debrid.NewAllDebrid(alldebrid.NewClient(key))
+	}
+
+	order := strings.TrimSpace(os.Getenv("DEBRID_PROVIDERS"))
+	if order == "" {
+		order = "realdebrid,alldebrid"
+	}
+	var providers []debrid.Provider
+	for _, name := range strings.Split(order, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if p, ok := available[name]; ok {
+			providers = append(providers, p)
+			delete(available, name)
+		}
+	}
+	for _, p := range available {
+		providers = append(providers, p) // configured key but missing from DEBRID_PROVIDERS
+	}
+
+	names := make([]string, 0, len(providers))
+	for _, p := range providers {
+		names = append(names, p.Name())
+	}
+	if len(names) > 0 {
+		log.Printf("✅ Provider debrid aktif: %s", strings.Join(names, ", "))
+	}
+	return debrid.NewManager(providers, debrid.ParseRoutes(os.Getenv("DEBRID_HOST_PROVIDERS")))
+}
+
+// mapDebridError turns a provider error into an HTTP status and a user message.
+func mapDebridError(err error) (status int, message string) {
+	if err == nil {
+		return http.StatusBadRequest, "Gagal memproses request debrid"
+	}
+
+	switch debrid.KindOf(err) {
+	case debrid.KindAuth:
+		return http.StatusUnauthorized, "API key provider debrid tidak valid. Silakan ganti token provider."
+	case debrid.KindRateLimit:
+		return http.StatusTooManyRequests, "Terlalu banyak request ke provider debrid. Coba lagi sebentar."
+	case debrid.KindForbidden:
+		return http.StatusForbidden, "IP address server tidak diizinkan oleh provider debrid."
+	case debrid.KindUnsupported:
+		return http.StatusBadRequest, "Host/link belum didukung oleh provider debrid."
+	case debrid.KindHostDown:
+		return http.StatusServiceUnavailable, "Host sedang maintenance / sementara tidak tersedia."
+	case debrid.KindQuota:
+		return http.StatusServiceUnavailable, "Kuota provider untuk host ini sedang habis. Coba lagi nanti."
+	case debrid.KindFileUnavailable:
+		return http.StatusBadRequest, "File tidak tersedia (sudah dihapus atau diblokir)."
+	case debrid.KindTemporary:
+		return http.StatusServiceUnavailable, "Provider debrid sedang tidak bisa dihubungi. Coba lagi sebentar."
+	}
+	return http.StatusBadRequest, "Gagal memproses link host premium"
+}
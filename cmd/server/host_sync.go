@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/debrid"
+	"gorm.io/gorm"
+)
+
+// hostSyncMu keeps the scheduled sync and the admin "sync now" button from running together.
+var hostSyncMu sync.Mutex
+
+type hostSyncResult struct {
+	Checked int      `json:"checked"`
+	Created int      `json:"created"`
+	Changed int      `json:"changed"` // availability or feed status changed
+	Missing int      `json:"missing"` // synced hosts no longer in any feed
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// mergedHost is one hoster across all provider feeds.
+type mergedHost struct {
+	name      string
+	domains   []string
+	up        bool
+	providers []string
+}
+
+func splitDomains(s string) []string {
+	var out []string
+	for _, d := range strings.Split(s, ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func mergeDomains(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	out := make([]string, 0, len(a)+len(b))
+	for _, d := range append(append([]string{}, a...), b...) {
+		if !seen[d] {
+			seen[d] = true
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func feedStatus(up bool) string {
+	if up {
+		return "up"
+	}
+	return "down"
+}
+
+func recordHostHistory(tx *gorm.DB, host database.HostAvailability, source, note string) error {
+	return tx.Create(&database.HostStatusHistory{
+		HostID:      host.ID,
+		IsAvailable: host.IsAvailable,
+		FeedStatus:  host.FeedStatus,
+		Source:      source,
+		Note:        note,
+	}).Error
+}
+
+// collectProviderHosts merges the status feeds of all providers. A host is up
+// when at least one provider can serve it.
+func collectProviderHosts() ([]*mergedHost, []string) {
+	var merged []*mergedHost
+	byDomain := make(map[string]*mergedHost)
+	var errs []string
+
+	for _, p := range debridProviders.Providers() {
+		hosts, err := p.Hosts()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", p.Name(), err))
+			continue
+		}
+		for _, h := range hosts {
+			var m *mergedHost
+			for _, d := range h.Domains {
+				if m = byDomain[d]; m != nil {
+					break
+				}
+			}
+			if m == nil {
+				m = &mergedHost{name: h.Name}
+				merged = append(merged, m)
+			}
+			m.domains = mergeDomains(m.domains, h.Domains)
+			m.up = m.up || h.Up
+			m.providers = append(m.providers, p.Name())
+			for _, d := range h.Domains {
+				byDomain[d] = m
+			}
+		}
+	}
+	return merged, errs
+}
+
+// syncHostAvailability upserts HostAvailability from the provider feeds. Rows
+// with AdminOverride keep their IsAvailable; every change is written to
+// HostStatusHistory. Hosts missing from the feed are only marked when all
+// providers answered, so one failing provider cannot switch everything off.
+func syncHostAvailability() (hostSyncResult, error) {
+	hostSyncMu.Lock()
+	defer hostSyncMu.Unlock()
+
+	var result hostSyncResult
+	if !debridProviders.Enabled() {
+		return result, fmt.Errorf("tidak ada provider debrid yang aktif")
+	}
+
+	merged, errs := collectProviderHosts()
+	result.Errors = errs
+	if len(merged) == 0 && len(errs) > 0 {
+		return result, fmt.Errorf("semua feed provider gagal: %s", strings.Join(errs, "; "))
+	}
+
+	var rows []database.HostAvailability
+	if err := database.DB.Find(&rows).Error; err != nil {
+		return result, err
+	}
+	byDomain := make(map[string]*database.HostAvailability)
+	byName := make(map[string]*database.HostAvailability)
+	for i := range rows {
+		byName[strings.ToLower(rows[i].Name)] = &rows[i]
+		for _, d := range splitDomains(rows[i].Domains) {
+			byDomain[d] = &rows[i]
+		}
+	}
+
+	now := time.Now()
+	seen := make(map[uint]bool)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, m := range merged {
+			result.Checked++
+			status := feedStatus(m.up)
+			providers := strings.Join(m.providers, ",")
+
+			var row *database.HostAvailability
+			for _, d := range m.domains {
+				if row = byDomain[d]; row != nil {
+					break
+				}
+			}
+			if row == nil {
+				row = byName[strings.ToLower(m.name)]
+			}
+
+			if row == nil {
+				created := database.HostAvailability{
+					Name:          m.name,
+					IsAvailable:   m.up,
+					Domains:       strings.Join(m.domains, ","),
+					Source:        "sync",
+					FeedStatus:    status,
+					Providers:     providers,
+					LastCheckedAt: &now,
+				}
+				if err := tx.Create(&created).Error; err != nil {
+					return err
+				}
+				if err := recordHostHistory(tx, created, "sync", "ditambahkan dari feed provider"); err != nil {
+					return err
+				}
+				byName[strings.ToLower(m.name)] = &created
+				for _, d := range m.domains {
+					byDomain[d] = &created
+				}
+				seen[created.ID] = true
+				result.Created++
+				continue
+			}
+
+			seen[row.ID] = true
+			available := row.IsAvailable
+			if !row.AdminOverride {
+				available = m.up
+			}
+			changed := available != row.IsAvailable || status != row.FeedStatus
+			if err := tx.Model(&database.HostAvailability{}).Where("id = ?", row.ID).Updates(map[string]any{
+				"is_available":    available,
+				"domains":         strings.Join(mergeDomains(splitDomains(row.Domains), m.domains), ","),
+				"feed_status":     status,
+				"providers":       providers,
+				"last_checked_at": now,
+			}).Error; err != nil {
+				return err
+			}
+			if changed {
+				row.IsAvailable, row.FeedStatus = available, status
+				note := "status feed: " + status
+				if row.AdminOverride {
+					note += " (override admin tetap dipakai)"
+				}
+				if err := recordHostHistory(tx, *row, "sync", note); err != nil {
+					return err
+				}
+				result.Changed++
+			}
+		}
+
+		if len(errs) > 0 {
+			return nil
+		}
+		for i := range rows {
+			row := &rows[i]
+			if seen[row.ID] || row.Source != "sync" || row.FeedStatus == "missing" {
+				continue
+			}
+			available := row.IsAvailable && row.AdminOverride
+			if err := tx.Model(&database.HostAvailability{}).Where("id = ?", row.ID).Updates(map[string]any{
+				"is_available":    available,
+				"feed_status":     "missing",
+				"last_checked_at": now,
+			}).Error; err != nil {
+				return err
+			}
+			row.IsAvailable, row.FeedStatus = available, "missing"
+			if err := recordHostHistory(tx, *row, "sync", "tidak ada lagi di feed provider"); err != nil {
+				return err
+			}
+			result.Missing++
+		}
+		return nil
+	})
+	return result, err
+}
+
+// cleanupHostStatusHistory deletes host status changes older than
+// HOST_HISTORY_RETENTION_DAYS (default 90). The current status stays in
+// HostAvailability.
+func cleanupHostStatusHistory() (string, error) {
+	days := envInt("HOST_HISTORY_RETENTION_DAYS", 90)
+	res := database.DB.Where("created_at < ?", time.Now().AddDate(0, 0, -days)).Delete(&database.HostStatusHistory{})
+	return fmt.Sprintf("%d riwayat host dihapus", res.RowsAffected), res.Error
+}
+
+// findHostForLink returns the host row whose domains match the link's host.
+func findHostForLink(link string) (string, *database.HostAvailability) {
+	host := debrid.HostOf(link)
+	if host == "" {
+		return "", nil
+	}
+	var rows []database.HostAvailability
+	database.DB.Where("domains <> ''").Find(&rows)
+
+	// Prefer the longest matching domain (files.example.com over example.com)
+	var best *database.HostAvailability
+	bestLen := 0
+	for i := range rows {
+		for _, d := range splitDomains(rows[i].Domains) {
+			if debrid.MatchesDomain(host, d) && len(d) > bestLen {
+				best, bestLen = &rows[i], len(d)
+			}
+		}
+	}
+	return host, best
+}
+
+// hostSummary is the public shape of a host on /api/hosts.
+type hostSummary struct {
+	Name    string   `json:"name"`
+	Status  string   `json:"status"` // online, down
+	Domains []string `json:"domains"`
+}
+
+func summarizeHosts(rows []database.HostAvailability) []hostSummary {
+	out := make([]hostSummary, 0, len(rows))
+	for _, hs := range rows {
+		status := "down"
+		if hs.IsAvailable {
+			status = "online"
+		}
+		domains := splitDomains(hs.Domains)
+		sort.Strings(domains)
+		if domains == nil {
+			domains = []string{}
+		}
+		out = append(out, hostSummary{Name: hs.Name, Status: status, Domains: domains})
+	}
+	return out
+}
+
+// handleAdminHostSync runs the provider host sync right away.
+func handleAdminHostSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	result, err := syncHostAvailability()
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, "Sinkronisasi host gagal", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
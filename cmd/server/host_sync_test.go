@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/debrid"
+)
+
+// fakeHostFeed is a debrid provider that only serves a host status feed.
+type fakeHostFeed struct {
+	debrid.Provider
+	name  string
+	hosts []debrid.Host
+}
+
+func (f *fakeHostFeed) Name() string                  { return f.name }
+func (f *fakeHostFeed) Hosts() ([]debrid.Host, error) { return f.hosts, nil }
+
+func TestSyncStoresHostsDownOnFirstSight(t *testing.T) {
+	newTestDB(t)
+	feed := &fakeHostFeed{name: "realdebrid", hosts: []debrid.Host{
+		{Name: "Rapidgator", Domains: []string{"rapidgator.net", "rg.to"}, Up: true},
+		{Name: "Nitroflare", Domains: []string{"nitroflare.com"}, Up: false},
+	}}
+	saved := debridProviders
+	t.Cleanup(func() { debridProviders = saved })
+	debridProviders = debrid.NewManager([]debrid.Provider{feed}, nil)
+
+	res, err := syncHostAvailability()
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if res.Created != 2 {
+		t.Fatalf("created %d hosts, want 2", res.Created)
+	}
+
+	check := func(name string, available bool, feedStatus string) {
+		t.Helper()
+		var host database.HostAvailability
+		if err := database.DB.Where("name = ?", name).First(&host).Error; err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var last database.HostStatusHistory
+		database.DB.Where("host_id = ?", host.ID).Order("id desc").First(&last)
+		if host.IsAvailable != available || host.FeedStatus != feedStatus {
+			t.Errorf("%s: available %v feed %q, want %v %q", name, host.IsAvailable, host.FeedStatus, available, feedStatus)
+		}
+		if last.IsAvailable != host.IsAvailable {
+			t.Errorf("%s: history says available %v, host row says %v", name, last.IsAvailable, host.IsAvailable)
+		}
+	}
+	check("Rapidgator", true, "up")
+	check("Nitroflare", false, "down")
+
+	// The host comes back up on the next sync.
+	feed.hosts[1].Up = true
+	if _, err := syncHostAvailability(); err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	check("Nitroflare", true, "up")
+}
+
+func TestCleanupHostStatusHistory(t *testing.T) {
+	newTestDB(t)
+	t.Setenv("HOST_HISTORY_RETENTION_DAYS", "30")
+
+	old := database.HostStatusHistory{HostID: 1, Source: "sync", CreatedAt: time.Now().AddDate(0, 0, -31)}
+	recent := database.HostStatusHistory{HostID: 1, Source: "sync", CreatedAt: time.Now().AddDate(0, 0, -29)}
+	database.DB.Create(&old)
+	database.DB.Create(&recent)
+
+	if _, err := cleanupHostStatusHistory(); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	var ids []uint
+	database.DB.Model(&database.HostStatusHistory{}).Pluck("id", &ids)
+	if len(ids) != 1 || ids[0] != recent.ID {
+		t.Fatalf("remaining history %v, want only %d", ids, recent.ID)
+	}
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/auth"
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/pdf"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var invoicePrefixPattern = regexp.MustCompile(`^[A-Z0-9]{1,8}$`)
+
+// loadInvoiceSettings returns the settings row, or the defaults if it is
+// missing.
+func loadInvoiceSettings(db *gorm.DB) database.InvoiceSettings {
+	settings := database.InvoiceSettings{ID: 1, Prefix: "INV", CompanyName: "AzifyPage", TaxName: "PPN"}
+	db.First(&settings, 1)
+	return settings
+}
+
+// nextInvoiceNo takes the next number of at's year, e.g. INV-2026-000042. The
+// counter row stays locked until tx ends, so a rolled back charge gives its
+// number back and the sequence has no gaps.
+func nextInvoiceNo(tx *gorm.DB, at time.Time) (string, error) {
+	year := at.Year()
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&database.InvoiceCounter{Year: year}).Error; err != nil {
+		return "", err
+	}
+	var counter database.InvoiceCounter
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&counter, "year = ?", year).Error; err != nil {
+		return "", err
+	}
+	counter.Last++
+	if err := tx.Model(&database.InvoiceCounter{}).Where("year = ?", year).Update("last", counter.Last).Error; err != nil {
+		return "", err
+	}
+	prefix := firstNonEmpty(loadInvoiceSettings(tx).Prefix, "INV")
+	return fmt.Sprintf("%s-%d-%06d", prefix, year, counter.Last), nil
+}
+
+// createInvoicedTransaction records trx with a new invoice number. Use it for
+// approved top ups and charges.
+func createInvoicedTransaction(tx *gorm.DB, trx *database.Transaction) error {
+	no, err := nextInvoiceNo(tx, time.Now())
+	if err != nil {
+		return err
+	}
+	trx.InvoiceNo = &no
+	return tx.Create(trx).Error
+}
+
+// backfillInvoiceNumbers numbers the top ups and charges recorded before
+// invoices existed, oldest first, in the year they were made. Admin balance
+// corrections are adjustments and get no invoice.
+func backfillInvoiceNumbers() error {
+	var pending []database.Transaction
+	if err := database.DB.
+		Where("invoice_no IS NULL AND type IN ?", []string{"download", "topup"}).
+		Order("id asc").
+		Find(&pending).Error; err != nil {
+		return err
+	}
+	for _, trx := range pending {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			no, err := nextInvoiceNo(tx, trx.CreatedAt)
+			if err != nil {
+				return err
+			}
+			return tx.Model(&database.Transaction{}).
+				Where("id = ? AND invoice_no IS NULL", trx.ID).
+				Update("invoice_no", no).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(pending) > 0 {
+		log.Printf("✅ %d transaksi lama diberi nomor invoice", len(pending))
+	}
+	return nil
+}
+
+var idMonthNames = [...]string{"", "Januari", "Februari", "Maret", "April", "Mei", "Juni", "Juli", "Agustus", "September", "Oktober", "November", "Desember"}
+
+func formatIDDate(t time.Time) string {
+	return fmt.Sprintf("%d %s %d", t.Day(), idMonthNames[t.Month()], t.Year())
+}
+
+// formatRupiah formats n as "Rp 1.250.000" ("-Rp 5.000" when negative).
+func formatRupiah(n int64) string {
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	digits := strconv.FormatInt(n, 10)
+	var sb strings.Builder
+	for i, c := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteRune(c)
+	}
+	return sign + "Rp " + sb.String()
+}
+
+// invoiceTax splits total, which includes tax at percent, into the tax and
+// the base it was charged on.
+func invoiceTax(total int64, percent float64) (tax, base int64) {
+	if percent <= 0 || total <= 0 {
+		return 0, total
+	}
+	tax = int64(float64(total)*percent/(100+percent) + 0.5)
+	return tax, total - tax
+}
+
+func formatPercent(p float64) string {
+	return strings.TrimSuffix(strings.TrimRight(strconv.FormatFloat(p, 'f', 2, 64), "0"), ".")
+}
+
+const (
+	pdfMarginLeft  = 50.0
+	pdfMarginRight = pdf.PageWidth - 50
+	pdfBottom      = pdf.PageHeight - 60
+)
+
+// drawInvoiceHeader prints the seller block on the left and title plus the
+// meta lines on the right, and returns the y below both.
+func drawInvoiceHeader(page *pdf.Page, settings database.InvoiceSettings, title string, meta []string) float64 {
+	page.Text(pdfMarginLeft, 62, pdf.Bold, 18, firstNonEmpty(settings.CompanyName, "AzifyPage"))
+	y := 80.0
+	var lines []string
+	lines = append(lines, pdf.Wrap(pdf.Regular, 9, settings.CompanyAddress, 260)...)
+	if contact := strings.Join(nonEmpty(settings.CompanyEmail, settings.CompanyPhone), " · "); contact != "" {
+		lines = append(lines, contact)
+	}
+	if settings.TaxID != "" {
+		lines = append(lines, "NPWP: "+settings.TaxID)
+	}
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		page.Text(pdfMarginLeft, y, pdf.Regular, 9, line)
+		y += 12
+	}
+
+	page.TextRight(pdfMarginRight, 62, pdf.Bold, 16, title)
+	right := 80.0
+	for _, line := range meta {
+		page.TextRight(pdfMarginRight, right, pdf.Regular, 9, line)
+		right += 12
+	}
+	if right > y {
+		y = right
+	}
+	y += 6
+	page.Line(pdfMarginLeft, y, pdfMarginRight, y, 0.8, 0)
+	return y + 20
+}
+
+func drawInvoiceFooter(page *pdf.Page, settings database.InvoiceSettings) {
+	lines := pdf.Wrap(pdf.Regular, 8, settings.Footer, pdfMarginRight-pdfMarginLeft)
+	y := pdf.PageHeight - 40 - float64(len(lines)-1)*10
+	for _, line := range lines {
+		page.Text(pdfMarginLeft, y, pdf.Regular, 8, line)
+		y += 10
+	}
+}
+
+func nonEmpty(values ...string) []string {
+	out := values[:0]
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// receiptLine is one row of the receipt table.
+type receiptLine struct {
+	label  string
+	amount int64
+}
+
+// receiptLines itemises trx: the nominal, unique code and fee of a top up, or
+// the price and voucher discount of a charge. It also returns the total paid
+// and notes printed under the table.
+func receiptLines(trx database.Transaction, topup *database.TopUpRequest) (lines []receiptLine, total int64, notes []string) {
+	if topup != nil {
+		method := topup.PaymentMethod
+		var pm database.PaymentMethod
+		if database.DB.Where("code = ?", topup.PaymentMethod).First(&pm).Error == nil {
+			method = pm.Label
+		}
+		lines = append(lines, receiptLine{fmt.Sprintf("Top up saldo %s via %s", topup.Serial, method), topup.Amount})
+		if topup.UniqueCode > 0 {
+			lines = append(lines, receiptLine{"Kode unik (masuk ke saldo)", topup.UniqueCode})
+		}
+		if topup.Fee > 0 {
+			lines = append(lines, receiptLine{"Biaya " + method, topup.Fee})
+		}
+		notes = append(notes, "Saldo masuk: "+formatRupiah(topup.CreditAmount()))
+		if topup.Bonus > 0 {
+			notes = append(notes, "Bonus promo: "+formatRupiah(topup.Bonus)+" (tidak ditagihkan)")
+		}
+		if topup.CryptoAmount != "" {
+			notes = append(notes, fmt.Sprintf("Dibayar %s USDT (kurs %s/USDT)", topup.CryptoAmount, formatRupiah(topup.CryptoRate)))
+		}
+		return lines, topup.PayableAmount(), notes
+	}
+
+	total = trx.Amount
+	if total < 0 {
+		total = -total
+	}
+	gross := trx.GrossAmount
+	if gross <= 0 {
+		gross = total + trx.Discount
+	}
+	// Charge descriptions end in " - Rp <price>..."; the table shows the price.
+	label := trx.Description
+	if i := strings.LastIndex(label, " - Rp "); i > 0 {
+		label = label[:i]
+	}
+	lines = append(lines, receiptLine{label, gross})
+	if trx.Discount > 0 {
+		lines = append(lines, receiptLine{"Diskon voucher " + trx.VoucherCode, -trx.Discount})
+	}
+	return lines, total, notes
+}
+
+// renderReceipt lays out the receipt of one invoiced transaction.
+func renderReceipt(trx database.Transaction, user database.User, topup *database.TopUpRequest, settings database.InvoiceSettings) *pdf.Document {
+	doc := pdf.New("Invoice " + *trx.InvoiceNo)
+	page := doc.AddPage()
+	y := drawInvoiceHeader(page, settings, "INVOICE", []string{
+		"No. " + *trx.InvoiceNo,
+		"Tanggal " + formatIDDate(trx.CreatedAt) + " " + trx.CreatedAt.Format("15:04"),
+		"Status: LUNAS",
+	})
+
+	page.Text(pdfMarginLeft, y, pdf.Bold, 10, "Ditagihkan kepada")
+	y += 14
+	for _, line := range nonEmpty(user.Name, user.Email, fmt.Sprintf("ID pengguna #%d", user.ID)) {
+		page.Text(pdfMarginLeft, y, pdf.Regular, 10, line)
+		y += 13
+	}
+	y += 14
+
+	page.FillRect(pdfMarginLeft, y-13, pdfMarginRight-pdfMarginLeft, 20, 0.92)
+	page.Text(pdfMarginLeft+8, y, pdf.Bold, 10, "Deskripsi")
+	page.TextRight(pdfMarginRight-8, y, pdf.Bold, 10, "Jumlah")
+	y += 22
+
+	lines, total, notes := receiptLines(trx, topup)
+	for _, line := range lines {
+		wrapped := pdf.Wrap(pdf.Regular, 10, line.label, 360)
+		for i, text := range wrapped {
+			page.Text(pdfMarginLeft+8, y+float64(i)*13, pdf.Regular, 10, text)
+		}
+		page.TextRight(pdfMarginRight-8, y, pdf.Regular, 10, formatRupiah(line.amount))
+		y += float64(len(wrapped))*13 + 6
+	}
+	page.Line(pdfMarginLeft, y-4, pdfMarginRight, y-4, 0.5, 0.6)
+	y += 12
+
+	totalsX := pdfMarginRight - 200
+	if tax, base := invoiceTax(total, settings.TaxPercent); tax > 0 {
+		page.Text(totalsX, y, pdf.Regular, 10, "Dasar pengenaan pajak")
+		page.TextRight(pdfMarginRight-8, y, pdf.Regular, 10, formatRupiah(base))
+		y += 15
+		page.Text(totalsX, y, pdf.Regular, 10, fmt.Sprintf("%s %s%%", firstNonEmpty(settings.TaxName, "PPN"), formatPercent(settings.TaxPercent)))
+		page.TextRight(pdfMarginRight-8, y, pdf.Regular, 10, formatRupiah(tax))
+		y += 15
+	}
+	page.Text(totalsX, y, pdf.Bold, 11, "Total dibayar")
+	page.TextRight(pdfMarginRight-8, y, pdf.Bold, 11, formatRupiah(total))
+	y += 30
+
+	for _, note := range notes {
+		page.Text(pdfMarginLeft, y, pdf.Regular, 9, note)
+		y += 12
+	}
+	drawInvoiceFooter(page, settings)
+	return doc
+}
+
+// handleTransactionReceipt serves GET /api/transactions/{id}/receipt as a PDF
+// to the owner or an admin.
+func handleTransactionReceipt(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	if id <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "id tidak valid", nil)
+		return
+	}
+
+	session := auth.GetSessionFromRequest(r)
+	var trx database.Transaction
+	if err := database.DB.First(&trx, id).Error; err != nil {
+		writeJSONError(w, http.StatusNotFound, "Transaksi tidak ditemukan", nil)
+		return
+	}
+	if trx.UserID != session.UserID && session.Role != "admin" {
+		writeJSONError(w, http.StatusForbidden, "Forbidden", nil)
+		return
+	}
+	if trx.InvoiceNo == nil {
+		writeJSONError(w, http.StatusNotFound, "Transaksi ini tidak punya invoice", nil)
+		return
+	}
+
+	var user database.User
+	database.DB.First(&user, trx.UserID)
+	var topup *database.TopUpRequest
+	if trx.TopUpID != 0 {
+		var t database.TopUpRequest
+		if database.DB.First(&t, trx.TopUpID).Error == nil {
+			topup = &t
+		}
+	}
+
+	doc := renderReceipt(trx, user, topup, loadInvoiceSettings(database.DB))
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s.pdf"`, *trx.InvoiceNo))
+	w.Header().Set("Cache-Control", "private, no-store")
+	if _, err := doc.WriteTo(w); err != nil {
+		log.Printf("receipt %s: %v", *trx.InvoiceNo, err)
+	}
+}
+
+// renderStatement lays out the ledger of one month with the running balance.
+func renderStatement(user database.User, month time.Time, opening int64, items []database.Transaction, settings database.InvoiceSettings) *pdf.Document {
+	period := idMonthNames[month.Month()] + " " + strconv.Itoa(month.Year())
+	doc := pdf.New("Laporan transaksi " + period)
+
+	var credit, debit int64
+	for _, trx := range items {
+		if trx.Amount >= 0 {
+			credit += trx.Amount
+		} else {
+			debit -= trx.Amount
+		}
+	}
+	closing := opening + credit - debit
+
+	page := doc.AddPage()
+	y := drawInvoiceHeader(page, settings, "LAPORAN TRANSAKSI", []string{
+		"Periode " + period,
+		"Dicetak " + formatIDDate(time.Now()),
+	})
+	for _, line := range nonEmpty(user.Name, user.Email, fmt.Sprintf("ID pengguna #%d", user.ID)) {
+		page.Text(pdfMarginLeft, y, pdf.Regular, 10, line)
+		y += 13
+	}
+	y += 10
+	summary := []receiptLine{
+		{"Saldo awal", opening},
+		{"Total masuk", credit},
+		{"Total keluar", -debit},
+		{"Saldo akhir", closing},
+	}
+	for _, s := range summary {
+		font := pdf.Regular
+		if s.label == "Saldo akhir" {
+			font = pdf.Bold
+		}
+		page.Text(pdfMarginLeft, y, font, 10, s.label)
+		page.TextRight(pdfMarginLeft+220, y, font, 10, formatRupiah(s.amount))
+		y += 14
+	}
+	y += 16
+
+	const (
+		colDate    = pdfMarginLeft + 4
+		colInvoice = pdfMarginLeft + 62
+		colDesc    = pdfMarginLeft + 150
+		colDebit   = pdfMarginRight - 130
+		colCredit  = pdfMarginRight - 65
+		colBalance = pdfMarginRight - 4
+		descWidth  = colDebit - colDesc - 55
+	)
+	tableHeader := func() {
+		page.FillRect(pdfMarginLeft, y-11, pdfMarginRight-pdfMarginLeft, 16, 0.92)
+		page.Text(colDate, y, pdf.Bold, 8, "Tanggal")
+		page.Text(colInvoice, y, pdf.Bold, 8, "No. Invoice")
+		page.Text(colDesc, y, pdf.Bold, 8, "Keterangan")
+		page.TextRight(colDebit, y, pdf.Bold, 8, "Keluar")
+		page.TextRight(colCredit, y, pdf.Bold, 8, "Masuk")
+		page.TextRight(colBalance, y, pdf.Bold, 8, "Saldo")
+		y += 16
+	}
+	tableHeader()
+
+	balance := opening
+	if len(items) == 0 {
+		page.Text(colDesc, y, pdf.Regular, 8, "Tidak ada transaksi pada periode ini.")
+	}
+	for _, trx := range items {
+		balance += trx.Amount
+		wrapped := pdf.Wrap(pdf.Regular, 8, trx.Description, descWidth)
+		if y+float64(len(wrapped))*10 > pdfBottom {
+			drawInvoiceFooter(page, settings)
+			page = doc.AddPage()
+			y = 60
+			tableHeader()
+		}
+		page.Text(colDate, y, pdf.Regular, 8, trx.CreatedAt.Format("02/01 15:04"))
+		if trx.InvoiceNo != nil {
+			page.Text(colInvoice, y, pdf.Regular, 8, *trx.InvoiceNo)
+		}
+		for i, text := range wrapped {
+			page.Text(colDesc, y+float64(i)*10, pdf.Regular, 8, text)
+		}
+		if trx.Amount < 0 {
+			page.TextRight(colDebit, y, pdf.Regular, 8, formatRupiah(-trx.Amount))
+		} else {
+			page.TextRight(colCredit, y, pdf.Regular, 8, formatRupiah(trx.Amount))
+		}
+		page.TextRight(colBalance, y, pdf.Regular, 8, formatRupiah(balance))
+		y += float64(len(wrapped))*10 + 4
+	}
+	drawInvoiceFooter(page, settings)
+	return doc
+}
+
+// handleTransactionStatement serves the monthly statement PDF:
+// GET /api/transactions/statement?month=2026-01 (default this month). Admins
+// can add user_id.
+func handleTransactionStatement(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	session := auth.GetSessionFromRequest(r)
+	userID := session.UserID
+	if raw := strings.TrimSpace(r.URL.Query().Get("user_id")); raw != "" && session.Role == "admin" {
+		id, _ := strconv.Atoi(raw)
+		userID = uint(id)
+	}
+
+	now := time.Now()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if raw := strings.TrimSpace(r.URL.Query().Get("month")); raw != "" {
+		parsed, err := time.ParseInLocation("2006-01", raw, now.Location())
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "month harus berformat YYYY-MM", nil)
+			return
+		}
+		month = parsed
+	}
+	end := month.AddDate(0, 1, 0)
+
+	var user database.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		writeJSONError(w, http.StatusNotFound, "User tidak ditemukan", nil)
+		return
+	}
+	// The opening balance is worked back from the current balance.
+	var since int64
+	database.DB.Model(&database.Transaction{}).
+		Where("user_id = ? AND created_at >= ?", user.ID, month).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&since)
+	var items []database.Transaction
+	if err := database.DB.Where("user_id = ? AND created_at >= ? AND created_at < ?", user.ID, month, end).
+		Order("created_at asc, id asc").
+		Find(&items).Error; err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Gagal mengambil transaksi", err)
+		return
+	}
+
+	doc := renderStatement(user, month, user.Balance-since, items, loadInvoiceSettings(database.DB))
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="laporan-%s.pdf"`, month.Format("2006-01")))
+	w.Header().Set("Cache-Control", "private, no-store")
+	if _, err := doc.WriteTo(w); err != nil {
+		log.Printf("statement user %d %s: %v", user.ID, month.Format("2006-01"), err)
+	}
+}
+
+// handleAdminInvoiceSettings reads (GET) and updates (PATCH, only the fields
+// sent) the details printed on receipts.
+func handleAdminInvoiceSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, loadInvoiceSettings(database.DB))
+
+	case http.MethodPatch:
+		settings := loadInvoiceSettings(database.DB)
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		settings.ID = 1
+		settings.Prefix = strings.ToUpper(strings.TrimSpace(settings.Prefix))
+		settings.CompanyName = strings.TrimSpace(settings.CompanyName)
+		settings.TaxName = firstNonEmpty(strings.TrimSpace(settings.TaxName), "PPN")
+		if err := validateInvoiceSettings(settings); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		if err := database.DB.Save(&settings).Error; err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to update invoice settings", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, settings)
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+	}
+}
+
+func validateInvoiceSettings(s database.InvoiceSettings) error {
+	switch {
+	case !invoicePrefixPattern.MatchString(s.Prefix):
+		return errors.New("prefix must be 1-8 letters/digits")
+	case s.CompanyName == "":
+		return errors.New("company_name is required")
+	case s.TaxPercent < 0 || s.TaxPercent > 100:
+		return errors.New("tax_percent must be 0-100")
+	}
+	return nil
+}
@@ -22,7 +22,6 @@ import (
 	"net/smtp"
 	"net/url"
 	"os"
-	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -31,6 +30,7 @@ import (
 
 	"github.com/youming-ai/pikpak-downloader/internal/auth"
 	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/debrid"
 	"github.com/youming-ai/pikpak-downloader/internal/pikpak"
 	"github.com/youming-ai/pikpak-downloader/internal/realdebrid"
 	"gorm.io/gorm"
@@ -43,7 +43,6 @@ var telegramBotToken string
 var telegramAdminChatIDs map[int64]struct{}
 var forgotPasswordCooldownMu sync.Mutex
 var forgotPasswordCooldown = make(map[string]time.Time)
-var premiumAPISemaphore = make(chan struct{}, 1)
 
 func firstNonEmpty(values ...string) string {
 	for _, value := range values {
@@ -54,32 +53,38 @@ func firstNonEmpty(values ...string) string {
 	return ""
 }
 
+// envInt reads a positive integer from the environment, or returns def.
+func envInt(name string, def int) int {
+	if raw := strings.TrimSpace(os.Getenv(name)); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			return n
+		}
+	}
+	return def
+}
+
 func writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(payload)
 }
 
+// writeJSONError writes the error envelope shared by all API handlers:
+// {"code": machine-readable, "message": for the user, "error": detail}.
 func writeJSONError(w http.ResponseWriter, status int, message string, err error) {
-	resp := map[string]any{"message": message}
+	detail := message
 	if err != nil {
-		resp["error"] = err.Error()
+		detail = err.Error()
 	}
-	writeJSON(w, status, resp)
+	writeJSON(w, status, map[string]any{
+		"code":    errorCode(status, err),
+		"message": message,
+		"error":   detail,
+	})
 }
 
 func isInvalidPikPakFolderError(err error) bool {
-	if err == nil {
-		return false
-	}
-	msg := strings.ToLower(err.Error())
-	if strings.Contains(msg, "parent_id") && (strings.Contains(msg, "invalid") || strings.Contains(msg, "not found")) {
-		return true
-	}
-	if strings.Contains(msg, "file not found") || strings.Contains(msg, "folder not found") || strings.Contains(msg, "resource not found") {
-		return true
-	}
-	return false
+	return pikpak.IsNotFound(err)
 }
 
 func recreateUserPikPakFolder(user *database.User) (string, error) {
@@ -236,6 +241,15 @@ func main() {
 	if err := database.SeedDefaultPricing(); err != nil {
 		log.Printf("Warning: Failed to seed pricing: %v", err)
 	}
+	if err := database.SeedDefaultPaymentMethods(); err != nil {
+		log.Printf("Warning: Failed to seed payment methods: %v", err)
+	}
+	if err := database.SeedDefaultInvoiceSettings(); err != nil {
+		log.Printf("Warning: Failed to seed invoice settings: %v", err)
+	}
+	if err := backfillInvoiceNumbers(); err != nil {
+		log.Printf("Warning: Failed to number old invoices: %v", err)
+	}
 	if err := database.SeedDefaultBanners(); err != nil {
 		log.Printf("Warning: Failed to seed banners: %v", err)
 	}
@@ -249,11 +263,23 @@ func main() {
 	// Initialize Real-Debrid client
 	rdAPIKey := strings.TrimSpace(os.Getenv("REALDEBRID_API_KEY"))
 	rdClient = realdebrid.NewClient(rdAPIKey)
-	if rdAPIKey == "" {
-		log.Println("ℹ️ REALDEBRID_API_KEY belum diatur. Mode host premium masih manual.")
-	} else {
-		log.Println("✅ REALDEBRID_API_KEY terdeteksi. Mode host premium otomatis aktif.")
+	if rdAPIKey != "" {
+		log.Println("✅ REALDEBRID_API_KEY terdeteksi.")
+	}
+	debridProviders = loadDebridProviders()
+	if !debridProviders.Enabled() {
+		log.Println("ℹ️ Belum ada API key provider debrid (REALDEBRID_API_KEY / ALLDEBRID_API_KEY). Mode host premium masih manual.")
 	}
+	premiumQueue = newPremiumJobQueue()
+	premiumLinks.ttl = loadPremiumLinkCacheTTL()
+	torrentBackendPolicy = loadTorrentBackendPolicy()
+	if debridProviders.Enabled() {
+		premiumQueue.Start()
+	}
+	startDebridHealthCheck()
+	paymentGateway = loadPaymentGateway()
+	cryptoExplorers = loadCryptoExplorers()
+	startScheduler()
 
 	// PikPak Client
 	username := os.Getenv("PIKPAK_USERNAME")
@@ -263,7 +289,22 @@ func main() {
 		log.Fatal("PIKPAK_USERNAME and PIKPAK_PASSWORD must be set in .env")
 	}
 
+	signingKey, err := loadManifestSigningKey()
+	if err != nil {
+		log.Fatalf("Fatal: %v", err)
+	}
+	manifestSigningKey = signingKey
+	manifestSnapshotTTL = loadManifestSnapshotTTL()
+	manifestSnapshotMax = loadManifestSnapshotMax()
+
 	globalClient = pikpak.NewClient("", "")
+	globalClient.WalkOptions = pikpak.WalkOptions{
+		Concurrency: envInt("PIKPAK_WALK_CONCURRENCY", pikpak.DefaultWalkOptions.Concurrency),
+		MaxDepth:    envInt("PIKPAK_WALK_MAX_DEPTH", pikpak.DefaultWalkOptions.MaxDepth),
+		MaxEntries:  envInt("PIKPAK_WALK_MAX_ENTRIES", pikpak.DefaultWalkOptions.MaxEntries),
+	}
+	globalClient.ListingCacheTTL = time.Duration(envInt("PIKPAK_LISTING_CACHE_SECONDS", int(pikpak.DefaultListingCacheTTL/time.Second))) * time.Second
+	globalClient.RunningListingCacheTTL = time.Duration(envInt("PIKPAK_RUNNING_LISTING_CACHE_SECONDS", int(pikpak.DefaultRunningListingCacheTTL/time.Second))) * time.Second
 
 	log.Printf("Attempting login as %s...", username)
 	if err := globalClient.Login(username, password); err != nil {
@@ -290,8 +331,11 @@ func main() {
 	http.HandleFunc("/api/file", auth.RequireAuth(handleFileOps))
 	http.HandleFunc("/api/file/link", auth.RequireAuth(handleGetDownloadLink))
 	http.HandleFunc("/api/file/download", auth.RequireAuth(handleDirectFileDownload))
-	http.HandleFunc("/api/folder/manifest", auth.RequireAuth(handleFolderManifest))
+	http.HandleFunc("/api/folder/manifest", requireAuthOrSignedManifest(handleFolderManifest))
+	http.HandleFunc("/api/folder/manifest/signed", auth.RequireAuth(handleSignedManifestURL))
+	http.HandleFunc("/d/", handleSignedFileRedirect)
 	http.HandleFunc("/api/task", auth.RequireAuth(handleAddOfflineTask))
+	http.HandleFunc("/api/task/debrid", auth.RequireAuth(handleDebridTorrents))
 
 	// User & Database API Endpoints (protected)
 	http.HandleFunc("/api/user", auth.RequireAuth(handleGetUser))
@@ -302,21 +346,46 @@ func main() {
 	http.HandleFunc("/api/user/email", auth.RequireAuth(handleSendVerificationEmail))
 	http.HandleFunc("/api/notifications", auth.RequireAuth(handleNotifications))
 	http.HandleFunc("/api/transactions", auth.RequireAuth(handleTransactions))
+	http.HandleFunc("GET /api/transactions/{id}/receipt", auth.RequireAuth(handleTransactionReceipt))
+	http.HandleFunc("/api/transactions/statement", auth.RequireAuth(handleTransactionStatement))
 	http.HandleFunc("/api/topups", auth.RequireAuth(handleTopUps))
-	http.HandleFunc("/api/hosts", handleGetHosts)     // Public
-	http.HandleFunc("/api/pricing", handleGetPricing) // Public
+	http.HandleFunc("/api/topups/proof", auth.RequireAuth(handleTopupProof))
+	http.HandleFunc("/api/topups/usdt", auth.RequireAuth(handleTopupUSDT))
+	http.HandleFunc("/api/topups/usdt/fake-send", auth.RequireAuth(handleFakeUSDTSend))
+	http.HandleFunc("/api/topups/promos", auth.RequireAuth(handleTopupPromos))
+	http.HandleFunc("/api/payments/webhook", handlePaymentWebhook) // Signed by the gateway
+	http.HandleFunc("/api/payments/fake/pay", auth.RequireAuth(handleFakePayment))
+	http.HandleFunc("/api/hosts", handleGetHosts)                 // Public
+	http.HandleFunc("/api/pricing", handleGetPricing)             // Public
+	http.HandleFunc("/api/payment-methods", handlePaymentMethods) // Public
+	http.HandleFunc("/api/plans", handlePlans)                    // Public
+	http.HandleFunc("/api/subscription", auth.RequireAuth(handleSubscription))
 	http.HandleFunc("/api/voucher/preview", auth.RequireAuth(handleVoucherPreview))
 	http.HandleFunc("/api/premium/request", auth.RequireAuth(handlePremiumRequest))
+	http.HandleFunc("/api/premium/batch", auth.RequireAuth(handlePremiumBatch))
 
 	// Admin Endpoints (protected by admin role)
 	http.HandleFunc("/api/admin/users", auth.RequireAdmin(handleAdminUsers))
 	http.HandleFunc("/api/admin/pricing", auth.RequireAdmin(handleAdminPricing))
 	http.HandleFunc("/api/admin/vouchers", auth.RequireAdmin(handleAdminVouchers))
+	http.HandleFunc("/api/admin/payment-methods", auth.RequireAdmin(handleAdminPaymentMethods))
+	http.HandleFunc("/api/admin/topup-promos", auth.RequireAdmin(handleAdminTopupPromos))
+	http.HandleFunc("/api/admin/invoice-settings", auth.RequireAdmin(handleAdminInvoiceSettings))
+	http.HandleFunc("/api/admin/transactions", auth.RequireAdmin(handleAdminTransactions))
+	http.HandleFunc("/api/admin/plans", auth.RequireAdmin(handleAdminPlans))
+	http.HandleFunc("/api/admin/subscriptions", auth.RequireAdmin(handleAdminSubscriptions))
 	http.HandleFunc("/api/admin/stats", auth.RequireAdmin(handleAdminStats))
 	http.HandleFunc("/api/admin/monitoring", auth.RequireAdmin(handleAdminMonitoring))
 	http.HandleFunc("/api/admin/user/balance", auth.RequireAdmin(handleAdminUserBalance))
 	http.HandleFunc("/api/admin/topups", auth.RequireAdmin(handleAdminTopUps))
+	http.HandleFunc("/api/admin/topups/reconcile", auth.RequireAdmin(handleAdminTopupReconcile))
+	http.HandleFunc("/api/admin/premium-requests", auth.RequireAdmin(handleAdminPremiumRequests))
 	http.HandleFunc("/api/admin/hosts", auth.RequireAdmin(handleAdminHosts))
+	http.HandleFunc("/api/admin/hosts/sync", auth.RequireAdmin(handleAdminHostSync))
+	http.HandleFunc("/api/admin/debrid/health", auth.RequireAdmin(handleAdminDebridHealth))
+	http.HandleFunc("/api/admin/jobs", auth.RequireAdmin(handleAdminJobs))
+	http.HandleFunc("/api/admin/jobs/runs", auth.RequireAdmin(handleAdminJobRuns))
+	http.HandleFunc("/api/admin/jobs/run", auth.RequireAdmin(handleAdminJobRun))
 	http.HandleFunc("/api/admin/banners", auth.RequireAdmin(handleAdminBanners))
 	http.HandleFunc("/api/admin/banners/upload-image", auth.RequireAdmin(handleAdminBannerImageUpload))
 	http.HandleFunc("/api/admin/profile-pictures/sync", auth.RequireAdmin(handleSyncProfilePictures))
@@ -450,7 +519,7 @@ func handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
 
 func handleManualLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
@@ -460,40 +529,30 @@ func handleManualLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 		return
 	}
 
 	if req.Email == "" || req.Password == "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Email dan password wajib diisi"})
+		writeJSONError(w, http.StatusBadRequest, "Email dan password wajib diisi", nil)
 		return
 	}
 
 	// Find user by email
 	var user database.User
 	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Email atau password salah"})
+		writeJSONError(w, http.StatusUnauthorized, "Email atau password salah", nil)
 		return
 	}
 
 	// Check password
 	if !auth.CheckPassword(user.Password, req.Password) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Email atau password salah"})
+		writeJSONError(w, http.StatusUnauthorized, "Email atau password salah", nil)
 		return
 	}
 
 	if !user.IsActive {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Akun dinonaktifkan"})
+		writeJSONError(w, http.StatusForbidden, "Akun dinonaktifkan", nil)
 		return
 	}
 
@@ -510,7 +569,7 @@ func handleManualLogin(w http.ResponseWriter, r *http.Request) {
 
 func handleRegister(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
@@ -520,41 +579,31 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 		return
 	}
 
 	if req.Email == "" || req.Password == "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Email dan password wajib diisi"})
+		writeJSONError(w, http.StatusBadRequest, "Email dan password wajib diisi", nil)
 		return
 	}
 
 	if len(req.Password) < 6 {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Password minimal 6 karakter"})
+		writeJSONError(w, http.StatusBadRequest, "Password minimal 6 karakter", nil)
 		return
 	}
 
 	// Check if email already exists
 	var existingUser database.User
 	if err := database.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Email sudah terdaftar"})
+		writeJSONError(w, http.StatusBadRequest, "Email sudah terdaftar", nil)
 		return
 	}
 
 	// Hash password
 	hashedPassword, err := auth.HashPassword(req.Password)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Gagal membuat akun"})
+		writeJSONError(w, http.StatusInternalServerError, "Gagal membuat akun", nil)
 		return
 	}
 
@@ -579,9 +628,7 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 		PikPakFolderName: folderName,
 	}
 	if err := database.DB.Create(&user).Error; err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Gagal membuat akun"})
+		writeJSONError(w, http.StatusInternalServerError, "Gagal membuat akun", nil)
 		return
 	}
 
@@ -725,7 +772,7 @@ func sendSMTPMail(to, subject, body string) error {
 
 func handleSendVerificationEmail(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
@@ -733,26 +780,20 @@ func handleSendVerificationEmail(w http.ResponseWriter, r *http.Request) {
 		Email string `json:"email"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Request tidak valid"})
+		writeJSONError(w, http.StatusBadRequest, "Request tidak valid", nil)
 		return
 	}
 
 	email := strings.ToLower(strings.TrimSpace(req.Email))
 	if email == "" || !strings.Contains(email, "@") || !strings.Contains(email, ".") {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Email tidak valid"})
+		writeJSONError(w, http.StatusBadRequest, "Email tidak valid", nil)
 		return
 	}
 
 	session := auth.GetSessionFromRequest(r)
 	var user database.User
 	if err := database.DB.First(&user, session.UserID).Error; err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"message": "User tidak ditemukan"})
+		writeJSONError(w, http.StatusUnauthorized, "User tidak ditemukan", nil)
 		return
 	}
 
@@ -762,9 +803,7 @@ func handleSendVerificationEmail(w http.ResponseWriter, r *http.Request) {
 			Where("LOWER(email) = ? AND id <> ?", email, user.ID).
 			Count(&exists)
 		if exists > 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"message": "Email sudah digunakan akun lain"})
+			writeJSONError(w, http.StatusBadRequest, "Email sudah digunakan akun lain", nil)
 			return
 		}
 		user.Email = email
@@ -773,9 +812,7 @@ func handleSendVerificationEmail(w http.ResponseWriter, r *http.Request) {
 
 	rawToken, err := generateSecureToken()
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Gagal membuat token verifikasi"})
+		writeJSONError(w, http.StatusInternalServerError, "Gagal membuat token verifikasi", nil)
 		return
 	}
 
@@ -783,9 +820,7 @@ func handleSendVerificationEmail(w http.ResponseWriter, r *http.Request) {
 	user.EmailVerifyToken = hashToken(rawToken)
 	user.EmailVerifyExp = &expires
 	if err := database.DB.Save(&user).Error; err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Gagal menyimpan verifikasi"})
+		writeJSONError(w, http.StatusInternalServerError, "Gagal menyimpan verifikasi", nil)
 		return
 	}
 
@@ -793,9 +828,7 @@ func handleSendVerificationEmail(w http.ResponseWriter, r *http.Request) {
 	body := fmt.Sprintf("Halo,\n\nKlik link berikut untuk verifikasi email akun azify.page kamu:\n%s\n\nLink berlaku 24 jam.\n\nJika kamu tidak meminta ini, abaikan email ini.", verifyURL)
 	if err := sendSMTPMail(user.Email, "Verifikasi Email azify.page", body); err != nil {
 		log.Printf("send verification email failed: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Gagal mengirim email verifikasi. Periksa SMTP."})
+		writeJSONError(w, http.StatusInternalServerError, "Gagal mengirim email verifikasi. Periksa SMTP.", nil)
 		return
 	}
 
@@ -845,7 +878,7 @@ func handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
 
 func handleForgotPassword(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
@@ -853,9 +886,7 @@ func handleForgotPassword(w http.ResponseWriter, r *http.Request) {
 		Email string `json:"email"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Request tidak valid"})
+		writeJSONError(w, http.StatusBadRequest, "Request tidak valid", nil)
 		return
 	}
 
@@ -883,10 +914,10 @@ func handleForgotPassword(w http.ResponseWriter, r *http.Request) {
 			retryAfter = 1
 		}
 		forgotPasswordCooldownMu.Unlock()
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusTooManyRequests)
-		json.NewEncoder(w).Encode(map[string]any{
+		writeJSON(w, http.StatusTooManyRequests, map[string]any{
+			"code":        "rate_limited",
 			"message":     "Tunggu sebentar sebelum minta link reset lagi.",
+			"error":       "Tunggu sebentar sebelum minta link reset lagi.",
 			"retry_after": retryAfter,
 		})
 		return
@@ -924,7 +955,7 @@ func handleForgotPassword(w http.ResponseWriter, r *http.Request) {
 
 func handleResetPassword(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
@@ -933,23 +964,17 @@ func handleResetPassword(w http.ResponseWriter, r *http.Request) {
 		NewPassword string `json:"new_password"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Request tidak valid"})
+		writeJSONError(w, http.StatusBadRequest, "Request tidak valid", nil)
 		return
 	}
 
 	rawToken := strings.TrimSpace(req.Token)
 	if rawToken == "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Token wajib diisi"})
+		writeJSONError(w, http.StatusBadRequest, "Token wajib diisi", nil)
 		return
 	}
 	if len(req.NewPassword) < 6 {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Password minimal 6 karakter"})
+		writeJSONError(w, http.StatusBadRequest, "Password minimal 6 karakter", nil)
 		return
 	}
 
@@ -957,17 +982,13 @@ func handleResetPassword(w http.ResponseWriter, r *http.Request) {
 	tokenHash := hashToken(rawToken)
 	var user database.User
 	if err := database.DB.Where("password_reset_token = ? AND password_reset_exp IS NOT NULL AND password_reset_exp > ?", tokenHash, now).First(&user).Error; err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Token reset tidak valid atau kedaluwarsa"})
+		writeJSONError(w, http.StatusBadRequest, "Token reset tidak valid atau kedaluwarsa", nil)
 		return
 	}
 
 	hashedPassword, err := auth.HashPassword(req.NewPassword)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Gagal memproses password"})
+		writeJSONError(w, http.StatusInternalServerError, "Gagal memproses password", nil)
 		return
 	}
 
@@ -976,9 +997,7 @@ func handleResetPassword(w http.ResponseWriter, r *http.Request) {
 		"password_reset_token": "",
 		"password_reset_exp":   nil,
 	}).Error; err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Gagal reset password"})
+		writeJSONError(w, http.StatusInternalServerError, "Gagal reset password", nil)
 		return
 	}
 
@@ -992,7 +1011,7 @@ func handleGetUser(w http.ResponseWriter, r *http.Request) {
 	session := auth.GetSessionFromRequest(r)
 	var user database.User
 	if err := database.DB.First(&user, session.UserID).Error; err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		writeJSONError(w, http.StatusNotFound, "User not found", nil)
 		return
 	}
 
@@ -1025,37 +1044,37 @@ func handleGetUser(w http.ResponseWriter, r *http.Request) {
 
 func handleUserPhotoUpload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
 	session := auth.GetSessionFromRequest(r)
 	if session == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized", nil)
 		return
 	}
 
 	if err := r.ParseMultipartForm(2 * 1024 * 1024); err != nil {
-		http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "Invalid multipart form", nil)
 		return
 	}
 
 	file, header, err := r.FormFile("photo")
 	if err != nil {
-		http.Error(w, "photo file is required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "photo file is required", nil)
 		return
 	}
 	defer file.Close()
 
 	if header.Size > 1*1024*1024 {
-		http.Error(w, "ukuran file melebihi 1MB", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "ukuran file melebihi 1MB", nil)
 		return
 	}
 
 	buffer := make([]byte, 512)
 	n, readErr := file.Read(buffer)
 	if readErr != nil && readErr != io.EOF {
-		http.Error(w, "gagal membaca file", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "gagal membaca file", nil)
 		return
 	}
 
@@ -1069,18 +1088,18 @@ func handleUserPhotoUpload(w http.ResponseWriter, r *http.Request) {
 	case "image/gif":
 		ext = ".gif"
 	default:
-		http.Error(w, "format gambar tidak didukung (gunakan jpg/png/gif)", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "format gambar tidak didukung (gunakan jpg/png/gif)", nil)
 		return
 	}
 
 	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		http.Error(w, "gagal reset file", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "gagal reset file", nil)
 		return
 	}
 
 	uploadDir := filepath.Join(".", "uploads", "profiles")
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		http.Error(w, "Failed to create upload directory", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to create upload directory", nil)
 		return
 	}
 
@@ -1100,27 +1119,27 @@ func handleUserPhotoUpload(w http.ResponseWriter, r *http.Request) {
 
 	outFile, err := os.Create(fullPath)
 	if err != nil {
-		http.Error(w, "Failed to create image file", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to create image file", nil)
 		return
 	}
 	defer outFile.Close()
 
 	written, err := io.Copy(outFile, io.LimitReader(file, 1*1024*1024+1))
 	if err != nil {
-		http.Error(w, "Failed to save image", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to save image", nil)
 		return
 	}
 
 	if written > 1*1024*1024 {
 		os.Remove(fullPath)
-		http.Error(w, "ukuran file melebihi 1MB", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "ukuran file melebihi 1MB", nil)
 		return
 	}
 
 	urlPath := "/uploads/profiles/" + filename
 	if err := database.DB.Model(&database.User{}).Where("id = ?", session.UserID).Update("picture", urlPath).Error; err != nil {
 		os.Remove(fullPath)
-		http.Error(w, "Failed to update profile picture", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to update profile picture", nil)
 		return
 	}
 
@@ -1139,6 +1158,11 @@ func handleUserPhotoUpload(w http.ResponseWriter, r *http.Request) {
 
 func handleUploadsDir(fs http.FileSystem) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Transfer proofs are private; they are served by /api/topups/proof.
+		if rel := strings.TrimLeft(filepath.ToSlash(filepath.Clean("/"+r.URL.Path)), "/"); rel == topupProofDir || strings.HasPrefix(rel, topupProofDir+"/") {
+			http.NotFound(w, r)
+			return
+		}
 		// Set cache headers for static files
 		w.Header().Set("Cache-Control", "public, max-age=86400") // 1 day cache
 		http.FileServer(fs).ServeHTTP(w, r)
@@ -1147,7 +1171,7 @@ func handleUploadsDir(fs http.FileSystem) http.Handler {
 
 func handleSyncProfilePictures(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
@@ -1167,7 +1191,7 @@ func handleSyncProfilePictures(w http.ResponseWriter, r *http.Request) {
 	// Read all files in the profiles directory
 	entries, err := os.ReadDir(profileDir)
 	if err != nil {
-		http.Error(w, "Failed to read profiles directory", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to read profiles directory", nil)
 		return
 	}
 
@@ -1247,13 +1271,13 @@ func handleSyncProfilePictures(w http.ResponseWriter, r *http.Request) {
 
 func handleUserNameUpdate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
 	session := auth.GetSessionFromRequest(r)
 	if session == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -1261,30 +1285,22 @@ func handleUserNameUpdate(w http.ResponseWriter, r *http.Request) {
 		Name string `json:"name"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 		return
 	}
 
 	name := strings.TrimSpace(req.Name)
 	if name == "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Nama tidak boleh kosong"})
+		writeJSONError(w, http.StatusBadRequest, "Nama tidak boleh kosong", nil)
 		return
 	}
 	if len([]rune(name)) > 80 {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Nama terlalu panjang"})
+		writeJSONError(w, http.StatusBadRequest, "Nama terlalu panjang", nil)
 		return
 	}
 
 	if err := database.DB.Model(&database.User{}).Where("id = ?", session.UserID).Update("name", name).Error; err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Gagal mengubah nama"})
+		writeJSONError(w, http.StatusInternalServerError, "Gagal mengubah nama", nil)
 		return
 	}
 
@@ -1294,13 +1310,13 @@ func handleUserNameUpdate(w http.ResponseWriter, r *http.Request) {
 
 func handleUserPasswordUpdate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
 	session := auth.GetSessionFromRequest(r)
 	if session == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -1309,52 +1325,38 @@ func handleUserPasswordUpdate(w http.ResponseWriter, r *http.Request) {
 		NewPassword     string `json:"new_password"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request"})
+		writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 		return
 	}
 
 	if strings.TrimSpace(req.CurrentPassword) == "" || strings.TrimSpace(req.NewPassword) == "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Password lama dan baru wajib diisi"})
+		writeJSONError(w, http.StatusBadRequest, "Password lama dan baru wajib diisi", nil)
 		return
 	}
 	if len(req.NewPassword) < 6 {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Password baru minimal 6 karakter"})
+		writeJSONError(w, http.StatusBadRequest, "Password baru minimal 6 karakter", nil)
 		return
 	}
 
 	var user database.User
 	if err := database.DB.First(&user, session.UserID).Error; err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "User tidak ditemukan"})
+		writeJSONError(w, http.StatusNotFound, "User tidak ditemukan", nil)
 		return
 	}
 
 	if !auth.CheckPassword(user.Password, req.CurrentPassword) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Password lama salah"})
+		writeJSONError(w, http.StatusBadRequest, "Password lama salah", nil)
 		return
 	}
 
 	hashedPassword, err := auth.HashPassword(req.NewPassword)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Gagal memproses password"})
+		writeJSONError(w, http.StatusInternalServerError, "Gagal memproses password", nil)
 		return
 	}
 
 	if err := database.DB.Model(&database.User{}).Where("id = ?", session.UserID).Update("password", hashedPassword).Error; err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Gagal mengubah password"})
+		writeJSONError(w, http.StatusInternalServerError, "Gagal mengubah password", nil)
 		return
 	}
 
@@ -1364,13 +1366,13 @@ func handleUserPasswordUpdate(w http.ResponseWriter, r *http.Request) {
 
 func handleUserDelete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
 	session := auth.GetSessionFromRequest(r)
 	if session == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -1419,9 +1421,7 @@ func handleUserDelete(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Gagal menghapus akun"})
+		writeJSONError(w, http.StatusInternalServerError, "Gagal menghapus akun", nil)
 		return
 	}
 
@@ -1443,7 +1443,7 @@ func handleNotifications(w http.ResponseWriter, r *http.Request) {
 			MarkAll bool `json:"mark_all"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 
@@ -1454,7 +1454,7 @@ func handleNotifications(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if req.ID == 0 {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 
@@ -1470,9 +1470,30 @@ func handleNotifications(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(notifications)
 }
 
+// handleTransactions lists the user's transactions, narrowed by the filters of
+// transactionFilter. With format=csv or format=json it streams all matches as
+// a download instead.
 func handleTransactions(w http.ResponseWriter, r *http.Request) {
 	session := auth.GetSessionFromRequest(r)
 
+	filter, err := transactionFilter(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	format, err := exportFormat(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	query := func() *gorm.DB {
+		return database.DB.Model(&database.Transaction{}).Where("transactions.user_id = ?", session.UserID).Scopes(filter)
+	}
+	if format != "" {
+		exportTransactions(w, query(), format, false)
+		return
+	}
+
 	pageRaw := strings.TrimSpace(r.URL.Query().Get("page"))
 	pageSizeRaw := strings.TrimSpace(r.URL.Query().Get("page_size"))
 	usePagination := pageRaw != "" || pageSizeRaw != ""
@@ -1495,7 +1516,7 @@ func handleTransactions(w http.ResponseWriter, r *http.Request) {
 		}
 
 		var total int64
-		database.DB.Model(&database.Transaction{}).Where("user_id = ?", session.UserID).Count(&total)
+		query().Count(&total)
 
 		totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
 		if totalPages == 0 {
@@ -1507,7 +1528,7 @@ func handleTransactions(w http.ResponseWriter, r *http.Request) {
 
 		offset := (page - 1) * pageSize
 		var items []database.Transaction
-		database.DB.Where("user_id = ?", session.UserID).
+		query().
 			Order("created_at desc").
 			Limit(pageSize).
 			Offset(offset).
@@ -1520,40 +1541,42 @@ func handleTransactions(w http.ResponseWriter, r *http.Request) {
 			"page_size":   pageSize,
 			"total":       total,
 			"total_pages": totalPages,
+			"totals":      transactionTotals(query()),
 		})
 		return
 	}
 
 	var transactions []database.Transaction
-	database.DB.Where("user_id = ?", session.UserID).Order("created_at desc").Limit(50).Find(&transactions)
+	query().Order("created_at desc").Limit(50).Find(&transactions)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(transactions)
 }
 
-type topupDestination struct {
-	Method  string
-	Label   string
-	Account string
+// topupSerialPrefix3 returns the PaymentMethod's serial prefix, or one derived
+// from the method code for methods that no longer exist.
+func topupSerialPrefix3(method string) string {
+	code := strings.ToLower(strings.TrimSpace(method))
+	var pm database.PaymentMethod
+	if err := database.DB.Select("serial_prefix").Where("code = ?", code).First(&pm).Error; err == nil && len(pm.SerialPrefix) == 3 {
+		return pm.SerialPrefix
+	}
+	return deriveSerialPrefix3(code)
 }
 
-func topupSerialPrefix3(method string) string {
-	switch strings.ToLower(strings.TrimSpace(method)) {
-	case "gopay":
-		return "GOP"
-	case "bri":
-		return "BRI"
-	case "bank_jago":
-		return "JGO"
-	case "crypto_usdt":
-		return "USD"
-	default:
-		m := strings.ToUpper(strings.TrimSpace(method))
-		if len(m) >= 3 {
-			return m[:3]
+// deriveSerialPrefix3 takes the first 3 alphanumeric chars of a method code,
+// uppercased and padded with X.
+func deriveSerialPrefix3(code string) string {
+	clean := make([]rune, 0, 3)
+	for _, r := range strings.ToUpper(code) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			clean = append(clean, r)
+		}
+		if len(clean) >= 3 {
+			break
 		}
-		return (m + "XXX")[:3]
 	}
+	return (string(clean) + "XXX")[:3]
 }
 
 func topupNamePrefix3(username string) string {
@@ -1603,26 +1626,9 @@ func generateTopupSerial(method string, username string, t time.Time) string {
 	return fmt.Sprintf("%s%s%s%s", prefix, dateTime, name3, uniq3)
 }
 
-func getTopupDestinations() map[string]topupDestination {
-	return map[string]topupDestination{
-		"gopay":       {Method: "gopay", Label: "GoPay", Account: "085778135021"},
-		"bri":         {Method: "bri", Label: "BRI", Account: "162901006178537"},
-		"bank_jago":   {Method: "bank_jago", Label: "Bank Jago", Account: "103325280390"},
-		"crypto_usdt": {Method: "crypto_usdt", Label: "Crypto (USDT)", Account: "SEGERA"},
-	}
-}
-
 func handleTopUps(w http.ResponseWriter, r *http.Request) {
 	session := auth.GetSessionFromRequest(r)
 
-	expireUserTopups := func() {
-		now := time.Now()
-		// Best-effort expiry update for this user.
-		database.DB.Model(&database.TopUpRequest{}).
-			Where("user_id = ? AND status = ? AND expires_at < ?", session.UserID, "awaiting_payment", now).
-			Updates(map[string]any{"status": "expired", "updated_at": now})
-	}
-
 	getFailureCountToday := func() int64 {
 		now := time.Now()
 		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
@@ -1643,8 +1649,10 @@ func handleTopUps(w http.ResponseWriter, r *http.Request) {
 		return &active, true
 	}
 
-	// Keep statuses fresh.
-	expireUserTopups()
+	// Keep statuses fresh between runs of the topup_expiry job.
+	if _, err := expireTopups(session.UserID); err != nil {
+		log.Printf("topup expiry user %d gagal: %v", session.UserID, err)
+	}
 
 	switch r.Method {
 	case http.MethodGet:
@@ -1708,22 +1716,18 @@ func handleTopUps(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		// One active topup at a time.
 		if active, ok := findActive(); ok {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusConflict)
-			json.NewEncoder(w).Encode(map[string]any{
-				"error":  "Anda masih punya top up yang sedang berjalan",
-				"active": active,
+			writeJSON(w, http.StatusConflict, map[string]any{
+				"code":    "topup_active",
+				"message": "Anda masih punya top up yang sedang berjalan",
+				"error":   "Anda masih punya top up yang sedang berjalan",
+				"active":  active,
 			})
 			return
 		}
 
 		// Max 3 failures (cancel/expired) per day.
 		if getFailureCountToday() >= 3 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusTooManyRequests)
-			json.NewEncoder(w).Encode(map[string]any{
-				"error": "Batas pembatalan/expired hari ini sudah tercapai (maks 3 kali). Silakan coba besok.",
-			})
+			writeJSONError(w, http.StatusTooManyRequests, "Batas pembatalan/expired hari ini sudah tercapai (maks 3 kali). Silakan coba besok.", nil)
 			return
 		}
 
@@ -1732,17 +1736,20 @@ func handleTopUps(w http.ResponseWriter, r *http.Request) {
 			PaymentMethod string `json:"payment_method"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
-		if req.Amount < 5000 {
-			http.Error(w, "Minimum top up is 5000", http.StatusBadRequest)
+		method, err := findPaymentMethod(req.PaymentMethod)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Metode pembayaran tidak tersedia", nil)
 			return
 		}
-		dests := getTopupDestinations()
-		dest, ok := dests[strings.ToLower(strings.TrimSpace(req.PaymentMethod))]
-		if !ok {
-			http.Error(w, "Unsupported payment method", http.StatusBadRequest)
+		if req.Amount < method.MinAmount {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Minimal top up via %s adalah Rp %d", method.Label, method.MinAmount), nil)
+			return
+		}
+		if method.MaxAmount > 0 && req.Amount > method.MaxAmount {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Maksimal top up via %s adalah Rp %d", method.Label, method.MaxAmount), nil)
 			return
 		}
 
@@ -1755,25 +1762,57 @@ func handleTopUps(w http.ResponseWriter, r *http.Request) {
 
 		now := time.Now()
 		topup := database.TopUpRequest{
-			Serial:         generateTopupSerial(dest.Method, username, now),
+			Serial:         generateTopupSerial(method.Code, username, now),
 			UserID:         session.UserID,
 			Username:       username,
 			Amount:         req.Amount,
-			PaymentMethod:  dest.Method,
-			PaymentAccount: dest.Account,
+			Fee:            method.Fee,
+			PaymentMethod:  method.Code,
+			PaymentAccount: firstNonEmpty(method.Account, method.Label),
 			Status:         "awaiting_payment",
 			ExpiresAt:      now.Add(30 * time.Minute),
 		}
-		if err := database.DB.Create(&topup).Error; err != nil {
-			http.Error(w, "Failed to create topup request", http.StatusInternalServerError)
+		quoteTopupPromo(&topup, now)
+		var createErr error
+		switch {
+		case method.Gateway != "":
+			createErr = database.DB.Create(&topup).Error
+		case method.Network != "":
+			createErr = createCryptoTopup(&topup, method)
+		default:
+			createErr = createManualTopup(&topup)
+		}
+		if errors.Is(createErr, errUniqueCodesExhausted) {
+			writeJSONError(w, http.StatusServiceUnavailable, "Terlalu banyak top up dengan nominal ini. Coba nominal lain atau tunggu beberapa menit.", nil)
+			return
+		}
+		if createErr != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to create topup request", nil)
 			return
 		}
 
+		message := fmt.Sprintf("Top up Rp %d via %s dibuat. Transfer tepat Rp %d (termasuk kode unik) dan konfirmasi sebelum %s.", topup.Amount, method.Label, topup.PayableAmount(), topup.ExpiresAt.Format("15:04"))
+		if method.Gateway != "" {
+			if err := createTopupCharge(&topup, method, user); err != nil {
+				log.Printf("payment: gagal membuat tagihan %s: %v", topup.Serial, err)
+				database.DB.Delete(&topup)
+				writeJSONError(w, http.StatusBadGateway, "Gagal membuat tagihan pembayaran. Silakan coba lagi.", nil)
+				return
+			}
+			message = fmt.Sprintf("Tagihan top up Rp %d via %s dibuat. Bayar sebelum %s, saldo masuk otomatis.", topup.PayableAmount(), method.Label, topup.ExpiresAt.Format("15:04"))
+		}
+		if method.Network != "" {
+			message = fmt.Sprintf("Top up Rp %d via %s dibuat. Kirim tepat %s USDT dan masukkan hash transaksinya sebelum %s.", topup.Amount, method.Label, topup.CryptoAmount, topup.ExpiresAt.Format("15:04"))
+		}
+		if topup.Bonus > 0 {
+			message += fmt.Sprintf(" Bonus promo Rp %d ditambahkan setelah top up disetujui.", topup.Bonus)
+		}
+
 		// Notify the user in-app.
 		database.DB.Create(&database.Notification{
 			UserID:  session.UserID,
 			Title:   "Top up dibuat",
-			Message: fmt.Sprintf("Top up Rp %d via %s dibuat. Silakan transfer dan konfirmasi sebelum %s.", req.Amount, dest.Label, topup.ExpiresAt.Format("15:04")),
+			Message: message,
 		})
 
 		w.Header().Set("Content-Type", "application/json")
@@ -1785,49 +1824,74 @@ func handleTopUps(w http.ResponseWriter, r *http.Request) {
 			ID     uint   `json:"id"`
 			Action string `json:"action"` // paid|cancel
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+		// Multipart (id, action, proof) lets "paid" carry a transfer proof image.
+		var proof multipart.File
+		var proofHeader *multipart.FileHeader
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			r.Body = http.MaxBytesReader(w, r.Body, topupProofMaxSize+64*1024)
+			if err := r.ParseMultipartForm(topupProofMaxSize); err != nil {
+				writeJSONError(w, http.StatusBadRequest, "Bukti transfer terlalu besar atau tidak valid (maks 2MB)", nil)
+				return
+			}
+			id, _ := strconv.ParseUint(strings.TrimSpace(r.FormValue("id")), 10, 64)
+			req.ID, req.Action = uint(id), r.FormValue("action")
+			if f, h, err := r.FormFile("proof"); err == nil {
+				defer f.Close()
+				proof, proofHeader = f, h
+			}
+		} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 		action := strings.ToLower(strings.TrimSpace(req.Action))
 		if req.ID == 0 || (action != "paid" && action != "cancel") {
-			http.Error(w, "Invalid id/action", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid id/action", nil)
 			return
 		}
 
 		var topup database.TopUpRequest
 		if err := database.DB.First(&topup, req.ID).Error; err != nil {
-			http.Error(w, "Topup request not found", http.StatusNotFound)
+			writeJSONError(w, http.StatusNotFound, "Topup request not found", nil)
 			return
 		}
 		if topup.UserID != session.UserID {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			writeJSONError(w, http.StatusForbidden, "Forbidden", nil)
 			return
 		}
 
 		now := time.Now()
-		// Expire if needed.
+		// Expire if needed. Status changes below are conditional on
+		// awaiting_payment so a concurrent webhook, admin action or expiry run wins cleanly.
 		if topup.Status == "awaiting_payment" && !topup.ExpiresAt.IsZero() && topup.ExpiresAt.Before(now) {
-			topup.Status = "expired"
-			_ = database.DB.Save(&topup).Error
+			if _, err := expireTopups(session.UserID); err != nil {
+				log.Printf("expire top up %s gagal: %v", topup.Serial, err)
+			}
+			database.DB.First(&topup, topup.ID)
 		}
 
 		if action == "cancel" {
 			if topup.Status != "awaiting_payment" {
-				http.Error(w, "Only awaiting_payment topups can be cancelled", http.StatusBadRequest)
+				writeJSONError(w, http.StatusBadRequest, "Only awaiting_payment topups can be cancelled", nil)
 				return
 			}
 			// Max 3 failures/day (cancel/expired) check at cancellation time.
 			if getFailureCountToday() >= 3 {
-				http.Error(w, "Daily cancellation/expiry limit reached", http.StatusTooManyRequests)
+				writeJSONError(w, http.StatusTooManyRequests, "Daily cancellation/expiry limit reached", nil)
 				return
 			}
-			topup.Status = "cancelled"
-			topup.CancelledAt = &now
-			if err := database.DB.Save(&topup).Error; err != nil {
-				http.Error(w, "Failed to cancel", http.StatusInternalServerError)
+			res := database.DB.Model(&database.TopUpRequest{}).
+				Where("id = ? AND status = ?", topup.ID, "awaiting_payment").
+				Updates(map[string]any{"status": "cancelled", "cancelled_at": now, "updated_at": now})
+			if res.Error != nil {
+				writeJSONError(w, http.StatusInternalServerError, "Failed to cancel", res.Error)
 				return
 			}
+			if res.RowsAffected == 0 {
+				writeJSONError(w, http.StatusConflict, "Top up sudah diproses, muat ulang halaman", nil)
+				return
+			}
+			topup.Status = "cancelled"
+			topup.CancelledAt = &now
 			database.DB.Create(&database.Notification{
 				UserID:  session.UserID,
 				Title:   "Top up dibatalkan",
@@ -1839,20 +1903,54 @@ func handleTopUps(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// action == paid
+		if topup.Gateway != "" {
+			writeJSONError(w, http.StatusBadRequest, "Pembayaran via payment gateway dikonfirmasi otomatis", nil)
+			return
+		}
+		if topup.CryptoAmount != "" {
+			writeJSONError(w, http.StatusBadRequest, "Top up USDT dikonfirmasi dengan hash transaksi", nil)
+			return
+		}
 		if topup.Status != "awaiting_payment" {
-			http.Error(w, "Topup is not in awaiting_payment", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Topup is not in awaiting_payment", nil)
 			return
 		}
 		if !topup.ExpiresAt.IsZero() && topup.ExpiresAt.Before(now) {
-			http.Error(w, "Topup expired", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Topup expired", nil)
 			return
 		}
-		topup.Status = "pending"
-		topup.PaidAt = &now
-		if err := database.DB.Save(&topup).Error; err != nil {
-			http.Error(w, "Failed to mark paid", http.StatusInternalServerError)
+		if proof == nil && topupProofRequired() {
+			writeJSONError(w, http.StatusBadRequest, "Bukti transfer wajib diunggah", nil)
 			return
 		}
+		if proof != nil {
+			name, err := saveTopupProof(proof, proofHeader)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, err.Error(), err)
+				return
+			}
+			topup.ProofImage = name
+		}
+		updates := map[string]any{"status": "pending", "paid_at": now, "updated_at": now}
+		if topup.ProofImage != "" {
+			updates["proof_image"] = topup.ProofImage
+		}
+		res := database.DB.Model(&database.TopUpRequest{}).
+			Where("id = ? AND status = ?", topup.ID, "awaiting_payment").
+			Updates(updates)
+		if res.Error != nil || res.RowsAffected == 0 {
+			if topup.ProofImage != "" {
+				os.Remove(topupProofPath(topup.ProofImage))
+			}
+			if res.Error != nil {
+				writeJSONError(w, http.StatusInternalServerError, "Failed to mark paid", res.Error)
+			} else {
+				writeJSONError(w, http.StatusConflict, "Top up sudah diproses, muat ulang halaman", nil)
+			}
+			return
+		}
+		topup.Status = "pending"
+		topup.PaidAt = &now
 
 		// Notify the user in-app.
 		database.DB.Create(&database.Notification{
@@ -1869,7 +1967,7 @@ func handleTopUps(w http.ResponseWriter, r *http.Request) {
 		return
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 }
@@ -1940,12 +2038,12 @@ func handleAdminTopUps(w http.ResponseWriter, r *http.Request) {
 			Reason string `json:"reason"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 		status := strings.ToLower(strings.TrimSpace(req.Status))
 		if req.ID == 0 || (status != "approved" && status != "rejected") {
-			http.Error(w, "Invalid id/status", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid id/status", nil)
 			return
 		}
 
@@ -1953,13 +2051,13 @@ func handleAdminTopUps(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			switch {
 			case errors.Is(err, errTopupNotFound):
-				http.Error(w, "Topup request not found", http.StatusNotFound)
+				writeJSONError(w, http.StatusNotFound, "Topup request not found", nil)
 				return
 			case errors.Is(err, errTopupAlreadyDecided):
-				http.Error(w, "Topup request already decided", http.StatusBadRequest)
+				writeJSONError(w, http.StatusBadRequest, "Topup request already decided", nil)
 				return
 			default:
-				http.Error(w, "Failed to process topup", http.StatusInternalServerError)
+				writeJSONError(w, http.StatusInternalServerError, "Failed to process topup", nil)
 				return
 			}
 		}
@@ -1969,7 +2067,7 @@ func handleAdminTopUps(w http.ResponseWriter, r *http.Request) {
 		return
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 }
@@ -1983,65 +2081,44 @@ func applyTopupDecision(id uint, status string, reason string) (database.TopUpRe
 		return database.TopUpRequest{}, fmt.Errorf("invalid decision")
 	}
 
-	var topup database.TopUpRequest
-	if err := database.DB.First(&topup, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return database.TopUpRequest{}, errTopupNotFound
-		}
-		return database.TopUpRequest{}, err
-	}
-	if topup.Status != "pending" {
-		return database.TopUpRequest{}, errTopupAlreadyDecided
-	}
-
 	now := time.Now()
 	cleanReason := strings.TrimSpace(reason)
 
-	if status == "approved" {
-		err := database.DB.Transaction(func(tx *gorm.DB) error {
-			var user database.User
-			if err := tx.First(&user, topup.UserID).Error; err != nil {
-				return err
-			}
-
-			user.Balance += topup.Amount
-			if err := tx.Save(&user).Error; err != nil {
-				return err
-			}
-
-			trx := database.Transaction{
-				UserID:      topup.UserID,
-				Amount:      topup.Amount,
-				Type:        "topup",
-				Description: fmt.Sprintf("Top Up (%s)", topup.PaymentMethod),
-			}
-			if err := tx.Create(&trx).Error; err != nil {
-				return err
+	// Lock the row so the admin panel, Telegram and the payment webhook cannot
+	// decide the same top up twice.
+	var topup database.TopUpRequest
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&topup, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errTopupNotFound
 			}
+			return err
+		}
+		if topup.Status != "pending" {
+			return errTopupAlreadyDecided
+		}
 
-			topup.Status = "approved"
-			topup.AdminReason = cleanReason
-			topup.DecidedAt = &now
-			return tx.Save(&topup).Error
-		})
-		if err != nil {
-			return database.TopUpRequest{}, err
+		topup.AdminReason = cleanReason
+		topup.DecidedAt = &now
+		if status == "approved" {
+			return creditTopupInTx(tx, &topup)
 		}
+		topup.Status = "rejected"
+		return tx.Save(&topup).Error
+	})
+	if err != nil {
+		return database.TopUpRequest{}, err
+	}
 
+	if status == "approved" {
 		database.DB.Create(&database.Notification{
 			UserID:  topup.UserID,
 			Title:   "Top up disetujui",
-			Message: fmt.Sprintf("Top up Rp %d telah disetujui. %s", topup.Amount, topup.AdminReason),
+			Message: fmt.Sprintf("Top up Rp %d telah disetujui.%s %s", topup.CreditAmount(), topupBonusNote(topup), topup.AdminReason),
 		})
 		return topup, nil
 	}
 
-	topup.Status = "rejected"
-	topup.AdminReason = cleanReason
-	topup.DecidedAt = &now
-	if err := database.DB.Save(&topup).Error; err != nil {
-		return database.TopUpRequest{}, err
-	}
 	database.DB.Create(&database.Notification{
 		UserID:  topup.UserID,
 		Title:   "Top up ditolak",
@@ -2051,6 +2128,37 @@ func applyTopupDecision(id uint, status string, reason string) (database.TopUpRe
 	return topup, nil
 }
 
+// creditTopupInTx adds topup.CreditAmount() to the user's balance, records the
+// transaction, credits the promo bonus and marks the top up approved. The
+// caller must hold the row lock.
+func creditTopupInTx(tx *gorm.DB, topup *database.TopUpRequest) error {
+	res := tx.Model(&database.User{}).Where("id = ?", topup.UserID).
+		Update("balance", gorm.Expr("balance + ?", topup.CreditAmount()))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	trx := database.Transaction{
+		UserID:      topup.UserID,
+		Amount:      topup.CreditAmount(),
+		Type:        "topup",
+		Description: fmt.Sprintf("Top Up (%s)", topup.PaymentMethod),
+		TopUpID:     topup.ID,
+	}
+	if err := createInvoicedTransaction(tx, &trx); err != nil {
+		return err
+	}
+	if err := creditTopupBonusInTx(tx, topup); err != nil {
+		return err
+	}
+
+	topup.Status = "approved"
+	return tx.Save(topup).Error
+}
+
 func parseTelegramAdminChatIDs() map[int64]struct{} {
 	ids := make(map[int64]struct{})
 	rawSingle := strings.TrimSpace(os.Getenv("TELEGRAM_ADMIN_CHAT_ID"))
@@ -2132,12 +2240,13 @@ func sendTelegramPendingTopupWithActions(topup database.TopUpRequest, paidAt tim
 		return nil
 	}
 	text := fmt.Sprintf(
-		"✅ Konfirmasi TopUp (PENDING)\n\nID: %d\nSerial: %s\nUser: %s (user_id=%d)\nNominal: Rp %d\nMetode: %s\nTujuan: %s\nPaidAt: %s\n\nPilih aksi:",
+		"✅ Konfirmasi TopUp (PENDING)\n\nID: %d\nSerial: %s\nUser: %s (user_id=%d)\nNominal: Rp %d\nTotal transfer: Rp %d\nMetode: %s\nTujuan: %s\nPaidAt: %s\n\nPilih aksi:",
 		topup.ID,
 		topup.Serial,
 		topup.Username,
 		topup.UserID,
 		topup.Amount,
+		topup.PayableAmount(),
 		topup.PaymentMethod,
 		topup.PaymentAccount,
 		paidAt.Format(time.RFC3339),
@@ -2150,7 +2259,21 @@ func sendTelegramPendingTopupWithActions(topup database.TopUpRequest, paidAt tim
 			},
 		},
 	}
+	if topup.Bonus > 0 {
+		text = strings.Replace(text, "\nMetode:", fmt.Sprintf("\nBonus promo: Rp %d\nMetode:", topup.Bonus), 1)
+	}
+	if topup.ProofImage != "" {
+		text = strings.Replace(text, "\n\nPilih aksi:", "\nBukti transfer: terlampir\n\nPilih aksi:", 1)
+	}
 	for chatID := range telegramAdminChatIDs {
+		if topup.ProofImage != "" {
+			// Photo captions keep the buttons; fall back to text if the upload fails.
+			err := telegramSendPhoto(chatID, topupProofPath(topup.ProofImage), text, replyMarkup)
+			if err == nil {
+				continue
+			}
+			log.Printf("telegram pending topup photo failed for chat %d: %v", chatID, err)
+		}
 		if err := telegramPostJSON("sendMessage", map[string]any{
 			"chat_id":                  chatID,
 			"text":                     text,
@@ -2247,7 +2370,7 @@ func handleTelegramUpdate(upd telegramUpdate) {
 	if text == "/start" || text == "/help" {
 		_ = telegramPostJSON("sendMessage", map[string]any{
 			"chat_id": chatID,
-			"text":    "Bot admin aktif. Saat ada top up pending, gunakan tombol ✅ ACC atau ❌ Reject dari notifikasi.",
+			"text":    "Bot admin aktif. Saat ada top up pending, gunakan tombol ✅ ACC atau ❌ Reject dari notifikasi. Request host premium manual bisa diklaim atau ditolak dari notifikasinya.",
 		})
 	}
 }
@@ -2267,6 +2390,19 @@ func handleTelegramCallback(cb telegramCallbackQuery) {
 	}
 
 	parts := strings.Split(strings.TrimSpace(cb.Data), ":")
+	if len(parts) == 3 && parts[0] == "premium" {
+		id64, err := strconv.ParseUint(strings.TrimSpace(parts[2]), 10, 64)
+		if err != nil || id64 == 0 {
+			_ = telegramPostJSON("answerCallbackQuery", map[string]any{
+				"callback_query_id": cb.ID,
+				"text":              "ID request tidak valid",
+				"show_alert":        false,
+			})
+			return
+		}
+		handleTelegramPremiumCallback(cb, strings.ToLower(strings.TrimSpace(parts[1])), uint(id64))
+		return
+	}
 	if len(parts) != 3 || parts[0] != "topup" {
 		_ = telegramPostJSON("answerCallbackQuery", map[string]any{
 			"callback_query_id": cb.ID,
@@ -2342,68 +2478,37 @@ func handleTelegramCallback(cb telegramCallbackQuery) {
 }
 
 func handleGetHosts(w http.ResponseWriter, r *http.Request) {
-	var hostSettings []database.HostAvailability
-	database.DB.Order("name asc").Find(&hostSettings)
-
-	hosts := make([]realdebrid.SimplifiedHost, 0, len(hostSettings))
-	for _, hs := range hostSettings {
-		status := "down"
-		if hs.IsAvailable {
-			status = "online"
+	// ?link= checks a pasted link against the supported domains before submission
+	if link := strings.TrimSpace(r.URL.Query().Get("link")); link != "" {
+		host, hs := findHostForLink(link)
+		if host == "" {
+			writeJSONError(w, http.StatusBadRequest, "Link tidak valid", nil)
+			return
 		}
-		hosts = append(hosts, realdebrid.SimplifiedHost{
-			Name:   hs.Name,
-			Status: status,
-		})
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(hosts)
-}
-
-func acquirePremiumAPISlot(ctx context.Context) error {
-	for {
-		select {
-		case premiumAPISemaphore <- struct{}{}:
-			return nil
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(150 * time.Millisecond):
+		resp := map[string]any{
+			"host":      host,
+			"supported": hs != nil,
+			"available": hs != nil && hs.IsAvailable,
 		}
+		switch {
+		case hs == nil:
+			resp["message"] = "Host belum didukung"
+		case !hs.IsAvailable:
+			resp["name"] = hs.Name
+			resp["message"] = "Host sedang tidak tersedia"
+		default:
+			resp["name"] = hs.Name
+			resp["message"] = "Host didukung"
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
 	}
-}
-
-func releasePremiumAPISlot() {
-	select {
-	case <-premiumAPISemaphore:
-	default:
-	}
-}
-
-func mapRealDebridError(err error) (status int, message string) {
-	if err == nil {
-		return http.StatusBadRequest, "Gagal memproses request Real-Debrid"
-	}
-	msg := err.Error()
-	lower := strings.ToLower(msg)
 
-	if strings.Contains(lower, "bad_token") || strings.Contains(lower, "error_code\": 8") {
-		return http.StatusUnauthorized, "REALDEBRID_API_KEY tidak valid. Silakan ganti token dari halaman apitoken."
-	}
-	if strings.Contains(lower, "error_code\": 34") || strings.Contains(lower, "too many requests") {
-		return http.StatusTooManyRequests, "Terlalu banyak request ke Real-Debrid. Coba lagi sebentar."
-	}
-	if strings.Contains(lower, "error_code\": 22") {
-		return http.StatusForbidden, "IP address tidak diizinkan oleh Real-Debrid untuk token ini."
-	}
-	if strings.Contains(lower, "error_code\": 16") {
-		return http.StatusBadRequest, "Host/link belum didukung oleh Real-Debrid."
-	}
-	if strings.Contains(lower, "error_code\": 17") || strings.Contains(lower, "error_code\": 19") {
-		return http.StatusServiceUnavailable, "Host sedang maintenance / sementara tidak tersedia."
-	}
+	var hostSettings []database.HostAvailability
+	database.DB.Order("name asc").Find(&hostSettings)
 
-	return http.StatusBadRequest, "Gagal memproses link host premium"
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summarizeHosts(hostSettings))
 }
 
 type voucherApplyResult struct {
@@ -2450,24 +2555,24 @@ func applyVoucherInTx(tx *gorm.DB, rawCode string, serviceType string, basePrice
 	var v database.Voucher
 	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("UPPER(code) = ?", code).First(&v).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("voucher_not_found")
+			return nil, errVoucherNotFound
 		}
 		return nil, err
 	}
 
 	if !v.IsActive {
-		return nil, fmt.Errorf("voucher_inactive")
+		return nil, errVoucherInactive
 	}
 	appliesTo := strings.ToLower(strings.TrimSpace(v.AppliesTo))
 	if appliesTo != "" && appliesTo != "all" && appliesTo != strings.ToLower(serviceType) {
-		return nil, fmt.Errorf("voucher_not_applicable")
+		return nil, errVoucherNotApplicable
 	}
 	now := time.Now()
 	if v.StartsAt != nil && now.Before(*v.StartsAt) {
-		return nil, fmt.Errorf("voucher_not_started")
+		return nil, errVoucherNotStarted
 	}
 	if v.EndsAt != nil && now.After(*v.EndsAt) {
-		return nil, fmt.Errorf("voucher_expired")
+		return nil, errVoucherExpired
 	}
 
 	usageScope := strings.ToLower(strings.TrimSpace(v.UsageScope))
@@ -2484,16 +2589,16 @@ func applyVoucherInTx(tx *gorm.DB, rawCode string, serviceType string, basePrice
 				return nil, err
 			}
 			if int(userUsageCount) >= v.UsageLimit {
-				return nil, fmt.Errorf("voucher_limit_reached")
+				return nil, errVoucherLimitReached
 			}
 		} else {
 			if v.UsedCount >= v.UsageLimit {
-				return nil, fmt.Errorf("voucher_limit_reached")
+				return nil, errVoucherLimitReached
 			}
 		}
 	}
 	if v.MinOrderAmount > 0 && basePrice < v.MinOrderAmount {
-		return nil, fmt.Errorf("voucher_min_order")
+		return nil, errVoucherMinOrder
 	}
 
 	discount := computeVoucherDiscount(v, basePrice)
@@ -2518,9 +2623,25 @@ func applyVoucherInTx(tx *gorm.DB, rawCode string, serviceType string, basePrice
 	return &voucherApplyResult{Code: v.Code, Discount: discount, Final: finalPrice}, nil
 }
 
-func handlePremiumRequest(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		session := auth.GetSessionFromRequest(r)
+func handlePremiumRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		session := auth.GetSessionFromRequest(r)
+
+		if idRaw := strings.TrimSpace(r.URL.Query().Get("id")); idRaw != "" {
+			id, err := strconv.Atoi(idRaw)
+			if err != nil || id <= 0 {
+				writeJSONError(w, http.StatusBadRequest, "id tidak valid", nil)
+				return
+			}
+			var job database.PremiumRequest
+			if err := database.DB.Where("id = ? AND user_id = ?", id, session.UserID).First(&job).Error; err != nil {
+				writeJSONError(w, http.StatusNotFound, "Request tidak ditemukan", nil)
+				return
+			}
+			writeJSON(w, http.StatusOK, premiumJobResponse(job, nil))
+			return
+		}
+
 		page := 1
 		if raw := strings.TrimSpace(r.URL.Query().Get("page")); raw != "" {
 			if v, err := strconv.Atoi(raw); err == nil && v > 0 {
@@ -2571,19 +2692,20 @@ func handlePremiumRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.Method == http.MethodPatch {
+		handlePremiumLinkRefresh(w, r)
+		return
+	}
+
 	if r.Method == http.MethodDelete {
 		session := auth.GetSessionFromRequest(r)
 		idRaw := strings.TrimSpace(r.URL.Query().Get("id"))
 		allRaw := strings.TrimSpace(r.URL.Query().Get("all"))
 
 		if allRaw == "1" || strings.EqualFold(allRaw, "true") {
-			if err := database.DB.Where("user_id = ?", session.UserID).Delete(&database.PremiumRequest{}).Error; err != nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(map[string]any{
-					"message": "Gagal menghapus riwayat host premium",
-					"error":   err.Error(),
-				})
+			// Jobs still holding a reservation stay until the queue settles them.
+			if err := database.DB.Where("user_id = ?", session.UserID).Where(premiumJobSettled).Delete(&database.PremiumRequest{}).Error; err != nil {
+				writeJSONError(w, http.StatusInternalServerError, "Gagal menghapus riwayat host premium", err)
 				return
 			}
 
@@ -2596,26 +2718,23 @@ func handlePremiumRequest(w http.ResponseWriter, r *http.Request) {
 
 		id, err := strconv.Atoi(idRaw)
 		if err != nil || id <= 0 {
-			http.Error(w, "id atau all wajib diisi", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "id atau all wajib diisi", nil)
+			return
+		}
+
+		var existing database.PremiumRequest
+		if err := database.DB.Where("id = ? AND user_id = ?", id, session.UserID).First(&existing).Error; err == nil && (existing.ReservedAmount > 0 || existing.QuotaGB > 0 && (existing.Status == "pending" || existing.Status == "processing")) {
+			writeJSONError(w, http.StatusConflict, "Request masih diproses, belum bisa dihapus", nil)
 			return
 		}
 
-		res := database.DB.Where("id = ? AND user_id = ?", id, session.UserID).Delete(&database.PremiumRequest{})
+		res := database.DB.Where("id = ? AND user_id = ?", id, session.UserID).Where(premiumJobSettled).Delete(&database.PremiumRequest{})
 		if res.Error != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]any{
-				"message": "Gagal menghapus item riwayat",
-				"error":   res.Error.Error(),
-			})
+			writeJSONError(w, http.StatusInternalServerError, "Gagal menghapus item riwayat", res.Error)
 			return
 		}
 		if res.RowsAffected == 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(map[string]any{
-				"message": "Data riwayat tidak ditemukan",
-			})
+			writeJSONError(w, http.StatusNotFound, "Data riwayat tidak ditemukan", nil)
 			return
 		}
 
@@ -2627,7 +2746,7 @@ func handlePremiumRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
@@ -2639,7 +2758,7 @@ func handlePremiumRequest(w http.ResponseWriter, r *http.Request) {
 		EstimatedSizeGB float64 `json:"estimated_size_gb"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 		return
 	}
 	req.URL = strings.TrimSpace(req.URL)
@@ -2648,49 +2767,43 @@ func handlePremiumRequest(w http.ResponseWriter, r *http.Request) {
 		req.EstimatedSizeGB = 0
 	}
 	if req.URL == "" {
-		http.Error(w, "URL wajib diisi", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "URL wajib diisi", nil)
 		return
 	}
 
-	if strings.TrimSpace(rdClient.APIKey) != "" {
-		if err := acquirePremiumAPISlot(r.Context()); err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusRequestTimeout)
-			json.NewEncoder(w).Encode(map[string]any{
-				"message": "Request dibatalkan sebelum diproses",
-			})
+	// AvailableFor is false when the account health check disabled every
+	// provider (expired/exhausted) or none has traffic left for this host;
+	// the request then goes to manual mode.
+	if debridProviders.AvailableFor(req.URL) {
+		if err := premiumQueue.waitCheckRate(r.Context()); err != nil {
+			writeJSONError(w, http.StatusRequestTimeout, "Request dibatalkan sebelum diproses", nil)
 			return
 		}
-		defer releasePremiumAPISlot()
 
-		checkInfo, err := rdClient.CheckLink(req.URL)
-		if err != nil {
-			status, friendly := mapRealDebridError(err)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(status)
-			json.NewEncoder(w).Encode(map[string]any{
-				"message": friendly,
-				"error":   err.Error(),
-			})
+		// The first provider that supports the host wins; it is recorded on the
+		// request so the queue unrestricts with the same provider.
+		var checkInfo debrid.LinkInfo
+		provider, err := debridProviders.Do(req.URL, "", func(p debrid.Provider) error {
+			info, cErr := p.CheckLink(req.URL)
+			if cErr == nil && !info.Supported {
+				return debrid.ErrUnsupported
+			}
+			checkInfo = info
+			return cErr
+		})
+		if err != nil && debrid.KindOf(err) == debrid.KindUnsupported {
+			writeJSONError(w, http.StatusBadRequest, "Host/link belum didukung oleh provider debrid", err)
 			return
 		}
-		if !checkInfo.Supported {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]any{
-				"message": "Host/link belum didukung oleh Real-Debrid",
-			})
+		if err != nil {
+			status, friendly := mapDebridError(err)
+			writeJSONError(w, status, friendly, err)
 			return
 		}
 
 		priceCfg, err := database.GetPricing("premium")
 		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusServiceUnavailable)
-			json.NewEncoder(w).Encode(map[string]any{
-				"message": "Pricing premium belum tersedia",
-				"error":   err.Error(),
-			})
+			writeJSONError(w, http.StatusServiceUnavailable, "Pricing premium belum tersedia", err)
 			return
 		}
 
@@ -2708,18 +2821,27 @@ func handlePremiumRequest(w http.ResponseWriter, r *http.Request) {
 			chargedGB = priceCfg.UnitSizeGB
 		}
 
-		var unrestricted realdebrid.UnrestrictedLinkResult
-		streamURL := ""
-		sizeGB := "0 GB"
-
-		var savedReq database.PremiumRequest
+		// Reserve the price and enqueue; Real-Debrid is called by the queue
+		// workers, outside of this transaction and its row lock.
+		var job database.PremiumRequest
 		voucherApplied := ""
 		voucherDiscount := int64(0)
+		quotaGB := 0
+		basePrice := price
 		finalPrice := price
 		var currentBalance int64
 		txErr := database.DB.Transaction(func(tx *gorm.DB) error {
-			if strings.TrimSpace(req.Voucher) != "" {
-				voucherResult, vErr := applyVoucherInTx(tx, req.Voucher, "premium", price, session.UserID)
+			// The quota is reserved with the balance and settled by the queue.
+			subscription, covered, err := takeQuotaInTx(tx, session.UserID, "premium", chargedGB)
+			if err != nil {
+				return err
+			}
+			quotaGB = covered
+			basePrice = quotaRemainder(price, chargedGB, covered)
+			finalPrice = basePrice
+
+			if strings.TrimSpace(req.Voucher) != "" && basePrice > 0 {
+				voucherResult, vErr := applyVoucherInTx(tx, req.Voucher, "premium", basePrice, session.UserID)
 				if vErr != nil {
 					return vErr
 				}
@@ -2734,7 +2856,7 @@ func handlePremiumRequest(w http.ResponseWriter, r *http.Request) {
 			}
 			if user.Balance < finalPrice {
 				currentBalance = user.Balance
-				return fmt.Errorf("insufficient_balance")
+				return errInsufficientBalance
 			}
 
 			user.Balance -= finalPrice
@@ -2743,136 +2865,78 @@ func handlePremiumRequest(w http.ResponseWriter, r *http.Request) {
 				return err
 			}
 
-			unrestricted, err = rdClient.UnrestrictLink(req.URL)
-			if err != nil {
-				return fmt.Errorf("unrestrict_failed: %w", err)
-			}
-
-			fileSize = unrestricted.Filesize
-			if fileSize <= 0 {
-				fileSize = checkInfo.Filesize
-			}
-			if fileSize <= 0 && req.EstimatedSizeGB > 0 {
-				fileSize = int64(req.EstimatedSizeGB * 1024 * 1024 * 1024)
+			job = database.PremiumRequest{
+				UserID:          session.UserID,
+				URL:             req.URL,
+				Filename:        checkInfo.Filename,
+				Host:            checkInfo.Host,
+				SizeBytes:       fileSize,
+				Price:           finalPrice,
+				Status:          "pending",
+				Mode:            "automatic",
+				Provider:        provider.Name(),
+				ReservedAmount:  finalPrice,
+				QuotedPrice:     finalPrice,
+				OriginalPrice:   basePrice,
+				VoucherCode:     voucherApplied,
+				VoucherDiscount: voucherDiscount,
+				ChargedGB:       chargedGB,
+				QuotaGB:         quotaGB,
 			}
-			if fileSize > 0 {
-				sizeGB = fmt.Sprintf("%.2f GB", float64(fileSize)/float64(1024*1024*1024))
+			if subscription != nil {
+				job.SubscriptionID = subscription.ID
+				job.Priority = subscription.Priority
 			}
-
-			if unrestricted.ID != "" {
-				if s, streamErr := rdClient.GetStreamingLink(unrestricted.ID); streamErr == nil {
-					streamURL = strings.TrimSpace(s)
-				} else {
-					log.Printf("realdebrid streaming link skipped: %v", streamErr)
-				}
-			}
-
-			savedReq = database.PremiumRequest{
-				UserID:    session.UserID,
-				URL:       req.URL,
-				Filename:  unrestricted.Filename,
-				Host:      unrestricted.Host,
-				SizeBytes: fileSize,
-				Price:     finalPrice,
-				Status:    "done",
-				ResultURL: unrestricted.Download,
-				StreamURL: streamURL,
+			if err := tx.Create(&job).Error; err != nil {
+				return err
 			}
-			if err := tx.Create(&savedReq).Error; err != nil {
+			if err := recordQuotaUsageInTx(tx, subscription, "premium", quotaGB, firstNonEmpty(checkInfo.Filename, req.URL), job.ID); err != nil {
 				return err
 			}
 
-			if err := tx.Create(&database.Transaction{
-				UserID:      session.UserID,
-				Amount:      -finalPrice,
-				Type:        "download",
-				Description: func() string {
-					if voucherApplied != "" && voucherDiscount > 0 {
-						return fmt.Sprintf("Premium Host: %s (%d GB) - Rp %d (Voucher %s -Rp %d)", unrestricted.Filename, chargedGB, finalPrice, voucherApplied, voucherDiscount)
-					}
-					return fmt.Sprintf("Premium Host: %s (%d GB) - Rp %d", unrestricted.Filename, chargedGB, finalPrice)
-				}(),
-			}).Error; err != nil {
-				return err
+			// The reservation is billed now; the queue refunds it or settles
+			// the difference to the final size.
+			if basePrice > 0 {
+				name := firstNonEmpty(checkInfo.Filename, req.URL)
+				if err := createInvoicedTransaction(tx, &database.Transaction{
+					UserID:      session.UserID,
+					Amount:      -finalPrice,
+					GrossAmount: basePrice,
+					Discount:    voucherDiscount,
+					VoucherCode: voucherApplied,
+					Type:        "download",
+					Description: func() string {
+						if voucherApplied != "" && voucherDiscount > 0 {
+							return fmt.Sprintf("Premium Host: %s (%d GB%s) - Rp %d (Voucher %s -Rp %d)", name, chargedGB, quotaNote(quotaGB), finalPrice, voucherApplied, voucherDiscount)
+						}
+						return fmt.Sprintf("Premium Host: %s (%d GB%s) - Rp %d", name, chargedGB, quotaNote(quotaGB), finalPrice)
+					}(),
+				}); err != nil {
+					return err
+				}
 			}
 
-			if err := tx.Create(&database.UserUsage{
+			return tx.Create(&database.UserUsage{
 				UserID:      session.UserID,
 				ServiceType: "premium",
 				Source:      req.URL,
-			}).Error; err != nil {
-				return err
-			}
-
-			notifMsg := fmt.Sprintf("Link premium siap diunduh. %s (%s). Biaya: Rp %d.", unrestricted.Filename, sizeGB, finalPrice)
-			if voucherApplied != "" && voucherDiscount > 0 {
-				notifMsg += fmt.Sprintf(" Voucher %s dipakai (-Rp %d).", voucherApplied, voucherDiscount)
-			}
-			if streamURL != "" {
-				notifMsg += " Tersedia juga link streaming."
-			}
-			if err := tx.Create(&database.Notification{
-				UserID:  session.UserID,
-				Title:   "Link premium siap",
-				Message: notifMsg,
-			}).Error; err != nil {
-				return err
-			}
-
-			return nil
+			}).Error
 		})
 		if txErr != nil {
-			errLower := strings.ToLower(txErr.Error())
-			if strings.Contains(errLower, "unrestrict_failed:") {
-				errMsg := txErr.Error()
-				if idx := strings.Index(errMsg, ":"); idx >= 0 && idx+1 < len(errMsg) {
-					errMsg = strings.TrimSpace(errMsg[idx+1:])
-				}
-				status, friendly := mapRealDebridError(errors.New(errMsg))
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(status)
-				json.NewEncoder(w).Encode(map[string]any{
-					"message": friendly,
-					"error":   errMsg,
-				})
-				return
-			}
-			if strings.Contains(errLower, "voucher_") {
-				friendly := "Voucher tidak valid"
-				switch {
-				case strings.Contains(errLower, "voucher_not_found"):
-					friendly = "Kode voucher tidak ditemukan"
-				case strings.Contains(errLower, "voucher_inactive"):
-					friendly = "Voucher sedang tidak aktif"
-				case strings.Contains(errLower, "voucher_not_applicable"):
-					friendly = "Voucher tidak berlaku untuk layanan ini"
-				case strings.Contains(errLower, "voucher_not_started"):
-					friendly = "Voucher belum mulai berlaku"
-				case strings.Contains(errLower, "voucher_expired"):
-					friendly = "Voucher sudah kedaluwarsa"
-				case strings.Contains(errLower, "voucher_limit_reached"):
-					friendly = "Kuota voucher sudah habis"
-				case strings.Contains(errLower, "voucher_min_order"):
-					friendly = "Nominal belum memenuhi syarat minimal voucher"
-				}
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusBadRequest)
-				json.NewEncoder(w).Encode(map[string]any{
-					"message": friendly,
-					"error":   txErr.Error(),
-				})
+			if isVoucherError(txErr) {
+				writeJSONError(w, http.StatusBadRequest, voucherErrorMessage(txErr), txErr)
 				return
 			}
 
-			if strings.Contains(strings.ToLower(txErr.Error()), "insufficient_balance") {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusPaymentRequired)
-				json.NewEncoder(w).Encode(map[string]any{
+			if errors.Is(txErr, errInsufficientBalance) {
+				writeJSON(w, http.StatusPaymentRequired, map[string]any{
+					"code":            "insufficient_balance",
 					"message":         "Saldo tidak mencukupi untuk URL premium ini",
 					"required_price":  finalPrice,
 					"original_price":  price,
 					"discount_amount": voucherDiscount,
 					"voucher_code":    voucherApplied,
+					"quota_gb":        quotaGB,
 					"required_units":  chargedUnits,
 					"required_gb":     chargedGB,
 					"current_balance": currentBalance,
@@ -2880,35 +2944,20 @@ func handlePremiumRequest(w http.ResponseWriter, r *http.Request) {
 				})
 				return
 			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]any{
-				"message": "Gagal menyimpan transaksi premium",
-				"error":   txErr.Error(),
-			})
+			writeJSONError(w, http.StatusInternalServerError, "Gagal menyimpan transaksi premium", txErr)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]any{
-			"message":       "Link premium valid dan siap diunduh",
-			"id":            savedReq.ID,
-			"mode":          "automatic",
-			"filename":      unrestricted.Filename,
-			"host":          unrestricted.Host,
-			"size_bytes":    fileSize,
-			"size_gb":       sizeGB,
-			"price":         finalPrice,
-			"original_price": price,
-			"discount_amount": voucherDiscount,
-			"voucher_code":   voucherApplied,
-			"charged_units": chargedUnits,
-			"charged_gb":    chargedGB,
-			"current_balance_after": currentBalance,
-			"download_url":  unrestricted.Download,
-			"stream_url":    streamURL,
-			"status":        "done",
-		})
+		premiumQueue.notify()
+
+		resp := premiumJobResponse(job, &currentBalance)
+		resp["charged_units"] = chargedUnits
+		if checkInfo.Filesize <= 0 {
+			// The check did not report a size; the queue re-prices from the final size.
+			resp["price_is_estimate"] = true
+			resp["message"] = "Link premium masuk antrian. Ukuran file belum diketahui, biaya akhir disesuaikan dengan ukuran sebenarnya."
+		}
+		writeJSON(w, http.StatusAccepted, resp)
 		return
 	}
 
@@ -2916,11 +2965,13 @@ func handlePremiumRequest(w http.ResponseWriter, r *http.Request) {
 		UserID: session.UserID,
 		URL:    req.URL,
 		Status: "pending",
+		Mode:   "manual",
 	}
 	if err := database.DB.Create(&premiumReq).Error; err != nil {
-		http.Error(w, "Failed to create request", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to create request", nil)
 		return
 	}
+	_ = sendTelegramPendingPremiumWithActions(premiumReq, firstNonEmpty(session.Name, session.Email))
 	_ = database.DB.Create(&database.UserUsage{
 		UserID:      session.UserID,
 		ServiceType: "premium",
@@ -3004,13 +3055,13 @@ func handleListFiles(w http.ResponseWriter, r *http.Request) {
 func handleGetDownloadLink(w http.ResponseWriter, r *http.Request) {
 	fileID := r.URL.Query().Get("file_id")
 	if fileID == "" {
-		http.Error(w, "file_id is required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "file_id is required", nil)
 		return
 	}
 
 	link, err := globalClient.GetDownloadUrl(fileID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get link: %v", err), http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to get link", err)
 		return
 	}
 
@@ -3073,23 +3124,18 @@ func handleDirectFileDownload(w http.ResponseWriter, r *http.Request) {
 
 func handleFileOps(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
 	fileID := strings.TrimSpace(r.URL.Query().Get("file_id"))
 	if fileID == "" {
-		http.Error(w, "file_id is required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "file_id is required", nil)
 		return
 	}
 
 	if err := globalClient.DeleteFile(fileID); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]any{
-			"message": "Gagal menghapus file",
-			"error":   err.Error(),
-		})
+		writeJSONError(w, http.StatusInternalServerError, "Gagal menghapus file", err)
 		return
 	}
 
@@ -3104,7 +3150,7 @@ func handleAddOfflineTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
@@ -3138,68 +3184,18 @@ func handleAddOfflineTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Add task to user's folder
-	targetFolderID := strings.TrimSpace(user.PikPakFolderID)
-	if targetFolderID == "" {
-		if newFolderID, folderErr := recreateUserPikPakFolder(&user); folderErr == nil {
-			targetFolderID = newFolderID
-		} else {
-			log.Printf("auto-create folder gagal (user_id=%d): %v", user.ID, folderErr)
-		}
-	}
-
-	res, err := globalClient.AddOfflineTaskToFolder(req.URL, targetFolderID)
-	if err != nil && targetFolderID != "" && isInvalidPikPakFolderError(err) {
-		newFolderID, recreateErr := recreateUserPikPakFolder(&user)
-		if recreateErr == nil {
-			targetFolderID = newFolderID
-			res, err = globalClient.AddOfflineTaskToFolder(req.URL, targetFolderID)
-		} else {
-			log.Printf("recreate folder saat add task gagal (user_id=%d): %v", user.ID, recreateErr)
-		}
-	}
+	sub, err := submitTorrent(&user, req.URL)
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "Gagal menambahkan task", err)
 		return
 	}
+	id, name, sizeBytes, isCached, res := sub.ID, sub.Name, sub.SizeBytes, sub.Cached, sub.Raw
 
-	var name, sizeStr, id, phase, progress string
-	var sizeBytes int64
-	var isCached bool
-
-	if task, ok := res["task"].(map[string]any); ok {
-		id, _ = task["id"].(string)
-		name, _ = task["name"].(string)
-		sizeStr, _ = task["file_size"].(string)
-		phase, _ = task["phase"].(string)
-		progress, _ = task["progress"].(string)
-	} else if file, ok := res["file"].(map[string]any); ok {
-		id, _ = file["id"].(string)
-		name, _ = file["name"].(string)
-		sizeStr, _ = file["size"].(string)
-		phase = "PHASE_TYPE_COMPLETE"
-		progress = "100"
-	} else {
-		if n, ok := res["name"].(string); ok {
-			name = n
-		}
-		if i, ok := res["id"].(string); ok {
-			id = i
-		}
-		phase, _ = res["phase"].(string)
-	}
-
-	estimation := "Calculating..."
-	if phase == "PHASE_TYPE_COMPLETE" || progress == "100" {
-		isCached = true
+	estimation := "Not Cached (Downloading by Server)"
+	if isCached {
 		estimation = "Instant (Cached)"
-	} else {
-		isCached = false
-		estimation = "Not Cached (Downloading by Server)"
 	}
 
-	fmt.Sscanf(sizeStr, "%d", &sizeBytes)
-
 	// Get pricing from database
 	pricing, err := database.GetPricing("torrent")
 	var price int64
@@ -3237,11 +3233,26 @@ func handleAddOfflineTask(w http.ResponseWriter, r *http.Request) {
 	sizeGB := float64(sizeBytes) / (1024 * 1024 * 1024)
 	voucherApplied := ""
 	voucherDiscount := int64(0)
+	quotaGB := 0
+	basePrice := price
 	finalPrice := price
 	var currentBalance int64
 	txErr := database.DB.Transaction(func(tx *gorm.DB) error {
-		if strings.TrimSpace(req.Voucher) != "" {
-			voucherResult, vErr := applyVoucherInTx(tx, req.Voucher, "torrent", price, session.UserID)
+		// The subscription quota goes first; the voucher and the balance
+		// only see the part it did not cover.
+		subscription, covered, err := takeQuotaInTx(tx, session.UserID, "torrent", chargedGB)
+		if err != nil {
+			return err
+		}
+		if err := recordQuotaUsageInTx(tx, subscription, "torrent", covered, name, 0); err != nil {
+			return err
+		}
+		quotaGB = covered
+		basePrice = quotaRemainder(price, chargedGB, covered)
+		finalPrice = basePrice
+
+		if strings.TrimSpace(req.Voucher) != "" && basePrice > 0 {
+			voucherResult, vErr := applyVoucherInTx(tx, req.Voucher, "torrent", basePrice, session.UserID)
 			if vErr != nil {
 				return vErr
 			}
@@ -3256,27 +3267,37 @@ func handleAddOfflineTask(w http.ResponseWriter, r *http.Request) {
 		}
 		if user.Balance < finalPrice {
 			currentBalance = user.Balance
-			return fmt.Errorf("insufficient_balance")
+			return errInsufficientBalance
 		}
 
 		user.Balance -= finalPrice
 		currentBalance = user.Balance
-		if err := tx.Model(&database.User{}).Where("id = ?", user.ID).Update("balance", user.Balance).Error; err != nil {
-			return err
-		}
+		// Nothing to bill when the quota covered the whole download.
+		if basePrice > 0 {
+			if err := tx.Model(&database.User{}).Where("id = ?", user.ID).Update("balance", user.Balance).Error; err != nil {
+				return err
+			}
 
-		if err := tx.Create(&database.Transaction{
-			UserID:      session.UserID,
-			Amount:      -finalPrice,
-			Type:        "download",
-			Description: func() string {
-				if voucherApplied != "" && voucherDiscount > 0 {
-					return fmt.Sprintf("Torrent/Magnet: %s (%d GB) - Rp %d (Voucher %s -Rp %d)", name, chargedGB, finalPrice, voucherApplied, voucherDiscount)
-				}
-				return fmt.Sprintf("Torrent/Magnet: %s (%d GB) - Rp %d", name, chargedGB, finalPrice)
-			}(),
-		}).Error; err != nil {
-			return err
+			if err := createInvoicedTransaction(tx, &database.Transaction{
+				UserID:      session.UserID,
+				Amount:      -finalPrice,
+				GrossAmount: basePrice,
+				Discount:    voucherDiscount,
+				VoucherCode: voucherApplied,
+				Type:        "download",
+				Description: func() string {
+					label := "Torrent/Magnet"
+					if sub.Backend == torrentPolicyRealDebrid {
+						label = "Torrent/Magnet (Real-Debrid)"
+					}
+					if voucherApplied != "" && voucherDiscount > 0 {
+						return fmt.Sprintf("%s: %s (%d GB%s) - Rp %d (Voucher %s -Rp %d)", label, name, chargedGB, quotaNote(quotaGB), finalPrice, voucherApplied, voucherDiscount)
+					}
+					return fmt.Sprintf("%s: %s (%d GB%s) - Rp %d", label, name, chargedGB, quotaNote(quotaGB), finalPrice)
+				}(),
+			}); err != nil {
+				return err
+			}
 		}
 
 		if err := tx.Create(&database.UserUsage{
@@ -3287,11 +3308,29 @@ func handleAddOfflineTask(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
+		if sub.Backend == torrentPolicyRealDebrid {
+			if err := tx.Create(&database.DebridTorrent{
+				UserID:    session.UserID,
+				RemoteID:  sub.ID,
+				Hash:      sub.Hash,
+				Magnet:    req.URL,
+				Name:      name,
+				SizeBytes: sizeBytes,
+				Price:     finalPrice,
+				Reason:    sub.Reason,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
 		if err := tx.Create(&database.Notification{
 			UserID:  session.UserID,
 			Title:   "Unduhan torrent diproses",
 			Message: func() string {
 				msg := fmt.Sprintf("Unduhan %s diterima. Biaya: Rp %d.", name, finalPrice)
+				if quotaGB > 0 {
+					msg += fmt.Sprintf(" %d GB dipotong dari kuota paket.", quotaGB)
+				}
 				if voucherApplied != "" && voucherDiscount > 0 {
 					msg += fmt.Sprintf(" Voucher %s dipakai (-Rp %d).", voucherApplied, voucherDiscount)
 				}
@@ -3304,49 +3343,22 @@ func handleAddOfflineTask(w http.ResponseWriter, r *http.Request) {
 		return nil
 	})
 	if txErr != nil {
-		if strings.TrimSpace(id) != "" {
-			if delErr := globalClient.DeleteTasks([]string{id}); delErr != nil {
-				log.Printf("cleanup task gagal (id=%s): %v", id, delErr)
-			}
-		}
+		sub.cleanup()
 
-		errLower := strings.ToLower(txErr.Error())
-		if strings.Contains(errLower, "voucher_") {
-			friendly := "Voucher tidak valid"
-			switch {
-			case strings.Contains(errLower, "voucher_not_found"):
-				friendly = "Kode voucher tidak ditemukan"
-			case strings.Contains(errLower, "voucher_inactive"):
-				friendly = "Voucher sedang tidak aktif"
-			case strings.Contains(errLower, "voucher_not_applicable"):
-				friendly = "Voucher tidak berlaku untuk layanan ini"
-			case strings.Contains(errLower, "voucher_not_started"):
-				friendly = "Voucher belum mulai berlaku"
-			case strings.Contains(errLower, "voucher_expired"):
-				friendly = "Voucher sudah kedaluwarsa"
-			case strings.Contains(errLower, "voucher_limit_reached"):
-				friendly = "Kuota voucher sudah habis"
-			case strings.Contains(errLower, "voucher_min_order"):
-				friendly = "Nominal belum memenuhi syarat minimal voucher"
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]any{
-				"message": friendly,
-				"error":   txErr.Error(),
-			})
+		if isVoucherError(txErr) {
+			writeJSONError(w, http.StatusBadRequest, voucherErrorMessage(txErr), txErr)
 			return
 		}
 
-		if strings.Contains(strings.ToLower(txErr.Error()), "insufficient_balance") {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPaymentRequired)
-			json.NewEncoder(w).Encode(map[string]any{
+		if errors.Is(txErr, errInsufficientBalance) {
+			writeJSON(w, http.StatusPaymentRequired, map[string]any{
+				"code":            "insufficient_balance",
 				"message":         "Saldo tidak mencukupi untuk torrent ini",
 				"required_price":  finalPrice,
 				"original_price":  price,
 				"discount_amount": voucherDiscount,
 				"voucher_code":    voucherApplied,
+				"quota_gb":        quotaGB,
 				"required_units":  chargedUnits,
 				"required_gb":     chargedGB,
 				"current_balance": currentBalance,
@@ -3357,12 +3369,7 @@ func handleAddOfflineTask(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]any{
-			"message": "Gagal menyimpan transaksi torrent",
-			"error":   txErr.Error(),
-		})
+		writeJSONError(w, http.StatusInternalServerError, "Gagal menyimpan transaksi torrent", txErr)
 		return
 	}
 
@@ -3377,9 +3384,11 @@ func handleAddOfflineTask(w http.ResponseWriter, r *http.Request) {
 		"original_price": price,
 		"discount_amount": voucherDiscount,
 		"voucher_code":   voucherApplied,
+		"quota_gb":       quotaGB,
 		"price_display": fmt.Sprintf("Rp %d", finalPrice),
 		"current_balance_after": currentBalance,
 		"cached":        isCached,
+		"backend":       sub.Backend,
 		"estimation":    estimation,
 		"raw":           res,
 	}
@@ -3403,7 +3412,7 @@ func handleGetPricing(w http.ResponseWriter, r *http.Request) {
 
 func handleVoucherPreview(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
@@ -3546,13 +3555,13 @@ func handleVoucherPreview(w http.ResponseWriter, r *http.Request) {
 func handleDeleteTask(w http.ResponseWriter, r *http.Request) {
 	taskID := r.URL.Query().Get("task_id")
 	if taskID == "" {
-		http.Error(w, "task_id is required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "task_id is required", nil)
 		return
 	}
 
 	err := globalClient.DeleteTasks([]string{taskID})
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to delete task: %v", err), http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to delete task", err)
 		return
 	}
 
@@ -3573,7 +3582,7 @@ func sanitizeDownloadName(name string) string {
 func handleFolderManifest(w http.ResponseWriter, r *http.Request) {
 	folderID := r.URL.Query().Get("folder_id")
 	if folderID == "" {
-		http.Error(w, "folder_id is required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "folder_id is required", nil)
 		return
 	}
 
@@ -3586,47 +3595,53 @@ func handleFolderManifest(w http.ResponseWriter, r *http.Request) {
 	if format == "" {
 		format = "json"
 	}
+	if !isValidManifestFormat(format) {
+		writeJSONError(w, http.StatusBadRequest, "invalid format. use "+manifestFormatList(), nil)
+		return
+	}
 
 	files, err := globalClient.WalkFolderManifest(folderID)
+	if errors.Is(err, pikpak.ErrWalkLimitExceeded) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "Folder terlalu besar untuk dibuat manifest. Pilih subfolder.", err)
+		return
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to walk folder: %v", err), http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to walk folder", err)
 		return
 	}
 
-	type ManifestEntry struct {
-		FileID         string    `json:"file_id"`
-		ParentID       string    `json:"parent_id"`
-		Name           string    `json:"name"`
-		RelativePath   string    `json:"relative_path"`
-		FolderPath     string    `json:"folder_path"`
-		Size           string    `json:"size"`
-		SizeStr        string    `json:"size_str"`
-		MimeType       string    `json:"mime_type"`
-		Modified       time.Time `json:"modified_time"`
-		ModifiedStr    string    `json:"modified_str"`
-		WebContentLink string    `json:"web_content_link"`
+	entries := buildManifestEntries(files)
+	safeFolderName := sanitizeDownloadName(folderName)
+
+	snapshotID := storeManifestSnapshot(folderID, entries)
+
+	// Signed manifests are fetched long after generation, so hand out /d/ links
+	// that resolve a fresh PikPak URL instead of the expiring web_content_link.
+	linkVariant := "direct"
+	if signed, ok := signedManifestFromRequest(r); ok {
+		useSignedFileLinks(entries, appBaseURL(r), signed.User.ID, signed.Exp)
+		linkVariant = fmt.Sprintf("signed:%d:%d", signed.User.ID, signed.Exp)
 	}
 
-	entries := make([]ManifestEntry, 0, len(files))
-	for _, f := range files {
-		var sizeBytes int64
-		fmt.Sscanf(f.Size, "%d", &sizeBytes)
-		entries = append(entries, ManifestEntry{
-			FileID:         f.ID,
-			ParentID:       f.ParentID,
-			Name:           f.Name,
-			RelativePath:   f.RelativePath,
-			FolderPath:     f.FolderPath,
-			Size:           f.Size,
-			SizeStr:        pikpak.FormatBytes(sizeBytes),
-			MimeType:       f.MimeType,
-			Modified:       f.Modified,
-			ModifiedStr:    pikpak.FormatTime(f.Modified),
-			WebContentLink: f.WebContentLink,
-		})
+	etag := manifestETag(snapshotID, format, folderName, linkVariant)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Manifest-Snapshot", snapshotID)
+
+	since := strings.TrimSpace(r.URL.Query().Get("since"))
+	if since == "" && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
 
-	safeFolderName := sanitizeDownloadName(folderName)
+	if since != "" {
+		prev, ok := getManifestSnapshot(since, folderID)
+		if !ok {
+			writeJSONError(w, http.StatusGone, "Snapshot tidak ditemukan atau sudah kedaluwarsa. Ambil manifest penuh tanpa since.", nil)
+			return
+		}
+		writeManifestDelta(w, format, folderID, folderName, safeFolderName, snapshotID, since, len(entries), diffManifest(prev, entries))
+		return
+	}
 
 	switch format {
 	case "jsonl", "ndjson":
@@ -3635,39 +3650,43 @@ func handleFolderManifest(w http.ResponseWriter, r *http.Request) {
 		enc := json.NewEncoder(w)
 		for _, entry := range entries {
 			if err := enc.Encode(entry); err != nil {
-				http.Error(w, fmt.Sprintf("Failed to encode manifest: %v", err), http.StatusInternalServerError)
+				writeJSONError(w, http.StatusInternalServerError, "Failed to encode manifest", err)
 				return
 			}
 		}
 		return
 
-	case "aria2", "aria2c":
-		var sb strings.Builder
-		sb.WriteString("# Aria2 input generated by /api/folder/manifest\n")
-		sb.WriteString(fmt.Sprintf("# Folder: %s\n", folderName))
-		sb.WriteString(fmt.Sprintf("# Total files: %d\n", len(entries)))
-		sb.WriteString("# ---------------------------------------------\n\n")
+	case "json":
+		resp := map[string]any{
+			"folder_id":    folderID,
+			"folder_name":  folderName,
+			"generated_at": time.Now().UTC(),
+			"snapshot_id":  snapshotID,
+			"total_files":  len(entries),
+			"items":        entries,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
 
-		for _, entry := range entries {
-			if entry.WebContentLink == "" {
-				continue
-			}
+	writeManifestExport(w, format, folderName, safeFolderName, entries)
+}
 
-			dirPart := path.Dir(entry.RelativePath)
-			if dirPart == "." {
-				dirPart = ""
+// writeManifestDelta answers ?since=<snapshot>. Download manager formats only
+// get the added and modified files, since they cannot express removals.
+func writeManifestDelta(w http.ResponseWriter, format, folderID, folderName, safeFolderName, snapshotID, since string, totalFiles int, delta manifestDelta) {
+	switch format {
+	case "jsonl", "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s_manifest_delta.jsonl\"", safeFolderName))
+		enc := json.NewEncoder(w)
+		for _, change := range delta.changes() {
+			if err := enc.Encode(change); err != nil {
+				writeJSONError(w, http.StatusInternalServerError, "Failed to encode manifest", err)
+				return
 			}
-			downloadDir := filepath.Clean(filepath.Join(safeFolderName, filepath.FromSlash(dirPart)))
-			outName := path.Base(entry.RelativePath)
-
-			sb.WriteString(entry.WebContentLink + "\n")
-			sb.WriteString("  dir=" + downloadDir + "\n")
-			sb.WriteString("  out=" + outName + "\n\n")
 		}
-
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s_aria2.txt\"", safeFolderName))
-		w.Write([]byte(sb.String()))
 		return
 
 	case "json":
@@ -3675,23 +3694,44 @@ func handleFolderManifest(w http.ResponseWriter, r *http.Request) {
 			"folder_id":    folderID,
 			"folder_name":  folderName,
 			"generated_at": time.Now().UTC(),
-			"total_files":  len(entries),
-			"items":        entries,
+			"snapshot_id":  snapshotID,
+			"since":        since,
+			"total_files":  totalFiles,
+			"added":        nonNilEntries(delta.Added),
+			"modified":     nonNilEntries(delta.Modified),
+			"removed":      nonNilEntries(delta.Removed),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
 		return
+	}
 
-	default:
-		http.Error(w, "invalid format. use json|jsonl|aria2", http.StatusBadRequest)
+	writeManifestExport(w, format, folderName, safeFolderName, delta.downloadable())
+}
+
+func writeManifestExport(w http.ResponseWriter, format, folderName, safeFolderName string, entries []ManifestEntry) {
+	exporter := manifestExporters[format]
+	body, err := exporter.render(folderName, safeFolderName, entries)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to encode manifest", err)
 		return
 	}
+	w.Header().Set("Content-Type", exporter.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s%s\"", safeFolderName, exporter.fileSuffix))
+	w.Write(body)
+}
+
+func nonNilEntries(entries []ManifestEntry) []ManifestEntry {
+	if entries == nil {
+		return []ManifestEntry{}
+	}
+	return entries
 }
 
 func handleDownloadFolder(w http.ResponseWriter, r *http.Request) {
 	folderID := r.URL.Query().Get("folder_id")
 	if folderID == "" {
-		http.Error(w, "folder_id is required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "folder_id is required", nil)
 		return
 	}
 
@@ -3702,8 +3742,12 @@ func handleDownloadFolder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	files, err := globalClient.WalkFolderManifest(folderID)
+	if errors.Is(err, pikpak.ErrWalkLimitExceeded) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "Folder terlalu besar untuk dibuat manifest. Pilih subfolder.", err)
+		return
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to walk folder: %v", err), http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to walk folder", err)
 		return
 	}
 
@@ -3797,12 +3841,12 @@ func handleAdminUsers(w http.ResponseWriter, r *http.Request) {
 			Identifier string `json:"identifier"` // email OR username(before @)
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 		identifier := strings.TrimSpace(req.Identifier)
 		if identifier == "" {
-			http.Error(w, "identifier is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "identifier is required", nil)
 			return
 		}
 
@@ -3812,13 +3856,13 @@ func handleAdminUsers(w http.ResponseWriter, r *http.Request) {
 			err = database.DB.Where("LOWER(email) LIKE ?", strings.ToLower(identifier)+"@%").First(&user).Error
 		}
 		if err != nil {
-			http.Error(w, "User tidak ditemukan", http.StatusNotFound)
+			writeJSONError(w, http.StatusNotFound, "User tidak ditemukan", nil)
 			return
 		}
 
 		if user.Role != "admin" {
 			if err := database.DB.Model(&database.User{}).Where("id = ?", user.ID).Update("role", "admin").Error; err != nil {
-				http.Error(w, "Failed to promote user", http.StatusInternalServerError)
+				writeJSONError(w, http.StatusInternalServerError, "Failed to promote user", nil)
 				return
 			}
 			user.Role = "admin"
@@ -3835,18 +3879,18 @@ func handleAdminUsers(w http.ResponseWriter, r *http.Request) {
 			Role     string `json:"role"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 		if req.UserID == 0 {
-			http.Error(w, "user_id is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "user_id is required", nil)
 			return
 		}
 
 		updates := map[string]any{}
 		if req.IsActive != nil {
 			if session != nil && session.UserID == req.UserID && !*req.IsActive {
-				http.Error(w, "Tidak bisa menonaktifkan akun admin sendiri", http.StatusBadRequest)
+				writeJSONError(w, http.StatusBadRequest, "Tidak bisa menonaktifkan akun admin sendiri", nil)
 				return
 			}
 			updates["is_active"] = *req.IsActive
@@ -3854,29 +3898,29 @@ func handleAdminUsers(w http.ResponseWriter, r *http.Request) {
 		if strings.TrimSpace(req.Role) != "" {
 			role := strings.ToLower(strings.TrimSpace(req.Role))
 			if role != "admin" && role != "client" {
-				http.Error(w, "role must be admin/client", http.StatusBadRequest)
+				writeJSONError(w, http.StatusBadRequest, "role must be admin/client", nil)
 				return
 			}
 			if session != nil && session.UserID == req.UserID && role != "admin" {
-				http.Error(w, "Tidak bisa menurunkan role akun sendiri", http.StatusBadRequest)
+				writeJSONError(w, http.StatusBadRequest, "Tidak bisa menurunkan role akun sendiri", nil)
 				return
 			}
 			updates["role"] = role
 		}
 
 		if len(updates) == 0 {
-			http.Error(w, "No changes provided", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "No changes provided", nil)
 			return
 		}
 
 		if err := database.DB.Model(&database.User{}).Where("id = ?", req.UserID).Updates(updates).Error; err != nil {
-			http.Error(w, "Failed to update user", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to update user", nil)
 			return
 		}
 
 		var updated database.User
 		if err := database.DB.First(&updated, req.UserID).Error; err != nil {
-			http.Error(w, "User not found", http.StatusNotFound)
+			writeJSONError(w, http.StatusNotFound, "User not found", nil)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -3884,7 +3928,7 @@ func handleAdminUsers(w http.ResponseWriter, r *http.Request) {
 		return
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 }
@@ -3900,7 +3944,7 @@ func handleAdminPricing(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		var req database.Pricing
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 
@@ -3915,7 +3959,7 @@ func handleAdminPricing(w http.ResponseWriter, r *http.Request) {
 			})
 
 		if result.Error != nil {
-			http.Error(w, "Failed to update pricing", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to update pricing", nil)
 			return
 		}
 
@@ -3924,7 +3968,7 @@ func handleAdminPricing(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 }
 
 func handleAdminVouchers(w http.ResponseWriter, r *http.Request) {
@@ -3932,7 +3976,7 @@ func handleAdminVouchers(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		var vouchers []database.Voucher
 		if err := database.DB.Order("created_at desc").Find(&vouchers).Error; err != nil {
-			http.Error(w, "Failed to fetch vouchers", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to fetch vouchers", nil)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -3942,7 +3986,7 @@ func handleAdminVouchers(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		var req database.Voucher
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 
@@ -3953,38 +3997,38 @@ func handleAdminVouchers(w http.ResponseWriter, r *http.Request) {
 		req.UsageScope = strings.ToLower(strings.TrimSpace(req.UsageScope))
 
 		if req.Code == "" {
-			http.Error(w, "code is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "code is required", nil)
 			return
 		}
 		if req.DiscountType != "percentage" && req.DiscountType != "fixed" {
-			http.Error(w, "discount_type must be percentage/fixed", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "discount_type must be percentage/fixed", nil)
 			return
 		}
 		if req.AppliesTo == "" {
 			req.AppliesTo = "all"
 		}
 		if req.AppliesTo != "all" && req.AppliesTo != "torrent" && req.AppliesTo != "premium" {
-			http.Error(w, "applies_to must be all/torrent/premium", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "applies_to must be all/torrent/premium", nil)
 			return
 		}
 		if req.UsageScope == "" {
 			req.UsageScope = "global"
 		}
 		if req.UsageScope != "global" && req.UsageScope != "per_user" {
-			http.Error(w, "usage_scope must be global/per_user", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "usage_scope must be global/per_user", nil)
 			return
 		}
 		if req.DiscountValue <= 0 {
-			http.Error(w, "discount_value must be > 0", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "discount_value must be > 0", nil)
 			return
 		}
 		if req.DiscountType == "percentage" && req.DiscountValue > 100 {
-			http.Error(w, "percentage max is 100", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "percentage max is 100", nil)
 			return
 		}
 
 		if err := database.DB.Create(&req).Error; err != nil {
-			http.Error(w, "Failed to create voucher", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to create voucher", nil)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -3994,11 +4038,11 @@ func handleAdminVouchers(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPatch:
 		var req database.Voucher
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 		if req.ID == 0 {
-			http.Error(w, "id is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
 			return
 		}
 
@@ -4015,7 +4059,7 @@ func handleAdminVouchers(w http.ResponseWriter, r *http.Request) {
 		if strings.TrimSpace(req.DiscountType) != "" {
 			dt := strings.ToLower(strings.TrimSpace(req.DiscountType))
 			if dt != "percentage" && dt != "fixed" {
-				http.Error(w, "discount_type must be percentage/fixed", http.StatusBadRequest)
+				writeJSONError(w, http.StatusBadRequest, "discount_type must be percentage/fixed", nil)
 				return
 			}
 			updates["discount_type"] = dt
@@ -4035,7 +4079,7 @@ func handleAdminVouchers(w http.ResponseWriter, r *http.Request) {
 		if strings.TrimSpace(req.AppliesTo) != "" {
 			ap := strings.ToLower(strings.TrimSpace(req.AppliesTo))
 			if ap != "all" && ap != "torrent" && ap != "premium" {
-				http.Error(w, "applies_to must be all/torrent/premium", http.StatusBadRequest)
+				writeJSONError(w, http.StatusBadRequest, "applies_to must be all/torrent/premium", nil)
 				return
 			}
 			updates["applies_to"] = ap
@@ -4043,7 +4087,7 @@ func handleAdminVouchers(w http.ResponseWriter, r *http.Request) {
 		if strings.TrimSpace(req.UsageScope) != "" {
 			scope := strings.ToLower(strings.TrimSpace(req.UsageScope))
 			if scope != "global" && scope != "per_user" {
-				http.Error(w, "usage_scope must be global/per_user", http.StatusBadRequest)
+				writeJSONError(w, http.StatusBadRequest, "usage_scope must be global/per_user", nil)
 				return
 			}
 			updates["usage_scope"] = scope
@@ -4056,13 +4100,13 @@ func handleAdminVouchers(w http.ResponseWriter, r *http.Request) {
 		updates["ends_at"] = req.EndsAt
 
 		if err := database.DB.Model(&database.Voucher{}).Where("id = ?", req.ID).Updates(updates).Error; err != nil {
-			http.Error(w, "Failed to update voucher", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to update voucher", nil)
 			return
 		}
 
 		var updated database.Voucher
 		if err := database.DB.First(&updated, req.ID).Error; err != nil {
-			http.Error(w, "Voucher not found", http.StatusNotFound)
+			writeJSONError(w, http.StatusNotFound, "Voucher not found", nil)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -4072,11 +4116,11 @@ func handleAdminVouchers(w http.ResponseWriter, r *http.Request) {
 	case http.MethodDelete:
 		id, _ := strconv.Atoi(strings.TrimSpace(r.URL.Query().Get("id")))
 		if id <= 0 {
-			http.Error(w, "id is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
 			return
 		}
 		if err := database.DB.Delete(&database.Voucher{}, id).Error; err != nil {
-			http.Error(w, "Failed to delete voucher", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to delete voucher", nil)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -4084,7 +4128,7 @@ func handleAdminVouchers(w http.ResponseWriter, r *http.Request) {
 		return
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 }
@@ -4199,7 +4243,7 @@ func handleAdminMonitoring(w http.ResponseWriter, r *http.Request) {
 
 func handleAdminUserBalance(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
@@ -4210,13 +4254,13 @@ func handleAdminUserBalance(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 		return
 	}
 
 	var user database.User
 	if err := database.DB.First(&user, req.UserID).Error; err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		writeJSONError(w, http.StatusNotFound, "User not found", nil)
 		return
 	}
 
@@ -4227,28 +4271,24 @@ func handleAdminUserBalance(w http.ResponseWriter, r *http.Request) {
 	} else if req.Amount != nil {
 		newBalance = oldBalance + *req.Amount
 	} else {
-		http.Error(w, "balance is required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "balance is required", nil)
 		return
 	}
 
 	if err := database.DB.Model(&database.User{}).Where("id = ?", req.UserID).Update("balance", newBalance).Error; err != nil {
-		http.Error(w, "Failed to update balance", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to update balance", nil)
 		return
 	}
 
 	delta := newBalance - oldBalance
 	if delta != 0 {
-		transType := "adjustment"
-		description := fmt.Sprintf("Admin set balance: %d -> %d", oldBalance, newBalance)
-		if delta > 0 {
-			transType = "topup"
-		}
-
+		// Corrections in either direction are adjustments, never top ups:
+		// they carry no invoice and do not count as revenue.
 		transaction := database.Transaction{
 			UserID:      req.UserID,
 			Amount:      delta,
-			Type:        transType,
-			Description: description,
+			Type:        "adjustment",
+			Description: fmt.Sprintf("Admin set balance: %d -> %d", oldBalance, newBalance),
 		}
 		database.DB.Create(&transaction)
 	}
@@ -4261,12 +4301,12 @@ func handleAdminHosts(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodDelete {
 		idStr := r.URL.Query().Get("id")
 		if idStr == "" {
-			http.Error(w, "id is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
 			return
 		}
 
 		if err := database.DB.Delete(&database.HostAvailability{}, idStr).Error; err != nil {
-			http.Error(w, "Failed to delete host", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to delete host", nil)
 			return
 		}
 
@@ -4277,17 +4317,19 @@ func handleAdminHosts(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method == http.MethodPatch {
 		var req struct {
-			ID          uint    `json:"id"`
-			Name        *string `json:"name"`
-			IsAvailable *bool   `json:"is_available"`
+			ID            uint    `json:"id"`
+			Name          *string `json:"name"`
+			IsAvailable   *bool   `json:"is_available"`
+			Domains       *string `json:"domains"`
+			AdminOverride *bool   `json:"admin_override"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 		if req.ID == 0 {
-			http.Error(w, "id is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
 			return
 		}
 
@@ -4295,21 +4337,47 @@ func handleAdminHosts(w http.ResponseWriter, r *http.Request) {
 		if req.Name != nil {
 			name := strings.TrimSpace(*req.Name)
 			if name == "" {
-				http.Error(w, "name cannot be empty", http.StatusBadRequest)
+				writeJSONError(w, http.StatusBadRequest, "name cannot be empty", nil)
 				return
 			}
 			updates["name"] = name
 		}
 		if req.IsAvailable != nil {
 			updates["is_available"] = *req.IsAvailable
+			// A manual toggle sticks until the admin hands the host back to the feed
+			if req.AdminOverride == nil {
+				updates["admin_override"] = true
+			}
+		}
+		if req.AdminOverride != nil {
+			updates["admin_override"] = *req.AdminOverride
+		}
+		if req.Domains != nil {
+			updates["domains"] = strings.Join(splitDomains(*req.Domains), ",")
 		}
 		if len(updates) == 0 {
-			http.Error(w, "no updates provided", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "no updates provided", nil)
 			return
 		}
 
-		if err := database.DB.Model(&database.HostAvailability{}).Where("id = ?", req.ID).Updates(updates).Error; err != nil {
-			http.Error(w, "Failed to update host", http.StatusInternalServerError)
+		var before database.HostAvailability
+		if err := database.DB.First(&before, req.ID).Error; err != nil {
+			writeJSONError(w, http.StatusNotFound, "Host not found", nil)
+			return
+		}
+		txErr := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&database.HostAvailability{}).Where("id = ?", req.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+			if req.IsAvailable != nil && *req.IsAvailable != before.IsAvailable {
+				before.IsAvailable = *req.IsAvailable
+				session := auth.GetSessionFromRequest(r)
+				return recordHostHistory(tx, before, "admin", "diubah oleh "+session.Email)
+			}
+			return nil
+		})
+		if txErr != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to update host", nil)
 			return
 		}
 
@@ -4323,24 +4391,32 @@ func handleAdminHosts(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method == http.MethodPost {
 		var req struct {
-			Name        string `json:"name"`
-			IsAvailable bool   `json:"is_available"`
+			Name          string `json:"name"`
+			IsAvailable   bool   `json:"is_available"`
+			Domains       string `json:"domains"`
+			AdminOverride bool   `json:"admin_override"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 
 		req.Name = strings.TrimSpace(req.Name)
 		if req.Name == "" {
-			http.Error(w, "name is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "name is required", nil)
 			return
 		}
 
-		setting := database.HostAvailability{Name: req.Name, IsAvailable: req.IsAvailable}
+		setting := database.HostAvailability{
+			Name:          req.Name,
+			IsAvailable:   req.IsAvailable,
+			Domains:       strings.Join(splitDomains(req.Domains), ","),
+			Source:        "manual",
+			AdminOverride: req.AdminOverride,
+		}
 		if err := database.DB.Create(&setting).Error; err != nil {
-			http.Error(w, "Failed to create host", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to create host", nil)
 			return
 		}
 
@@ -4349,7 +4425,15 @@ func handleAdminHosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// GET - return all admin-input hosts
+	// GET ?history=<id> - availability changes of one host
+	if hostID := strings.TrimSpace(r.URL.Query().Get("history")); hostID != "" {
+		var history []database.HostStatusHistory
+		database.DB.Where("host_id = ?", hostID).Order("id desc").Limit(100).Find(&history)
+		writeJSON(w, http.StatusOK, history)
+		return
+	}
+
+	// GET - return all hosts (admin-input and synced)
 	var result []database.HostAvailability
 	database.DB.Order("name asc").Find(&result)
 
@@ -4361,23 +4445,23 @@ func handleAdminOfficialPosts(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodDelete {
 		idStr := r.URL.Query().Get("id")
 		if idStr == "" {
-			http.Error(w, "id is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
 			return
 		}
 
 		var post database.OfficialPost
 		if err := database.DB.First(&post, idStr).Error; err != nil {
-			http.Error(w, "Post not found", http.StatusNotFound)
+			writeJSONError(w, http.StatusNotFound, "Post not found", nil)
 			return
 		}
 		if strings.EqualFold(strings.TrimSpace(post.Type), "guide_help") {
-			http.Error(w, "Panduan & bantuan tidak bisa dihapus", http.StatusForbidden)
+			writeJSONError(w, http.StatusForbidden, "Panduan & bantuan tidak bisa dihapus", nil)
 			return
 		}
 
 		result := database.DB.Delete(&database.OfficialPost{}, idStr)
 		if result.Error != nil {
-			http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to delete post", nil)
 			return
 		}
 
@@ -4395,12 +4479,12 @@ func handleAdminOfficialPosts(w http.ResponseWriter, r *http.Request) {
 			IsActive *bool   `json:"is_active"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 
 		if req.ID == 0 {
-			http.Error(w, "id is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
 			return
 		}
 
@@ -4408,7 +4492,7 @@ func handleAdminOfficialPosts(w http.ResponseWriter, r *http.Request) {
 		if req.Title != nil {
 			title := strings.TrimSpace(*req.Title)
 			if title == "" {
-				http.Error(w, "title cannot be empty", http.StatusBadRequest)
+				writeJSONError(w, http.StatusBadRequest, "title cannot be empty", nil)
 				return
 			}
 			updates["title"] = title
@@ -4416,7 +4500,7 @@ func handleAdminOfficialPosts(w http.ResponseWriter, r *http.Request) {
 		if req.Content != nil {
 			content := strings.TrimSpace(*req.Content)
 			if content == "" {
-				http.Error(w, "content cannot be empty", http.StatusBadRequest)
+				writeJSONError(w, http.StatusBadRequest, "content cannot be empty", nil)
 				return
 			}
 			updates["content"] = content
@@ -4429,12 +4513,12 @@ func handleAdminOfficialPosts(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if len(updates) == 0 {
-			http.Error(w, "no updates provided", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "no updates provided", nil)
 			return
 		}
 
 		if err := database.DB.Model(&database.OfficialPost{}).Where("id = ?", req.ID).Updates(updates).Error; err != nil {
-			http.Error(w, "Failed to update post", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to update post", nil)
 			return
 		}
 
@@ -4453,7 +4537,7 @@ func handleAdminOfficialPosts(w http.ResponseWriter, r *http.Request) {
 			Type    string `json:"type"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 
@@ -4462,7 +4546,7 @@ func handleAdminOfficialPosts(w http.ResponseWriter, r *http.Request) {
 		req.Type = strings.TrimSpace(req.Type)
 
 		if req.Title == "" || req.Content == "" {
-			http.Error(w, "title and content are required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "title and content are required", nil)
 			return
 		}
 		if req.Type == "" {
@@ -4476,7 +4560,7 @@ func handleAdminOfficialPosts(w http.ResponseWriter, r *http.Request) {
 			Author:  "Admin",
 		}
 		if err := database.DB.Create(&post).Error; err != nil {
-			http.Error(w, "Failed to create post", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to create post", nil)
 			return
 		}
 
@@ -4508,13 +4592,13 @@ func handleOfficialPosts(w http.ResponseWriter, r *http.Request) {
 		// Admin only - create official post
 		session := auth.GetSessionFromRequest(r)
 		if session == nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeJSONError(w, http.StatusUnauthorized, "Unauthorized", nil)
 			return
 		}
 		var user database.User
 		database.DB.First(&user, session.UserID)
 		if user.Role != "admin" {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			writeJSONError(w, http.StatusForbidden, "Forbidden", nil)
 			return
 		}
 
@@ -4524,7 +4608,7 @@ func handleOfficialPosts(w http.ResponseWriter, r *http.Request) {
 			Type    string `json:"type"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 
@@ -4551,10 +4635,10 @@ func handleOfficialPosts(w http.ResponseWriter, r *http.Request) {
 		var post database.OfficialPost
 		if err := database.DB.Where("id = ? AND is_active = ?", idStr, true).First(&post).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
-				http.Error(w, "Post not found", http.StatusNotFound)
+				writeJSONError(w, http.StatusNotFound, "Post not found", nil)
 				return
 			}
-			http.Error(w, "Failed to fetch post", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to fetch post", nil)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -4622,19 +4706,19 @@ func handleAdminBanners(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodDelete {
 		idStr := r.URL.Query().Get("id")
 		if idStr == "" {
-			http.Error(w, "id is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
 			return
 		}
 
 		var banner database.Banner
 		if err := database.DB.First(&banner, idStr).Error; err != nil {
-			http.Error(w, "Banner not found", http.StatusNotFound)
+			writeJSONError(w, http.StatusNotFound, "Banner not found", nil)
 			return
 		}
 		oldImage := banner.Image
 
 		if err := database.DB.Delete(&database.Banner{}, idStr).Error; err != nil {
-			http.Error(w, "Failed to delete banner", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to delete banner", nil)
 			return
 		}
 		removeLocalBannerImageIfAny(oldImage)
@@ -4656,17 +4740,17 @@ func handleAdminBanners(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 		if req.ID == 0 {
-			http.Error(w, "id is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
 			return
 		}
 
 		var currentBanner database.Banner
 		if err := database.DB.First(&currentBanner, req.ID).Error; err != nil {
-			http.Error(w, "Banner not found", http.StatusNotFound)
+			writeJSONError(w, http.StatusNotFound, "Banner not found", nil)
 			return
 		}
 		oldImage := strings.TrimSpace(currentBanner.Image)
@@ -4675,7 +4759,7 @@ func handleAdminBanners(w http.ResponseWriter, r *http.Request) {
 		if req.Title != nil {
 			title := strings.TrimSpace(*req.Title)
 			if title == "" {
-				http.Error(w, "title cannot be empty", http.StatusBadRequest)
+				writeJSONError(w, http.StatusBadRequest, "title cannot be empty", nil)
 				return
 			}
 			updates["title"] = title
@@ -4697,12 +4781,12 @@ func handleAdminBanners(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if len(updates) == 0 {
-			http.Error(w, "no updates provided", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "no updates provided", nil)
 			return
 		}
 
 		if err := database.DB.Model(&database.Banner{}).Where("id = ?", req.ID).Updates(updates).Error; err != nil {
-			http.Error(w, "Failed to update banner", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to update banner", nil)
 			return
 		}
 
@@ -4730,7 +4814,7 @@ func handleAdminBanners(w http.ResponseWriter, r *http.Request) {
 			SortOrder   int    `json:"sort_order"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 
@@ -4740,7 +4824,7 @@ func handleAdminBanners(w http.ResponseWriter, r *http.Request) {
 		req.Color = strings.TrimSpace(req.Color)
 
 		if req.Title == "" {
-			http.Error(w, "title is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "title is required", nil)
 			return
 		}
 
@@ -4758,7 +4842,7 @@ func handleAdminBanners(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if err := database.DB.Create(&banner).Error; err != nil {
-			http.Error(w, "Failed to create banner", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to create banner", nil)
 			return
 		}
 
@@ -4776,10 +4860,14 @@ func handleAdminBanners(w http.ResponseWriter, r *http.Request) {
 }
 
 func validateBannerImage(file multipart.File, header *multipart.FileHeader) (width int, height int, ext string, err error) {
-	const maxSize = 1 * 1024 * 1024 // 1MB
+	return validateImageUpload(file, header, 1*1024*1024) // 1MB
+}
 
+// validateImageUpload checks that an uploaded file is a jpg/png/gif image of
+// at most maxSize bytes and rewinds it for saving.
+func validateImageUpload(file multipart.File, header *multipart.FileHeader, maxSize int64) (width int, height int, ext string, err error) {
 	if header.Size > maxSize {
-		return 0, 0, "", fmt.Errorf("ukuran file melebihi 1MB")
+		return 0, 0, "", fmt.Errorf("ukuran file melebihi %dMB", maxSize/(1024*1024))
 	}
 
 	buffer := make([]byte, 512)
@@ -4818,33 +4906,31 @@ func validateBannerImage(file multipart.File, header *multipart.FileHeader) (wid
 
 func handleAdminBannerImageUpload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
 	if err := r.ParseMultipartForm(2 * 1024 * 1024); err != nil {
-		http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "Invalid multipart form", nil)
 		return
 	}
 
 	file, header, err := r.FormFile("image")
 	if err != nil {
-		http.Error(w, "image file is required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "image file is required", nil)
 		return
 	}
 	defer file.Close()
 
 	width, height, ext, err := validateBannerImage(file, header)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		writeJSONError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
 
 	uploadDir := filepath.Join(".", "uploads", "banners")
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		http.Error(w, "Failed to create upload directory", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to create upload directory", nil)
 		return
 	}
 
@@ -4855,22 +4941,20 @@ func handleAdminBannerImageUpload(w http.ResponseWriter, r *http.Request) {
 
 	outFile, err := os.Create(fullPath)
 	if err != nil {
-		http.Error(w, "Failed to create image file", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to create image file", nil)
 		return
 	}
 	defer outFile.Close()
 
 	written, err := io.Copy(outFile, io.LimitReader(file, 1*1024*1024+1))
 	if err != nil {
-		http.Error(w, "Failed to save image", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to save image", nil)
 		return
 	}
 
 	if written > 1*1024*1024 {
 		os.Remove(fullPath)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "ukuran file melebihi 1MB"})
+		writeJSONError(w, http.StatusBadRequest, "ukuran file melebihi 1MB", nil)
 		return
 	}
 
@@ -4893,7 +4977,7 @@ func handleUserPosts(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodDelete {
 		idStr := r.URL.Query().Get("id")
 		if idStr == "" {
-			http.Error(w, "id is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
 			return
 		}
 
@@ -4910,7 +4994,7 @@ func handleUserPosts(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if result.RowsAffected == 0 {
-			http.Error(w, "Post not found or not yours", http.StatusNotFound)
+			writeJSONError(w, http.StatusNotFound, "Post not found or not yours", nil)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -4923,14 +5007,12 @@ func handleUserPosts(w http.ResponseWriter, r *http.Request) {
 			Content string `json:"content"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 
 		if len(req.Content) == 0 || len(req.Content) > 500 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Konten harus 1-500 karakter"})
+			writeJSONError(w, http.StatusBadRequest, "Konten harus 1-500 karakter", nil)
 			return
 		}
 
@@ -4961,10 +5043,10 @@ func handleUserPosts(w http.ResponseWriter, r *http.Request) {
 		var post database.UserPost
 		if err := database.DB.First(&post, idStr).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
-				http.Error(w, "Post not found", http.StatusNotFound)
+				writeJSONError(w, http.StatusNotFound, "Post not found", nil)
 				return
 			}
-			http.Error(w, "Failed to fetch post", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to fetch post", nil)
 			return
 		}
 
@@ -5032,19 +5114,19 @@ func handleUserPostReplies(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodDelete {
 		idStr := r.URL.Query().Get("id")
 		if idStr == "" {
-			http.Error(w, "id is required", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
 			return
 		}
 
 		replyID64, err := strconv.ParseUint(idStr, 10, 64)
 		if err != nil || replyID64 == 0 {
-			http.Error(w, "invalid id", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "invalid id", nil)
 			return
 		}
 
 		result := database.DB.Where("id = ? AND user_id = ?", uint(replyID64), session.UserID).Delete(&database.UserPostReply{})
 		if result.RowsAffected == 0 {
-			http.Error(w, "Reply not found or not yours", http.StatusNotFound)
+			writeJSONError(w, http.StatusNotFound, "Reply not found or not yours", nil)
 			return
 		}
 
@@ -5059,32 +5141,28 @@ func handleUserPostReplies(w http.ResponseWriter, r *http.Request) {
 			Content string `json:"content"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
 			return
 		}
 
 		req.Content = strings.TrimSpace(req.Content)
 		if req.PostID == 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "post_id wajib"})
+			writeJSONError(w, http.StatusBadRequest, "post_id wajib", nil)
 			return
 		}
 
 		if len(req.Content) == 0 || len(req.Content) > 500 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Konten balasan harus 1-500 karakter"})
+			writeJSONError(w, http.StatusBadRequest, "Konten balasan harus 1-500 karakter", nil)
 			return
 		}
 
 		var post database.UserPost
 		if err := database.DB.First(&post, req.PostID).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
-				http.Error(w, "Post not found", http.StatusNotFound)
+				writeJSONError(w, http.StatusNotFound, "Post not found", nil)
 				return
 			}
-			http.Error(w, "Failed to check post", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to check post", nil)
 			return
 		}
 
@@ -5105,7 +5183,7 @@ func handleUserPostReplies(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if err := database.DB.Create(&reply).Error; err != nil {
-			http.Error(w, "Failed to create reply", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to create reply", nil)
 			return
 		}
 
@@ -5116,13 +5194,13 @@ func handleUserPostReplies(w http.ResponseWriter, r *http.Request) {
 
 	postIDStr := r.URL.Query().Get("post_id")
 	if postIDStr == "" {
-		http.Error(w, "post_id is required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "post_id is required", nil)
 		return
 	}
 
 	postID64, err := strconv.ParseUint(postIDStr, 10, 64)
 	if err != nil || postID64 == 0 {
-		http.Error(w, "invalid post_id", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "invalid post_id", nil)
 		return
 	}
 
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/youming-ai/pikpak-downloader/internal/pikpak"
+)
+
+// ManifestEntry is one file row of a folder manifest. Every export format is
+// rendered from the same list so RelativePath stays consistent across them.
+type ManifestEntry struct {
+	FileID         string    `json:"file_id"`
+	ParentID       string    `json:"parent_id"`
+	Name           string    `json:"name"`
+	RelativePath   string    `json:"relative_path"`
+	FolderPath     string    `json:"folder_path"`
+	Size           string    `json:"size"`
+	SizeStr        string    `json:"size_str"`
+	MimeType       string    `json:"mime_type"`
+	Modified       time.Time `json:"modified_time"`
+	ModifiedStr    string    `json:"modified_str"`
+	WebContentLink string    `json:"web_content_link"`
+	Hash           string    `json:"hash"`         // PikPak GCID, uppercase hex
+	MD5Checksum    string    `json:"md5_checksum"` // empty when PikPak has no MD5 for the file
+}
+
+func buildManifestEntries(files []pikpak.ManifestFile) []ManifestEntry {
+	entries := make([]ManifestEntry, 0, len(files))
+	for _, f := range files {
+		var sizeBytes int64
+		fmt.Sscanf(f.Size, "%d", &sizeBytes)
+		entries = append(entries, ManifestEntry{
+			FileID:         f.ID,
+			ParentID:       f.ParentID,
+			Name:           f.Name,
+			RelativePath:   f.RelativePath,
+			FolderPath:     f.FolderPath,
+			Size:           f.Size,
+			SizeStr:        pikpak.FormatBytes(sizeBytes),
+			MimeType:       f.MimeType,
+			Modified:       f.Modified,
+			ModifiedStr:    pikpak.FormatTime(f.Modified),
+			WebContentLink: f.WebContentLink,
+			Hash:           strings.ToUpper(firstNonEmpty(f.Hash, f.GCID)),
+			MD5Checksum:    strings.ToLower(strings.TrimSpace(f.MD5Checksum)),
+		})
+	}
+	return entries
+}
+
+func (e ManifestEntry) sizeBytes() int64 {
+	var n int64
+	fmt.Sscanf(e.Size, "%d", &n)
+	return n
+}
+
+// localDir returns the directory (slash separated) the entry should be saved
+// into, rooted at the sanitized folder name.
+func (e ManifestEntry) localDir(safeFolderName string) string {
+	dirPart := path.Dir(e.RelativePath)
+	if dirPart == "." {
+		dirPart = ""
+	}
+	return path.Clean(path.Join(safeFolderName, dirPart))
+}
+
+// localPath returns the full slash separated output path of the entry.
+func (e ManifestEntry) localPath(safeFolderName string) string {
+	return path.Join(e.localDir(safeFolderName), path.Base(e.RelativePath))
+}
+
+type manifestExporter struct {
+	contentType string
+	fileSuffix  string
+	render      func(folderName, safeFolderName string, entries []ManifestEntry) ([]byte, error)
+}
+
+var manifestExporters = map[string]manifestExporter{
+	"aria2":    {contentType: "text/plain; charset=utf-8", fileSuffix: "_aria2.txt", render: renderManifestAria2},
+	"aria2c":   {contentType: "text/plain; charset=utf-8", fileSuffix: "_aria2.txt", render: renderManifestAria2},
+	"metalink": {contentType: "application/metalink4+xml", fileSuffix: ".meta4", render: renderManifestMetalink},
+	"meta4":    {contentType: "application/metalink4+xml", fileSuffix: ".meta4", render: renderManifestMetalink},
+	"crawljob": {contentType: "application/json; charset=utf-8", fileSuffix: ".crawljob", render: renderManifestCrawljob},
+	"ef2":      {contentType: "text/plain; charset=utf-8", fileSuffix: ".ef2", render: renderManifestEF2},
+	"idm":      {contentType: "text/plain; charset=utf-8", fileSuffix: ".ef2", render: renderManifestEF2},
+	"curl":     {contentType: "text/plain; charset=utf-8", fileSuffix: "_curl.txt", render: renderManifestCurl},
+	"wget":     {contentType: "text/x-shellscript; charset=utf-8", fileSuffix: "_wget.sh", render: renderManifestWget},
+	"sh":       {contentType: "text/x-shellscript; charset=utf-8", fileSuffix: "_wget.sh", render: renderManifestWget},
+}
+
+func isValidManifestFormat(format string) bool {
+	switch format {
+	case "json", "jsonl", "ndjson":
+		return true
+	}
+	_, ok := manifestExporters[format]
+	return ok
+}
+
+func manifestFormatList() string {
+	formats := []string{"json", "jsonl"}
+	extra := make([]string, 0, len(manifestExporters))
+	for name := range manifestExporters {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	return strings.Join(append(formats, extra...), "|")
+}
+
+// manifestLine makes s safe to write on one line of a line-based export:
+// CR, LF and other control characters become spaces, so a file name or link
+// cannot start a directive of its own.
+func manifestLine(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", " ")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// countManifestLinks counts the entries an export actually lists; entries
+// without a link are skipped by every renderer.
+func countManifestLinks(entries []ManifestEntry) int {
+	n := 0
+	for _, entry := range entries {
+		if entry.WebContentLink != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func renderManifestAria2(folderName, safeFolderName string, entries []ManifestEntry) ([]byte, error) {
+	var sb strings.Builder
+	sb.WriteString("# Aria2 input generated by /api/folder/manifest\n")
+	sb.WriteString(fmt.Sprintf("# Folder: %s\n", manifestLine(folderName)))
+	sb.WriteString(fmt.Sprintf("# Total files: %d\n", countManifestLinks(entries)))
+	sb.WriteString("# ---------------------------------------------\n\n")
+
+	for _, entry := range entries {
+		if entry.WebContentLink == "" {
+			continue
+		}
+		sb.WriteString(manifestLine(entry.WebContentLink) + "\n")
+		sb.WriteString("  dir=" + manifestLine(filepath.FromSlash(entry.localDir(safeFolderName))) + "\n")
+		sb.WriteString("  out=" + manifestLine(path.Base(entry.RelativePath)) + "\n")
+		if entry.MD5Checksum != "" {
+			sb.WriteString("  checksum=md5=" + manifestLine(entry.MD5Checksum) + "\n")
+		}
+		sb.WriteString("\n")
+	}
+	return []byte(sb.String()), nil
+}
+
+// Metalink 4 (RFC 5854) document.
+type metalinkDocument struct {
+	XMLName   xml.Name       `xml:"urn:ietf:params:xml:ns:metalink metalink"`
+	Generator string         `xml:"generator"`
+	Published string         `xml:"published"`
+	Files     []metalinkFile `xml:"file"`
+}
+
+type metalinkFile struct {
+	Name   string         `xml:"name,attr"`
+	Size   int64          `xml:"size,omitempty"`
+	Hashes []metalinkHash `xml:"hash,omitempty"`
+	URLs   []string       `xml:"url"`
+}
+
+type metalinkHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func renderManifestMetalink(folderName, safeFolderName string, entries []ManifestEntry) ([]byte, error) {
+	doc := metalinkDocument{
+		Generator: "azify.page",
+		Published: time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, entry := range entries {
+		if entry.WebContentLink == "" {
+			continue
+		}
+		file := metalinkFile{
+			Name: entry.localPath(safeFolderName),
+			URLs: []string{entry.WebContentLink},
+		}
+		if size := entry.sizeBytes(); size > 0 {
+			file.Size = size
+		}
+		if entry.MD5Checksum != "" {
+			file.Hashes = append(file.Hashes, metalinkHash{Type: "md5", Value: entry.MD5Checksum})
+		}
+		doc.Files = append(doc.Files, file)
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
+
+// crawljobEntry follows the JSON flavour of JDownloader's folderwatch .crawljob files.
+type crawljobEntry struct {
+	Text           string `json:"text"`
+	PackageName    string `json:"packageName"`
+	Filename       string `json:"filename"`
+	DownloadFolder string `json:"downloadFolder"`
+	Enabled        string `json:"enabled"`
+	AutoStart      string `json:"autoStart"`
+	AutoConfirm    string `json:"autoConfirm"`
+	ForcedStart    string `json:"forcedStart"`
+}
+
+func renderManifestCrawljob(folderName, safeFolderName string, entries []ManifestEntry) ([]byte, error) {
+	jobs := make([]crawljobEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.WebContentLink == "" {
+			continue
+		}
+		jobs = append(jobs, crawljobEntry{
+			Text:           entry.WebContentLink,
+			PackageName:    folderName,
+			Filename:       path.Base(entry.RelativePath),
+			DownloadFolder: entry.localDir(safeFolderName),
+			Enabled:        "TRUE",
+			AutoStart:      "TRUE",
+			AutoConfirm:    "TRUE",
+			ForcedStart:    "UNSET",
+		})
+	}
+	return json.MarshalIndent(jobs, "", "  ")
+}
+
+// renderManifestEF2 writes an Internet Download Manager export. IDM has no
+// folder field, so the relative path is kept in the filename using Windows
+// separators.
+func renderManifestEF2(folderName, safeFolderName string, entries []ManifestEntry) ([]byte, error) {
+	var sb strings.Builder
+	for _, entry := range entries {
+		if entry.WebContentLink == "" {
+			continue
+		}
+		sb.WriteString("<\r\n")
+		sb.WriteString(manifestLine(entry.WebContentLink) + "\r\n")
+		sb.WriteString("filename: " + manifestLine(strings.ReplaceAll(entry.localPath(safeFolderName), "/", "\\")) + "\r\n")
+		sb.WriteString(">\r\n")
+	}
+	return []byte(sb.String()), nil
+}
+
+func curlConfigQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(manifestLine(s)) + `"`
+}
+
+func renderManifestCurl(folderName, safeFolderName string, entries []ManifestEntry) ([]byte, error) {
+	var sb strings.Builder
+	sb.WriteString("# curl config generated by /api/folder/manifest\n")
+	sb.WriteString(fmt.Sprintf("# Folder: %s\n", manifestLine(folderName)))
+	sb.WriteString(fmt.Sprintf("# Total files: %d\n", countManifestLinks(entries)))
+	sb.WriteString("# Usage: curl --config <this file>\n\n")
+	sb.WriteString("create-dirs\n")
+	sb.WriteString("location\n")
+	sb.WriteString("fail\n")
+	sb.WriteString("continue-at = \"-\"\n\n")
+
+	for _, entry := range entries {
+		if entry.WebContentLink == "" {
+			continue
+		}
+		sb.WriteString("url = " + curlConfigQuote(entry.WebContentLink) + "\n")
+		sb.WriteString("output = " + curlConfigQuote(entry.localPath(safeFolderName)) + "\n\n")
+	}
+	return []byte(sb.String()), nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func renderManifestWget(folderName, safeFolderName string, entries []ManifestEntry) ([]byte, error) {
+	var sb strings.Builder
+	sb.WriteString("#!/bin/sh\n")
+	sb.WriteString("# wget script generated by /api/folder/manifest\n")
+	sb.WriteString(fmt.Sprintf("# Folder: %s\n", manifestLine(folderName)))
+	sb.WriteString(fmt.Sprintf("# Total files: %d\n\n", countManifestLinks(entries)))
+	sb.WriteString("set -u\n\n")
+	sb.WriteString("fetch() {\n")
+	sb.WriteString("  mkdir -p \"$(dirname \"$2\")\" && wget -c -O \"$2\" \"$1\" || echo \"FAILED: $2\" >&2\n")
+	sb.WriteString("}\n\n")
+
+	for _, entry := range entries {
+		if entry.WebContentLink == "" {
+			continue
+		}
+		sb.WriteString("fetch " + shellQuote(entry.WebContentLink) + " " + shellQuote(entry.localPath(safeFolderName)) + "\n")
+	}
+	return []byte(sb.String()), nil
+}
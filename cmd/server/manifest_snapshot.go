@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultManifestSnapshotTTL = 24 * time.Hour
+	defaultManifestSnapshotMax = 1000
+)
+
+// manifestSnapshot is a link-less copy of a folder manifest, kept in memory so
+// clients can later ask for the delta with ?since=<snapshot id>.
+type manifestSnapshot struct {
+	ID        string
+	FolderID  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Entries   map[string]ManifestEntry // keyed by file id
+}
+
+// manifestChange is a delta row; Change is one of added, modified, removed.
+type manifestChange struct {
+	Change string `json:"change"`
+	ManifestEntry
+}
+
+type manifestDelta struct {
+	Added    []ManifestEntry
+	Modified []ManifestEntry
+	Removed  []ManifestEntry
+}
+
+var (
+	manifestSnapshotsMu sync.Mutex
+	manifestSnapshots   = make(map[string]*manifestSnapshot)
+	manifestSnapshotTTL = defaultManifestSnapshotTTL
+	manifestSnapshotMax = defaultManifestSnapshotMax
+)
+
+func loadManifestSnapshotTTL() time.Duration {
+	return time.Duration(envInt("MANIFEST_SNAPSHOT_TTL_HOURS", int(defaultManifestSnapshotTTL/time.Hour))) * time.Hour
+}
+
+func loadManifestSnapshotMax() int {
+	return max(envInt("MANIFEST_SNAPSHOT_MAX", defaultManifestSnapshotMax), 1)
+}
+
+// entryFingerprint covers everything that makes a client re-download a file.
+func entryFingerprint(e ManifestEntry) string {
+	return strings.Join([]string{
+		e.FileID,
+		e.RelativePath,
+		e.Size,
+		strconv.FormatInt(e.Modified.Unix(), 10),
+		e.Hash,
+		e.MD5Checksum,
+	}, "\x00")
+}
+
+// manifestSnapshotID is content addressed: an unchanged folder yields the same
+// id, which doubles as the manifest ETag.
+func manifestSnapshotID(folderID string, entries []ManifestEntry) string {
+	prints := make([]string, 0, len(entries))
+	for _, e := range entries {
+		prints = append(prints, entryFingerprint(e))
+	}
+	sort.Strings(prints)
+
+	h := sha256.New()
+	h.Write([]byte(folderID))
+	for _, p := range prints {
+		h.Write([]byte{'\n'})
+		h.Write([]byte(p))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// manifestETag identifies one rendering of a snapshot: the same folder served
+// in another format, under another name or with signed links is another body.
+func manifestETag(snapshotID, format, folderName, linkVariant string) string {
+	h := sha256.New()
+	for _, part := range []string{snapshotID, format, folderName, linkVariant} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`
+}
+
+// storeManifestSnapshot records the current manifest and returns its snapshot id.
+// Past manifestSnapshotMax snapshots the ones closest to expiry are dropped.
+func storeManifestSnapshot(folderID string, entries []ManifestEntry) string {
+	id := manifestSnapshotID(folderID, entries)
+	now := time.Now()
+
+	manifestSnapshotsMu.Lock()
+	defer manifestSnapshotsMu.Unlock()
+
+	for k, snap := range manifestSnapshots {
+		if now.After(snap.ExpiresAt) {
+			delete(manifestSnapshots, k)
+		}
+	}
+
+	if snap, ok := manifestSnapshots[id]; ok {
+		snap.ExpiresAt = now.Add(manifestSnapshotTTL)
+		return id
+	}
+
+	if over := len(manifestSnapshots) - manifestSnapshotMax + 1; over > 0 {
+		oldest := make([]*manifestSnapshot, 0, len(manifestSnapshots))
+		for _, snap := range manifestSnapshots {
+			oldest = append(oldest, snap)
+		}
+		sort.Slice(oldest, func(i, j int) bool { return oldest[i].ExpiresAt.Before(oldest[j].ExpiresAt) })
+		for _, snap := range oldest[:over] {
+			delete(manifestSnapshots, snap.ID)
+		}
+	}
+
+	byID := make(map[string]ManifestEntry, len(entries))
+	for _, e := range entries {
+		e.WebContentLink = "" // links expire; never serve them from the cache
+		byID[e.FileID] = e
+	}
+	manifestSnapshots[id] = &manifestSnapshot{
+		ID:        id,
+		FolderID:  folderID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(manifestSnapshotTTL),
+		Entries:   byID,
+	}
+	return id
+}
+
+func getManifestSnapshot(id, folderID string) (*manifestSnapshot, bool) {
+	manifestSnapshotsMu.Lock()
+	defer manifestSnapshotsMu.Unlock()
+
+	snap, ok := manifestSnapshots[id]
+	if ok && time.Now().After(snap.ExpiresAt) {
+		delete(manifestSnapshots, id)
+		return nil, false
+	}
+	if !ok || snap.FolderID != folderID {
+		return nil, false
+	}
+	return snap, true
+}
+
+// diffManifest compares the current entries (with fresh links) against an older snapshot.
+func diffManifest(prev *manifestSnapshot, current []ManifestEntry) manifestDelta {
+	var delta manifestDelta
+	seen := make(map[string]struct{}, len(current))
+	for _, e := range current {
+		seen[e.FileID] = struct{}{}
+		old, ok := prev.Entries[e.FileID]
+		switch {
+		case !ok:
+			delta.Added = append(delta.Added, e)
+		case entryFingerprint(old) != entryFingerprint(e):
+			delta.Modified = append(delta.Modified, e)
+		}
+	}
+	for id, old := range prev.Entries {
+		if _, ok := seen[id]; !ok {
+			delta.Removed = append(delta.Removed, old)
+		}
+	}
+	sort.Slice(delta.Removed, func(i, j int) bool {
+		return delta.Removed[i].RelativePath < delta.Removed[j].RelativePath
+	})
+	return delta
+}
+
+// changes flattens the delta for jsonl output.
+func (d manifestDelta) changes() []manifestChange {
+	out := make([]manifestChange, 0, len(d.Added)+len(d.Modified)+len(d.Removed))
+	for _, e := range d.Added {
+		out = append(out, manifestChange{Change: "added", ManifestEntry: e})
+	}
+	for _, e := range d.Modified {
+		out = append(out, manifestChange{Change: "modified", ManifestEntry: e})
+	}
+	for _, e := range d.Removed {
+		out = append(out, manifestChange{Change: "removed", ManifestEntry: e})
+	}
+	return out
+}
+
+// downloadable returns the entries a download manager has to (re)fetch.
+func (d manifestDelta) downloadable() []ManifestEntry {
+	out := make([]ManifestEntry, 0, len(d.Added)+len(d.Modified))
+	out = append(out, d.Added...)
+	return append(out, d.Modified...)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestManifestETagVariesByRendering(t *testing.T) {
+	base := manifestETag("snap", "json", "Folder", "direct")
+	if again := manifestETag("snap", "json", "Folder", "direct"); again != base {
+		t.Fatalf("same rendering gave %s and %s", base, again)
+	}
+	for name, etag := range map[string]string{
+		"format":      manifestETag("snap", "aria2", "Folder", "direct"),
+		"folder name": manifestETag("snap", "json", "Other", "direct"),
+		"signed":      manifestETag("snap", "json", "Folder", "signed:1:1700000000"),
+		"snapshot":    manifestETag("other", "json", "Folder", "direct"),
+	} {
+		if etag == base {
+			t.Errorf("changing the %s kept ETag %s", name, etag)
+		}
+	}
+}
+
+func TestManifestSnapshotCacheIsBounded(t *testing.T) {
+	prevMax, prevTTL := manifestSnapshotMax, manifestSnapshotTTL
+	manifestSnapshotMax, manifestSnapshotTTL = 3, time.Hour
+	manifestSnapshotsMu.Lock()
+	prevSnaps := manifestSnapshots
+	manifestSnapshots = make(map[string]*manifestSnapshot)
+	manifestSnapshotsMu.Unlock()
+	t.Cleanup(func() {
+		manifestSnapshotMax, manifestSnapshotTTL = prevMax, prevTTL
+		manifestSnapshotsMu.Lock()
+		manifestSnapshots = prevSnaps
+		manifestSnapshotsMu.Unlock()
+	})
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		ids = append(ids, storeManifestSnapshot(fmt.Sprintf("folder-%d", i), []ManifestEntry{{FileID: "f"}}))
+		time.Sleep(time.Millisecond)
+	}
+	if n := len(manifestSnapshots); n != 3 {
+		t.Fatalf("%d snapshots cached, want 3", n)
+	}
+	if _, ok := getManifestSnapshot(ids[0], "folder-0"); ok {
+		t.Fatal("oldest snapshot survived past the cap")
+	}
+	if _, ok := getManifestSnapshot(ids[4], "folder-4"); !ok {
+		t.Fatal("newest snapshot was evicted")
+	}
+}
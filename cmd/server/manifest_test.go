@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestManifestHeaders(t *testing.T) {
+	entries := []ManifestEntry{
+		{FileID: "a", RelativePath: "a.bin", WebContentLink: "https://dl.example.com/a"},
+		{FileID: "b", RelativePath: "sub/b.bin", WebContentLink: "https://dl.example.com/b"},
+		{FileID: "c", RelativePath: "c.bin"}, // no link yet
+	}
+	folderName := "Game\r\n--header=evil\rX\nY"
+
+	for _, format := range []string{"aria2", "curl", "wget"} {
+		out, err := manifestExporters[format].render(folderName, "Game", entries)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		text := string(out)
+		if !strings.Contains(text, "# Folder: Game --header=evil X Y\n") {
+			t.Errorf("%s: folder line not flattened:\n%s", format, text)
+		}
+		if !strings.Contains(text, "# Total files: 2\n") {
+			t.Errorf("%s: total should only count files with a link:\n%s", format, text)
+		}
+		for _, line := range strings.Split(text, "\n") {
+			if strings.HasPrefix(line, "--header") || strings.Contains(line, "\r") {
+				t.Errorf("%s: folder name leaked into line %q", format, line)
+			}
+		}
+	}
+}
+
+func TestManifestFileNamesStayOnOneLine(t *testing.T) {
+	entries := []ManifestEntry{
+		{FileID: "a", RelativePath: "sub\n  dir=/etc/a.bin", WebContentLink: "https://dl.example.com/a"},
+		{FileID: "b", RelativePath: "evil\r\n  out=passwd\x00.bin", WebContentLink: "https://dl.example.com/b\nhttps://evil.example.com/x"},
+	}
+
+	for _, format := range []string{"aria2", "ef2", "curl"} {
+		out, err := manifestExporters[format].render("Game", "Game", entries)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		for _, line := range strings.Split(strings.ReplaceAll(string(out), "\r\n", "\n"), "\n") {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, "dir=/etc") || strings.HasPrefix(trimmed, "out=passwd") ||
+				strings.HasPrefix(trimmed, "https://evil") || strings.ContainsAny(line, "\r\x00") {
+				t.Errorf("%s: file value leaked into line %q", format, line)
+			}
+		}
+	}
+}
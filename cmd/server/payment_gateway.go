@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/auth"
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/payment"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// paymentGateway issues QRIS/VA charges for top ups. nil keeps top ups on
+// manual transfer with admin approval only.
+var paymentGateway payment.Gateway
+
+// loadPaymentGateway reads PAYMENT_GATEWAY (midtrans or fake) from .env.
+func loadPaymentGateway() payment.Gateway {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("PAYMENT_GATEWAY")))
+	switch name {
+	case "":
+		return nil
+	case "midtrans":
+		key := strings.TrimSpace(os.Getenv("MIDTRANS_SERVER_KEY"))
+		if key == "" {
+			log.Println("⚠️ PAYMENT_GATEWAY=midtrans tetapi MIDTRANS_SERVER_KEY kosong. Payment gateway dimatikan.")
+			return nil
+		}
+		production := strings.EqualFold(strings.TrimSpace(os.Getenv("MIDTRANS_PRODUCTION")), "true")
+		log.Printf("✅ Payment gateway aktif: midtrans (production=%v)", production)
+		return payment.NewMidtrans(key, production)
+	case "fake":
+		log.Println("⚠️ Payment gateway aktif: fake (hanya untuk development)")
+		return payment.NewFake(firstNonEmpty(os.Getenv("FAKE_PAYMENT_SECRET"), "dev-secret"))
+	default:
+		log.Printf("⚠️ PAYMENT_GATEWAY %q tidak dikenal. Payment gateway dimatikan.", name)
+		return nil
+	}
+}
+
+// createTopupCharge asks the gateway for a charge and stores what the user
+// needs to pay on topup. The top up serial is the gateway order id.
+func createTopupCharge(topup *database.TopUpRequest, method database.PaymentMethod, user database.User) error {
+	charge, err := paymentGateway.CreateCharge(payment.ChargeRequest{
+		OrderID:   topup.Serial,
+		Amount:    topup.PayableAmount(),
+		Method:    method.Gateway,
+		Bank:      method.Bank,
+		Name:      firstNonEmpty(user.Name, topup.Username),
+		Email:     user.Email,
+		ExpiresAt: topup.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	topup.Gateway = paymentGateway.Name()
+	topup.GatewayRef = charge.Reference
+	topup.PaymentURL = charge.QRURL
+	if charge.Method == payment.MethodVA {
+		topup.PaymentCode = charge.VANumber
+		topup.PaymentAccount = charge.VANumber
+	} else {
+		topup.PaymentCode = charge.QRString
+	}
+	if !charge.ExpiresAt.IsZero() && charge.ExpiresAt.Before(topup.ExpiresAt) {
+		topup.ExpiresAt = charge.ExpiresAt
+	}
+	return database.DB.Save(topup).Error
+}
+
+// handlePaymentWebhook receives gateway notifications. It is unauthenticated;
+// the gateway signature is the only proof the payment happened.
+func handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	if paymentGateway == nil {
+		writeJSONError(w, http.StatusNotFound, "Payment gateway tidak aktif", nil)
+		return
+	}
+
+	ev, err := paymentGateway.ParseWebhook(r)
+	if err != nil {
+		if errors.Is(err, payment.ErrInvalidSignature) {
+			log.Printf("payment webhook: signature tidak valid dari %s", r.RemoteAddr)
+			writeJSONError(w, http.StatusUnauthorized, "Signature tidak valid", nil)
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "Notifikasi tidak valid", err)
+		return
+	}
+
+	topup, applied, err := processPaymentEvent(paymentGateway.Name(), ev)
+	if err != nil {
+		// A non-2xx answer makes the gateway redeliver the notification.
+		log.Printf("payment webhook: gagal memproses %s (%s): %v", ev.OrderID, ev.Status, err)
+		writeJSONError(w, http.StatusInternalServerError, "Gagal memproses notifikasi", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ok":       true,
+		"applied":  applied,
+		"topup_id": topup.ID,
+	})
+}
+
+// processPaymentEvent applies a verified gateway event to its top up exactly
+// once. applied is false for redelivered events and for events that do not
+// change the top up.
+func processPaymentEvent(gateway string, ev payment.Event) (database.TopUpRequest, bool, error) {
+	var topup database.TopUpRequest
+	applied := false
+	underpaid := false
+	now := time.Now()
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("serial = ?", ev.OrderID).
+			First(&topup).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// The unique (gateway, event_id) index makes redeliveries a no-op.
+		record := database.PaymentEvent{
+			Gateway: gateway,
+			EventID: ev.ID,
+			OrderID: ev.OrderID,
+			Status:  ev.Status,
+			Amount:  ev.Amount,
+			TopUpID: topup.ID,
+			Payload: string(ev.Raw),
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 || topup.ID == 0 || topup.Gateway != gateway {
+			return nil
+		}
+
+		switch ev.Status {
+		case payment.StatusPaid:
+			// Money that arrives after expiry or cancellation is still credited.
+			if topup.Status == "approved" || topup.Status == "rejected" {
+				return nil
+			}
+			if ev.Amount < topup.PayableAmount() {
+				underpaid = true
+				return nil
+			}
+			if topup.PaidAt == nil {
+				topup.PaidAt = &now
+			}
+			topup.DecidedAt = &now
+			topup.AdminReason = "Dibayar via " + gateway
+			applied = true
+			return creditTopupInTx(tx, &topup)
+
+		case payment.StatusExpired, payment.StatusFailed:
+			if topup.Status != "awaiting_payment" {
+				return nil
+			}
+			topup.Status = "expired"
+			if ev.Status == payment.StatusFailed {
+				topup.Status = "cancelled"
+				topup.CancelledAt = &now
+			}
+			applied = true
+			return tx.Save(&topup).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return database.TopUpRequest{}, false, err
+	}
+
+	switch {
+	case underpaid:
+		log.Printf("payment: %s dibayar Rp %d, kurang dari Rp %d", topup.Serial, ev.Amount, topup.PayableAmount())
+		_ = sendTelegramAdminMessage(fmt.Sprintf("⚠️ Top up %s dibayar Rp %d via %s, kurang dari tagihan Rp %d. Periksa manual.",
+			topup.Serial, ev.Amount, gateway, topup.PayableAmount()))
+	case applied && topup.Status == "approved":
+		database.DB.Create(&database.Notification{
+			UserID:  topup.UserID,
+			Title:   "Top up berhasil",
+			Message: fmt.Sprintf("Pembayaran top up Rp %d diterima. Saldo sudah ditambahkan.%s", topup.CreditAmount(), topupBonusNote(topup)),
+		})
+		_ = sendTelegramAdminMessage(fmt.Sprintf("✅ Top up %s (%s) Rp %d lunas via %s.",
+			topup.Serial, topup.Username, topup.Amount, gateway))
+	case applied:
+		database.DB.Create(&database.Notification{
+			UserID:  topup.UserID,
+			Title:   "Top up kedaluwarsa",
+			Message: fmt.Sprintf("Tagihan top up Rp %d tidak dibayar dan sudah ditutup.", topup.Amount),
+		})
+	}
+	return topup, applied, nil
+}
+
+// handleFakePayment simulates paying a top up with the fake gateway. The
+// notification goes through the same signature check as a real webhook.
+func handleFakePayment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	fake, ok := paymentGateway.(*payment.Fake)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "Fake payment gateway tidak aktif", nil)
+		return
+	}
+
+	var req struct {
+		ID     uint  `json:"id"`
+		Amount int64 `json:"amount"` // optional, defaults to the amount billed
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+		return
+	}
+
+	session := auth.GetSessionFromRequest(r)
+	var topup database.TopUpRequest
+	if err := database.DB.First(&topup, req.ID).Error; err != nil {
+		writeJSONError(w, http.StatusNotFound, "Topup request not found", nil)
+		return
+	}
+	if topup.UserID != session.UserID && session.Role != "admin" {
+		writeJSONError(w, http.StatusForbidden, "Forbidden", nil)
+		return
+	}
+	amount := req.Amount
+	if amount == 0 {
+		amount = topup.PayableAmount()
+	}
+
+	body, signature, err := fake.Pay(topup.Serial, amount)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Gagal membuat notifikasi", err)
+		return
+	}
+	notify, _ := http.NewRequest(http.MethodPost, "/api/payments/webhook", bytes.NewReader(body))
+	notify.Header.Set(payment.FakeSignatureHeader, signature)
+	ev, err := fake.ParseWebhook(notify)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Gagal memverifikasi notifikasi", err)
+		return
+	}
+
+	topup, applied, err := processPaymentEvent(fake.Name(), ev)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Gagal memproses pembayaran", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"applied": applied,
+		"topup":   topup,
+	})
+}
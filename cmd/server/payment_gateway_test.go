@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/payment"
+)
+
+func newGatewayTopup(t *testing.T, user database.User, serial string, amount int64) database.TopUpRequest {
+	t.Helper()
+	topup := database.TopUpRequest{UserID: user.ID, Serial: serial, Amount: amount, Gateway: "midtrans", PaymentMethod: "qris", Status: "awaiting_payment"}
+	if err := database.DB.Create(&topup).Error; err != nil {
+		t.Fatalf("create top up: %v", err)
+	}
+	return topup
+}
+
+func TestProcessPaymentEventRedelivery(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "gateway@example.com", 0)
+	topup := newGatewayTopup(t, user, "TU-PAY-1", 50000)
+
+	paid := payment.Event{ID: "tx-1:settlement", OrderID: topup.Serial, Status: payment.StatusPaid, Amount: 50000}
+	if _, applied, err := processPaymentEvent("midtrans", paid); err != nil || !applied {
+		t.Fatalf("first delivery: applied %v, err %v", applied, err)
+	}
+	// The same notification again, and a later one for the same payment.
+	if _, applied, err := processPaymentEvent("midtrans", paid); err != nil || applied {
+		t.Fatalf("redelivery: applied %v, err %v", applied, err)
+	}
+	capture := paid
+	capture.ID = "tx-1:capture"
+	if _, applied, err := processPaymentEvent("midtrans", capture); err != nil || applied {
+		t.Fatalf("second event for a credited top up: applied %v, err %v", applied, err)
+	}
+
+	var after database.User
+	database.DB.First(&after, user.ID)
+	if after.Balance != 50000 {
+		t.Fatalf("balance = %d, want 50000 credited once", after.Balance)
+	}
+	var credits int64
+	database.DB.Model(&database.Transaction{}).Where("top_up_id = ?", topup.ID).Count(&credits)
+	if credits != 1 {
+		t.Fatalf("%d transactions for the top up, want 1", credits)
+	}
+	var events int64
+	database.DB.Model(&database.PaymentEvent{}).Count(&events)
+	if events != 2 {
+		t.Fatalf("%d payment events stored, want 2", events)
+	}
+}
+
+func TestProcessPaymentEventRejectsUnderpaymentAndStrangers(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "under@example.com", 0)
+	topup := newGatewayTopup(t, user, "TU-PAY-2", 50000)
+
+	events := []payment.Event{
+		{ID: "tx-2:settlement", OrderID: topup.Serial, Status: payment.StatusPaid, Amount: 49000},
+		{ID: "tx-3:settlement", OrderID: "TU-UNKNOWN", Status: payment.StatusPaid, Amount: 50000},
+	}
+	for _, ev := range events {
+		if _, applied, err := processPaymentEvent("midtrans", ev); err != nil || applied {
+			t.Fatalf("event %s: applied %v, err %v", ev.ID, applied, err)
+		}
+	}
+	// A different gateway cannot settle a Midtrans top up.
+	if _, applied, _ := processPaymentEvent("fake", payment.Event{ID: "f-1", OrderID: topup.Serial, Status: payment.StatusPaid, Amount: 50000}); applied {
+		t.Fatal("event from another gateway was applied")
+	}
+
+	var after database.User
+	database.DB.First(&after, user.ID)
+	var stored database.TopUpRequest
+	database.DB.First(&stored, topup.ID)
+	if after.Balance != 0 || stored.Status != "awaiting_payment" {
+		t.Fatalf("balance %d, status %q; want nothing credited", after.Balance, stored.Status)
+	}
+}
+
+func TestCancelTopup(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "cancel@example.com", 0)
+	open := database.TopUpRequest{UserID: user.ID, Serial: "TU-C-1", Amount: 20000, Status: "awaiting_payment", ExpiresAt: time.Now().Add(time.Hour)}
+	late := database.TopUpRequest{UserID: user.ID, Serial: "TU-C-2", Amount: 20000, Status: "awaiting_payment", ExpiresAt: time.Now().Add(-time.Minute)}
+	database.DB.Create(&open)
+	database.DB.Create(&late)
+
+	cancel := func(id uint) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		body := strings.NewReader(fmt.Sprintf(`{"id":%d,"action":"cancel"}`, id))
+		handleTopUps(rec, withSession(httptest.NewRequest(http.MethodPatch, "/api/topups", body), user))
+		return rec
+	}
+
+	if rec := cancel(open.ID); rec.Code != http.StatusOK {
+		t.Fatalf("cancel: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := cancel(open.ID); rec.Code != http.StatusBadRequest {
+		t.Fatalf("second cancel: status %d, want 400", rec.Code)
+	}
+	if rec := cancel(late.ID); rec.Code != http.StatusBadRequest {
+		t.Fatalf("cancel past the deadline: status %d, want 400", rec.Code)
+	}
+
+	database.DB.First(&open, open.ID)
+	database.DB.First(&late, late.ID)
+	if open.Status != "cancelled" || open.CancelledAt == nil || late.Status != "expired" {
+		t.Fatalf("statuses %q/%q, want cancelled/expired", open.Status, late.Status)
+	}
+}
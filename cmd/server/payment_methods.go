@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/youming-ai/pikpak-downloader/internal/chain"
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/payment"
+)
+
+var errPaymentMethodUnavailable = errors.New("payment method unavailable")
+
+// paymentMethodUsable reports whether users can top up with pm right now:
+// gateway methods need a configured payment gateway and USDT methods an
+// explorer for their network.
+func paymentMethodUsable(pm database.PaymentMethod) bool {
+	return pm.IsActive && (pm.Gateway == "" || paymentGateway != nil) &&
+		(pm.Network == "" || cryptoExplorers[pm.Network] != nil)
+}
+
+// findPaymentMethod returns the usable PaymentMethod with the given code.
+func findPaymentMethod(code string) (database.PaymentMethod, error) {
+	var pm database.PaymentMethod
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" || database.DB.Where("code = ?", code).First(&pm).Error != nil || !paymentMethodUsable(pm) {
+		return database.PaymentMethod{}, errPaymentMethodUnavailable
+	}
+	return pm, nil
+}
+
+// normalizePaymentMethod cleans admin input and checks the fields that must
+// be consistent with each other.
+func normalizePaymentMethod(pm *database.PaymentMethod) error {
+	pm.Code = strings.ToLower(strings.TrimSpace(pm.Code))
+	pm.Label = strings.TrimSpace(pm.Label)
+	pm.Account = strings.TrimSpace(pm.Account)
+	pm.AccountName = strings.TrimSpace(pm.AccountName)
+	pm.Gateway = strings.ToLower(strings.TrimSpace(pm.Gateway))
+	pm.Bank = strings.ToLower(strings.TrimSpace(pm.Bank))
+	pm.Network = strings.ToLower(strings.TrimSpace(pm.Network))
+	pm.SerialPrefix = strings.ToUpper(strings.TrimSpace(pm.SerialPrefix))
+	if pm.SerialPrefix == "" {
+		pm.SerialPrefix = deriveSerialPrefix3(pm.Code)
+	}
+
+	switch {
+	case pm.Code == "":
+		return errors.New("code is required")
+	case pm.Label == "":
+		return errors.New("label is required")
+	case len(pm.SerialPrefix) != 3 || deriveSerialPrefix3(pm.SerialPrefix) != pm.SerialPrefix:
+		return errors.New("serial_prefix must be 3 letters/digits")
+	case pm.Gateway != "" && pm.Gateway != payment.MethodQRIS && pm.Gateway != payment.MethodVA:
+		return errors.New("gateway must be empty, qris or va")
+	case pm.Gateway == payment.MethodVA && pm.Bank == "":
+		return errors.New("bank is required for va")
+	case pm.Network != "" && pm.Network != chain.NetworkTRC20 && pm.Network != chain.NetworkBEP20:
+		return errors.New("network must be empty, trc20 or bep20")
+	case pm.Network != "" && pm.Gateway != "":
+		return errors.New("network and gateway cannot both be set")
+	case pm.Network != "" && pm.IsActive && pm.Rate <= 0:
+		return errors.New("rate is required for an active usdt method")
+	case pm.Gateway == "" && pm.Account == "" && pm.IsActive:
+		return errors.New("account is required for an active manual method")
+	case pm.MinAmount < 0 || pm.MaxAmount < 0 || pm.Fee < 0 || pm.Rate < 0:
+		return errors.New("amounts must be >= 0")
+	case pm.MaxAmount > 0 && pm.MaxAmount < pm.MinAmount:
+		return errors.New("max_amount must be >= min_amount")
+	}
+	return nil
+}
+
+// handlePaymentMethods lists the methods users can top up with.
+func handlePaymentMethods(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	var methods []database.PaymentMethod
+	if err := database.DB.Where("is_active = ?", true).Order("sort_order asc, id asc").Find(&methods).Error; err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to fetch payment methods", nil)
+		return
+	}
+	usable := make([]database.PaymentMethod, 0, len(methods))
+	for _, pm := range methods {
+		if paymentMethodUsable(pm) {
+			usable = append(usable, pm)
+		}
+	}
+	writeJSON(w, http.StatusOK, usable)
+}
+
+func handleAdminPaymentMethods(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var methods []database.PaymentMethod
+		if err := database.DB.Order("sort_order asc, id asc").Find(&methods).Error; err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to fetch payment methods", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"items":           methods,
+			"gateway_enabled": paymentGateway != nil,
+		})
+		return
+
+	case http.MethodPost:
+		var req database.PaymentMethod
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		req.ID = 0
+		if err := normalizePaymentMethod(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		var exists int64
+		database.DB.Model(&database.PaymentMethod{}).Where("code = ?", req.Code).Count(&exists)
+		if exists > 0 {
+			writeJSONError(w, http.StatusConflict, "code already exists", nil)
+			return
+		}
+		if err := database.DB.Create(&req).Error; err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to create payment method", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, req)
+		return
+
+	case http.MethodPatch:
+		// Decode over the stored row so omitted fields keep their values.
+		var body json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		var ref struct {
+			ID uint `json:"id"`
+		}
+		if err := json.Unmarshal(body, &ref); err != nil || ref.ID == 0 {
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
+			return
+		}
+
+		var pm database.PaymentMethod
+		if err := database.DB.First(&pm, ref.ID).Error; err != nil {
+			writeJSONError(w, http.StatusNotFound, "Payment method not found", nil)
+			return
+		}
+		oldCode := pm.Code
+		if err := json.Unmarshal(body, &pm); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		pm.ID = ref.ID
+		if err := normalizePaymentMethod(&pm); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		if pm.Code != oldCode {
+			// Top ups keep the code in payment_method; renaming would orphan them.
+			writeJSONError(w, http.StatusBadRequest, "code cannot be changed", nil)
+			return
+		}
+
+		if err := database.DB.Model(&database.PaymentMethod{}).Where("id = ?", pm.ID).Updates(map[string]any{
+			"label":         pm.Label,
+			"account":       pm.Account,
+			"account_name":  pm.AccountName,
+			"instructions":  pm.Instructions,
+			"logo_url":      pm.LogoURL,
+			"serial_prefix": pm.SerialPrefix,
+			"gateway":       pm.Gateway,
+			"bank":          pm.Bank,
+			"network":       pm.Network,
+			"rate":          pm.Rate,
+			"min_amount":    pm.MinAmount,
+			"max_amount":    pm.MaxAmount,
+			"fee":           pm.Fee,
+			"is_active":     pm.IsActive,
+			"sort_order":    pm.SortOrder,
+		}).Error; err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to update payment method", nil)
+			return
+		}
+		database.DB.First(&pm, pm.ID)
+		writeJSON(w, http.StatusOK, pm)
+		return
+
+	case http.MethodDelete:
+		id, _ := strconv.Atoi(strings.TrimSpace(r.URL.Query().Get("id")))
+		if id <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
+			return
+		}
+		var pm database.PaymentMethod
+		if err := database.DB.First(&pm, id).Error; err != nil {
+			writeJSONError(w, http.StatusNotFound, "Payment method not found", nil)
+			return
+		}
+		var open int64
+		database.DB.Model(&database.TopUpRequest{}).
+			Where("payment_method = ? AND status IN ?", pm.Code, []string{"awaiting_payment", "pending"}).
+			Count(&open)
+		if open > 0 {
+			writeJSONError(w, http.StatusConflict, "Masih ada top up berjalan dengan metode ini. Nonaktifkan saja dulu.", nil)
+			return
+		}
+		if err := database.DB.Delete(&database.PaymentMethod{}, id).Error; err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to delete payment method", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"message": "Payment method deleted"})
+		return
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/auth"
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errPremiumRequestNotFound = errors.New("premium request not found")
+var errPremiumRequestClosed = errors.New("premium request already finished")
+var errPremiumClaimedByOther = errors.New("premium request claimed by another admin")
+
+// premiumFulfillment is what an admin attaches when completing a manual request.
+type premiumFulfillment struct {
+	ResultURL string
+	StreamURL string
+	Filename  string
+	SizeBytes int64
+	Price     *int64 // nil means price from the premium Pricing and SizeBytes
+}
+
+type adminPremiumItem struct {
+	database.PremiumRequest
+	Username  string `json:"username"`
+	UserEmail string `json:"user_email"`
+}
+
+func handleAdminPremiumRequests(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		page := 1
+		if v := strings.TrimSpace(r.URL.Query().Get("page")); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				page = n
+			}
+		}
+		pageSize := 25
+		if v := strings.TrimSpace(r.URL.Query().Get("page_size")); v != "" {
+			if n, err := strconv.Atoi(v); err == nil {
+				if n < 1 {
+					n = 1
+				}
+				if n > 100 {
+					n = 100
+				}
+				pageSize = n
+			}
+		}
+
+		query := database.DB.Model(&database.PremiumRequest{}).Where("mode = ?", "manual")
+		switch status := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("status"))); status {
+		case "", "open":
+			query = query.Where("status IN ?", []string{"pending", "processing"})
+		case "all":
+		default:
+			query = query.Where("status = ?", status)
+		}
+
+		var total int64
+		query.Count(&total)
+
+		var pendingCount int64
+		database.DB.Model(&database.PremiumRequest{}).Where("mode = ? AND status = ?", "manual", "pending").Count(&pendingCount)
+
+		totalPages := 0
+		if total > 0 {
+			totalPages = int(math.Ceil(float64(total) / float64(pageSize)))
+		}
+		if totalPages > 0 && page > totalPages {
+			page = totalPages
+		}
+		offset := (page - 1) * pageSize
+		if offset < 0 {
+			offset = 0
+		}
+
+		var reqs []database.PremiumRequest
+		query.Order("CASE WHEN status = 'pending' THEN 0 WHEN status = 'processing' THEN 1 ELSE 2 END").
+			Order("created_at asc").
+			Offset(offset).
+			Limit(pageSize).
+			Find(&reqs)
+
+		userIDs := make([]uint, 0, len(reqs))
+		for _, req := range reqs {
+			userIDs = append(userIDs, req.UserID)
+		}
+		users := map[uint]database.User{}
+		if len(userIDs) > 0 {
+			var list []database.User
+			database.DB.Where("id IN ?", userIDs).Find(&list)
+			for _, u := range list {
+				users[u.ID] = u
+			}
+		}
+
+		items := make([]adminPremiumItem, 0, len(reqs))
+		for _, req := range reqs {
+			u := users[req.UserID]
+			items = append(items, adminPremiumItem{PremiumRequest: req, Username: u.Name, UserEmail: u.Email})
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"items":         items,
+			"total":         total,
+			"pending_count": pendingCount,
+			"page":          page,
+			"page_size":     pageSize,
+			"total_pages":   totalPages,
+		})
+		return
+
+	case http.MethodPatch:
+		session := auth.GetSessionFromRequest(r)
+		var req struct {
+			ID        uint   `json:"id"`
+			Action    string `json:"action"` // claim|release|complete|reject
+			ResultURL string `json:"result_url"`
+			StreamURL string `json:"stream_url"`
+			Filename  string `json:"filename"`
+			SizeBytes int64  `json:"size_bytes"`
+			Price     *int64 `json:"price"`
+			Reason    string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		if req.ID == 0 {
+			writeJSONError(w, http.StatusBadRequest, "id wajib diisi", nil)
+			return
+		}
+		admin := "admin:" + session.Email
+
+		var (
+			result database.PremiumRequest
+			err    error
+		)
+		switch strings.ToLower(strings.TrimSpace(req.Action)) {
+		case "claim":
+			result, err = claimPremiumRequest(req.ID, admin)
+		case "release":
+			result, err = releasePremiumClaim(req.ID, admin)
+		case "complete":
+			if strings.TrimSpace(req.ResultURL) == "" {
+				writeJSONError(w, http.StatusBadRequest, "result_url wajib diisi", nil)
+				return
+			}
+			if req.Price != nil && *req.Price < 0 {
+				writeJSONError(w, http.StatusBadRequest, "price tidak boleh negatif", nil)
+				return
+			}
+			result, err = completePremiumRequest(req.ID, admin, premiumFulfillment{
+				ResultURL: strings.TrimSpace(req.ResultURL),
+				StreamURL: strings.TrimSpace(req.StreamURL),
+				Filename:  strings.TrimSpace(req.Filename),
+				SizeBytes: req.SizeBytes,
+				Price:     req.Price,
+			})
+		case "reject":
+			result, err = rejectPremiumRequest(req.ID, admin, req.Reason)
+		default:
+			writeJSONError(w, http.StatusBadRequest, "action tidak valid (claim|release|complete|reject)", nil)
+			return
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, errPremiumRequestNotFound):
+				writeJSONError(w, http.StatusNotFound, "Request premium tidak ditemukan", nil)
+			case errors.Is(err, errPremiumRequestClosed):
+				writeJSONError(w, http.StatusConflict, "Request premium sudah selesai", nil)
+			case errors.Is(err, errPremiumClaimedByOther):
+				writeJSONError(w, http.StatusConflict, "Request premium sedang dikerjakan admin lain", nil)
+			case errors.Is(err, errInsufficientBalance):
+				writeJSONError(w, http.StatusPaymentRequired, "Saldo user tidak mencukupi untuk harga ini", err)
+			default:
+				writeJSONError(w, http.StatusInternalServerError, "Gagal memproses request premium", err)
+			}
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+		return
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+}
+
+// loadOpenManualPremium locks a manual request that has not finished yet.
+func loadOpenManualPremium(tx *gorm.DB, id uint) (database.PremiumRequest, error) {
+	var req database.PremiumRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND mode = ?", id, "manual").
+		First(&req).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return req, errPremiumRequestNotFound
+		}
+		return req, err
+	}
+	if req.Status != "pending" && req.Status != "processing" {
+		return req, errPremiumRequestClosed
+	}
+	return req, nil
+}
+
+// premiumClaimHeldByOther reports whether claimedBy keeps admin away from a
+// request. Telegram has no way to attach a result, so a claim made there is
+// finished from the web panel by whichever admin picks it up.
+func premiumClaimHeldByOther(claimedBy, admin string) bool {
+	if claimedBy == "" || claimedBy == admin {
+		return false
+	}
+	return !(strings.HasPrefix(claimedBy, "telegram:") && strings.HasPrefix(admin, "admin:"))
+}
+
+func claimPremiumRequest(id uint, admin string) (database.PremiumRequest, error) {
+	var req database.PremiumRequest
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if req, err = loadOpenManualPremium(tx, id); err != nil {
+			return err
+		}
+		if req.Status == "processing" && premiumClaimHeldByOther(req.ClaimedBy, admin) {
+			return errPremiumClaimedByOther
+		}
+		now := time.Now()
+		req.Status = "processing"
+		req.ClaimedBy = admin
+		req.ClaimedAt = &now
+		return tx.Save(&req).Error
+	})
+	return req, err
+}
+
+func releasePremiumClaim(id uint, admin string) (database.PremiumRequest, error) {
+	var req database.PremiumRequest
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if req, err = loadOpenManualPremium(tx, id); err != nil {
+			return err
+		}
+		if premiumClaimHeldByOther(req.ClaimedBy, admin) {
+			return errPremiumClaimedByOther
+		}
+		req.Status = "pending"
+		req.ClaimedBy = ""
+		req.ClaimedAt = nil
+		return tx.Save(&req).Error
+	})
+	return req, err
+}
+
+// completePremiumRequest attaches the admin's result and charges the user.
+func completePremiumRequest(id uint, admin string, f premiumFulfillment) (database.PremiumRequest, error) {
+	var req database.PremiumRequest
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if req, err = loadOpenManualPremium(tx, id); err != nil {
+			return err
+		}
+		if req.Status == "processing" && premiumClaimHeldByOther(req.ClaimedBy, admin) {
+			return errPremiumClaimedByOther
+		}
+
+		if f.SizeBytes > 0 {
+			req.SizeBytes = f.SizeBytes
+		}
+		chargedGB := 0
+		price := int64(0)
+		if f.Price != nil {
+			price = *f.Price
+		} else if priceCfg, perr := database.GetPricing("premium"); perr == nil {
+			price, _, chargedGB = priceCfg.CalculatePrice(req.SizeBytes)
+		} else {
+			return perr
+		}
+
+		if price > 0 {
+			var user database.User
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, req.UserID).Error; err != nil {
+				return err
+			}
+			if user.Balance < price {
+				return errInsufficientBalance
+			}
+			if err := tx.Model(&database.User{}).Where("id = ?", user.ID).
+				Update("balance", gorm.Expr("balance - ?", price)).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		req.Status = "done"
+		req.ResultURL = f.ResultURL
+		req.StreamURL = f.StreamURL
+		req.Filename = firstNonEmpty(f.Filename, req.Filename)
+		req.Price = price
+		req.OriginalPrice = price
+		req.ChargedGB = chargedGB
+		req.ClaimedBy = admin
+		req.FinishedAt = &now
+		if err := tx.Save(&req).Error; err != nil {
+			return err
+		}
+
+		name := firstNonEmpty(req.Filename, req.URL)
+		if price > 0 {
+			if err := createInvoicedTransaction(tx, &database.Transaction{
+				UserID:      req.UserID,
+				Amount:      -price,
+				GrossAmount: price,
+				Type:        "download",
+				Description: fmt.Sprintf("Premium Host: %s - Rp %d", name, price),
+			}); err != nil {
+				return err
+			}
+		}
+
+		msg := fmt.Sprintf("Link premium siap diunduh. %s. Biaya: Rp %d.", name, price)
+		if req.StreamURL != "" {
+			msg += " Tersedia juga link streaming."
+		}
+		return tx.Create(&database.Notification{
+			UserID:  req.UserID,
+			Title:   "Link premium siap",
+			Message: msg,
+		}).Error
+	})
+	return req, err
+}
+
+func rejectPremiumRequest(id uint, admin string, reason string) (database.PremiumRequest, error) {
+	var req database.PremiumRequest
+	cleanReason := strings.TrimSpace(reason)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if req, err = loadOpenManualPremium(tx, id); err != nil {
+			return err
+		}
+		now := time.Now()
+		req.Status = "failed"
+		req.AdminReason = cleanReason
+		req.ClaimedBy = firstNonEmpty(req.ClaimedBy, admin)
+		req.FinishedAt = &now
+		if err := tx.Save(&req).Error; err != nil {
+			return err
+		}
+
+		msg := fmt.Sprintf("Request host premium untuk %s ditolak.", req.URL)
+		if cleanReason != "" {
+			msg += " Alasan: " + cleanReason
+		}
+		return tx.Create(&database.Notification{
+			UserID:  req.UserID,
+			Title:   "Request premium ditolak",
+			Message: msg,
+		}).Error
+	})
+	return req, err
+}
+
+func sendTelegramPendingPremiumWithActions(req database.PremiumRequest, username string) error {
+	if telegramBotToken == "" || len(telegramAdminChatIDs) == 0 {
+		return nil
+	}
+	text := fmt.Sprintf(
+		"🔗 Request Host Premium (PENDING)\n\nID: %d\nUser: %s (user_id=%d)\nURL: %s\nDibuat: %s\n\nKlaim lalu isi link hasil dari panel admin, atau tolak:",
+		req.ID,
+		username,
+		req.UserID,
+		req.URL,
+		req.CreatedAt.Format(time.RFC3339),
+	)
+	replyMarkup := map[string]any{
+		"inline_keyboard": [][]map[string]string{
+			{
+				{"text": "🙋 Klaim", "callback_data": fmt.Sprintf("premium:claim:%d", req.ID)},
+				{"text": "❌ Reject", "callback_data": fmt.Sprintf("premium:reject:%d", req.ID)},
+			},
+		},
+	}
+	for chatID := range telegramAdminChatIDs {
+		if err := telegramPostJSON("sendMessage", map[string]any{
+			"chat_id":                  chatID,
+			"text":                     text,
+			"disable_web_page_preview": true,
+			"reply_markup":             replyMarkup,
+		}); err != nil {
+			log.Printf("telegram pending premium message failed for chat %d: %v", chatID, err)
+		}
+	}
+	return nil
+}
+
+// handleTelegramPremiumCallback handles premium:<claim|reject>:<id> buttons.
+func handleTelegramPremiumCallback(cb telegramCallbackQuery, action string, id uint) {
+	chatID := cb.Message.Chat.ID
+	admin := fmt.Sprintf("telegram:%d", chatID)
+
+	var (
+		req  database.PremiumRequest
+		err  error
+		done string
+	)
+	switch action {
+	case "claim":
+		req, err = claimPremiumRequest(id, admin)
+		done = "diklaim. Isi link hasil dari panel admin."
+	case "reject":
+		req, err = rejectPremiumRequest(id, admin, "Ditolak via Telegram")
+		done = "ditolak."
+	default:
+		_ = telegramPostJSON("answerCallbackQuery", map[string]any{
+			"callback_query_id": cb.ID,
+			"text":              "Aksi tidak valid",
+			"show_alert":        false,
+		})
+		return
+	}
+	if err != nil {
+		msg := "Gagal memproses"
+		switch {
+		case errors.Is(err, errPremiumRequestNotFound):
+			msg = "Request tidak ditemukan"
+		case errors.Is(err, errPremiumRequestClosed):
+			msg = "Request sudah selesai"
+		case errors.Is(err, errPremiumClaimedByOther):
+			msg = "Sudah diklaim admin lain"
+		}
+		_ = telegramPostJSON("answerCallbackQuery", map[string]any{
+			"callback_query_id": cb.ID,
+			"text":              msg,
+			"show_alert":        false,
+		})
+		return
+	}
+
+	_ = telegramPostJSON("answerCallbackQuery", map[string]any{
+		"callback_query_id": cb.ID,
+		"text":              "Berhasil",
+		"show_alert":        false,
+	})
+	_ = telegramPostJSON("sendMessage", map[string]any{
+		"chat_id": chatID,
+		"text":    fmt.Sprintf("Request premium #%d %s", req.ID, done),
+	})
+	_ = telegramPostJSON("editMessageReplyMarkup", map[string]any{
+		"chat_id":    chatID,
+		"message_id": cb.Message.MessageID,
+		"reply_markup": map[string]any{
+			"inline_keyboard": [][]map[string]string{},
+		},
+	})
+}
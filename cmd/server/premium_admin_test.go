@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+)
+
+func newManualPremium(t *testing.T, user database.User) database.PremiumRequest {
+	t.Helper()
+	req := database.PremiumRequest{UserID: user.ID, URL: "https://rapidgator.net/file/abc", Mode: "manual", Status: "pending"}
+	if err := database.DB.Create(&req).Error; err != nil {
+		t.Fatalf("create request: %v", err)
+	}
+	return req
+}
+
+func TestCompleteTelegramClaimFromPanel(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "premium@example.com", 10000)
+	req := newManualPremium(t, user)
+
+	if _, err := claimPremiumRequest(req.ID, "telegram:42"); err != nil {
+		t.Fatalf("claim from telegram: %v", err)
+	}
+	if _, err := claimPremiumRequest(req.ID, "telegram:43"); !errors.Is(err, errPremiumClaimedByOther) {
+		t.Fatalf("second telegram claim: err %v, want errPremiumClaimedByOther", err)
+	}
+
+	price := int64(4000)
+	done, err := completePremiumRequest(req.ID, "admin:ops@example.com", premiumFulfillment{ResultURL: "https://dl.example.com/abc", Price: &price})
+	if err != nil {
+		t.Fatalf("complete from panel: %v", err)
+	}
+	if done.Status != "done" || done.ClaimedBy != "admin:ops@example.com" {
+		t.Fatalf("status %q, claimed by %q", done.Status, done.ClaimedBy)
+	}
+	var after database.User
+	database.DB.First(&after, user.ID)
+	if after.Balance != 6000 {
+		t.Fatalf("balance = %d, want 6000", after.Balance)
+	}
+}
+
+func TestReleaseClaims(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "release@example.com", 0)
+
+	tests := []struct {
+		claimedBy, releasedBy string
+		wantErr               bool
+	}{
+		{"telegram:42", "admin:ops@example.com", false},
+		{"admin:ops@example.com", "admin:ops@example.com", false},
+		{"admin:a@example.com", "admin:b@example.com", true},
+		{"admin:a@example.com", "telegram:42", true},
+	}
+	for _, tt := range tests {
+		req := newManualPremium(t, user)
+		if _, err := claimPremiumRequest(req.ID, tt.claimedBy); err != nil {
+			t.Fatalf("claim as %s: %v", tt.claimedBy, err)
+		}
+		_, err := releasePremiumClaim(req.ID, tt.releasedBy)
+		if got := errors.Is(err, errPremiumClaimedByOther); got != tt.wantErr {
+			t.Errorf("claimed by %s, released by %s: err %v", tt.claimedBy, tt.releasedBy, err)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/youming-ai/pikpak-downloader/internal/auth"
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxContainerUploadBytes = 1 << 20
+
+// batchQuoteItem is one expanded file in a folder/container quote.
+type batchQuoteItem struct {
+	URL       string `json:"url"`
+	Filename  string `json:"filename"`
+	Host      string `json:"host"`
+	SizeBytes int64  `json:"size_bytes"`
+	Price     int64  `json:"price"`
+}
+
+type batchSkippedItem struct {
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// splitBatchPrice spreads total over the files proportionally to their size.
+// The rounding remainder goes to the last file so the shares add up to total.
+func splitBatchPrice(total int64, sizes []int64) []int64 {
+	shares := make([]int64, len(sizes))
+	if len(sizes) == 0 {
+		return shares
+	}
+	var sum int64
+	for _, s := range sizes {
+		sum += s
+	}
+	var assigned int64
+	for i, s := range sizes {
+		if i == len(sizes)-1 {
+			shares[i] = total - assigned
+			break
+		}
+		if sum > 0 {
+			shares[i] = total * s / sum
+		} else {
+			shares[i] = total / int64(len(sizes))
+		}
+		assigned += shares[i]
+	}
+	return shares
+}
+
+// handlePremiumBatch expands a hoster folder or a DLC/RSDF/CCF container into
+// single-file premium requests. POST with {"dry_run": true} only returns the quote.
+func handlePremiumBatch(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSessionFromRequest(r)
+
+	if r.Method == http.MethodGet {
+		id, err := strconv.Atoi(strings.TrimSpace(r.URL.Query().Get("id")))
+		if err != nil || id <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "id tidak valid", nil)
+			return
+		}
+		var batch database.PremiumBatch
+		if err := database.DB.Where("id = ? AND user_id = ?", id, session.UserID).First(&batch).Error; err != nil {
+			writeJSONError(w, http.StatusNotFound, "Batch tidak ditemukan", nil)
+			return
+		}
+		var children []database.PremiumRequest
+		database.DB.Where("batch_id = ?", batch.ID).Order("id asc").Find(&children)
+
+		items := make([]map[string]any, 0, len(children))
+		counts := map[string]int{}
+		for _, c := range children {
+			items = append(items, premiumJobResponse(c, nil))
+			counts[c.Status]++
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"batch":  batch,
+			"counts": counts,
+			"items":  items,
+		})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	if strings.TrimSpace(rdClient.APIKey) == "" {
+		writeJSONError(w, http.StatusServiceUnavailable, "Folder/container hanya bisa diproses saat Real-Debrid aktif", nil)
+		return
+	}
+
+	var (
+		sourceType string
+		source     string
+		voucher    string
+		dryRun     bool
+		container  []byte
+	)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxContainerUploadBytes); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid form", nil)
+			return
+		}
+		file, header, err := r.FormFile("container")
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "File container wajib diunggah", nil)
+			return
+		}
+		defer file.Close()
+		container, err = io.ReadAll(io.LimitReader(file, maxContainerUploadBytes+1))
+		if err != nil || len(container) == 0 || len(container) > maxContainerUploadBytes {
+			writeJSONError(w, http.StatusBadRequest, "File container tidak valid (maks 1 MB)", nil)
+			return
+		}
+		sourceType = "container"
+		source = header.Filename
+		voucher = r.FormValue("voucher")
+		dryRun, _ = strconv.ParseBool(r.FormValue("dry_run"))
+	} else {
+		var req struct {
+			URL     string `json:"url"`
+			Type    string `json:"type"` // folder|container
+			Voucher string `json:"voucher"`
+			DryRun  bool   `json:"dry_run"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		source = strings.TrimSpace(req.URL)
+		if source == "" {
+			writeJSONError(w, http.StatusBadRequest, "URL wajib diisi", nil)
+			return
+		}
+		sourceType = strings.ToLower(strings.TrimSpace(req.Type))
+		if sourceType == "" {
+			sourceType = "folder"
+		}
+		if sourceType != "folder" && sourceType != "container" {
+			writeJSONError(w, http.StatusBadRequest, "type harus folder atau container", nil)
+			return
+		}
+		voucher = req.Voucher
+		dryRun = req.DryRun
+	}
+	voucher = strings.TrimSpace(voucher)
+
+	if err := premiumQueue.waitCheckRate(r.Context()); err != nil {
+		writeJSONError(w, http.StatusRequestTimeout, "Request dibatalkan sebelum diproses", nil)
+		return
+	}
+	var links []string
+	var err error
+	switch {
+	case container != nil:
+		links, err = rdClient.UnrestrictContainerFile(container)
+	case sourceType == "container":
+		links, err = rdClient.UnrestrictContainerLink(source)
+	default:
+		links, err = rdClient.UnrestrictFolder(source)
+	}
+	if err != nil {
+		status, friendly := mapDebridError(err)
+		writeJSONError(w, status, friendly, err)
+		return
+	}
+	if len(links) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "Tidak ada file di folder/container ini", nil)
+		return
+	}
+	if maxFiles := envInt("PREMIUM_BATCH_MAX_FILES", 50); len(links) > maxFiles {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Folder/container berisi %d file, maksimal %d file per batch", len(links), maxFiles), nil)
+		return
+	}
+
+	items := make([]batchQuoteItem, 0, len(links))
+	skipped := make([]batchSkippedItem, 0)
+	for _, link := range links {
+		if err := premiumQueue.waitCheckRate(r.Context()); err != nil {
+			writeJSONError(w, http.StatusRequestTimeout, "Request dibatalkan sebelum diproses", nil)
+			return
+		}
+		info, err := rdClient.CheckLink(link)
+		if err != nil {
+			_, friendly := mapDebridError(err)
+			skipped = append(skipped, batchSkippedItem{URL: link, Reason: friendly})
+			continue
+		}
+		if !info.Supported {
+			skipped = append(skipped, batchSkippedItem{URL: link, Reason: "Host/link belum didukung oleh Real-Debrid"})
+			continue
+		}
+		items = append(items, batchQuoteItem{
+			URL:       link,
+			Filename:  info.Filename,
+			Host:      info.Host,
+			SizeBytes: max(info.Filesize, 0),
+		})
+	}
+	if len(items) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"code":    "batch_empty",
+			"message": "Tidak ada file yang didukung di folder/container ini",
+			"skipped": skipped,
+		})
+		return
+	}
+
+	priceCfg, err := database.GetPricing("premium")
+	if err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "Pricing premium belum tersedia", err)
+		return
+	}
+	var totalSize int64
+	sizes := make([]int64, len(items))
+	for i, it := range items {
+		sizes[i] = it.SizeBytes
+		totalSize += it.SizeBytes
+	}
+	price, chargedUnits, chargedGB := priceCfg.CalculatePrice(totalSize)
+	if price <= 0 {
+		price = priceCfg.PricePerUnit
+		chargedUnits = 1
+		chargedGB = priceCfg.UnitSizeGB
+	}
+	for i, share := range splitBatchPrice(price, sizes) {
+		items[i].Price = share
+	}
+
+	quote := map[string]any{
+		"source":        source,
+		"source_type":   sourceType,
+		"file_count":    len(items),
+		"total_size":    totalSize,
+		"total_size_gb": fmt.Sprintf("%.2f GB", float64(totalSize)/float64(1024*1024*1024)),
+		"price":         price,
+		"charged_units": chargedUnits,
+		"charged_gb":    chargedGB,
+		"items":         items,
+		"skipped":       skipped,
+	}
+	if dryRun {
+		quote["message"] = "Estimasi biaya folder/container"
+		writeJSON(w, http.StatusOK, quote)
+		return
+	}
+
+	var batch database.PremiumBatch
+	finalPrice := price
+	voucherApplied := ""
+	voucherDiscount := int64(0)
+	var currentBalance int64
+	jobs := make([]database.PremiumRequest, 0, len(items))
+	txErr := database.DB.Transaction(func(tx *gorm.DB) error {
+		if voucher != "" {
+			voucherResult, vErr := applyVoucherInTx(tx, voucher, "premium", price, session.UserID)
+			if vErr != nil {
+				return vErr
+			}
+			voucherApplied = voucherResult.Code
+			voucherDiscount = voucherResult.Discount
+			finalPrice = voucherResult.Final
+		}
+
+		var user database.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, session.UserID).Error; err != nil {
+			return err
+		}
+		if user.Balance < finalPrice {
+			currentBalance = user.Balance
+			return errInsufficientBalance
+		}
+		currentBalance = user.Balance - finalPrice
+		if err := tx.Model(&database.User{}).Where("id = ?", user.ID).Update("balance", currentBalance).Error; err != nil {
+			return err
+		}
+
+		batch = database.PremiumBatch{
+			UserID:          session.UserID,
+			Source:          source,
+			SourceType:      sourceType,
+			FileCount:       len(items),
+			TotalSize:       totalSize,
+			Price:           finalPrice,
+			OriginalPrice:   price,
+			VoucherCode:     voucherApplied,
+			VoucherDiscount: voucherDiscount,
+			ChargedGB:       chargedGB,
+		}
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		if err := createInvoicedTransaction(tx, &database.Transaction{
+			UserID:      session.UserID,
+			Amount:      -finalPrice,
+			GrossAmount: price,
+			Discount:    voucherDiscount,
+			VoucherCode: voucherApplied,
+			Type:        "download",
+			Description: func() string {
+				if voucherApplied != "" && voucherDiscount > 0 {
+					return fmt.Sprintf("Premium Host (batch #%d): %s, %d file (%d GB) - Rp %d (Voucher %s -Rp %d)", batch.ID, source, len(items), chargedGB, finalPrice, voucherApplied, voucherDiscount)
+				}
+				return fmt.Sprintf("Premium Host (batch #%d): %s, %d file (%d GB) - Rp %d", batch.ID, source, len(items), chargedGB, finalPrice)
+			}(),
+		}); err != nil {
+			return err
+		}
+
+		// Batches are paid from the balance only but queue with the plan's priority.
+		priority := subscriptionPriority(tx, session.UserID)
+		finalShares := splitBatchPrice(finalPrice, sizes)
+		for i, it := range items {
+			job := database.PremiumRequest{
+				UserID:         session.UserID,
+				URL:            it.URL,
+				Filename:       it.Filename,
+				Host:           it.Host,
+				SizeBytes:      it.SizeBytes,
+				Price:          finalShares[i],
+				Status:         "pending",
+				Mode:           "automatic",
+				Provider:       "realdebrid", // the links were expanded by Real-Debrid
+				BatchID:        &batch.ID,
+				ReservedAmount: finalShares[i],
+				OriginalPrice:  it.Price,
+				Priority:       priority,
+			}
+			if err := tx.Create(&job).Error; err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+
+		return tx.Create(&database.UserUsage{
+			UserID:      session.UserID,
+			ServiceType: "premium",
+			Source:      source,
+		}).Error
+	})
+	if txErr != nil {
+		switch {
+		case isVoucherError(txErr):
+			writeJSONError(w, http.StatusBadRequest, voucherErrorMessage(txErr), txErr)
+		case errors.Is(txErr, errInsufficientBalance):
+			writeJSON(w, http.StatusPaymentRequired, map[string]any{
+				"code":            "insufficient_balance",
+				"message":         "Saldo tidak mencukupi untuk folder/container ini",
+				"required_price":  finalPrice,
+				"original_price":  price,
+				"discount_amount": voucherDiscount,
+				"voucher_code":    voucherApplied,
+				"required_units":  chargedUnits,
+				"required_gb":     chargedGB,
+				"current_balance": currentBalance,
+				"size_gb":         fmt.Sprintf("%d GB", chargedGB),
+			})
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "Gagal menyimpan transaksi premium", txErr)
+		}
+		return
+	}
+
+	premiumQueue.notify()
+
+	jobItems := make([]map[string]any, 0, len(jobs))
+	for _, job := range jobs {
+		jobItems = append(jobItems, premiumJobResponse(job, nil))
+	}
+	quote["message"] = fmt.Sprintf("%d file masuk antrian", len(jobs))
+	quote["batch_id"] = batch.ID
+	quote["price"] = finalPrice
+	quote["original_price"] = price
+	quote["discount_amount"] = voucherDiscount
+	quote["voucher_code"] = voucherApplied
+	quote["current_balance_after"] = currentBalance
+	quote["items"] = jobItems
+	writeJSON(w, http.StatusAccepted, quote)
+}
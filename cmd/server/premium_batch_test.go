@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"gorm.io/gorm"
+)
+
+func TestSplitBatchPrice(t *testing.T) {
+	tests := []struct {
+		total int64
+		sizes []int64
+		want  []int64
+	}{
+		{10000, []int64{1, 1}, []int64{5000, 5000}},
+		{10000, []int64{1, 2}, []int64{3333, 6667}},
+		{10000, []int64{0, 0, 0}, []int64{3333, 3333, 3334}},
+		{10000, nil, []int64{}},
+	}
+	for _, tt := range tests {
+		got := splitBatchPrice(tt.total, tt.sizes)
+		if len(got) != len(tt.want) {
+			t.Fatalf("splitBatchPrice(%d, %v) = %v, want %v", tt.total, tt.sizes, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("splitBatchPrice(%d, %v) = %v, want %v", tt.total, tt.sizes, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestFailedBatchReleasesVoucher(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "batch@example.com", 0)
+	voucher := database.Voucher{Code: "HEMAT", DiscountType: "fixed", DiscountValue: 2000, IsActive: true}
+	database.DB.Create(&voucher)
+
+	var batch database.PremiumBatch
+	var jobs []*database.PremiumRequest
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := applyVoucherInTx(tx, voucher.Code, "premium", 10000, user.ID); err != nil {
+			return err
+		}
+		batch = database.PremiumBatch{UserID: user.ID, FileCount: 2, Price: 8000, OriginalPrice: 10000, VoucherCode: voucher.Code, VoucherDiscount: 2000}
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		for i := 0; i < 2; i++ {
+			job := &database.PremiumRequest{UserID: user.ID, URL: fmt.Sprintf("https://rapidgator.net/file/%d", i),
+				Status: "pending", Mode: "automatic", BatchID: &batch.ID, Price: 4000, ReservedAmount: 4000}
+			if err := tx.Create(job).Error; err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+
+	usedCount := func() int {
+		var v database.Voucher
+		database.DB.First(&v, voucher.ID)
+		return v.UsedCount
+	}
+	if got := usedCount(); got != 1 {
+		t.Fatalf("used_count after batch = %d, want 1", got)
+	}
+
+	if err := releasePremiumJob(jobs[0], "gagal", nil); err != nil {
+		t.Fatalf("release first: %v", err)
+	}
+	if got := usedCount(); got != 1 {
+		t.Fatalf("used_count with one file left = %d, want 1", got)
+	}
+	if err := releasePremiumJob(jobs[1], "gagal", nil); err != nil {
+		t.Fatalf("release second: %v", err)
+	}
+	if got := usedCount(); got != 0 {
+		t.Fatalf("used_count after every file failed = %d, want 0", got)
+	}
+	var after database.User
+	database.DB.First(&after, user.ID)
+	if after.Balance != 8000 {
+		t.Fatalf("balance = %d, want the 8000 reserved", after.Balance)
+	}
+}
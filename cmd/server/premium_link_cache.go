@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/auth"
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/debrid"
+)
+
+// premiumLinkCache keeps recent unrestrict results keyed by normalized source
+// URL, so the same file requested again within minutes reuses the direct link
+// instead of calling the provider again.
+type premiumLinkCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedPremiumLink
+}
+
+type cachedPremiumLink struct {
+	provider     string
+	unrestricted debrid.Unrestricted
+	streamURL    string
+	expiresAt    time.Time
+}
+
+var premiumLinks = &premiumLinkCache{ttl: 10 * time.Minute, entries: make(map[string]cachedPremiumLink)}
+
+func loadPremiumLinkCacheTTL() time.Duration {
+	return time.Duration(envInt("PREMIUM_LINK_CACHE_MINUTES", 10)) * time.Minute
+}
+
+// normalizePremiumURL makes equivalent links share a cache key: lower-case
+// host without www., no fragment, no utm_* parameters, sorted query, no trailing slash.
+func normalizePremiumURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return strings.TrimSpace(raw)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme == "http" {
+		u.Scheme = "https"
+	}
+	u.Host = strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	u.Fragment = ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	q := u.Query()
+	for k := range q {
+		if strings.HasPrefix(strings.ToLower(k), "utm_") {
+			q.Del(k)
+		}
+	}
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	u.RawQuery = strings.Join(parts, "&")
+	return u.String()
+}
+
+func (c *premiumLinkCache) get(link string) (cachedPremiumLink, bool) {
+	if c.ttl <= 0 {
+		return cachedPremiumLink{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[normalizePremiumURL(link)]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return cachedPremiumLink{}, false
+	}
+	return entry, true
+}
+
+func (c *premiumLinkCache) put(link, provider string, unrestricted debrid.Unrestricted, streamURL string) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[normalizePremiumURL(link)] = cachedPremiumLink{
+		provider:     provider,
+		unrestricted: unrestricted,
+		streamURL:    streamURL,
+		expiresAt:    now.Add(c.ttl),
+	}
+}
+
+// unrestrictPremiumLink returns a direct link for job.URL from the cache or
+// the providers (preferring job.Provider), plus a streaming link when offered.
+func unrestrictPremiumLink(ctx context.Context, job *database.PremiumRequest) (string, debrid.Unrestricted, string, error) {
+	if cached, ok := premiumLinks.get(job.URL); ok {
+		return cached.provider, cached.unrestricted, cached.streamURL, nil
+	}
+
+	if err := premiumQueue.waitRate(ctx); err != nil {
+		return "", debrid.Unrestricted{}, "", err
+	}
+	var unrestricted debrid.Unrestricted
+	provider, err := debridProviders.Do(job.URL, job.Provider, func(p debrid.Provider) error {
+		res, uErr := p.Unrestrict(job.URL)
+		unrestricted = res
+		return uErr
+	})
+	if err != nil {
+		return "", debrid.Unrestricted{}, "", err
+	}
+
+	streamURL := ""
+	if unrestricted.StreamRef != "" {
+		if err := premiumQueue.waitRate(ctx); err == nil {
+			if s, streamErr := provider.StreamingLink(unrestricted.StreamRef); streamErr == nil {
+				streamURL = strings.TrimSpace(s)
+			} else {
+				log.Printf("%s streaming link skipped: %v", provider.Name(), streamErr)
+			}
+		}
+	}
+
+	premiumLinks.put(job.URL, provider.Name(), unrestricted, streamURL)
+	return provider.Name(), unrestricted, streamURL, nil
+}
+
+// handlePremiumLinkRefresh re-generates the direct link of a finished request
+// without charging again, within PREMIUM_REFRESH_DAYS of the original request.
+func handlePremiumLinkRefresh(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSessionFromRequest(r)
+
+	var req struct {
+		ID     uint   `json:"id"`
+		Action string `json:"action"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+		writeJSONError(w, http.StatusBadRequest, "id wajib diisi", nil)
+		return
+	}
+	if req.Action != "refresh" {
+		writeJSONError(w, http.StatusBadRequest, "action tidak dikenal", nil)
+		return
+	}
+	if !debridProviders.Available() {
+		writeJSONError(w, http.StatusServiceUnavailable, "Refresh link hanya tersedia saat provider debrid aktif", nil)
+		return
+	}
+
+	var job database.PremiumRequest
+	if err := database.DB.Where("id = ? AND user_id = ?", req.ID, session.UserID).First(&job).Error; err != nil {
+		writeJSONError(w, http.StatusNotFound, "Request tidak ditemukan", nil)
+		return
+	}
+	if job.Status != "done" {
+		writeJSONError(w, http.StatusConflict, "Hanya request yang sudah selesai yang bisa di-refresh", nil)
+		return
+	}
+	days := envInt("PREMIUM_REFRESH_DAYS", 7)
+	if time.Since(job.CreatedAt) > time.Duration(days)*24*time.Hour {
+		writeJSONError(w, http.StatusGone, "Masa refresh link sudah lewat. Silakan request ulang.", nil)
+		return
+	}
+	if limit := envInt("PREMIUM_REFRESH_MAX", 20); job.RefreshCount >= limit {
+		writeJSONError(w, http.StatusTooManyRequests, "Batas refresh link untuk request ini sudah tercapai", nil)
+		return
+	}
+
+	provider, unrestricted, streamURL, err := unrestrictPremiumLink(r.Context(), &job)
+	if err != nil {
+		status, friendly := mapDebridError(err)
+		writeJSONError(w, status, friendly, err)
+		return
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(&database.PremiumRequest{}).Where("id = ?", job.ID).Updates(map[string]any{
+		"result_url":        unrestricted.Download,
+		"stream_url":        streamURL,
+		"provider":          provider,
+		"refresh_count":     job.RefreshCount + 1,
+		"link_refreshed_at": now,
+	}).Error; err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Gagal menyimpan link baru", err)
+		return
+	}
+	job.ResultURL, job.StreamURL, job.Provider = unrestricted.Download, streamURL, provider
+	job.RefreshCount++
+	job.LinkRefreshedAt = &now
+
+	resp := premiumJobResponse(job, nil)
+	resp["message"] = "Link baru siap diunduh (tanpa biaya tambahan)"
+	writeJSON(w, http.StatusOK, resp)
+}
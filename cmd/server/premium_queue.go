@@ -0,0 +1,593 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/debrid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// premiumJobQueue processes automatic premium requests stored in the
+// premium_requests table. The table is the queue: a job is claimed by flipping
+// its status from pending to processing, so restarts and multiple instances
+// never pick the same row twice.
+type premiumJobQueue struct {
+	workers     int
+	maxAttempts int
+	rate        *rateLimiter // provider calls made by the workers
+	checkRate   *rateLimiter // provider calls made while handling a request
+	wake        chan struct{}
+}
+
+// rateLimiter is a token bucket: up to burst calls at once, refilled at a fixed rate.
+type rateLimiter struct {
+	tokens chan struct{}
+}
+
+// newRateLimiter allows perMinute calls per minute with bursts of up to burst
+// calls. Both are clamped to at least 1: a zero rate would divide by zero and a
+// zero burst would block every caller forever.
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	perMinute, burst = max(perMinute, 1), max(burst, 1)
+	interval := max(time.Minute/time.Duration(perMinute), time.Millisecond)
+
+	l := &rateLimiter{tokens: make(chan struct{}, burst)}
+	for i := 0; i < burst; i++ {
+		l.tokens <- struct{}{}
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			select {
+			case l.tokens <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return l
+}
+
+func (l *rateLimiter) wait(ctx context.Context) error {
+	select {
+	case <-l.tokens:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var premiumQueue *premiumJobQueue
+
+func newPremiumJobQueue() *premiumJobQueue {
+	return &premiumJobQueue{
+		workers:     envInt("PREMIUM_WORKERS", 2),
+		maxAttempts: envInt("PREMIUM_MAX_ATTEMPTS", 3),
+		rate:        newRateLimiter(envInt("PREMIUM_RATE_PER_MINUTE", 30), envInt("PREMIUM_RATE_BURST", 1)),
+		checkRate:   newRateLimiter(envInt("PREMIUM_CHECK_RATE_PER_MINUTE", 60), envInt("PREMIUM_CHECK_RATE_BURST", 5)),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Start puts jobs abandoned by a dead worker back in the queue and launches the workers.
+func (q *premiumJobQueue) Start() {
+	if n, err := recoverStalePremiumJobs(); err != nil {
+		log.Printf("premium queue: gagal memulihkan job: %v", err)
+	} else if n > 0 {
+		log.Printf("premium queue: %d job dikembalikan ke antrian", n)
+	}
+
+	for i := 0; i < q.workers; i++ {
+		go q.worker()
+	}
+	log.Printf("✅ Premium queue aktif (%d worker)", q.workers)
+}
+
+// recoverStalePremiumJobs returns jobs claimed longer than
+// PREMIUM_JOB_LEASE_MINUTES ago (default 15) to the queue. A live worker
+// finishes well within the lease, so jobs other instances are still working
+// on are left alone.
+func recoverStalePremiumJobs() (int64, error) {
+	lease := time.Duration(envInt("PREMIUM_JOB_LEASE_MINUTES", 15)) * time.Minute
+	res := database.DB.Model(&database.PremiumRequest{}).
+		Where("mode = ? AND status = ? AND (started_at IS NULL OR started_at < ?)", "automatic", "processing", time.Now().Add(-lease)).
+		Update("status", "pending")
+	return res.RowsAffected, res.Error
+}
+
+// notify wakes an idle worker after a job was enqueued.
+func (q *premiumJobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// waitRate blocks until the workers' next provider call is allowed.
+func (q *premiumJobQueue) waitRate(ctx context.Context) error {
+	return q.rate.wait(ctx)
+}
+
+// waitCheckRate blocks until a request handler's next provider call is
+// allowed. Handlers have their own bucket so they never queue behind the workers.
+func (q *premiumJobQueue) waitCheckRate(ctx context.Context) error {
+	return q.checkRate.wait(ctx)
+}
+
+func (q *premiumJobQueue) worker() {
+	for {
+		// Keep jobs queued while every provider is disabled by the health check.
+		if !debridProviders.Available() {
+			time.Sleep(30 * time.Second)
+			continue
+		}
+		job, ok := q.claimNext()
+		if !ok {
+			select {
+			case <-q.wake:
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		q.process(job)
+	}
+}
+
+// premiumTrafficWait is how long a queued job waits when no provider has
+// traffic left for its host.
+const premiumTrafficWait = 5 * time.Minute
+
+func (q *premiumJobQueue) claimNext() (*database.PremiumRequest, bool) {
+	for {
+		now := time.Now()
+		var job database.PremiumRequest
+		err := database.DB.
+			Where("mode = ? AND status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", "automatic", "pending", now).
+			Order("priority desc, id asc").
+			First(&job).Error
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("premium queue: gagal membaca antrian: %v", err)
+			}
+			return nil, false
+		}
+
+		// No provider has traffic left for the host: keep the job queued
+		// until the next health check frees it up.
+		if !debridProviders.AvailableFor(job.URL) {
+			if err := database.DB.Model(&database.PremiumRequest{}).
+				Where("id = ? AND status = ?", job.ID, "pending").
+				Update("next_attempt_at", now.Add(premiumTrafficWait)).Error; err != nil {
+				log.Printf("premium queue: gagal menunda job %d: %v", job.ID, err)
+				return nil, false
+			}
+			continue
+		}
+
+		res := database.DB.Model(&database.PremiumRequest{}).
+			Where("id = ? AND status = ?", job.ID, "pending").
+			Updates(map[string]any{
+				"status":     "processing",
+				"started_at": now,
+				"attempts":   gorm.Expr("attempts + 1"),
+			})
+		if res.Error != nil {
+			log.Printf("premium queue: gagal klaim job %d: %v", job.ID, res.Error)
+			return nil, false
+		}
+		if res.RowsAffected == 1 {
+			job.Status = "processing"
+			job.StartedAt = &now
+			job.Attempts++
+			return &job, true
+		}
+		// Another worker claimed it first; try the next one.
+	}
+}
+
+func (q *premiumJobQueue) process(job *database.PremiumRequest) {
+	provider, unrestricted, streamURL, err := unrestrictPremiumLink(context.Background(), job)
+	if err != nil {
+		q.handleFailure(job, err)
+		return
+	}
+	job.Provider = provider
+
+	if err := finalizePremiumJob(job, unrestricted, streamURL); err != nil {
+		var topUp *premiumTopUpError
+		if errors.As(err, &topUp) {
+			if rerr := releasePremiumJob(job, topUp.Error(), nil); rerr != nil {
+				log.Printf("premium queue: gagal mengembalikan saldo job %d: %v", job.ID, rerr)
+			}
+			return
+		}
+		// The link stays in premiumLinks, so a retry does not call the provider again.
+		log.Printf("premium queue: gagal menyelesaikan job %d: %v", job.ID, err)
+		q.retryOrRelease(job, err, "Gagal menyimpan hasil link premium", true)
+	}
+}
+
+// isRetryablePremiumError reports whether a provider failure is worth another attempt.
+func isRetryablePremiumError(err error) bool {
+	switch debrid.KindOf(err) {
+	case debrid.KindTemporary, debrid.KindRateLimit, debrid.KindHostDown, debrid.KindQuota:
+		return true
+	}
+	return false
+}
+
+func (q *premiumJobQueue) handleFailure(job *database.PremiumRequest, err error) {
+	_, friendly := mapDebridError(err)
+	q.retryOrRelease(job, err, friendly, isRetryablePremiumError(err))
+}
+
+// retryOrRelease puts a failed job back in the queue with a backoff while it
+// has attempts left and the failure is retryable; otherwise it fails the job
+// and returns its reservation.
+func (q *premiumJobQueue) retryOrRelease(job *database.PremiumRequest, err error, friendly string, retryable bool) {
+	if retryable && job.Attempts < q.maxAttempts {
+		next := time.Now().Add(time.Duration(job.Attempts) * 30 * time.Second)
+		if uerr := database.DB.Model(&database.PremiumRequest{}).
+			Where("id = ? AND status = ?", job.ID, "processing").
+			Updates(map[string]any{
+				"status":          "pending",
+				"error":           err.Error(),
+				"next_attempt_at": next,
+			}).Error; uerr != nil {
+			log.Printf("premium queue: gagal menjadwalkan ulang job %d: %v", job.ID, uerr)
+		}
+		return
+	}
+
+	if rerr := releasePremiumJob(job, friendly, err); rerr != nil {
+		log.Printf("premium queue: gagal mengembalikan saldo job %d: %v", job.ID, rerr)
+	}
+}
+
+// premiumJobSettled matches jobs that hold no balance or quota reservation
+// and can be removed from the history.
+const premiumJobSettled = "reserved_amount = 0 AND NOT (quota_gb > 0 AND status IN ('pending', 'processing'))"
+
+// premiumTopUpError means the final size costs more than was reserved and the
+// user's balance cannot cover the difference.
+type premiumTopUpError struct {
+	SizeBytes int64
+	Final     int64
+	Extra     int64
+}
+
+func (e *premiumTopUpError) Error() string {
+	return fmt.Sprintf("Ukuran file sebenarnya %.2f GB, biaya akhir Rp %d. Saldo tidak cukup untuk selisih Rp %d.",
+		float64(e.SizeBytes)/float64(1024*1024*1024), e.Final, e.Extra)
+}
+
+// repricePremiumJob recomputes the charge from the unrestricted (final) size.
+// The quote was based on the check result or the user's estimate, which can
+// be 0 or wrong. Batch children keep their share of the batch price. Quota
+// reserved at request time still covers its GB (up to the new size); any
+// extra GB are billed to the balance.
+func repricePremiumJob(tx *gorm.DB, job *database.PremiumRequest, fileSize int64) (original, final, discount int64, chargedGB int, err error) {
+	original, final, discount, chargedGB = job.OriginalPrice, job.Price, job.VoucherDiscount, job.ChargedGB
+	if job.BatchID != nil || fileSize <= 0 || fileSize == job.SizeBytes {
+		return
+	}
+
+	priceCfg, err := database.GetPricing("premium")
+	if err != nil {
+		return
+	}
+	price, _, gb := priceCfg.CalculatePrice(fileSize)
+	if price <= 0 {
+		price = priceCfg.PricePerUnit
+		gb = priceCfg.UnitSizeGB
+	}
+	price = quotaRemainder(price, gb, job.QuotaGB)
+
+	discount = 0
+	if job.VoucherCode != "" {
+		var v database.Voucher
+		if vErr := tx.Where("UPPER(code) = ?", strings.ToUpper(job.VoucherCode)).First(&v).Error; vErr == nil {
+			discount = computeVoucherDiscount(v, price)
+		} else {
+			discount = job.VoucherDiscount // voucher deleted since; keep the quoted discount
+		}
+		if discount > price {
+			discount = price
+		}
+	}
+	return price, price - discount, discount, gb, nil
+}
+
+// finalizePremiumJob stores the result and settles the reservation, re-priced
+// from the final size: the difference to the reservation is taken from or
+// refunded to the balance.
+func finalizePremiumJob(job *database.PremiumRequest, unrestricted debrid.Unrestricted, streamURL string) error {
+	fileSize := unrestricted.Filesize
+	if fileSize <= 0 {
+		fileSize = job.SizeBytes
+	}
+	sizeGB := "0 GB"
+	if fileSize > 0 {
+		sizeGB = fmt.Sprintf("%.2f GB", float64(fileSize)/float64(1024*1024*1024))
+	}
+	filename := firstNonEmpty(unrestricted.Filename, job.Filename)
+	now := time.Now()
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var current database.PremiumRequest
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, job.ID).Error; err != nil {
+			return err
+		}
+		if current.Status != "processing" {
+			return fmt.Errorf("job %d tidak lagi diproses", job.ID)
+		}
+
+		quoted := current.Price
+		original, final, discount, chargedGB, err := repricePremiumJob(tx, &current, fileSize)
+		if err != nil {
+			return err
+		}
+		quotaGB := min(current.QuotaGB, chargedGB)
+		if err := returnPremiumQuotaInTx(tx, current.SubscriptionID, current.ID, current.QuotaGB-quotaGB); err != nil {
+			return err
+		}
+		// extra > 0: charge more than reserved; extra < 0: refund the rest.
+		extra := final - current.ReservedAmount
+		if extra != 0 {
+			var user database.User
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, current.UserID).Error; err != nil {
+				return err
+			}
+			if extra > 0 && user.Balance < extra {
+				return &premiumTopUpError{SizeBytes: fileSize, Final: final, Extra: extra}
+			}
+			if err := tx.Model(&database.User{}).Where("id = ?", user.ID).
+				Update("balance", gorm.Expr("balance - ?", extra)).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&database.PremiumRequest{}).Where("id = ?", current.ID).
+			Updates(map[string]any{
+				"status":           "done",
+				"filename":         filename,
+				"host":             firstNonEmpty(unrestricted.Host, job.Host),
+				"size_bytes":       fileSize,
+				"result_url":       unrestricted.Download,
+				"stream_url":       streamURL,
+				"provider":         job.Provider,
+				"price":            final,
+				"quoted_price":     quoted,
+				"original_price":   original,
+				"voucher_discount": discount,
+				"charged_gb":       chargedGB,
+				"quota_gb":         quotaGB,
+				"reserved_amount":  0,
+				"error":            "",
+				"finished_at":      now,
+			}).Error; err != nil {
+			return err
+		}
+		job.Price, job.QuotedPrice, job.OriginalPrice, job.VoucherDiscount, job.ChargedGB, job.QuotaGB = final, quoted, original, discount, chargedGB, quotaGB
+
+		// The reservation was billed when the job was queued; only the
+		// difference to the final size is recorded here.
+		switch {
+		case extra > 0:
+			if err := createInvoicedTransaction(tx, &database.Transaction{
+				UserID:      job.UserID,
+				Amount:      -extra,
+				GrossAmount: extra,
+				Type:        "download",
+				Description: fmt.Sprintf("Premium Host: %s (%d GB%s) - selisih ukuran akhir Rp %d (estimasi Rp %d)", filename, job.ChargedGB, quotaNote(job.QuotaGB), extra, quoted),
+			}); err != nil {
+				return err
+			}
+		case extra < 0:
+			if err := tx.Create(&database.Transaction{
+				UserID:      job.UserID,
+				Amount:      -extra,
+				Type:        "refund",
+				Description: fmt.Sprintf("Refund Premium Host: %s (%d GB%s) - selisih ukuran akhir Rp %d (estimasi Rp %d)", filename, job.ChargedGB, quotaNote(job.QuotaGB), -extra, quoted),
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		notifMsg := fmt.Sprintf("Link premium siap diunduh. %s (%s). Biaya: Rp %d.", filename, sizeGB, job.Price)
+		if job.QuotaGB > 0 {
+			notifMsg += fmt.Sprintf(" %d GB dipotong dari kuota paket.", job.QuotaGB)
+		}
+		if final > quoted {
+			notifMsg += fmt.Sprintf(" Ukuran akhir lebih besar dari estimasi, selisih Rp %d dipotong dari saldo (estimasi awal Rp %d).", final-quoted, quoted)
+		} else if final < quoted {
+			notifMsg += fmt.Sprintf(" Ukuran akhir lebih kecil dari estimasi, selisih Rp %d dikembalikan ke saldo (estimasi awal Rp %d).", quoted-final, quoted)
+		}
+		if job.VoucherCode != "" && job.VoucherDiscount > 0 {
+			notifMsg += fmt.Sprintf(" Voucher %s dipakai (-Rp %d).", job.VoucherCode, job.VoucherDiscount)
+		}
+		if streamURL != "" {
+			notifMsg += " Tersedia juga link streaming."
+		}
+		return tx.Create(&database.Notification{
+			UserID:  job.UserID,
+			Title:   "Link premium siap",
+			Message: notifMsg,
+		}).Error
+	})
+}
+
+// releasePremiumJob marks the job failed and gives the reserved balance,
+// voucher and quota back.
+func releasePremiumJob(job *database.PremiumRequest, friendly string, cause error) error {
+	now := time.Now()
+	errMsg := friendly
+	if cause != nil {
+		errMsg = cause.Error()
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var current database.PremiumRequest
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, job.ID).Error; err != nil {
+			return err
+		}
+		if current.Status != "processing" && current.Status != "pending" {
+			return nil
+		}
+
+		if err := tx.Model(&database.PremiumRequest{}).Where("id = ?", current.ID).Updates(map[string]any{
+			"status":          "failed",
+			"reserved_amount": 0,
+			"error":           errMsg,
+			"finished_at":     now,
+		}).Error; err != nil {
+			return err
+		}
+
+		if current.ReservedAmount > 0 {
+			if err := tx.Model(&database.User{}).Where("id = ?", current.UserID).
+				Update("balance", gorm.Expr("balance + ?", current.ReservedAmount)).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&database.Transaction{
+				UserID:      current.UserID,
+				Amount:      current.ReservedAmount,
+				Type:        "refund",
+				Description: fmt.Sprintf("Refund Premium Host: %s - Rp %d", firstNonEmpty(current.Filename, current.URL), current.ReservedAmount),
+			}).Error; err != nil {
+				return err
+			}
+		}
+		if current.VoucherCode != "" {
+			if err := releaseVoucherInTx(tx, current.VoucherCode, current.UserID); err != nil {
+				return err
+			}
+		}
+		if current.BatchID != nil {
+			if err := releaseBatchVoucherInTx(tx, *current.BatchID); err != nil {
+				return err
+			}
+		}
+		if err := returnPremiumQuotaInTx(tx, current.SubscriptionID, current.ID, current.QuotaGB); err != nil {
+			return err
+		}
+
+		msg := fmt.Sprintf("Link premium %s gagal diproses: %s", current.URL, friendly)
+		if current.ReservedAmount > 0 {
+			msg += fmt.Sprintf(" Saldo Rp %d dikembalikan.", current.ReservedAmount)
+		}
+		if current.QuotaGB > 0 {
+			msg += fmt.Sprintf(" Kuota paket %d GB dikembalikan.", current.QuotaGB)
+		}
+		return tx.Create(&database.Notification{
+			UserID:  current.UserID,
+			Title:   "Link premium gagal",
+			Message: msg,
+		}).Error
+	})
+}
+
+// releaseBatchVoucherInTx gives back the voucher a batch was bought with once
+// every file of the batch has failed. The batch row lock orders concurrent
+// failures of its files, so only the last one releases.
+func releaseBatchVoucherInTx(tx *gorm.DB, batchID uint) error {
+	var batch database.PremiumBatch
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&batch, batchID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if batch.VoucherCode == "" {
+		return nil
+	}
+	var open int64
+	if err := tx.Model(&database.PremiumRequest{}).
+		Where("batch_id = ? AND status <> ?", batch.ID, "failed").
+		Count(&open).Error; err != nil {
+		return err
+	}
+	if open > 0 {
+		return nil
+	}
+	return releaseVoucherInTx(tx, batch.VoucherCode, batch.UserID)
+}
+
+// releaseVoucherInTx undoes one applyVoucherInTx use of the voucher by the user.
+func releaseVoucherInTx(tx *gorm.DB, rawCode string, userID uint) error {
+	code := strings.ToUpper(strings.TrimSpace(rawCode))
+	var v database.Voucher
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("UPPER(code) = ?", code).First(&v).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if err := tx.Model(&database.Voucher{}).
+		Where("id = ? AND used_count > 0", v.ID).
+		Update("used_count", gorm.Expr("used_count - 1")).Error; err != nil {
+		return err
+	}
+
+	var usage database.VoucherUsage
+	err := tx.Where("voucher_id = ? AND user_id = ?", v.ID, userID).Order("id desc").First(&usage).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Delete(&usage).Error
+}
+
+// premiumJobResponse is the shape returned for a single automatic request, both
+// right after enqueueing and when the client polls ?id=.
+func premiumJobResponse(job database.PremiumRequest, currentBalance *int64) map[string]any {
+	sizeGB := "0 GB"
+	if job.SizeBytes > 0 {
+		sizeGB = fmt.Sprintf("%.2f GB", float64(job.SizeBytes)/float64(1024*1024*1024))
+	}
+
+	message := "Link premium masuk antrian dan sedang diproses"
+	switch job.Status {
+	case "done":
+		message = "Link premium valid dan siap diunduh"
+	case "failed":
+		message = "Link premium gagal diproses. Saldo sudah dikembalikan."
+	}
+
+	resp := map[string]any{
+		"message":           message,
+		"id":                job.ID,
+		"mode":              firstNonEmpty(job.Mode, "manual"),
+		"provider":          job.Provider,
+		"status":            job.Status,
+		"filename":          job.Filename,
+		"host":              job.Host,
+		"size_bytes":        job.SizeBytes,
+		"size_gb":           sizeGB,
+		"price":             job.Price,
+		"original_price":    job.OriginalPrice,
+		"discount_amount":   job.VoucherDiscount,
+		"voucher_code":      job.VoucherCode,
+		"charged_gb":        job.ChargedGB,
+		"quota_gb":          job.QuotaGB,
+		"download_url":      job.ResultURL,
+		"stream_url":        job.StreamURL,
+		"error":             job.Error,
+		"attempts":          job.Attempts,
+		"refresh_count":     job.RefreshCount,
+		"link_refreshed_at": job.LinkRefreshedAt,
+	}
+	if currentBalance != nil {
+		resp["current_balance_after"] = *currentBalance
+	}
+	return resp
+}
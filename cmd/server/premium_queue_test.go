@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/debrid"
+	"github.com/youming-ai/pikpak-downloader/internal/realdebrid"
+)
+
+func TestQueueHoldsJobsForExhaustedHosts(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "queue@example.com", 0)
+
+	saved := debridProviders
+	t.Cleanup(func() { debridProviders = saved })
+	debridProviders = debrid.NewManager([]debrid.Provider{debrid.NewRealDebrid(realdebrid.NewClient("test"))}, nil)
+	debridProviders.SetExhaustedHosts("realdebrid", []string{"rapidgator.net"})
+
+	held := database.PremiumRequest{UserID: user.ID, URL: "https://rapidgator.net/file/abc", Mode: "automatic", Status: "pending"}
+	database.DB.Create(&held)
+
+	q := newPremiumJobQueue()
+	if job, ok := q.claimNext(); ok {
+		t.Fatalf("claimed job %d for a host without traffic", job.ID)
+	}
+	database.DB.First(&held, held.ID)
+	if held.Status != "pending" || held.Attempts != 0 || held.NextAttemptAt == nil {
+		t.Fatalf("held job: status %q, attempts %d, next attempt %v", held.Status, held.Attempts, held.NextAttemptAt)
+	}
+
+	other := database.PremiumRequest{UserID: user.ID, URL: "https://mega.nz/file/xyz", Mode: "automatic", Status: "pending"}
+	database.DB.Create(&other)
+	job, ok := q.claimNext()
+	if !ok || job.ID != other.ID {
+		t.Fatalf("claimNext = %v, %v; want job %d", job, ok, other.ID)
+	}
+}
+
+func TestMigrationBackfillsLegacyAutomaticRequests(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "legacy-premium@example.com", 0)
+
+	// Rows as the pre-queue handler wrote them: no mode, so the column default applies.
+	legacy := database.PremiumRequest{UserID: user.ID, URL: "https://rapidgator.net/file/1", Status: "done", Price: 5000, ResultURL: "https://dl.example/1"}
+	pending := database.PremiumRequest{UserID: user.ID, URL: "https://rapidgator.net/file/2", Status: "pending"}
+	database.DB.Create(&legacy)
+	database.DB.Create(&pending)
+
+	// A manual request an admin completed after the queue existed.
+	finished := time.Now()
+	manual := database.PremiumRequest{UserID: user.ID, URL: "https://rapidgator.net/file/3", Mode: "manual", Status: "done",
+		ResultURL: "https://dl.example/3", ClaimedBy: "admin:ops@example.com", FinishedAt: &finished}
+	database.DB.Create(&manual)
+
+	if err := database.AutoMigrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, tt := range []struct {
+		id       uint
+		mode     string
+		provider string
+	}{
+		{legacy.ID, "automatic", "realdebrid"},
+		{pending.ID, "manual", ""},
+		{manual.ID, "manual", ""},
+	} {
+		var got database.PremiumRequest
+		database.DB.First(&got, tt.id)
+		if got.Mode != tt.mode || got.Provider != tt.provider {
+			t.Errorf("request %d: mode %q provider %q, want %q %q", tt.id, got.Mode, got.Provider, tt.mode, tt.provider)
+		}
+	}
+}
+
+func TestRateLimiterClampsSettings(t *testing.T) {
+	tests := []struct {
+		perMinute, burst int
+	}{
+		{0, 0},
+		{-5, -1},
+		{30, 0},
+		{1 << 62, 1},
+	}
+	for _, tt := range tests {
+		l := newRateLimiter(tt.perMinute, tt.burst)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err := l.wait(ctx); err != nil {
+			t.Errorf("newRateLimiter(%d, %d): first call blocked: %v", tt.perMinute, tt.burst, err)
+		}
+		cancel()
+	}
+}
+
+func TestHandlersDoNotWaitForWorkers(t *testing.T) {
+	q := newPremiumJobQueue()
+	// Drain the workers' bucket.
+	for len(q.rate.tokens) > 0 {
+		<-q.rate.tokens
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := q.waitCheckRate(ctx); err != nil {
+		t.Fatalf("handler waited for the workers' bucket: %v", err)
+	}
+}
+
+func TestFinalizeFailureRetriesThenReleases(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "finalize@example.com", 0)
+
+	// No premium pricing in the test database: re-pricing the final size fails.
+	link := "https://rapidgator.net/file/finalize"
+	premiumLinks.put(link, "realdebrid", debrid.Unrestricted{Download: "https://dl.example/f", Filesize: 5 << 30}, "")
+	t.Cleanup(func() { premiumLinks.entries = make(map[string]cachedPremiumLink) })
+
+	job := database.PremiumRequest{UserID: user.ID, URL: link, Mode: "automatic", Status: "processing", ReservedAmount: 5000, Price: 5000, Attempts: 1}
+	database.DB.Create(&job)
+
+	q := newPremiumJobQueue()
+	q.maxAttempts = 2
+	q.process(&job)
+	var got database.PremiumRequest
+	database.DB.First(&got, job.ID)
+	if got.Status != "pending" || got.ReservedAmount != 5000 || got.NextAttemptAt == nil {
+		t.Fatalf("after first failure: status %q, reserved %d, next attempt %v; want pending", got.Status, got.ReservedAmount, got.NextAttemptAt)
+	}
+
+	database.DB.Model(&got).Updates(map[string]any{"status": "processing", "attempts": 2})
+	got.Status, got.Attempts = "processing", 2
+	q.process(&got)
+	database.DB.First(&got, job.ID)
+	var balance database.User
+	database.DB.First(&balance, user.ID)
+	if got.Status != "failed" || got.ReservedAmount != 0 || balance.Balance != 5000 {
+		t.Fatalf("after last attempt: status %q, reserved %d, balance %d; want failed and refunded", got.Status, got.ReservedAmount, balance.Balance)
+	}
+}
+
+func TestRecoverOnlyStaleJobs(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "lease@example.com", 0)
+
+	stale := time.Now().Add(-time.Hour)
+	fresh := time.Now().Add(-time.Minute)
+	abandoned := database.PremiumRequest{UserID: user.ID, URL: "https://rapidgator.net/file/a", Mode: "automatic", Status: "processing", StartedAt: &stale}
+	running := database.PremiumRequest{UserID: user.ID, URL: "https://rapidgator.net/file/b", Mode: "automatic", Status: "processing", StartedAt: &fresh}
+	database.DB.Create(&abandoned)
+	database.DB.Create(&running)
+
+	n, err := recoverStalePremiumJobs()
+	if err != nil || n != 1 {
+		t.Fatalf("recovered %d jobs (err %v), want 1", n, err)
+	}
+	database.DB.First(&abandoned, abandoned.ID)
+	database.DB.First(&running, running.ID)
+	if abandoned.Status != "pending" || running.Status != "processing" {
+		t.Fatalf("abandoned %q, running %q; want pending and processing", abandoned.Status, running.Status)
+	}
+}
+
+func TestPremiumRefundsAreRecorded(t *testing.T) {
+	newTestDB(t)
+	database.DB.Create(&database.Pricing{ServiceType: "premium", DisplayName: "Premium Host", PricePerUnit: 2000, UnitSizeGB: 2, IsActive: true})
+	user := newTestUser(t, "refund@example.com", 0)
+
+	// Reserved for 10 GB, finished at 2 GB: Rp 8.000 goes back.
+	smaller := database.PremiumRequest{UserID: user.ID, URL: "https://rapidgator.net/file/smaller", Mode: "automatic", Status: "processing",
+		SizeBytes: 10 << 30, Price: 10000, ReservedAmount: 10000, OriginalPrice: 10000, ChargedGB: 10}
+	failed := database.PremiumRequest{UserID: user.ID, URL: "https://rapidgator.net/file/failed", Mode: "automatic", Status: "processing",
+		Price: 4000, ReservedAmount: 4000}
+	database.DB.Create(&smaller)
+	database.DB.Create(&failed)
+
+	if err := finalizePremiumJob(&smaller, debrid.Unrestricted{Download: "https://dl.example/s", Filename: "s.bin", Filesize: 2 << 30}, ""); err != nil {
+		t.Fatalf("finalize: %v", err)
+	}
+	if err := releasePremiumJob(&failed, "gagal", nil); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handleTransactions(rec, withSession(httptest.NewRequest(http.MethodGet, "/api/transactions?type=refund", nil), user))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var rows []database.Transaction
+	if err := json.Unmarshal(rec.Body.Bytes(), &rows); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var total int64
+	for _, row := range rows {
+		if row.Type != "refund" {
+			t.Errorf("row %d has type %q", row.ID, row.Type)
+		}
+		total += row.Amount
+	}
+	var balance database.User
+	database.DB.First(&balance, user.ID)
+	if len(rows) != 2 || total != 12000 || balance.Balance != total {
+		t.Fatalf("got %d refund rows totalling %d, balance %d; want 2 rows of Rp 12.000", len(rows), total, balance.Balance)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/scheduler"
+	"gorm.io/gorm/clause"
+)
+
+// jobScheduler runs the periodic jobs registered in startScheduler.
+var jobScheduler *scheduler.Scheduler
+
+// dbJobStore keeps scheduler locks in ScheduledJob rows and runs in JobRun.
+type dbJobStore struct{}
+
+func (dbJobStore) Acquire(job, owner string, slot, until time.Time) (bool, error) {
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&database.ScheduledJob{Name: job}).Error; err != nil {
+		return false, err
+	}
+	now := time.Now()
+	updates := map[string]any{"locked_by": owner, "locked_until": until, "updated_at": now}
+	q := database.DB.Model(&database.ScheduledJob{}).
+		Where("name = ? AND (locked_until IS NULL OR locked_until < ?)", job, now)
+	if !slot.IsZero() {
+		q = q.Where("(last_slot IS NULL OR last_slot < ?)", slot)
+		updates["last_slot"] = slot
+	}
+	res := q.Updates(updates)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (dbJobStore) Release(job, owner string) error {
+	return database.DB.Model(&database.ScheduledJob{}).
+		Where("name = ? AND locked_by = ?", job, owner).
+		Updates(map[string]any{"locked_by": "", "locked_until": nil, "updated_at": time.Now()}).Error
+}
+
+func (dbJobStore) SaveRun(run *scheduler.Run) error {
+	row := database.JobRun{
+		ID:        run.ID,
+		Job:       run.Job,
+		Trigger:   run.Trigger,
+		Status:    run.Status,
+		Output:    run.Output,
+		Error:     run.Error,
+		StartedAt: run.StartedAt,
+	}
+	if !run.FinishedAt.IsZero() {
+		row.FinishedAt = &run.FinishedAt
+	}
+	if err := database.DB.Save(&row).Error; err != nil {
+		return err
+	}
+	run.ID = row.ID
+	return nil
+}
+
+// jobSpec is the schedule of a job: JOB_<NAME>_SPEC from .env, or def.
+func jobSpec(name, def string) string {
+	return firstNonEmpty(strings.TrimSpace(os.Getenv("JOB_"+strings.ToUpper(name)+"_SPEC")), def)
+}
+
+// startScheduler registers the periodic jobs and starts running them.
+func startScheduler() {
+	jobScheduler = scheduler.New(dbJobStore{})
+	add := func(name, def string, timeout time.Duration, fn scheduler.Func) {
+		if err := jobScheduler.Add(name, jobSpec(name, def), timeout, fn); err != nil {
+			log.Printf("⚠️ Scheduler: %v", err)
+		}
+	}
+
+	add("topup_expiry", "* * * * *", 5*time.Minute, func() (string, error) {
+		n, err := expireTopups(0)
+		return fmt.Sprintf("%d top up kedaluwarsa", n), err
+	})
+	if interval := envInt("USDT_CHECK_INTERVAL_SECONDS", 60); interval > 0 && len(cryptoExplorers) > 0 {
+		add("usdt_deposits", fmt.Sprintf("@every %ds", interval), 10*time.Minute, checkPendingCryptoDeposits)
+	}
+	add("subscription_renewal", "* * * * *", 10*time.Minute, renewSubscriptions)
+	if debridProviders.Enabled() {
+		add("premium_recovery", "*/5 * * * *", 5*time.Minute, func() (string, error) {
+			n, err := recoverStalePremiumJobs()
+			return fmt.Sprintf("%d job premium dikembalikan ke antrian", n), err
+		})
+		interval := envInt("HOST_SYNC_INTERVAL_MINUTES", 30)
+		add("host_sync", fmt.Sprintf("@every %dm", interval), 10*time.Minute, func() (string, error) {
+			res, err := syncHostAvailability()
+			return fmt.Sprintf("%d host dicek, %d baru, %d berubah, %d hilang", res.Checked, res.Created, res.Changed, res.Missing), err
+		})
+	}
+	add("job_runs_cleanup", "0 3 * * *", 10*time.Minute, cleanupJobRuns)
+	add("host_history_cleanup", "30 3 * * *", 10*time.Minute, cleanupHostStatusHistory)
+
+	jobScheduler.Start()
+	log.Printf("✅ Scheduler aktif (%d job)", len(jobScheduler.Jobs()))
+}
+
+// expireTopups closes awaiting_payment top ups past their deadline, for one
+// user or for everyone when userID is 0, and notifies each user once.
+func expireTopups(userID uint) (int, error) {
+	now := time.Now()
+	q := database.DB.Where("status = ? AND expires_at < ?", "awaiting_payment", now)
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+	var due []database.TopUpRequest
+	if err := q.Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, t := range due {
+		// Conditional so a concurrent payment or another run wins cleanly.
+		res := database.DB.Model(&database.TopUpRequest{}).
+			Where("id = ? AND status = ?", t.ID, "awaiting_payment").
+			Updates(map[string]any{"status": "expired", "updated_at": now})
+		if res.Error != nil {
+			return expired, res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+		expired++
+		database.DB.Create(&database.Notification{
+			UserID:  t.UserID,
+			Title:   "Top up kedaluwarsa",
+			Message: fmt.Sprintf("Top up %s Rp %d tidak dibayar sampai %s dan sudah ditutup.", t.Serial, t.Amount, t.ExpiresAt.Format("02 Jan 15:04")),
+		})
+	}
+	return expired, nil
+}
+
+// cleanupJobRuns deletes run history older than JOB_RUN_RETENTION_DAYS
+// (default 30).
+func cleanupJobRuns() (string, error) {
+	days := envInt("JOB_RUN_RETENTION_DAYS", 30)
+	if days <= 0 {
+		return "retensi dimatikan", nil
+	}
+	res := database.DB.Where("started_at < ?", time.Now().AddDate(0, 0, -days)).Delete(&database.JobRun{})
+	return fmt.Sprintf("%d run dihapus", res.RowsAffected), res.Error
+}
+
+// handleAdminJobs lists the jobs with their lock and last run.
+func handleAdminJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	var locks []database.ScheduledJob
+	database.DB.Find(&locks)
+	lockByName := make(map[string]database.ScheduledJob, len(locks))
+	for _, l := range locks {
+		lockByName[l.Name] = l
+	}
+
+	jobs := []map[string]any{}
+	if jobScheduler != nil {
+		for _, j := range jobScheduler.Jobs() {
+			item := map[string]any{
+				"name":         j.Name,
+				"spec":         j.Spec,
+				"timeout":      j.Timeout,
+				"next_run":     j.NextRun,
+				"locked_by":    "",
+				"locked_until": nil,
+				"last_run":     nil,
+			}
+			if l, ok := lockByName[j.Name]; ok && l.LockedUntil != nil && l.LockedUntil.After(time.Now()) {
+				item["locked_by"] = l.LockedBy
+				item["locked_until"] = l.LockedUntil
+			}
+			var last database.JobRun
+			if database.DB.Where("job = ?", j.Name).Order("id desc").First(&last).Error == nil {
+				item["last_run"] = last
+			}
+			jobs = append(jobs, item)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": jobs})
+}
+
+// handleAdminJobRuns pages through the run history, optionally of one job.
+func handleAdminJobRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 25
+	}
+
+	q := database.DB.Model(&database.JobRun{})
+	if job := strings.TrimSpace(r.URL.Query().Get("job")); job != "" {
+		q = q.Where("job = ?", job)
+	}
+	if status := strings.TrimSpace(r.URL.Query().Get("status")); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var total int64
+	q.Count(&total)
+	var runs []database.JobRun
+	if err := q.Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&runs).Error; err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Gagal mengambil riwayat job", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items":     runs,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// handleAdminJobRun runs a job now ({"name": "topup_expiry"}) and returns the
+// finished run.
+func handleAdminJobRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		writeJSONError(w, http.StatusBadRequest, "name is required", nil)
+		return
+	}
+	if jobScheduler == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "Scheduler belum aktif", nil)
+		return
+	}
+
+	run, err := jobScheduler.Trigger(strings.TrimSpace(req.Name))
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownJob):
+		writeJSONError(w, http.StatusNotFound, "Job tidak ditemukan", nil)
+		return
+	case errors.Is(err, scheduler.ErrLocked):
+		writeJSONError(w, http.StatusConflict, "Job sedang berjalan", nil)
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, "Gagal menjalankan job", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
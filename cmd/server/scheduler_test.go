@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+)
+
+func TestJobStoreLockContention(t *testing.T) {
+	newTestDB(t)
+	store := dbJobStore{}
+	slot := time.Now().Truncate(time.Minute)
+	until := time.Now().Add(time.Minute)
+
+	// Many instances race for the same slot; exactly one gets it.
+	const instances = 8
+	var wg sync.WaitGroup
+	won := make(chan string, instances)
+	for i := 0; i < instances; i++ {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			ok, err := store.Acquire("tick", owner, slot, until)
+			if err != nil {
+				t.Errorf("Acquire(%s): %v", owner, err)
+			}
+			if ok {
+				won <- owner
+			}
+		}(fmt.Sprintf("instance-%d", i))
+	}
+	wg.Wait()
+	close(won)
+	var winners []string
+	for owner := range won {
+		winners = append(winners, owner)
+	}
+	if len(winners) != 1 {
+		t.Fatalf("%d instances acquired the lock, want 1: %v", len(winners), winners)
+	}
+	holder := winners[0]
+
+	// Manual runs are refused while the lock is held, and only the holder releases it.
+	if ok, _ := store.Acquire("tick", "manual", time.Time{}, until); ok {
+		t.Fatal("manual run acquired a held lock")
+	}
+	if err := store.Release("tick", "someone-else"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := store.Acquire("tick", "manual", time.Time{}, until); ok {
+		t.Fatal("lock released by an instance that did not hold it")
+	}
+	if err := store.Release("tick", holder); err != nil {
+		t.Fatal(err)
+	}
+
+	// A slot that already ran is not run again, a later slot and manual runs are.
+	if ok, _ := store.Acquire("tick", "late", slot, until); ok {
+		t.Fatal("slot ran twice")
+	}
+	if ok, _ := store.Acquire("tick", "manual", time.Time{}, until); !ok {
+		t.Fatal("manual run refused after release")
+	}
+	store.Release("tick", "manual")
+	if ok, _ := store.Acquire("tick", "next", slot.Add(time.Minute), until); !ok {
+		t.Fatal("next slot refused")
+	}
+
+	// A lock left behind by a dead instance expires.
+	database.DB.Model(&database.ScheduledJob{}).Where("name = ?", "tick").Update("locked_until", time.Now().Add(-time.Second))
+	if ok, _ := store.Acquire("tick", "takeover", time.Time{}, until); !ok {
+		t.Fatal("expired lock not taken over")
+	}
+	var row database.ScheduledJob
+	database.DB.Where("name = ?", "tick").First(&row)
+	if row.LockedBy != "takeover" {
+		t.Fatalf("locked by %q, want takeover", row.LockedBy)
+	}
+}
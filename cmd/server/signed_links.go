@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/auth"
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+)
+
+const (
+	defaultSignedManifestTTL = 7 * 24 * time.Hour
+	maxSignedManifestTTL     = 30 * 24 * time.Hour
+)
+
+var manifestSigningKey []byte
+
+// loadManifestSigningKey reads MANIFEST_SIGNING_SECRET. Without it a random key is
+// generated, which means signed links stop working after a restart.
+func loadManifestSigningKey() ([]byte, error) {
+	if secret := strings.TrimSpace(os.Getenv("MANIFEST_SIGNING_SECRET")); secret != "" {
+		return []byte(secret), nil
+	}
+	log.Println("⚠️  MANIFEST_SIGNING_SECRET belum diatur. Link manifest bertanda tangan tidak bertahan setelah restart.")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate manifest signing key: %w", err)
+	}
+	return key, nil
+}
+
+func signParts(parts ...string) []byte {
+	mac := hmac.New(sha256.New, manifestSigningKey)
+	mac.Write([]byte(strings.Join(parts, "\n")))
+	return mac.Sum(nil)
+}
+
+func manifestSignature(folderID string, userID uint, exp int64) string {
+	sum := signParts("manifest", folderID, strconv.FormatUint(uint64(userID), 10), strconv.FormatInt(exp, 10))
+	return base64.RawURLEncoding.EncodeToString(sum)
+}
+
+// buildSignedManifestURL returns a manifest URL that can be fetched without the session cookie.
+func buildSignedManifestURL(baseURL, folderID, folderName, format string, userID uint, exp time.Time) string {
+	q := url.Values{}
+	q.Set("folder_id", folderID)
+	if strings.TrimSpace(folderName) != "" {
+		q.Set("folder_name", folderName)
+	}
+	if strings.TrimSpace(format) != "" {
+		q.Set("format", format)
+	}
+	q.Set("uid", strconv.FormatUint(uint64(userID), 10))
+	q.Set("exp", strconv.FormatInt(exp.Unix(), 10))
+	q.Set("sig", manifestSignature(folderID, userID, exp.Unix()))
+	return baseURL + "/api/folder/manifest?" + q.Encode()
+}
+
+// signedManifest is the verified signature of a manifest request.
+type signedManifest struct {
+	User *database.User
+	Exp  int64
+}
+
+type signedManifestKey struct{}
+
+// signedManifestFromRequest returns the signature requireAuthOrSignedManifest
+// verified, if the request came in through a signed URL.
+func signedManifestFromRequest(r *http.Request) (signedManifest, bool) {
+	signed, ok := r.Context().Value(signedManifestKey{}).(signedManifest)
+	return signed, ok
+}
+
+// verifySignedManifestRequest checks uid/exp/sig query params and returns the signing user.
+func verifySignedManifestRequest(r *http.Request) (signedManifest, bool) {
+	q := r.URL.Query()
+	sig := strings.TrimSpace(q.Get("sig"))
+	if sig == "" {
+		return signedManifest{}, false
+	}
+	uid64, err := strconv.ParseUint(strings.TrimSpace(q.Get("uid")), 10, 64)
+	if err != nil || uid64 == 0 {
+		return signedManifest{}, false
+	}
+	exp, err := strconv.ParseInt(strings.TrimSpace(q.Get("exp")), 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return signedManifest{}, false
+	}
+	expected := manifestSignature(q.Get("folder_id"), uint(uid64), exp)
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return signedManifest{}, false
+	}
+	user, ok := loadActiveUser(uint(uid64))
+	if !ok {
+		return signedManifest{}, false
+	}
+	return signedManifest{User: user, Exp: exp}, true
+}
+
+func loadActiveUser(userID uint) (*database.User, bool) {
+	var user database.User
+	if err := database.DB.First(&user, userID).Error; err != nil || !user.IsActive {
+		return nil, false
+	}
+	return &user, true
+}
+
+// requireAuthOrSignedManifest lets download managers fetch a manifest with a signed
+// URL, and falls back to the regular session check otherwise. The verified
+// signature is passed on in the request context.
+func requireAuthOrSignedManifest(next http.HandlerFunc) http.HandlerFunc {
+	authed := auth.RequireAuth(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimSpace(r.URL.Query().Get("sig")) != "" {
+			signed, ok := verifySignedManifestRequest(r)
+			if !ok {
+				writeJSONError(w, http.StatusForbidden, "Link manifest tidak valid atau sudah kedaluwarsa", nil)
+				return
+			}
+			next(w, r.WithContext(context.WithValue(r.Context(), signedManifestKey{}, signed)))
+			return
+		}
+		authed(w, r)
+	}
+}
+
+// signFileToken creates the opaque token used by GET /d/{signed}.
+func signFileToken(fileID string, userID uint, exp int64) string {
+	payload := fmt.Sprintf("%s|%d|%d", fileID, userID, exp)
+	sum := signParts("file", payload)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(sum)
+}
+
+func parseFileToken(token string) (fileID string, userID uint, err error) {
+	payloadPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", 0, fmt.Errorf("token tidak valid")
+	}
+	payloadRaw, err := base64.RawURLEncoding.DecodeString(payloadPart)
+	if err != nil {
+		return "", 0, fmt.Errorf("token tidak valid")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigPart)
+	if err != nil || !hmac.Equal(sig, signParts("file", string(payloadRaw))) {
+		return "", 0, fmt.Errorf("tanda tangan tidak valid")
+	}
+
+	parts := strings.Split(string(payloadRaw), "|")
+	if len(parts) != 3 {
+		return "", 0, fmt.Errorf("token tidak valid")
+	}
+	uid64, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("token tidak valid")
+	}
+	exp, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("token tidak valid")
+	}
+	if time.Now().Unix() > exp {
+		return "", 0, fmt.Errorf("link sudah kedaluwarsa")
+	}
+	return parts[0], uint(uid64), nil
+}
+
+// useSignedFileLinks swaps the expiring web_content_link values for /d/ redirect links.
+func useSignedFileLinks(entries []ManifestEntry, baseURL string, userID uint, exp int64) {
+	for i := range entries {
+		entries[i].WebContentLink = baseURL + "/d/" + signFileToken(entries[i].FileID, userID, exp)
+	}
+}
+
+// handleSignedManifestURL issues a cookie-less manifest URL for download managers.
+func handleSignedManifestURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+
+	session := auth.GetSessionFromRequest(r)
+	q := r.URL.Query()
+	folderID := strings.TrimSpace(q.Get("folder_id"))
+	if folderID == "" {
+		writeJSONError(w, http.StatusBadRequest, "folder_id is required", nil)
+		return
+	}
+	format := strings.ToLower(strings.TrimSpace(q.Get("format")))
+	if format == "" {
+		format = "json"
+	}
+	if !isValidManifestFormat(format) {
+		writeJSONError(w, http.StatusBadRequest, "invalid format. use "+manifestFormatList(), nil)
+		return
+	}
+
+	ttl := defaultSignedManifestTTL
+	if raw := strings.TrimSpace(q.Get("ttl_hours")); raw != "" {
+		if hours, err := strconv.Atoi(raw); err == nil && hours > 0 {
+			// Clamp before converting so huge values cannot overflow the Duration.
+			ttl = time.Duration(min(hours, int(maxSignedManifestTTL/time.Hour))) * time.Hour
+		}
+	}
+	exp := time.Now().Add(ttl)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"url":        buildSignedManifestURL(appBaseURL(r), folderID, q.Get("folder_name"), format, session.UserID, exp),
+		"expires_at": exp.UTC(),
+		"format":     format,
+	})
+}
+
+// handleSignedFileRedirect resolves a fresh PikPak link at fetch time so long
+// running download manager jobs never hit an expired web_content_link.
+func handleSignedFileRedirect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, "/d/")
+	if i := strings.Index(token, "/"); i >= 0 {
+		token = token[:i] // allow a trailing /<filename> for download managers
+	}
+	fileID, userID, err := parseFileToken(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if _, ok := loadActiveUser(userID); !ok {
+		http.Error(w, "Akun tidak aktif", http.StatusForbidden)
+		return
+	}
+
+	link, err := globalClient.GetDownloadUrl(fileID)
+	if err != nil || strings.TrimSpace(link) == "" {
+		http.Error(w, fmt.Sprintf("Failed to get link: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, link, http.StatusFound)
+}
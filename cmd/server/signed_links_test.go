@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func useSigningKey(t *testing.T) {
+	prev := manifestSigningKey
+	manifestSigningKey = []byte("test-key")
+	t.Cleanup(func() { manifestSigningKey = prev })
+}
+
+func TestSignedManifestURLClampsTTL(t *testing.T) {
+	newTestDB(t)
+	useSigningKey(t)
+	user := newTestUser(t, "signed@example.com", 0)
+
+	for _, hours := range []string{"720", "9223372036854775807"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/folder/manifest/signed?folder_id=F1&ttl_hours="+hours, nil)
+		handleSignedManifestURL(rec, withSession(req, user))
+		var resp struct {
+			ExpiresAt time.Time `json:"expires_at"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("ttl_hours=%s: status %d: %s", hours, rec.Code, rec.Body)
+		}
+		if until := time.Until(resp.ExpiresAt); until <= 0 || until > maxSignedManifestTTL {
+			t.Errorf("ttl_hours=%s: expires in %v, want at most %v", hours, until, maxSignedManifestTTL)
+		}
+	}
+}
+
+func TestSignedManifestIsPassedToHandler(t *testing.T) {
+	newTestDB(t)
+	useSigningKey(t)
+	user := newTestUser(t, "signed-ctx@example.com", 0)
+	exp := time.Now().Add(time.Hour)
+
+	var got signedManifest
+	var ok bool
+	handler := requireAuthOrSignedManifest(func(w http.ResponseWriter, r *http.Request) {
+		got, ok = signedManifestFromRequest(r)
+	})
+
+	u, _ := url.Parse(buildSignedManifestURL("http://localhost", "F1", "", "aria2", user.ID, exp))
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, u.RequestURI(), nil))
+	if !ok || got.User.ID != user.ID || got.Exp != exp.Unix() {
+		t.Fatalf("handler saw %+v (ok %v), want user %d expiring %d", got, ok, user.ID, exp.Unix())
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, u.RequestURI()+"x", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("tampered signature: status %d, want 403", rec.Code)
+	}
+}
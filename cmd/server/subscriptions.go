@@ -0,0 +1,598 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/auth"
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// quotaColumns are the used-GB counters of Subscription per service type.
+var quotaColumns = map[string]string{
+	"torrent": "torrent_used_gb",
+	"premium": "premium_used_gb",
+}
+
+// quotaLeft is the GB of serviceType still unused in the period.
+func quotaLeft(sub database.Subscription, serviceType string) int {
+	left := 0
+	switch serviceType {
+	case "torrent":
+		left = sub.TorrentGB - sub.TorrentUsedGB
+	case "premium":
+		left = sub.PremiumGB - sub.PremiumUsedGB
+	}
+	return max(left, 0)
+}
+
+// currentSubscriptionInTx locks the user's running period, nil when there is
+// none. Callers lock it before the user row.
+func currentSubscriptionInTx(tx *gorm.DB, userID uint, now time.Time) (*database.Subscription, error) {
+	var sub database.Subscription
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND status = ? AND period_start <= ? AND period_end > ?", userID, "active", now, now).
+		Order("period_end desc").
+		First(&sub).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// subscriptionPriority is the premium queue priority of the user's running
+// period, 0 without one. It does not lock, so it is safe after the user row.
+func subscriptionPriority(db *gorm.DB, userID uint) int {
+	var sub database.Subscription
+	now := time.Now()
+	if err := db.Where("user_id = ? AND status = ? AND period_start <= ? AND period_end > ?", userID, "active", now, now).
+		Order("period_end desc").
+		First(&sub).Error; err != nil {
+		return 0
+	}
+	return sub.Priority
+}
+
+// takeQuotaInTx covers up to gb of a serviceType charge from the user's
+// running period. It returns the period (nil without one) and the GB covered;
+// record the use with recordQuotaUsageInTx.
+func takeQuotaInTx(tx *gorm.DB, userID uint, serviceType string, gb int) (*database.Subscription, int, error) {
+	sub, err := currentSubscriptionInTx(tx, userID, time.Now())
+	if err != nil || sub == nil {
+		return nil, 0, err
+	}
+	covered := min(gb, quotaLeft(*sub, serviceType))
+	if covered <= 0 {
+		return sub, 0, nil
+	}
+	col := quotaColumns[serviceType]
+	if err := tx.Model(&database.Subscription{}).Where("id = ?", sub.ID).
+		Update(col, gorm.Expr(col+" + ?", covered)).Error; err != nil {
+		return nil, 0, err
+	}
+	return sub, covered, nil
+}
+
+// recordQuotaUsageInTx logs GB taken by takeQuotaInTx.
+func recordQuotaUsageInTx(tx *gorm.DB, sub *database.Subscription, serviceType string, gb int, description string, premiumRequestID uint) error {
+	if sub == nil || gb <= 0 {
+		return nil
+	}
+	return tx.Create(&database.SubscriptionUsage{
+		SubscriptionID:   sub.ID,
+		UserID:           sub.UserID,
+		ServiceType:      serviceType,
+		GB:               gb,
+		Description:      description,
+		PremiumRequestID: premiumRequestID,
+	}).Error
+}
+
+// returnPremiumQuotaInTx gives gb of a premium request's quota back to its
+// period, e.g. when the job fails or turns out smaller than quoted.
+func returnPremiumQuotaInTx(tx *gorm.DB, subscriptionID, premiumRequestID uint, gb int) error {
+	if subscriptionID == 0 || gb <= 0 {
+		return nil
+	}
+	if err := tx.Model(&database.Subscription{}).Where("id = ?", subscriptionID).
+		Update("premium_used_gb", gorm.Expr("GREATEST(premium_used_gb - ?, 0)", gb)).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&database.SubscriptionUsage{}).
+		Where("subscription_id = ? AND premium_request_id = ?", subscriptionID, premiumRequestID).
+		Update("gb", gorm.Expr("gb - ?", gb)).Error; err != nil {
+		return err
+	}
+	return tx.Where("subscription_id = ? AND premium_request_id = ? AND gb <= 0", subscriptionID, premiumRequestID).
+		Delete(&database.SubscriptionUsage{}).Error
+}
+
+// quotaRemainder is the part of price for the GB the quota did not cover,
+// rounded up.
+func quotaRemainder(price int64, chargedGB, covered int) int64 {
+	if covered <= 0 || chargedGB <= 0 {
+		return price
+	}
+	if covered >= chargedGB {
+		return 0
+	}
+	rest := int64(chargedGB - covered)
+	return (price*rest + int64(chargedGB) - 1) / int64(chargedGB)
+}
+
+// quotaNote is appended to charge descriptions and messages.
+func quotaNote(covered int) string {
+	if covered <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(", %d GB dari kuota paket", covered)
+}
+
+// startSubscriptionInTx takes the plan price from the balance and opens a
+// period from start. It returns the new period and the balance after.
+func startSubscriptionInTx(tx *gorm.DB, userID uint, plan database.Plan, start time.Time, autoRenew bool) (*database.Subscription, int64, error) {
+	var user database.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+		return nil, 0, err
+	}
+	if user.Balance < plan.Price {
+		return nil, user.Balance, errInsufficientBalance
+	}
+
+	sub := database.Subscription{
+		UserID:        userID,
+		PlanID:        plan.ID,
+		PlanName:      plan.Name,
+		Status:        "active",
+		AutoRenew:     autoRenew,
+		Price:         plan.Price,
+		PeriodStart:   start,
+		PeriodEnd:     start.AddDate(0, plan.PeriodMonths, 0),
+		TorrentGB:     plan.TorrentGB,
+		PremiumGB:     plan.PremiumGB,
+		StorageGB:     plan.StorageGB,
+		RetentionDays: plan.RetentionDays,
+		Priority:      plan.Priority,
+	}
+	if err := tx.Create(&sub).Error; err != nil {
+		return nil, 0, err
+	}
+	if plan.Price == 0 {
+		return &sub, user.Balance, nil
+	}
+
+	if err := tx.Model(&database.User{}).Where("id = ?", userID).
+		Update("balance", gorm.Expr("balance - ?", plan.Price)).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := createInvoicedTransaction(tx, &database.Transaction{
+		UserID:      userID,
+		Amount:      -plan.Price,
+		GrossAmount: plan.Price,
+		Type:        "subscription",
+		Description: fmt.Sprintf("Paket %s (%s - %s) - Rp %d", plan.Name, formatIDDate(sub.PeriodStart), formatIDDate(sub.PeriodEnd), plan.Price),
+	}); err != nil {
+		return nil, 0, err
+	}
+	return &sub, user.Balance - plan.Price, nil
+}
+
+// renewSubscriptions closes periods that have ended and, with auto renew on,
+// starts the next one from the balance. Without enough balance, or when the
+// plan is gone or inactive, the subscription just ends.
+func renewSubscriptions() (string, error) {
+	now := time.Now()
+	var due []database.Subscription
+	if err := database.DB.Where("status = ? AND period_end <= ?", "active", now).Find(&due).Error; err != nil {
+		return "", err
+	}
+
+	renewed, ended := 0, 0
+	for _, s := range due {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			var sub database.Subscription
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sub, s.ID).Error; err != nil {
+				return err
+			}
+			if sub.Status != "active" {
+				return nil
+			}
+			if err := tx.Model(&database.Subscription{}).Where("id = ?", sub.ID).Update("status", "expired").Error; err != nil {
+				return err
+			}
+
+			reason := ""
+			var plan database.Plan
+			switch {
+			case !sub.AutoRenew:
+				// Ends as the user asked.
+			case tx.First(&plan, sub.PlanID).Error != nil || !plan.IsActive:
+				reason = " Paket ini sudah tidak tersedia untuk diperpanjang."
+			default:
+				// Continue from the old end so periods stay aligned, unless
+				// the server was down for longer than a whole period.
+				start := sub.PeriodEnd
+				if !start.AddDate(0, plan.PeriodMonths, 0).After(now) {
+					start = now
+				}
+				next, _, err := startSubscriptionInTx(tx, sub.UserID, plan, start, true)
+				if errors.Is(err, errInsufficientBalance) {
+					reason = fmt.Sprintf(" Saldo tidak cukup untuk perpanjangan %s.", formatRupiah(plan.Price))
+					break
+				}
+				if err != nil {
+					return err
+				}
+				renewed++
+				return tx.Create(&database.Notification{
+					UserID:  sub.UserID,
+					Title:   "Paket diperpanjang",
+					Message: fmt.Sprintf("Paket %s diperpanjang sampai %s. Biaya %s dipotong dari saldo.", plan.Name, formatIDDate(next.PeriodEnd), formatRupiah(plan.Price)),
+				}).Error
+			}
+
+			ended++
+			return tx.Create(&database.Notification{
+				UserID:  sub.UserID,
+				Title:   "Paket berakhir",
+				Message: fmt.Sprintf("Paket %s sudah berakhir; unduhan kembali memakai saldo.%s", sub.PlanName, reason),
+			}).Error
+		})
+		if err != nil {
+			log.Printf("perpanjang paket %d: %v", s.ID, err)
+		}
+	}
+	return fmt.Sprintf("%d diperpanjang, %d berakhir", renewed, ended), nil
+}
+
+// normalizePlan trims and validates a plan from the admin API.
+func normalizePlan(p *database.Plan) error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Description = strings.TrimSpace(p.Description)
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	if p.Price < 0 {
+		return errors.New("price must not be negative")
+	}
+	if p.PeriodMonths < 1 || p.PeriodMonths > 12 {
+		return errors.New("period_months must be 1-12")
+	}
+	if p.TorrentGB < 0 || p.PremiumGB < 0 || p.StorageGB < 0 || p.RetentionDays < 0 {
+		return errors.New("quotas must not be negative")
+	}
+	if p.TorrentGB == 0 && p.PremiumGB == 0 {
+		return errors.New("torrent_gb or premium_gb is required")
+	}
+	return nil
+}
+
+// handlePlans lists the plans users can buy.
+func handlePlans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	var plans []database.Plan
+	if err := database.DB.Where("is_active = ?", true).Order("sort_order asc, price asc").Find(&plans).Error; err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Gagal mengambil daftar paket", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, plans)
+}
+
+// handleSubscription shows (GET), buys (POST {plan_id, auto_renew}) or
+// toggles auto renew of (PATCH {auto_renew}) the user's subscription.
+func handleSubscription(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSessionFromRequest(r)
+	if session == nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", nil)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		now := time.Now()
+		var sub *database.Subscription
+		var current database.Subscription
+		err := database.DB.Where("user_id = ? AND status = ? AND period_start <= ? AND period_end > ?", session.UserID, "active", now, now).
+			Order("period_end desc").
+			First(&current).Error
+		switch {
+		case err == nil:
+			sub = &current
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			writeJSONError(w, http.StatusInternalServerError, "Gagal mengambil paket", err)
+			return
+		}
+		usage := []database.SubscriptionUsage{}
+		if sub != nil {
+			database.DB.Where("subscription_id = ?", sub.ID).Order("created_at desc").Limit(50).Find(&usage)
+		}
+		var history []database.Subscription
+		database.DB.Where("user_id = ?", session.UserID).Order("period_start desc").Limit(12).Find(&history)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"subscription": sub,
+			"usage":        usage,
+			"history":      history,
+		})
+		return
+
+	case http.MethodPost:
+		var req struct {
+			PlanID    uint  `json:"plan_id"`
+			AutoRenew *bool `json:"auto_renew"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		var plan database.Plan
+		if err := database.DB.Where("id = ? AND is_active = ?", req.PlanID, true).First(&plan).Error; err != nil {
+			writeJSONError(w, http.StatusNotFound, "Paket tidak ditemukan", nil)
+			return
+		}
+		autoRenew := req.AutoRenew == nil || *req.AutoRenew
+
+		var sub *database.Subscription
+		var balance int64
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			// The user row lock serializes purchases; the period is only read
+			// so the lock order stays period -> user everywhere else.
+			var user database.User
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, session.UserID).Error; err != nil {
+				return err
+			}
+			var running int64
+			now := time.Now()
+			tx.Model(&database.Subscription{}).
+				Where("user_id = ? AND status = ? AND period_end > ?", session.UserID, "active", now).
+				Count(&running)
+			if running > 0 {
+				return errSubscriptionActive
+			}
+			var err error
+			sub, balance, err = startSubscriptionInTx(tx, session.UserID, plan, now, autoRenew)
+			if err != nil {
+				return err
+			}
+			return tx.Create(&database.Notification{
+				UserID:  session.UserID,
+				Title:   "Paket aktif",
+				Message: fmt.Sprintf("Paket %s aktif sampai %s.", plan.Name, formatIDDate(sub.PeriodEnd)),
+			}).Error
+		})
+		switch {
+		case errors.Is(err, errInsufficientBalance):
+			writeJSON(w, http.StatusPaymentRequired, map[string]any{
+				"code":            "insufficient_balance",
+				"message":         "Saldo tidak mencukupi untuk membeli paket ini",
+				"required_price":  plan.Price,
+				"current_balance": balance,
+			})
+			return
+		case errors.Is(err, errSubscriptionActive):
+			writeJSONError(w, http.StatusConflict, errSubscriptionActive.message, err)
+			return
+		case err != nil:
+			writeJSONError(w, http.StatusInternalServerError, "Gagal membeli paket", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"subscription":          sub,
+			"current_balance_after": balance,
+		})
+		return
+
+	case http.MethodPatch:
+		var req struct {
+			AutoRenew bool `json:"auto_renew"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		res := database.DB.Model(&database.Subscription{}).
+			Where("user_id = ? AND status = ? AND period_end > ?", session.UserID, "active", time.Now()).
+			Update("auto_renew", req.AutoRenew)
+		if res.Error != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Gagal mengubah paket", res.Error)
+			return
+		}
+		if res.RowsAffected == 0 {
+			writeJSONError(w, http.StatusNotFound, "Tidak ada paket aktif", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"auto_renew": req.AutoRenew})
+		return
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+}
+
+// handleAdminPlans manages plans. Running periods keep the quotas they were
+// bought with; edits apply from the next purchase or renewal.
+func handleAdminPlans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var plans []database.Plan
+		if err := database.DB.Order("sort_order asc, price asc").Find(&plans).Error; err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to fetch plans", nil)
+			return
+		}
+		var stats []struct {
+			PlanID uint
+			Active int64
+		}
+		database.DB.Model(&database.Subscription{}).
+			Select("plan_id, COUNT(*) AS active").
+			Where("status = ? AND period_end > ?", "active", time.Now()).
+			Group("plan_id").
+			Scan(&stats)
+		active := make(map[uint]int64, len(stats))
+		for _, s := range stats {
+			active[s.PlanID] = s.Active
+		}
+
+		items := make([]map[string]any, 0, len(plans))
+		for _, p := range plans {
+			items = append(items, map[string]any{
+				"plan":         p,
+				"active_count": active[p.ID],
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+		return
+
+	case http.MethodPost:
+		// A plan is active unless the body says otherwise.
+		req := database.Plan{IsActive: true}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		req.ID = 0
+		if err := normalizePlan(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		if err := database.DB.Create(&req).Error; err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to create plan", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, req)
+		return
+
+	case http.MethodPatch:
+		// Decode over the stored row so omitted fields keep their values.
+		var body json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		var ref struct {
+			ID uint `json:"id"`
+		}
+		if err := json.Unmarshal(body, &ref); err != nil || ref.ID == 0 {
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
+			return
+		}
+
+		var plan database.Plan
+		if err := database.DB.First(&plan, ref.ID).Error; err != nil {
+			writeJSONError(w, http.StatusNotFound, "Plan not found", nil)
+			return
+		}
+		if err := json.Unmarshal(body, &plan); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		plan.ID = ref.ID
+		if err := normalizePlan(&plan); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+
+		if err := database.DB.Model(&database.Plan{}).Where("id = ?", plan.ID).Updates(map[string]any{
+			"name":           plan.Name,
+			"description":    plan.Description,
+			"price":          plan.Price,
+			"period_months":  plan.PeriodMonths,
+			"torrent_gb":     plan.TorrentGB,
+			"premium_gb":     plan.PremiumGB,
+			"storage_gb":     plan.StorageGB,
+			"retention_days": plan.RetentionDays,
+			"priority":       plan.Priority,
+			"sort_order":     plan.SortOrder,
+			"is_active":      plan.IsActive,
+		}).Error; err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to update plan", nil)
+			return
+		}
+		database.DB.First(&plan, plan.ID)
+		writeJSON(w, http.StatusOK, plan)
+		return
+
+	case http.MethodDelete:
+		id, _ := strconv.Atoi(strings.TrimSpace(r.URL.Query().Get("id")))
+		if id <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
+			return
+		}
+		// Running periods keep their quotas but are not renewed.
+		if err := database.DB.Delete(&database.Plan{}, id).Error; err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to delete plan", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"message": "Plan deleted"})
+		return
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+}
+
+// handleAdminSubscriptions pages through subscription periods with the
+// user's email, optionally filtered by status and user_id.
+func handleAdminSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	values := r.URL.Query()
+	page, _ := strconv.Atoi(values.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(values.Get("page_size"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 25
+	}
+
+	query := func() *gorm.DB {
+		q := database.DB.Model(&database.Subscription{}).
+			Joins("LEFT JOIN users ON users.id = subscriptions.user_id")
+		if status := strings.TrimSpace(values.Get("status")); status != "" {
+			q = q.Where("subscriptions.status = ?", status)
+		}
+		if userID, _ := strconv.Atoi(values.Get("user_id")); userID > 0 {
+			q = q.Where("subscriptions.user_id = ?", userID)
+		}
+		return q
+	}
+
+	var total int64
+	query().Count(&total)
+	var items []struct {
+		database.Subscription
+		UserEmail string `json:"user_email"`
+	}
+	if err := query().Select("subscriptions.*, users.email AS user_email").
+		Order("subscriptions.period_start desc, subscriptions.id desc").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Scan(&items).Error; err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to fetch subscriptions", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items":     items,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+)
+
+func newTestPlan(t *testing.T) database.Plan {
+	t.Helper()
+	plan := database.Plan{Name: "Hemat", Price: 50000, PeriodMonths: 1, TorrentGB: 100, PremiumGB: 20, IsActive: true}
+	if err := database.DB.Create(&plan).Error; err != nil {
+		t.Fatalf("create plan: %v", err)
+	}
+	return plan
+}
+
+func buyPlan(t *testing.T, user database.User, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := withSession(httptest.NewRequest(http.MethodPost, "/api/subscription", strings.NewReader(body)), user)
+	rec := httptest.NewRecorder()
+	handleSubscription(rec, req)
+	return rec
+}
+
+func TestBuySubscriptionWithoutAutoRenew(t *testing.T) {
+	newTestDB(t)
+	plan := newTestPlan(t)
+	user := newTestUser(t, "hemat@example.com", 80000)
+
+	rec := buyPlan(t, user, fmt.Sprintf(`{"plan_id":%d,"auto_renew":false}`, plan.ID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("buy: status %d: %s", rec.Code, rec.Body)
+	}
+
+	var sub database.Subscription
+	if err := database.DB.Where("user_id = ?", user.ID).First(&sub).Error; err != nil {
+		t.Fatalf("load subscription: %v", err)
+	}
+	if sub.AutoRenew {
+		t.Fatal("stored auto_renew = true, want false")
+	}
+	var after database.User
+	database.DB.First(&after, user.ID)
+	if after.Balance != 30000 {
+		t.Fatalf("balance = %d, want 30000", after.Balance)
+	}
+
+	// At the end of the period it must end without charging again.
+	database.DB.Model(&database.Subscription{}).Where("id = ?", sub.ID).
+		Updates(map[string]any{"period_start": time.Now().AddDate(0, -1, -1), "period_end": time.Now().Add(-time.Minute)})
+	if _, err := renewSubscriptions(); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	database.DB.First(&after, user.ID)
+	if after.Balance != 30000 {
+		t.Fatalf("balance after renewal run = %d, want 30000", after.Balance)
+	}
+	var count int64
+	database.DB.Model(&database.Subscription{}).Where("user_id = ?", user.ID).Count(&count)
+	database.DB.First(&sub, sub.ID)
+	if count != 1 || sub.Status != "expired" {
+		t.Fatalf("periods = %d, status = %q; want 1 expired period", count, sub.Status)
+	}
+}
+
+func TestRenewSubscriptionChargesBalance(t *testing.T) {
+	newTestDB(t)
+	plan := newTestPlan(t)
+	user := newTestUser(t, "renew@example.com", 120000)
+
+	if rec := buyPlan(t, user, fmt.Sprintf(`{"plan_id":%d}`, plan.ID)); rec.Code != http.StatusOK {
+		t.Fatalf("buy: status %d: %s", rec.Code, rec.Body)
+	}
+	var sub database.Subscription
+	database.DB.Where("user_id = ?", user.ID).First(&sub)
+	if !sub.AutoRenew {
+		t.Fatal("auto_renew should default to true")
+	}
+	end := time.Now().Add(-time.Minute)
+	database.DB.Model(&database.Subscription{}).Where("id = ?", sub.ID).
+		Updates(map[string]any{"period_start": end.AddDate(0, -1, 0), "period_end": end})
+
+	if _, err := renewSubscriptions(); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	var after database.User
+	database.DB.First(&after, user.ID)
+	if after.Balance != 20000 {
+		t.Fatalf("balance = %d, want 20000", after.Balance)
+	}
+	var next database.Subscription
+	if err := database.DB.Where("user_id = ? AND status = ?", user.ID, "active").First(&next).Error; err != nil {
+		t.Fatalf("no renewed period: %v", err)
+	}
+	if !next.PeriodStart.Equal(end) || next.TorrentUsedGB != 0 {
+		t.Fatalf("renewed period starts %v (want %v), used %d GB", next.PeriodStart, end, next.TorrentUsedGB)
+	}
+}
+
+func TestInactivePlanStaysInactive(t *testing.T) {
+	newTestDB(t)
+	rec := httptest.NewRecorder()
+	handleAdminPlans(rec, httptest.NewRequest(http.MethodPost, "/api/admin/plans",
+		strings.NewReader(`{"name":"Draft","price":1000,"period_months":1,"torrent_gb":10,"is_active":false}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body)
+	}
+	var plan database.Plan
+	database.DB.Where("name = ?", "Draft").First(&plan)
+	if plan.IsActive {
+		t.Fatal("plan created with is_active false is stored active")
+	}
+}
+
+func TestTakeQuota(t *testing.T) {
+	newTestDB(t)
+	plan := newTestPlan(t)
+	user := newTestUser(t, "quota@example.com", 60000)
+	if rec := buyPlan(t, user, fmt.Sprintf(`{"plan_id":%d}`, plan.ID)); rec.Code != http.StatusOK {
+		t.Fatalf("buy: status %d: %s", rec.Code, rec.Body)
+	}
+
+	_, covered, err := takeQuotaInTx(database.DB, user.ID, "premium", 15)
+	if err != nil || covered != 15 {
+		t.Fatalf("first take: covered %d, err %v", covered, err)
+	}
+	_, covered, err = takeQuotaInTx(database.DB, user.ID, "premium", 8)
+	if err != nil || covered != 5 {
+		t.Fatalf("second take: covered %d, want the 5 GB left (err %v)", covered, err)
+	}
+	if got := quotaRemainder(16000, 8, covered); got != 6000 {
+		t.Fatalf("remainder = %d, want 6000", got)
+	}
+}
+
+func TestQuotaRemainder(t *testing.T) {
+	tests := []struct {
+		price            int64
+		chargedGB, quota int
+		want             int64
+	}{
+		{6500, 10, 0, 6500},
+		{6500, 10, 10, 0},
+		{6500, 10, 12, 0},
+		{6500, 10, 3, 4550},
+		{2000, 2, 1, 1000},
+		{4000, 3, 1, 2667}, // rounded up
+	}
+	for _, tt := range tests {
+		if got := quotaRemainder(tt.price, tt.chargedGB, tt.quota); got != tt.want {
+			t.Errorf("quotaRemainder(%d, %d, %d) = %d, want %d", tt.price, tt.chargedGB, tt.quota, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/youming-ai/pikpak-downloader/internal/auth"
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB points database.DB at a fresh SQLite database with every table
+// migrated. Row locks are not enforced by SQLite; tests that need them
+// exercise the conditional updates instead.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	prev := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = prev
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := database.AutoMigrate(); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	return db
+}
+
+// newTestUser creates a client with the given balance.
+func newTestUser(t *testing.T, email string, balance int64) database.User {
+	t.Helper()
+	user := database.User{Email: email, Name: email, Password: "x", Role: "client", Balance: balance}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// withSession adds a session cookie for user to r.
+func withSession(r *http.Request, user database.User) *http.Request {
+	id := auth.CreateSession(user.ID, user.Email, user.Name, "", user.Role)
+	r.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: id})
+	return r
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/auth"
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"gorm.io/gorm"
+)
+
+// topupPromoBonus is the bonus promo p gives for a top up of amount: the
+// highest tier not above amount decides, 0 when amount is below every tier.
+func topupPromoBonus(p database.TopupPromo, amount int64) int64 {
+	var tier *database.TopupPromoTier
+	for i := range p.Tiers {
+		t := &p.Tiers[i]
+		if amount >= t.MinAmount && (tier == nil || t.MinAmount > tier.MinAmount) {
+			tier = t
+		}
+	}
+	if tier == nil {
+		return 0
+	}
+	if tier.BonusType == "fixed" {
+		return tier.BonusValue
+	}
+	bonus := amount * tier.BonusValue / 100
+	if tier.MaxBonus > 0 && bonus > tier.MaxBonus {
+		bonus = tier.MaxBonus
+	}
+	return bonus
+}
+
+// topupPromoEligible reports whether userID may still get a bonus from p:
+// the per-user limit is not used up and, for first-top-up promos, the user
+// has no approved top up yet.
+func topupPromoEligible(db *gorm.DB, p database.TopupPromo, userID uint) (bool, error) {
+	if p.PerUserLimit > 0 {
+		var used int64
+		if err := db.Model(&database.TopupPromoUsage{}).Where("promo_id = ? AND user_id = ?", p.ID, userID).Count(&used).Error; err != nil {
+			return false, err
+		}
+		if used >= int64(p.PerUserLimit) {
+			return false, nil
+		}
+	}
+	if p.FirstTopupOnly {
+		var approved int64
+		if err := db.Model(&database.TopUpRequest{}).Where("user_id = ? AND status = ?", userID, "approved").Count(&approved).Error; err != nil {
+			return false, err
+		}
+		if approved > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// runningTopupPromos loads the active promos whose window contains now.
+func runningTopupPromos(now time.Time) ([]database.TopupPromo, error) {
+	var promos []database.TopupPromo
+	err := database.DB.Preload("Tiers").
+		Where("is_active = ? AND (starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at > ?)", true, now, now).
+		Order("id asc").
+		Find(&promos).Error
+	return promos, err
+}
+
+// eligibleTopupPromos is runningTopupPromos narrowed to those userID can
+// still use.
+func eligibleTopupPromos(userID uint, now time.Time) ([]database.TopupPromo, error) {
+	promos, err := runningTopupPromos(now)
+	if err != nil {
+		return nil, err
+	}
+	eligible := promos[:0]
+	for _, p := range promos {
+		ok, err := topupPromoEligible(database.DB, p, userID)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			eligible = append(eligible, p)
+		}
+	}
+	return eligible, nil
+}
+
+// bestTopupPromo picks the promo giving the largest bonus for amount. Promos
+// do not stack.
+func bestTopupPromo(promos []database.TopupPromo, amount int64) (*database.TopupPromo, int64) {
+	var best *database.TopupPromo
+	var bonus int64
+	for i := range promos {
+		if b := topupPromoBonus(promos[i], amount); b > bonus {
+			best, bonus = &promos[i], b
+		}
+	}
+	return best, bonus
+}
+
+// quoteTopupPromo sets PromoID and Bonus on a new top up from the promos
+// running now. Errors only drop the bonus; they never block the top up.
+func quoteTopupPromo(topup *database.TopUpRequest, now time.Time) {
+	promos, err := eligibleTopupPromos(topup.UserID, now)
+	if err != nil {
+		return
+	}
+	if p, bonus := bestTopupPromo(promos, topup.Amount); p != nil {
+		topup.PromoID = p.ID
+		topup.Bonus = bonus
+	}
+}
+
+// creditTopupBonusInTx credits the bonus quoted on topup as its own
+// "topup_bonus" transaction and sets topup.Bonus to what was credited. The
+// quote is honoured even if the promo has since ended, but the per-user
+// limits are checked again. Callers run it after crediting the top up, so the
+// user row is already locked and approvals of one user cannot race.
+func creditTopupBonusInTx(tx *gorm.DB, topup *database.TopUpRequest) error {
+	if topup.PromoID == 0 || topup.Bonus <= 0 {
+		topup.Bonus = 0
+		return nil
+	}
+	var promo database.TopupPromo
+	if err := tx.First(&promo, topup.PromoID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			topup.Bonus = 0
+			return nil
+		}
+		return err
+	}
+	ok, err := topupPromoEligible(tx, promo, topup.UserID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		topup.Bonus = 0
+		return nil
+	}
+
+	if err := tx.Model(&database.User{}).Where("id = ?", topup.UserID).
+		Update("balance", gorm.Expr("balance + ?", topup.Bonus)).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(&database.Transaction{
+		UserID:      topup.UserID,
+		Amount:      topup.Bonus,
+		Type:        "topup_bonus",
+		Description: fmt.Sprintf("Bonus top up %s (%s)", topup.Serial, promo.Name),
+		TopUpID:     topup.ID,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Create(&database.TopupPromoUsage{
+		PromoID: promo.ID,
+		UserID:  topup.UserID,
+		TopUpID: topup.ID,
+		Bonus:   topup.Bonus,
+	}).Error
+}
+
+// topupBonusNote is appended to approval notifications.
+func topupBonusNote(topup database.TopUpRequest) string {
+	if topup.Bonus <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" Bonus promo Rp %d juga sudah ditambahkan.", topup.Bonus)
+}
+
+// normalizeTopupPromo cleans admin input and checks the tiers.
+func normalizeTopupPromo(p *database.TopupPromo) error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Description = strings.TrimSpace(p.Description)
+	switch {
+	case p.Name == "":
+		return errors.New("name is required")
+	case len(p.Tiers) == 0:
+		return errors.New("at least one tier is required")
+	case p.PerUserLimit < 0:
+		return errors.New("per_user_limit must be >= 0")
+	case p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt):
+		return errors.New("ends_at must be after starts_at")
+	}
+
+	seen := make(map[int64]bool, len(p.Tiers))
+	for i := range p.Tiers {
+		t := &p.Tiers[i]
+		t.ID = 0
+		t.PromoID = p.ID
+		t.BonusType = strings.ToLower(strings.TrimSpace(t.BonusType))
+		if t.BonusType == "" {
+			t.BonusType = "percentage"
+		}
+		switch {
+		case t.BonusType != "percentage" && t.BonusType != "fixed":
+			return errors.New("bonus_type must be percentage/fixed")
+		case t.BonusValue <= 0:
+			return errors.New("bonus_value must be > 0")
+		case t.BonusType == "percentage" && t.BonusValue > 100:
+			return errors.New("percentage max is 100")
+		case t.MinAmount < 0 || t.MaxBonus < 0:
+			return errors.New("amounts must be >= 0")
+		case seen[t.MinAmount]:
+			return errors.New("tiers must have different min_amount")
+		}
+		seen[t.MinAmount] = true
+	}
+	sort.Slice(p.Tiers, func(a, b int) bool { return p.Tiers[a].MinAmount < p.Tiers[b].MinAmount })
+	return nil
+}
+
+// handleTopupPromos lists the promos the user can still get, with the bonus
+// for ?amount= when given, so the top up form can preview it.
+func handleTopupPromos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	session := auth.GetSessionFromRequest(r)
+	promos, err := eligibleTopupPromos(session.UserID, time.Now())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Gagal mengambil promo top up", err)
+		return
+	}
+
+	resp := map[string]any{"promos": promos, "promo": nil, "bonus": int64(0)}
+	if amount, _ := strconv.ParseInt(strings.TrimSpace(r.URL.Query().Get("amount")), 10, 64); amount > 0 {
+		if p, bonus := bestTopupPromo(promos, amount); p != nil {
+			resp["promo"] = p
+			resp["bonus"] = bonus
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func handleAdminTopupPromos(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var promos []database.TopupPromo
+		if err := database.DB.Preload("Tiers", func(db *gorm.DB) *gorm.DB {
+			return db.Order("min_amount asc")
+		}).Order("created_at desc").Find(&promos).Error; err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to fetch topup promos", nil)
+			return
+		}
+
+		var stats []struct {
+			PromoID uint
+			Uses    int64
+			Total   int64
+		}
+		database.DB.Model(&database.TopupPromoUsage{}).
+			Select("promo_id, COUNT(*) AS uses, COALESCE(SUM(bonus), 0) AS total").
+			Group("promo_id").
+			Scan(&stats)
+		byPromo := make(map[uint][2]int64, len(stats))
+		for _, s := range stats {
+			byPromo[s.PromoID] = [2]int64{s.Uses, s.Total}
+		}
+
+		items := make([]map[string]any, 0, len(promos))
+		for _, p := range promos {
+			items = append(items, map[string]any{
+				"promo":       p,
+				"used_count":  byPromo[p.ID][0],
+				"bonus_total": byPromo[p.ID][1],
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+		return
+
+	case http.MethodPost:
+		// A promo is active unless the body says otherwise.
+		req := database.TopupPromo{IsActive: true}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		req.ID = 0
+		if err := normalizeTopupPromo(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		if err := database.DB.Create(&req).Error; err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to create topup promo", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, req)
+		return
+
+	case http.MethodPatch:
+		// Decode over the stored row so omitted fields keep their values; a
+		// "tiers" array replaces all tiers.
+		var body json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		var ref struct {
+			ID uint `json:"id"`
+		}
+		if err := json.Unmarshal(body, &ref); err != nil || ref.ID == 0 {
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
+			return
+		}
+
+		var promo database.TopupPromo
+		if err := database.DB.Preload("Tiers").First(&promo, ref.ID).Error; err != nil {
+			writeJSONError(w, http.StatusNotFound, "Topup promo not found", nil)
+			return
+		}
+		// Decoding into the old slice would merge new tiers into old ones.
+		oldTiers := promo.Tiers
+		promo.Tiers = nil
+		if err := json.Unmarshal(body, &promo); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request", nil)
+			return
+		}
+		if promo.Tiers == nil {
+			promo.Tiers = oldTiers
+		}
+		promo.ID = ref.ID
+		if err := normalizeTopupPromo(&promo); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&database.TopupPromo{}).Where("id = ?", promo.ID).Updates(map[string]any{
+				"name":             promo.Name,
+				"description":      promo.Description,
+				"per_user_limit":   promo.PerUserLimit,
+				"first_topup_only": promo.FirstTopupOnly,
+				"starts_at":        promo.StartsAt,
+				"ends_at":          promo.EndsAt,
+				"is_active":        promo.IsActive,
+			}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("promo_id = ?", promo.ID).Delete(&database.TopupPromoTier{}).Error; err != nil {
+				return err
+			}
+			return tx.Create(&promo.Tiers).Error
+		})
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to update topup promo", nil)
+			return
+		}
+		database.DB.Preload("Tiers").First(&promo, promo.ID)
+		writeJSON(w, http.StatusOK, promo)
+		return
+
+	case http.MethodDelete:
+		id, _ := strconv.Atoi(strings.TrimSpace(r.URL.Query().Get("id")))
+		if id <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "id is required", nil)
+			return
+		}
+		// Open top ups quoting the promo lose their bonus; usages stay for reports.
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("promo_id = ?", id).Delete(&database.TopupPromoTier{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&database.TopupPromo{}, id).Error
+		})
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to delete topup promo", nil)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"message": "Topup promo deleted"})
+		return
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"gorm.io/gorm"
+)
+
+func TestDraftTopupPromoGivesNoBonus(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "draft@example.com", 0)
+
+	rec := httptest.NewRecorder()
+	handleAdminTopupPromos(rec, httptest.NewRequest(http.MethodPost, "/api/admin/topup-promos", strings.NewReader(
+		`{"name":"Draft","is_active":false,"tiers":[{"min_amount":100000,"bonus_type":"percentage","bonus_value":10}]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body)
+	}
+	var promo database.TopupPromo
+	database.DB.Where("name = ?", "Draft").First(&promo)
+	if promo.IsActive {
+		t.Fatal("promo created with is_active false is stored active")
+	}
+
+	topup := database.TopUpRequest{UserID: user.ID, Amount: 200000}
+	quoteTopupPromo(&topup, time.Now())
+	if topup.PromoID != 0 || topup.Bonus != 0 {
+		t.Fatalf("draft promo quoted: promo %d, bonus %d", topup.PromoID, topup.Bonus)
+	}
+}
+
+func TestCreditTopupBonusRespectsUserLimit(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "bonus@example.com", 0)
+	promo := database.TopupPromo{
+		Name:         "Oktober",
+		PerUserLimit: 1,
+		IsActive:     true,
+		Tiers: []database.TopupPromoTier{
+			{MinAmount: 50000, BonusType: "fixed", BonusValue: 5000},
+			{MinAmount: 100000, BonusType: "percentage", BonusValue: 10, MaxBonus: 15000},
+		},
+	}
+	if err := database.DB.Create(&promo).Error; err != nil {
+		t.Fatalf("create promo: %v", err)
+	}
+
+	if got := topupPromoBonus(promo, 300000); got != 15000 {
+		t.Fatalf("bonus for 300000 = %d, want the 15000 cap", got)
+	}
+
+	credit := func(serial string) database.TopUpRequest {
+		topup := database.TopUpRequest{UserID: user.ID, Serial: serial, Amount: 120000}
+		quoteTopupPromo(&topup, time.Now())
+		if err := database.DB.Create(&topup).Error; err != nil {
+			t.Fatalf("create top up: %v", err)
+		}
+		if err := database.DB.Transaction(func(tx *gorm.DB) error {
+			return creditTopupBonusInTx(tx, &topup)
+		}); err != nil {
+			t.Fatalf("credit bonus: %v", err)
+		}
+		return topup
+	}
+
+	first := credit("TU-1")
+	if first.Bonus != 12000 {
+		t.Fatalf("first bonus = %d, want 12000", first.Bonus)
+	}
+
+	// Quoted before the first was used, credited after: the limit wins.
+	second := database.TopUpRequest{UserID: user.ID, Serial: "TU-2", Amount: 120000, PromoID: promo.ID, Bonus: 12000}
+	database.DB.Create(&second)
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return creditTopupBonusInTx(tx, &second)
+	}); err != nil {
+		t.Fatalf("credit second: %v", err)
+	}
+	if second.Bonus != 0 {
+		t.Fatalf("second bonus = %d, want 0 past the per-user limit", second.Bonus)
+	}
+
+	var after database.User
+	database.DB.First(&after, user.ID)
+	if after.Balance != 12000 {
+		t.Fatalf("balance = %d, want only the first bonus", after.Balance)
+	}
+	var bonuses int64
+	database.DB.Model(&database.Transaction{}).Where("user_id = ? AND type = ?", user.ID, "topup_bonus").Count(&bonuses)
+	if bonuses != 1 {
+		t.Fatalf("%d bonus transactions, want 1", bonuses)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/auth"
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+)
+
+// Transfer proofs live under uploads/ like other images but contain account
+// details, so handleUploadsDir refuses to serve this directory publicly.
+const (
+	topupProofDir     = "topup-proofs"
+	topupProofMaxSize = 2 * 1024 * 1024 // 2MB
+)
+
+// topupProofRequired reports whether users must attach a transfer proof when
+// confirming a manual top up (TOPUP_PROOF_REQUIRED, default false).
+func topupProofRequired() bool {
+	return strings.EqualFold(strings.TrimSpace(os.Getenv("TOPUP_PROOF_REQUIRED")), "true")
+}
+
+func topupProofPath(name string) string {
+	return filepath.Join(".", "uploads", topupProofDir, filepath.Base(name))
+}
+
+// saveTopupProof validates an uploaded transfer proof and stores it with a
+// random name, which is returned for TopUpRequest.ProofImage.
+func saveTopupProof(file multipart.File, header *multipart.FileHeader) (string, error) {
+	_, _, ext, err := validateImageUpload(file, header, topupProofMaxSize)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Join(".", "uploads", topupProofDir), 0755); err != nil {
+		return "", fmt.Errorf("gagal menyimpan bukti transfer")
+	}
+
+	randomPart := make([]byte, 12)
+	rand.Read(randomPart)
+	name := fmt.Sprintf("proof_%s%s", hex.EncodeToString(randomPart), ext)
+	out, err := os.Create(topupProofPath(name))
+	if err != nil {
+		return "", fmt.Errorf("gagal menyimpan bukti transfer")
+	}
+	written, err := io.Copy(out, io.LimitReader(file, topupProofMaxSize+1))
+	out.Close()
+	if err != nil || written > topupProofMaxSize {
+		os.Remove(topupProofPath(name))
+		if err == nil {
+			return "", fmt.Errorf("ukuran file melebihi %dMB", topupProofMaxSize/(1024*1024))
+		}
+		return "", fmt.Errorf("gagal menyimpan bukti transfer")
+	}
+	return name, nil
+}
+
+// handleTopupProof serves the transfer proof of a top up to its owner and to
+// admins.
+func handleTopupProof(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	id, _ := strconv.Atoi(strings.TrimSpace(r.URL.Query().Get("id")))
+	if id <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "id is required", nil)
+		return
+	}
+
+	session := auth.GetSessionFromRequest(r)
+	var topup database.TopUpRequest
+	if err := database.DB.First(&topup, id).Error; err != nil {
+		writeJSONError(w, http.StatusNotFound, "Topup request not found", nil)
+		return
+	}
+	if topup.UserID != session.UserID && session.Role != "admin" {
+		writeJSONError(w, http.StatusForbidden, "Forbidden", nil)
+		return
+	}
+	if topup.ProofImage == "" {
+		writeJSONError(w, http.StatusNotFound, "Bukti transfer tidak ada", nil)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeFile(w, r, topupProofPath(topup.ProofImage))
+}
+
+// telegramSendPhoto uploads a local image with sendPhoto. Extra fields such as
+// reply_markup are JSON-encoded as the Bot API expects for multipart requests.
+func telegramSendPhoto(chatID int64, path, caption string, replyMarkup any) error {
+	if telegramBotToken == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("chat_id", strconv.FormatInt(chatID, 10))
+	mw.WriteField("caption", caption)
+	if replyMarkup != nil {
+		b, _ := json.Marshal(replyMarkup)
+		mw.WriteField("reply_markup", string(b))
+	}
+	part, err := mw.CreateFormFile("photo", filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return err
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/sendPhoto", telegramBotToken)
+	req, err := http.NewRequest(http.MethodPost, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("telegram sendPhoto failed: %s", strings.TrimSpace(string(b)))
+	}
+	return nil
+}
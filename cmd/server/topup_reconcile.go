@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/mutation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errUniqueCodesExhausted = errors.New("semua kode unik untuk nominal ini sedang terpakai")
+
+// topupReconcileWindow is how long after creation a transfer can still be
+// matched to a top up (TOPUP_RECONCILE_WINDOW_HOURS, default 24).
+func topupReconcileWindow() time.Duration {
+	return time.Duration(envInt("TOPUP_RECONCILE_WINDOW_HOURS", 24)) * time.Hour
+}
+
+// mutationDefaultMethod is the payment method a bank export belongs to when
+// the admin does not pick one.
+var mutationDefaultMethod = map[string]string{
+	mutation.FormatBRI:   "bri",
+	mutation.FormatJago:  "bank_jago",
+	mutation.FormatGoPay: "gopay",
+}
+
+// createManualTopup stores a manual-transfer top up with a unique code in
+// 1..TOPUP_UNIQUE_CODE_MAX (default 999, 0 = off) added to what the user
+// transfers, so no two top ups that can still be paid share an amount. Top ups
+// created within the reconcile window keep their amount whatever their status,
+// so a bank row from that window never matches two of them.
+func createManualTopup(topup *database.TopUpRequest) error {
+	maxCode := int64(envInt("TOPUP_UNIQUE_CODE_MAX", 999))
+	if maxCode <= 0 {
+		return database.DB.Create(topup).Error
+	}
+	base := topup.Amount + topup.Fee
+	return createTopupWithCode(topup, func() (string, error) {
+		var taken []int64
+		database.DB.Model(&database.TopUpRequest{}).
+			Where("(gateway = '' OR gateway IS NULL) AND amount + fee + unique_code BETWEEN ? AND ?", base+1, base+maxCode).
+			Where("status IN ? OR created_at >= ?",
+				[]string{"awaiting_payment", "pending"},
+				time.Now().Add(-topupReconcileWindow())).
+			Pluck("amount + fee + unique_code", &taken)
+
+		used := make(map[int64]bool, len(taken))
+		for _, v := range taken {
+			used[v-base] = true
+		}
+		free := make([]int64, 0, maxCode)
+		for code := int64(1); code <= maxCode; code++ {
+			if !used[code] {
+				free = append(free, code)
+			}
+		}
+		if len(free) == 0 {
+			return "", errUniqueCodesExhausted
+		}
+		topup.UniqueCode = free[rand.IntN(len(free))]
+		return fmt.Sprintf("manual:%d", base+topup.UniqueCode), nil
+	})
+}
+
+// createTopupWithCode inserts topup under the code key pick chooses. The key
+// has a unique index, so when another server or request claimed the same
+// amount in the meantime the insert fails and a new code is picked.
+func createTopupWithCode(topup *database.TopUpRequest, pick func() (string, error)) error {
+	for attempt := 0; attempt < 3; attempt++ {
+		if err := releaseTopupCodes(); err != nil {
+			return err
+		}
+		key, err := pick()
+		if err != nil {
+			return err
+		}
+		topup.ID, topup.CodeKey = 0, &key
+		err = database.DB.Create(topup).Error
+		if err == nil {
+			return nil
+		}
+		var claimed int64
+		if database.DB.Model(&database.TopUpRequest{}).Where("code_key = ?", key).Count(&claimed); claimed == 0 {
+			return err
+		}
+	}
+	return errUniqueCodesExhausted
+}
+
+// releaseTopupCodes frees the code keys of top ups whose amount may be handed
+// out again: closed manual top ups past the reconcile window, and USDT top ups
+// once decided or, when they expired or were cancelled, past the window.
+func releaseTopupCodes() error {
+	return database.DB.Model(&database.TopUpRequest{}).
+		Where("code_key IS NOT NULL AND status NOT IN ?", []string{"awaiting_payment", "pending"}).
+		Where("created_at < ? OR (crypto_amount <> '' AND status IN ?)",
+			time.Now().Add(-topupReconcileWindow()), []string{"approved", "rejected"}).
+		Update("code_key", nil).Error
+}
+
+// reconcileEntry is one credit row of a bank export and what it matched.
+type reconcileEntry struct {
+	mutation.Row
+	Outcome     string   `json:"outcome"` // applied, matched, already_approved, rejected, not_pending, ambiguous, duplicate, unmatched
+	TopUpID     uint     `json:"topup_id,omitempty"`
+	Serial      string   `json:"serial,omitempty"`
+	Username    string   `json:"username,omitempty"`
+	TopupStatus string   `json:"topup_status,omitempty"` // before applying
+	Candidates  []string `json:"candidates,omitempty"`   // serials, for ambiguous rows
+	Error       string   `json:"error,omitempty"`
+}
+
+type reconcileReport struct {
+	Format    string           `json:"format"`
+	Method    string           `json:"method"`
+	Apply     bool             `json:"apply"`
+	Rows      int              `json:"rows"`
+	Debits    int              `json:"debits"`
+	Invalid   []int            `json:"invalid_lines"`
+	Summary   map[string]int   `json:"summary"`
+	Matched   []reconcileEntry `json:"matched"`
+	Unmatched []reconcileEntry `json:"unmatched"`
+	// Unpaid lists top ups marked paid by the user that no row matched.
+	Unpaid []database.TopUpRequest `json:"unpaid"`
+}
+
+// handleAdminTopupReconcile matches a bank mutation CSV to manual top ups.
+// Multipart fields: file, format (auto|bri|jago|gopay), method (payment method
+// code, default from format) and apply (true approves the matches; otherwise
+// the report is only a proposal).
+func handleAdminTopupReconcile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 5<<20)
+	if err := r.ParseMultipartForm(5 << 20); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "File terlalu besar atau tidak valid (maks 5 MB)", nil)
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "File CSV mutasi wajib diunggah", nil)
+		return
+	}
+	defer file.Close()
+
+	parsed, err := mutation.Parse(file, r.FormValue("format"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Gagal membaca CSV mutasi", err)
+		return
+	}
+
+	method := strings.ToLower(strings.TrimSpace(r.FormValue("method")))
+	if method == "" {
+		method = mutationDefaultMethod[parsed.Format]
+	}
+	apply := r.FormValue("apply") == "true" || r.FormValue("apply") == "1"
+
+	report, err := reconcileTopups(parsed, method, apply)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Gagal mencocokkan mutasi", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// reconcileTopups matches every credit row to the manual top up whose payable
+// amount equals the row amount and whose reconcile window contains the row
+// time. Only rows with exactly one candidate are matched.
+func reconcileTopups(parsed mutation.Result, method string, apply bool) (reconcileReport, error) {
+	report := reconcileReport{
+		Format:    parsed.Format,
+		Method:    method,
+		Apply:     apply,
+		Rows:      len(parsed.Rows),
+		Debits:    parsed.Debits,
+		Invalid:   parsed.Invalid,
+		Summary:   map[string]int{},
+		Matched:   []reconcileEntry{},
+		Unmatched: []reconcileEntry{},
+		Unpaid:    []database.TopUpRequest{},
+	}
+	if len(parsed.Rows) == 0 {
+		return report, nil
+	}
+
+	window := topupReconcileWindow()
+	const skew = 10 * time.Minute // bank clocks vs ours
+	first, last := parsed.Rows[0].Time, parsed.Rows[0].Time
+	for _, row := range parsed.Rows {
+		if row.Time.Before(first) {
+			first = row.Time
+		}
+		if row.Time.After(last) {
+			last = row.Time
+		}
+	}
+
+	q := database.DB.Where("(gateway = '' OR gateway IS NULL) AND created_at BETWEEN ? AND ?", first.Add(-window), last.Add(24*time.Hour+skew))
+	if method != "" {
+		q = q.Where("payment_method = ?", method)
+	}
+	var candidates []database.TopUpRequest
+	if err := q.Order("created_at asc").Find(&candidates).Error; err != nil {
+		return report, err
+	}
+
+	inWindow := func(row mutation.Row, t database.TopUpRequest) bool {
+		start, end := t.CreatedAt.Add(-skew), t.CreatedAt.Add(window)
+		if row.DateOnly {
+			return row.Time.Before(end) && row.Time.Add(24*time.Hour).After(start)
+		}
+		return !row.Time.Before(start) && row.Time.Before(end)
+	}
+
+	claimed := map[uint]bool{}
+	for _, row := range parsed.Rows {
+		entry := reconcileEntry{Row: row}
+		var matches []database.TopUpRequest
+		for _, t := range candidates {
+			if t.PayableAmount() == row.Amount && inWindow(row, t) {
+				matches = append(matches, t)
+			}
+		}
+
+		switch len(matches) {
+		case 0:
+			entry.Outcome = "unmatched"
+		case 1:
+			t := matches[0]
+			entry.TopUpID, entry.Serial, entry.Username, entry.TopupStatus = t.ID, t.Serial, t.Username, t.Status
+			switch {
+			case claimed[t.ID]:
+				entry.Outcome = "duplicate"
+			case t.Status == "approved":
+				entry.Outcome = "already_approved"
+			case t.Status == "rejected":
+				entry.Outcome = "rejected"
+			case t.Status != "pending":
+				entry.Outcome = "not_pending"
+			default:
+				entry.Outcome = "matched"
+			}
+			claimed[t.ID] = true
+		default:
+			entry.Outcome = "ambiguous"
+			for _, t := range matches {
+				entry.Candidates = append(entry.Candidates, t.Serial)
+			}
+		}
+
+		if entry.Outcome == "matched" && apply {
+			note := fmt.Sprintf("Cocok dengan mutasi %s baris %d", parsed.Format, row.Line)
+			if _, err := approveTopupFromMutation(entry.TopUpID, row.Time, note); err != nil {
+				entry.Error = err.Error()
+			} else {
+				entry.Outcome = "applied"
+			}
+		}
+
+		report.Summary[entry.Outcome]++
+		switch entry.Outcome {
+		case "matched", "applied", "already_approved":
+			report.Matched = append(report.Matched, entry)
+		default:
+			report.Unmatched = append(report.Unmatched, entry)
+		}
+	}
+
+	for _, t := range candidates {
+		if t.Status == "pending" && !claimed[t.ID] {
+			report.Unpaid = append(report.Unpaid, t)
+		}
+	}
+	return report, nil
+}
+
+// approveTopupFromMutation approves a pending manual top up whose transfer
+// was found in a bank export. Top ups that were never confirmed, expired or
+// were cancelled are left to the admin.
+func approveTopupFromMutation(id uint, paidAt time.Time, note string) (database.TopUpRequest, error) {
+	var topup database.TopUpRequest
+	now := time.Now()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&topup, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errTopupNotFound
+			}
+			return err
+		}
+		if topup.Status != "pending" {
+			return errTopupAlreadyDecided
+		}
+		if topup.PaidAt == nil {
+			topup.PaidAt = &paidAt
+		}
+		topup.AdminReason = note
+		topup.DecidedAt = &now
+		return creditTopupInTx(tx, &topup)
+	})
+	if err != nil {
+		return database.TopUpRequest{}, err
+	}
+
+	database.DB.Create(&database.Notification{
+		UserID:  topup.UserID,
+		Title:   "Top up disetujui",
+		Message: fmt.Sprintf("Transfer top up Rp %d sudah diterima. Saldo bertambah Rp %d.%s", topup.PayableAmount(), topup.CreditAmount(), topupBonusNote(topup)),
+	})
+	return topup, nil
+}
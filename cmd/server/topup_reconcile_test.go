@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/mutation"
+)
+
+func TestManualTopupSkipsCodesUsedInWindow(t *testing.T) {
+	newTestDB(t)
+	t.Setenv("TOPUP_UNIQUE_CODE_MAX", "4")
+	user := newTestUser(t, "code@example.com", 0)
+
+	// Every status created within the reconcile window holds its code;
+	// older closed top ups give theirs back.
+	for code, status := range map[int64]string{1: "approved", 2: "rejected", 3: "expired"} {
+		database.DB.Create(&database.TopUpRequest{UserID: user.ID, Serial: fmt.Sprintf("TU-OLD-%d", code), Amount: 50000, UniqueCode: code, Status: status})
+	}
+	old := database.TopUpRequest{UserID: user.ID, Serial: "TU-OLD-4", Amount: 50000, UniqueCode: 4, Status: "approved"}
+	database.DB.Create(&old)
+	database.DB.Model(&old).UpdateColumn("created_at", time.Now().Add(-topupReconcileWindow()-time.Hour))
+
+	topup := database.TopUpRequest{UserID: user.ID, Serial: "TU-NEW-1", Amount: 50000, Status: "awaiting_payment"}
+	if err := createManualTopup(&topup); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if topup.UniqueCode != 4 {
+		t.Fatalf("unique code = %d, want 4, the only one free", topup.UniqueCode)
+	}
+
+	next := database.TopUpRequest{UserID: user.ID, Serial: "TU-NEW-2", Amount: 50000, Status: "awaiting_payment"}
+	if err := createManualTopup(&next); !errors.Is(err, errUniqueCodesExhausted) {
+		t.Fatalf("err %v, want errUniqueCodesExhausted", err)
+	}
+}
+
+func TestCodeKeyRejectsAmountClaimedConcurrently(t *testing.T) {
+	newTestDB(t)
+	t.Setenv("TOPUP_UNIQUE_CODE_MAX", "1")
+	user := newTestUser(t, "race@example.com", 0)
+
+	// Another server inserted 50001 a moment ago; its row is not visible to
+	// the free-code query here, only the unique key stops the second insert.
+	key := "manual:50001"
+	database.DB.Create(&database.TopUpRequest{UserID: user.ID, Serial: "TU-OTHER", Amount: 1, Status: "awaiting_payment", CodeKey: &key})
+
+	topup := database.TopUpRequest{UserID: user.ID, Serial: "TU-RACE", Amount: 50000, Status: "awaiting_payment"}
+	if err := createManualTopup(&topup); !errors.Is(err, errUniqueCodesExhausted) {
+		t.Fatalf("err %v, want errUniqueCodesExhausted", err)
+	}
+
+	// Once that top up is closed and out of the window its key is released.
+	database.DB.Model(&database.TopUpRequest{}).Where("serial = ?", "TU-OTHER").
+		Updates(map[string]any{"status": "expired", "created_at": time.Now().Add(-topupReconcileWindow() - time.Hour)})
+	if err := createManualTopup(&topup); err != nil || topup.UniqueCode != 1 {
+		t.Fatalf("after release: code %d, err %v; want 1", topup.UniqueCode, err)
+	}
+}
+
+func TestReconcileApprovesOnlyPendingTopups(t *testing.T) {
+	newTestDB(t)
+	user := newTestUser(t, "reconcile@example.com", 0)
+
+	paidAt := time.Now()
+	for i, status := range []string{"pending", "awaiting_payment", "expired", "cancelled"} {
+		database.DB.Create(&database.TopUpRequest{UserID: user.ID, Serial: "TU-" + status, Amount: 50000, UniqueCode: int64(i + 1),
+			PaymentMethod: "bri", Status: status})
+	}
+	parsed := mutation.Result{Format: mutation.FormatBRI}
+	for i := range 4 {
+		parsed.Rows = append(parsed.Rows, mutation.Row{Line: i + 2, Time: paidAt, Amount: 50000 + int64(i+1)})
+	}
+
+	report, err := reconcileTopups(parsed, "bri", true)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if report.Summary["applied"] != 1 || report.Summary["not_pending"] != 3 {
+		t.Fatalf("summary %v, want 1 applied and 3 not_pending", report.Summary)
+	}
+	for _, status := range []string{"awaiting_payment", "expired", "cancelled"} {
+		var topup database.TopUpRequest
+		database.DB.Where("serial = ?", "TU-"+status).First(&topup)
+		if topup.Status != status {
+			t.Errorf("%s top up became %q", status, topup.Status)
+		}
+	}
+	var balance database.User
+	database.DB.First(&balance, user.ID)
+	if balance.Balance != 50001 { // the unique code is credited too
+		t.Fatalf("balance %d, want only the pending top up credited", balance.Balance)
+	}
+}
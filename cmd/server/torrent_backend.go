@@ -0,0 +1,418 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/apierror"
+	"github.com/youming-ai/pikpak-downloader/internal/auth"
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"github.com/youming-ai/pikpak-downloader/internal/debrid"
+	"github.com/youming-ai/pikpak-downloader/internal/pikpak"
+	"github.com/youming-ai/pikpak-downloader/internal/realdebrid"
+)
+
+// Torrent routing policies (TORRENT_BACKEND):
+//
+//	pikpak     - always PikPak (default)
+//	fallback   - PikPak, or Real-Debrid when PikPak is full or unhealthy
+//	cached     - Real-Debrid when it reports the hash as instantly available, otherwise fallback
+//	realdebrid - always Real-Debrid for magnet links
+const (
+	torrentPolicyPikPak     = "pikpak"
+	torrentPolicyFallback   = "fallback"
+	torrentPolicyCached     = "cached"
+	torrentPolicyRealDebrid = "realdebrid"
+)
+
+var torrentBackendPolicy = torrentPolicyPikPak
+
+func loadTorrentBackendPolicy() string {
+	policy := strings.ToLower(strings.TrimSpace(os.Getenv("TORRENT_BACKEND")))
+	switch policy {
+	case torrentPolicyPikPak, torrentPolicyFallback, torrentPolicyCached, torrentPolicyRealDebrid:
+		return policy
+	case "":
+		return torrentPolicyPikPak
+	}
+	log.Printf("⚠️  TORRENT_BACKEND=%q tidak dikenal, memakai %q", policy, torrentPolicyPikPak)
+	return torrentPolicyPikPak
+}
+
+// torrentSubmission is the backend-neutral result of submitting a torrent.
+type torrentSubmission struct {
+	Backend   string // pikpak, realdebrid
+	Reason    string // why Real-Debrid was used
+	ID        string
+	Name      string
+	SizeBytes int64
+	Cached    bool
+	Hash      string
+	Raw       map[string]any
+}
+
+// cleanup undoes the submission when the charge fails.
+func (s torrentSubmission) cleanup() {
+	if strings.TrimSpace(s.ID) == "" {
+		return
+	}
+	var err error
+	if s.Backend == torrentPolicyRealDebrid {
+		err = rdClient.DeleteTorrent(s.ID)
+	} else {
+		err = globalClient.DeleteTasks([]string{s.ID})
+	}
+	if err != nil {
+		log.Printf("cleanup task gagal (backend=%s id=%s): %v", s.Backend, s.ID, err)
+	}
+}
+
+// magnetInfoHash returns the lower-case btih hash of a magnet link, or "".
+func magnetInfoHash(link string) string {
+	link = strings.TrimSpace(link)
+	if !strings.HasPrefix(strings.ToLower(link), "magnet:?") {
+		return ""
+	}
+	q, err := url.ParseQuery(link[len("magnet:?"):])
+	if err != nil {
+		return ""
+	}
+	for _, xt := range q["xt"] {
+		if lower := strings.ToLower(xt); strings.HasPrefix(lower, "urn:btih:") {
+			return lower[len("urn:btih:"):]
+		}
+	}
+	return ""
+}
+
+// isPikPakUnavailableError reports whether an add-task error means PikPak itself
+// cannot take the job right now (storage or task quota, auth, outage), as opposed
+// to a bad link.
+func isPikPakUnavailableError(err error) bool {
+	switch apierror.CategoryOf(err) {
+	case apierror.CategoryAuth, apierror.CategoryQuota, apierror.CategoryRateLimit, apierror.CategoryUnavailable:
+		return true
+	}
+	return apierror.Retryable(err)
+}
+
+// submitTorrent routes a torrent to PikPak or Real-Debrid according to
+// torrentBackendPolicy. Non-magnet links always go to PikPak.
+func submitTorrent(user *database.User, link string) (torrentSubmission, error) {
+	hash := magnetInfoHash(link)
+	rdReady := hash != "" && strings.TrimSpace(rdClient.APIKey) != ""
+	policy := torrentBackendPolicy
+	if !rdReady {
+		policy = torrentPolicyPikPak
+	}
+
+	if policy == torrentPolicyRealDebrid {
+		return submitRealDebridTorrent(link, hash, "policy")
+	}
+	if policy == torrentPolicyCached {
+		avail, err := rdClient.InstantAvailability(hash)
+		if err != nil {
+			log.Printf("instantAvailability gagal (hash=%s): %v", hash, err)
+		} else if avail[hash] {
+			return submitRealDebridTorrent(link, hash, "cached")
+		}
+	}
+
+	sub, err := submitPikPakTorrent(user, link)
+	if err != nil && policy != torrentPolicyPikPak && isPikPakUnavailableError(err) {
+		log.Printf("PikPak tidak tersedia, torrent dialihkan ke Real-Debrid (user_id=%d): %v", user.ID, err)
+		return submitRealDebridTorrent(link, hash, "pikpak_unavailable")
+	}
+	return sub, err
+}
+
+func submitPikPakTorrent(user *database.User, link string) (torrentSubmission, error) {
+	// Add task to user's folder
+	targetFolderID := strings.TrimSpace(user.PikPakFolderID)
+	if targetFolderID == "" {
+		if newFolderID, folderErr := recreateUserPikPakFolder(user); folderErr == nil {
+			targetFolderID = newFolderID
+		} else {
+			log.Printf("auto-create folder gagal (user_id=%d): %v", user.ID, folderErr)
+		}
+	}
+
+	res, err := globalClient.AddOfflineTaskToFolder(link, targetFolderID)
+	if err != nil && targetFolderID != "" && isInvalidPikPakFolderError(err) {
+		newFolderID, recreateErr := recreateUserPikPakFolder(user)
+		if recreateErr == nil {
+			targetFolderID = newFolderID
+			res, err = globalClient.AddOfflineTaskToFolder(link, targetFolderID)
+		} else {
+			log.Printf("recreate folder saat add task gagal (user_id=%d): %v", user.ID, recreateErr)
+		}
+	}
+	if err != nil {
+		return torrentSubmission{}, err
+	}
+
+	sub := torrentSubmission{Backend: torrentPolicyPikPak, Raw: res}
+	var sizeStr, phase, progress string
+	if task, ok := res["task"].(map[string]any); ok {
+		sub.ID, _ = task["id"].(string)
+		sub.Name, _ = task["name"].(string)
+		sizeStr, _ = task["file_size"].(string)
+		phase, _ = task["phase"].(string)
+		progress, _ = task["progress"].(string)
+	} else if file, ok := res["file"].(map[string]any); ok {
+		sub.ID, _ = file["id"].(string)
+		sub.Name, _ = file["name"].(string)
+		sizeStr, _ = file["size"].(string)
+		phase = "PHASE_TYPE_COMPLETE"
+		progress = "100"
+	} else {
+		if n, ok := res["name"].(string); ok {
+			sub.Name = n
+		}
+		if i, ok := res["id"].(string); ok {
+			sub.ID = i
+		}
+		phase, _ = res["phase"].(string)
+	}
+	sub.Cached = phase == "PHASE_TYPE_COMPLETE" || progress == "100"
+	fmt.Sscanf(sizeStr, "%d", &sub.SizeBytes)
+	return sub, nil
+}
+
+func submitRealDebridTorrent(magnet, hash, reason string) (torrentSubmission, error) {
+	added, err := rdClient.AddMagnet(magnet)
+	if err != nil {
+		return torrentSubmission{}, err
+	}
+
+	// Magnet conversion takes a moment; wait briefly so the name and size can be priced.
+	var info realdebrid.TorrentInfo
+	for i := 0; i < 5; i++ {
+		info, err = rdClient.TorrentInfo(added.ID)
+		if err != nil || info.Status != "magnet_conversion" {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		rdClient.DeleteTorrent(added.ID)
+		return torrentSubmission{}, err
+	}
+	if info.Failed() {
+		rdClient.DeleteTorrent(added.ID)
+		return torrentSubmission{}, fmt.Errorf("real-debrid torrent %s: %s", added.ID, info.Status)
+	}
+	if info.Status == "waiting_files_selection" {
+		if err := rdClient.SelectFiles(added.ID, "all"); err != nil {
+			rdClient.DeleteTorrent(added.ID)
+			return torrentSubmission{}, err
+		}
+		if refreshed, rErr := rdClient.TorrentInfo(added.ID); rErr == nil {
+			info = refreshed
+		}
+	}
+
+	size := info.Bytes
+	if size <= 0 {
+		size = info.OriginalBytes
+	}
+	name := strings.TrimSpace(info.Filename)
+	if name == "" {
+		name = strings.TrimSpace(info.OriginalFilename)
+	}
+	return torrentSubmission{
+		Backend:   torrentPolicyRealDebrid,
+		Reason:    reason,
+		ID:        added.ID,
+		Name:      name,
+		SizeBytes: size,
+		Cached:    info.Finished(),
+		Hash:      hash,
+		Raw: map[string]any{
+			"backend": torrentPolicyRealDebrid,
+			"torrent": info,
+		},
+	}, nil
+}
+
+// refreshDebridTorrent pulls the current state from Real-Debrid, starts torrents
+// still waiting for file selection, and stores the status on the row.
+func refreshDebridTorrent(t *database.DebridTorrent) (realdebrid.TorrentInfo, error) {
+	info, err := rdClient.TorrentInfo(t.RemoteID)
+	if err != nil {
+		return info, err
+	}
+	if info.Status == "waiting_files_selection" {
+		if err := rdClient.SelectFiles(t.RemoteID, "all"); err != nil {
+			return info, err
+		}
+		if refreshed, rErr := rdClient.TorrentInfo(t.RemoteID); rErr == nil {
+			info = refreshed
+		}
+	}
+
+	updates := map[string]any{"status": info.Status, "progress": info.Progress}
+	if info.Bytes > 0 {
+		updates["size_bytes"] = info.Bytes
+	}
+	if strings.TrimSpace(info.Filename) != "" {
+		updates["name"] = info.Filename
+	}
+	database.DB.Model(t).Updates(updates)
+	return info, nil
+}
+
+// debridFile is one downloadable file of a finished Real-Debrid torrent. URL is
+// empty until the user unrestricts it.
+type debridFile struct {
+	Index    int    `json:"index"`
+	Filename string `json:"filename"`
+	Size     string `json:"size,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+// debridTorrentFileNames names each entry of info.Links. Real-Debrid returns
+// one link per selected file, in file order.
+func debridTorrentFileNames(info realdebrid.TorrentInfo) []string {
+	var selected []string
+	for _, f := range info.Files {
+		if f.Selected == 1 {
+			selected = append(selected, path.Base(f.Path))
+		}
+	}
+	names := make([]string, len(info.Links))
+	for i := range names {
+		if len(selected) == len(info.Links) {
+			names[i] = selected[i]
+		} else {
+			names[i] = fmt.Sprintf("File %d", i+1)
+		}
+	}
+	return names
+}
+
+// handleDebridTorrents lists and manages the user's Real-Debrid torrents.
+// GET ?id= refreshes one torrent and lists its files once it is downloaded;
+// POST ?id=&file= unrestricts one of those files.
+func handleDebridTorrents(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSessionFromRequest(r)
+
+	idStr := strings.TrimSpace(r.URL.Query().Get("id"))
+	var torrent database.DebridTorrent
+	if idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "id tidak valid", nil)
+			return
+		}
+		if err := database.DB.Where("id = ? AND user_id = ?", id, session.UserID).First(&torrent).Error; err != nil {
+			writeJSONError(w, http.StatusNotFound, "Torrent tidak ditemukan", nil)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if idStr == "" {
+			var items []database.DebridTorrent
+			database.DB.Where("user_id = ?", session.UserID).Order("id desc").Limit(100).Find(&items)
+			writeJSON(w, http.StatusOK, map[string]any{"items": items})
+			return
+		}
+
+		info, err := refreshDebridTorrent(&torrent)
+		if err != nil {
+			status, friendly := mapDebridError(err)
+			writeJSONError(w, status, friendly, err)
+			return
+		}
+		files := make([]debridFile, 0, len(info.Links))
+		if info.Finished() {
+			names := debridTorrentFileNames(info)
+			for i, link := range info.Links {
+				file := debridFile{Index: i, Filename: names[i]}
+				if cached, ok := premiumLinks.get(link); ok {
+					file.Filename = firstNonEmpty(cached.unrestricted.Filename, file.Filename)
+					file.Size = pikpak.FormatBytes(cached.unrestricted.Filesize)
+					file.URL = cached.unrestricted.Download
+				}
+				files = append(files, file)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"torrent": torrent,
+			"status":  info.Status,
+			"ready":   info.Finished(),
+			"failed":  info.Failed(),
+			"files":   files,
+		})
+
+	case http.MethodPost:
+		// Unrestricting is a user action, one file at a time, through the same
+		// rate limit and link cache as premium requests.
+		if idStr == "" {
+			writeJSONError(w, http.StatusBadRequest, "id wajib diisi", nil)
+			return
+		}
+		index, err := strconv.Atoi(r.URL.Query().Get("file"))
+		if err != nil || index < 0 {
+			writeJSONError(w, http.StatusBadRequest, "file tidak valid", nil)
+			return
+		}
+		info, err := rdClient.TorrentInfo(torrent.RemoteID)
+		if err != nil {
+			status, friendly := mapDebridError(err)
+			writeJSONError(w, status, friendly, err)
+			return
+		}
+		if !info.Finished() || index >= len(info.Links) {
+			writeJSONError(w, http.StatusConflict, "File belum siap diunduh", nil)
+			return
+		}
+		link := info.Links[index]
+		cached, ok := premiumLinks.get(link)
+		if !ok {
+			if err := premiumQueue.waitCheckRate(r.Context()); err != nil {
+				writeJSONError(w, http.StatusServiceUnavailable, "Server sibuk, coba lagi", err)
+				return
+			}
+			res, err := rdClient.UnrestrictLink(link)
+			if err != nil {
+				log.Printf("unrestrict link torrent gagal (id=%d): %v", torrent.ID, err)
+				status, friendly := mapDebridError(err)
+				writeJSONError(w, status, friendly, err)
+				return
+			}
+			cached.unrestricted = debrid.Unrestricted{Filename: res.Filename, Filesize: res.Filesize, Host: res.Host, Download: res.Download}
+			premiumLinks.put(link, torrentPolicyRealDebrid, cached.unrestricted, "")
+		}
+		writeJSON(w, http.StatusOK, debridFile{
+			Index:    index,
+			Filename: cached.unrestricted.Filename,
+			Size:     pikpak.FormatBytes(cached.unrestricted.Filesize),
+			URL:      cached.unrestricted.Download,
+		})
+
+	case http.MethodDelete:
+		if idStr == "" {
+			writeJSONError(w, http.StatusBadRequest, "id wajib diisi", nil)
+			return
+		}
+		if err := rdClient.DeleteTorrent(torrent.RemoteID); err != nil && apierror.CategoryOf(err) != apierror.CategoryNotFound {
+			writeJSONError(w, http.StatusBadGateway, "Gagal menghapus torrent di Real-Debrid", err)
+			return
+		}
+		database.DB.Delete(&torrent)
+		writeJSON(w, http.StatusOK, map[string]any{"message": "Torrent dihapus"})
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/database"
+	"gorm.io/gorm"
+)
+
+// transactionTypes are the Transaction.Type values that can be filtered on.
+var transactionTypes = map[string]bool{
+	"topup":        true,
+	"topup_bonus":  true,
+	"download":     true,
+	"refund":       true,
+	"subscription": true,
+	"adjustment":   true,
+}
+
+// transactionFilter reads the history filters shared by the user and admin
+// endpoints:
+//
+//	type=topup,download      one or more types
+//	from=2026-01-01          created on or after (date or RFC 3339)
+//	to=2026-01-31            created on or before; a date covers the whole day
+//	min_amount, max_amount   bounds on the absolute amount
+//	q=text                   in the description or invoice number
+//
+// Columns are qualified so the scope also works on queries joining users.
+func transactionFilter(values url.Values) (func(*gorm.DB) *gorm.DB, error) {
+	var types []string
+	for _, raw := range strings.Split(values.Get("type"), ",") {
+		t := strings.ToLower(strings.TrimSpace(raw))
+		if t == "" {
+			continue
+		}
+		if !transactionTypes[t] {
+			return nil, fmt.Errorf("type %q tidak dikenal", t)
+		}
+		types = append(types, t)
+	}
+
+	from, _, err := parseFilterTime(values.Get("from"))
+	if err != nil {
+		return nil, errors.New("from tidak valid (YYYY-MM-DD)")
+	}
+	to, toIsDate, err := parseFilterTime(values.Get("to"))
+	if err != nil {
+		return nil, errors.New("to tidak valid (YYYY-MM-DD)")
+	}
+	if toIsDate {
+		to = to.AddDate(0, 0, 1)
+	}
+
+	var minAmount, maxAmount int64 = -1, -1
+	if raw := strings.TrimSpace(values.Get("min_amount")); raw != "" {
+		if minAmount, err = strconv.ParseInt(raw, 10, 64); err != nil || minAmount < 0 {
+			return nil, errors.New("min_amount tidak valid")
+		}
+	}
+	if raw := strings.TrimSpace(values.Get("max_amount")); raw != "" {
+		if maxAmount, err = strconv.ParseInt(raw, 10, 64); err != nil || maxAmount < 0 {
+			return nil, errors.New("max_amount tidak valid")
+		}
+	}
+	text := strings.TrimSpace(values.Get("q"))
+
+	return func(db *gorm.DB) *gorm.DB {
+		if len(types) > 0 {
+			db = db.Where("transactions.type IN ?", types)
+		}
+		if !from.IsZero() {
+			db = db.Where("transactions.created_at >= ?", from)
+		}
+		if !to.IsZero() {
+			if toIsDate {
+				db = db.Where("transactions.created_at < ?", to)
+			} else {
+				db = db.Where("transactions.created_at <= ?", to)
+			}
+		}
+		if minAmount >= 0 {
+			db = db.Where("ABS(transactions.amount) >= ?", minAmount)
+		}
+		if maxAmount >= 0 {
+			db = db.Where("ABS(transactions.amount) <= ?", maxAmount)
+		}
+		if text != "" {
+			like := "%" + escapeLike(text) + "%"
+			db = db.Where("(transactions.description LIKE ? OR transactions.invoice_no LIKE ?)", like, like)
+		}
+		return db
+	}, nil
+}
+
+// parseFilterTime accepts a date (in local time) or an RFC 3339 timestamp.
+// Empty input gives the zero time.
+func parseFilterTime(raw string) (t time.Time, isDate bool, err error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, false, nil
+	}
+	if t, err = time.ParseInLocation("2006-01-02", raw, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err = time.Parse(time.RFC3339, raw)
+	return t, false, err
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// transactionTotals sums the filtered rows: money in, money out and the net.
+func transactionTotals(q *gorm.DB) map[string]int64 {
+	var sums struct {
+		In  int64
+		Out int64
+	}
+	q.Select("COALESCE(SUM(CASE WHEN transactions.amount > 0 THEN transactions.amount ELSE 0 END), 0) AS `in`, " +
+		"COALESCE(SUM(CASE WHEN transactions.amount < 0 THEN -transactions.amount ELSE 0 END), 0) AS `out`").
+		Scan(&sums)
+	return map[string]int64{"in": sums.In, "out": sums.Out, "net": sums.In - sums.Out}
+}
+
+// transactionExportRow is one exported transaction; UserEmail is only
+// filled in the admin export.
+type transactionExportRow struct {
+	database.Transaction
+	UserEmail string `json:"user_email,omitempty"`
+}
+
+// exportTransactions streams the rows of q, oldest first, as CSV or as a
+// JSON array, without loading them all into memory.
+func exportTransactions(w http.ResponseWriter, q *gorm.DB, format string, withUser bool) {
+	rows, err := q.Order("transactions.created_at asc, transactions.id asc").Rows()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Gagal mengekspor transaksi", err)
+		return
+	}
+	defer rows.Close()
+
+	name := "transaksi-" + time.Now().Format("20060102-150405")
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, name))
+		enc := json.NewEncoder(w)
+		w.Write([]byte("["))
+		for n := 0; rows.Next(); n++ {
+			var row transactionExportRow
+			if err := database.DB.ScanRows(rows, &row); err != nil {
+				log.Printf("export transaksi: %v", err)
+				break
+			}
+			if n > 0 {
+				w.Write([]byte(","))
+			}
+			enc.Encode(row)
+		}
+		w.Write([]byte("]\n"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, name))
+	cw := csv.NewWriter(w)
+	header := []string{"id", "created_at", "user_id"}
+	if withUser {
+		header = append(header, "user_email")
+	}
+	header = append(header, "type", "amount", "gross_amount", "discount", "voucher_code", "invoice_no", "topup_id", "description")
+	cw.Write(header)
+	for rows.Next() {
+		var row transactionExportRow
+		if err := database.DB.ScanRows(rows, &row); err != nil {
+			log.Printf("export transaksi: %v", err)
+			break
+		}
+		invoice := ""
+		if row.InvoiceNo != nil {
+			invoice = *row.InvoiceNo
+		}
+		record := []string{
+			strconv.FormatUint(uint64(row.ID), 10),
+			row.CreatedAt.Format(time.RFC3339),
+			strconv.FormatUint(uint64(row.UserID), 10),
+		}
+		if withUser {
+			record = append(record, csvText(row.UserEmail))
+		}
+		record = append(record,
+			row.Type,
+			strconv.FormatInt(row.Amount, 10),
+			strconv.FormatInt(row.GrossAmount, 10),
+			strconv.FormatInt(row.Discount, 10),
+			csvText(row.VoucherCode),
+			invoice,
+			strconv.FormatUint(uint64(row.TopUpID), 10),
+			csvText(row.Description),
+		)
+		cw.Write(record)
+	}
+	cw.Flush()
+}
+
+// csvText keeps spreadsheet apps from evaluating user-supplied text (file
+// names, voucher codes) as a formula.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// exportFormat is the requested export format, "" for a normal page.
+func exportFormat(r *http.Request) (string, error) {
+	switch f := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format"))); f {
+	case "", "csv", "json":
+		return f, nil
+	default:
+		return "", errors.New("format harus csv atau json")
+	}
+}
+
+// handleAdminTransactions pages through (or exports) the transactions of all
+// users with the history filters plus user_id and user (email or name text).
+func handleAdminTransactions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		return
+	}
+	values := r.URL.Query()
+	filter, err := transactionFilter(values)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	format, err := exportFormat(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	userID, _ := strconv.Atoi(strings.TrimSpace(values.Get("user_id")))
+	userText := strings.TrimSpace(values.Get("user"))
+
+	query := func() *gorm.DB {
+		q := database.DB.Model(&database.Transaction{}).
+			Joins("LEFT JOIN users ON users.id = transactions.user_id").
+			Scopes(filter)
+		if userID > 0 {
+			q = q.Where("transactions.user_id = ?", userID)
+		}
+		if userText != "" {
+			like := "%" + escapeLike(userText) + "%"
+			q = q.Where("(users.email LIKE ? OR users.name LIKE ?)", like, like)
+		}
+		return q
+	}
+
+	if format != "" {
+		exportTransactions(w, query().Select("transactions.*, users.email AS user_email"), format, true)
+		return
+	}
+
+	page, _ := strconv.Atoi(values.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(values.Get("page_size"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 25
+	}
+	var total int64
+	query().Count(&total)
+	var items []transactionExportRow
+	if err := query().Select("transactions.*, users.email AS user_email").
+		Order("transactions.created_at desc, transactions.id desc").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Scan(&items).Error; err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Gagal mengambil transaksi", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items":     items,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+		"totals":    transactionTotals(query()),
+	})
+}
@@ -8,6 +8,7 @@ import TasksPage from './pages/TasksPage';
 import TopUpPage from './pages/TopUpPage';
 import TopupNewPage from './pages/TopupNewPage';
 import TopupReceiptPage from './pages/TopupReceiptPage';
+import PlansPage from './pages/PlansPage';
 import SignInPage from './pages/SignInPage';
 import SignUpPage from './pages/SignUpPage';
 import ResetPasswordPage from './pages/ResetPasswordPage';
@@ -173,6 +174,14 @@ function AppContent() {
           </ProtectedRoute>
         }
       />
+      <Route
+        path="/plans"
+        element={
+          <ProtectedRoute>
+            <PlansPage />
+          </ProtectedRoute>
+        }
+      />
       <Route
         path="/topup/new"
         element={
@@ -0,0 +1,202 @@
+import React, { useCallback, useEffect, useState } from 'react';
+import Box from '@mui/material/Box';
+import Paper from '@mui/material/Paper';
+import Typography from '@mui/material/Typography';
+import Button from '@mui/material/Button';
+import Chip from '@mui/material/Chip';
+import Collapse from '@mui/material/Collapse';
+import LinearProgress from '@mui/material/LinearProgress';
+import DownloadIcon from '@mui/icons-material/Download';
+import DeleteOutlineIcon from '@mui/icons-material/DeleteOutline';
+import LinkIcon from '@mui/icons-material/Link';
+import { readApiError } from '../utils/apiError';
+
+const statusLabel = {
+    queued: 'Antri',
+    magnet_conversion: 'Membaca magnet',
+    waiting_files_selection: 'Menyiapkan',
+    downloading: 'Mengunduh',
+    uploading: 'Mengunggah',
+    compressing: 'Mengompres',
+    downloaded: 'Selesai',
+};
+
+// DebridTorrentList shows torrents that were routed to Real-Debrid. Files are
+// only unrestricted when the user asks for a link.
+export default function DebridTorrentList() {
+    const [items, setItems] = useState([]);
+    const [openId, setOpenId] = useState(null);
+    const [detail, setDetail] = useState(null);
+    const [loadingDetail, setLoadingDetail] = useState(false);
+    const [busy, setBusy] = useState(null);
+    const [error, setError] = useState('');
+
+    const loadItems = useCallback(() => {
+        fetch('/api/task/debrid')
+            .then((res) => (res.ok ? res.json() : { items: [] }))
+            .then((data) => setItems(Array.isArray(data?.items) ? data.items : []))
+            .catch(() => setItems([]));
+    }, []);
+
+    useEffect(() => {
+        loadItems();
+    }, [loadItems]);
+
+    const loadDetail = useCallback(async (id) => {
+        setLoadingDetail(true);
+        setError('');
+        try {
+            const res = await fetch(`/api/task/debrid?id=${id}`);
+            if (!res.ok) {
+                setError(await readApiError(res, 'Gagal memuat torrent'));
+                return;
+            }
+            const data = await res.json();
+            setDetail(data);
+            setItems((prev) => prev.map((t) => (t.id === id ? { ...t, status: data.status, progress: data.torrent?.progress } : t)));
+        } finally {
+            setLoadingDetail(false);
+        }
+    }, []);
+
+    // Poll only the opened torrent while it is still downloading.
+    useEffect(() => {
+        if (!openId || detail?.ready || detail?.failed) return undefined;
+        const timer = setInterval(() => loadDetail(openId), 10000);
+        return () => clearInterval(timer);
+    }, [openId, detail, loadDetail]);
+
+    const toggle = (id) => {
+        if (openId === id) {
+            setOpenId(null);
+            setDetail(null);
+            return;
+        }
+        setOpenId(id);
+        setDetail(null);
+        loadDetail(id);
+    };
+
+    const getLink = async (id, index) => {
+        setBusy(`${id}:${index}`);
+        setError('');
+        try {
+            const res = await fetch(`/api/task/debrid?id=${id}&file=${index}`, { method: 'POST' });
+            if (!res.ok) {
+                setError(await readApiError(res, 'Gagal membuat link'));
+                return;
+            }
+            const file = await res.json();
+            setDetail((d) => (d ? { ...d, files: d.files.map((f) => (f.index === index ? file : f)) } : d));
+        } finally {
+            setBusy(null);
+        }
+    };
+
+    const remove = async (id) => {
+        setBusy(`${id}:delete`);
+        try {
+            const res = await fetch(`/api/task/debrid?id=${id}`, { method: 'DELETE' });
+            if (!res.ok) {
+                setError(await readApiError(res, 'Gagal menghapus torrent'));
+                return;
+            }
+            if (openId === id) {
+                setOpenId(null);
+                setDetail(null);
+            }
+            loadItems();
+        } finally {
+            setBusy(null);
+        }
+    };
+
+    if (items.length === 0) return null;
+
+    return (
+        <Box sx={{ p: 2, borderTop: '1px solid', borderColor: 'divider' }}>
+            <Typography variant="subtitle2" fontWeight={700} sx={{ mb: 1 }}>
+                Torrent via Real-Debrid
+            </Typography>
+            {error && (
+                <Typography variant="caption" color="error" sx={{ display: 'block', mb: 1 }}>
+                    {error}
+                </Typography>
+            )}
+            <Box sx={{ display: 'flex', flexDirection: 'column', gap: 1 }}>
+                {items.map((t) => (
+                    <Paper key={t.id} variant="outlined" sx={{ p: 1.25 }}>
+                        <Box sx={{ display: 'flex', alignItems: 'center', gap: 1 }}>
+                            <Typography variant="body2" fontWeight={600} noWrap sx={{ flex: 1, minWidth: 0 }} title={t.name}>
+                                {t.name || t.hash || `Torrent #${t.id}`}
+                            </Typography>
+                            <Chip size="small" label={statusLabel[t.status] || t.status} color={t.status === 'downloaded' ? 'success' : 'default'} />
+                            <Button size="small" onClick={() => toggle(t.id)} sx={{ textTransform: 'none' }}>
+                                {openId === t.id ? 'Tutup' : 'File'}
+                            </Button>
+                            <Button
+                                size="small"
+                                color="error"
+                                startIcon={<DeleteOutlineIcon fontSize="small" />}
+                                disabled={busy === `${t.id}:delete`}
+                                onClick={() => remove(t.id)}
+                                sx={{ textTransform: 'none' }}
+                            >
+                                Hapus
+                            </Button>
+                        </Box>
+                        <Collapse in={openId === t.id} unmountOnExit>
+                            <Box sx={{ mt: 1 }}>
+                                {loadingDetail && !detail ? (
+                                    <LinearProgress />
+                                ) : detail && !detail.ready ? (
+                                    <Box>
+                                        <Typography variant="caption" color="text.secondary">
+                                            {detail.failed ? 'Torrent gagal di Real-Debrid.' : `Progress ${Math.round(detail.torrent?.progress || 0)}%`}
+                                        </Typography>
+                                        {!detail.failed && <LinearProgress variant="determinate" value={Number(detail.torrent?.progress || 0)} />}
+                                    </Box>
+                                ) : (
+                                    (detail?.files || []).map((f) => (
+                                        <Box key={f.index} sx={{ display: 'flex', alignItems: 'center', gap: 1, py: 0.5 }}>
+                                            <Typography variant="body2" noWrap sx={{ flex: 1, minWidth: 0 }} title={f.filename}>
+                                                {f.filename}
+                                            </Typography>
+                                            {f.size && (
+                                                <Typography variant="caption" color="text.secondary">
+                                                    {f.size}
+                                                </Typography>
+                                            )}
+                                            {f.url ? (
+                                                <Button
+                                                    size="small"
+                                                    variant="contained"
+                                                    startIcon={<DownloadIcon fontSize="small" />}
+                                                    onClick={() => window.open(f.url, '_blank', 'noopener,noreferrer')}
+                                                    sx={{ textTransform: 'none' }}
+                                                >
+                                                    Unduh
+                                                </Button>
+                                            ) : (
+                                                <Button
+                                                    size="small"
+                                                    variant="outlined"
+                                                    startIcon={<LinkIcon fontSize="small" />}
+                                                    disabled={busy === `${t.id}:${f.index}`}
+                                                    onClick={() => getLink(t.id, f.index)}
+                                                    sx={{ textTransform: 'none' }}
+                                                >
+                                                    {busy === `${t.id}:${f.index}` ? 'Memproses...' : 'Buat Link'}
+                                                </Button>
+                                            )}
+                                        </Box>
+                                    ))
+                                )}
+                            </Box>
+                        </Collapse>
+                    </Paper>
+                ))}
+            </Box>
+        </Box>
+    );
+}
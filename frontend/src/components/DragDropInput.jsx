@@ -47,6 +47,7 @@ export default function DragDropInput({ onCheck, loading }) {
     const [showEstimateResult, setShowEstimateResult] = useState(false);
     const [voucherPreview, setVoucherPreview] = useState(null);
     const [checkingVoucher, setCheckingVoucher] = useState(false);
+    const [hostCheck, setHostCheck] = useState(null);
 
     useEffect(() => {
         const snapshotKey = 'pricing_previous_snapshot_v1';
@@ -116,6 +117,33 @@ export default function DragDropInput({ onCheck, loading }) {
             });
     }, []);
 
+    // Check a pasted premium link against the host list while the user types.
+    useEffect(() => {
+        const link = url.trim();
+        if (mode !== 'premium' || !/^https?:\/\//i.test(link)) {
+            setHostCheck(null);
+            return undefined;
+        }
+        let cancelled = false;
+        const timer = setTimeout(() => {
+            fetch(`/api/hosts?link=${encodeURIComponent(link)}`)
+                .then(async (res) => ({ ok: res.ok, ...(await res.json()) }))
+                .then((data) => {
+                    if (!cancelled) setHostCheck(data);
+                })
+                .catch(() => {
+                    if (!cancelled) setHostCheck(null);
+                });
+        }, 400);
+        return () => {
+            cancelled = true;
+            clearTimeout(timer);
+        };
+    }, [url, mode]);
+
+    // Only block when the host list is set up; an empty list means it was never synced.
+    const hostBlocked = mode === 'premium' && hosts.length > 0 && !!hostCheck && (!hostCheck.ok || !hostCheck.available);
+
     const onDrop = useCallback((acceptedFiles) => {
         console.log(acceptedFiles);
     }, []);
@@ -123,7 +151,7 @@ export default function DragDropInput({ onCheck, loading }) {
     const { getRootProps, getInputProps, isDragActive } = useDropzone({ onDrop, noClick: true });
 
     const handleFetch = () => {
-        if (!url) return;
+        if (!url || hostBlocked) return;
         if (mode === 'premium') {
             setShowPremiumReceipt(true);
             return;
@@ -453,6 +481,12 @@ export default function DragDropInput({ onCheck, loading }) {
                                 placeholder="https://rapidgator.net/file/..."
                                 startDecorator={<LinkIcon fontSize="small" />}
                             />
+                            {hostCheck && (
+                                <Typography level="body-xs" color={hostCheck.ok && hostCheck.available ? 'success' : 'warning'}>
+                                    {hostCheck.name || hostCheck.host ? `${hostCheck.name || hostCheck.host}: ` : ''}
+                                    {hostCheck.message}
+                                </Typography>
+                            )}
                             <Box sx={{ display: 'flex', gap: 1, flexDirection: { xs: 'column', sm: 'row' } }}>
                                 <Input
                                     fullWidth
@@ -524,7 +558,7 @@ export default function DragDropInput({ onCheck, loading }) {
                                     variant="solid"
                                     color="primary"
                                     onClick={handleFetch}
-                                    disabled={loading || !url}
+                                    disabled={loading || !url || hostBlocked}
                                     sx={{ minWidth: 120, whiteSpace: 'nowrap' }}
                                 >
                                     {loading ? 'Mengirim...' : 'Proses'}
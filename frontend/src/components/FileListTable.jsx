@@ -22,6 +22,7 @@ import DownloadIcon from '@mui/icons-material/Download';
 import ListAltIcon from '@mui/icons-material/ListAlt';
 import InboxIcon from '@mui/icons-material/Inbox';
 import DeleteOutlineIcon from '@mui/icons-material/DeleteOutline';
+import { readApiError } from '../utils/apiError';
 
 export default function FileListTable({ files, loading, onFolderClick, onGetLink, onDeleted, onFolderDownload }) {
     const [deletingId, setDeletingId] = useState('');
@@ -146,8 +147,7 @@ export default function FileListTable({ files, loading, onFolderClick, onGetLink
             const dirHandle = await window.showDirectoryPicker({ mode: 'readwrite' });
             const res = await fetch(`/api/folder/manifest?folder_id=${file.id}&folder_name=${encodeURIComponent(file.name)}&format=json`);
             if (!res.ok) {
-                const text = await res.text();
-                throw new Error(text || `HTTP ${res.status}`);
+                throw new Error(await readApiError(res, `HTTP ${res.status}`));
             }
 
             const data = await res.json();
@@ -0,0 +1,201 @@
+import React, { useEffect, useState } from 'react';
+import Box from '@mui/joy/Box';
+import Input from '@mui/joy/Input';
+import Button from '@mui/joy/Button';
+import Typography from '@mui/joy/Typography';
+import Alert from '@mui/joy/Alert';
+import Divider from '@mui/joy/Divider';
+import Select from '@mui/joy/Select';
+import Option from '@mui/joy/Option';
+import LinearProgress from '@mui/joy/LinearProgress';
+import FolderZipOutlinedIcon from '@mui/icons-material/FolderZipOutlined';
+import { useAuth } from '../App';
+import { readApiError } from '../utils/apiError';
+
+const formatIDR = (value) => `Rp ${Number(value || 0).toLocaleString('id-ID')}`;
+
+// PremiumBatchForm expands a hoster folder or a DLC/RSDF/CCF container into
+// premium requests via /api/premium/batch: quote first, then queue.
+export default function PremiumBatchForm() {
+    const { refreshUser } = useAuth();
+    const [sourceType, setSourceType] = useState('folder');
+    const [url, setUrl] = useState('');
+    const [file, setFile] = useState(null);
+    const [voucher, setVoucher] = useState('');
+    const [quote, setQuote] = useState(null);
+    const [batch, setBatch] = useState(null);
+    const [busy, setBusy] = useState(false);
+    const [error, setError] = useState('');
+
+    const reset = () => {
+        setQuote(null);
+        setBatch(null);
+        setError('');
+    };
+
+    const send = async (dryRun) => {
+        let body;
+        let headers;
+        if (sourceType === 'container' && file) {
+            body = new FormData();
+            body.append('container', file);
+            body.append('voucher', voucher.trim().toUpperCase());
+            body.append('dry_run', String(dryRun));
+        } else {
+            headers = { 'Content-Type': 'application/json' };
+            body = JSON.stringify({ url: url.trim(), type: sourceType, voucher: voucher.trim().toUpperCase(), dry_run: dryRun });
+        }
+        return fetch('/api/premium/batch', { method: 'POST', headers, body });
+    };
+
+    const check = async () => {
+        setBusy(true);
+        reset();
+        try {
+            const res = await send(true);
+            if (!res.ok) {
+                setError(await readApiError(res, 'Folder/container tidak bisa dibaca'));
+                return;
+            }
+            setQuote(await res.json());
+        } catch (e) {
+            setError(e.message);
+        } finally {
+            setBusy(false);
+        }
+    };
+
+    const submit = async () => {
+        setBusy(true);
+        setError('');
+        try {
+            const res = await send(false);
+            if (!res.ok) {
+                setError(await readApiError(res, 'Gagal memproses folder/container'));
+                return;
+            }
+            const data = await res.json();
+            setQuote(data);
+            setBatch({ id: data.batch_id, counts: { pending: data.file_count } });
+            if (refreshUser) await refreshUser();
+        } catch (e) {
+            setError(e.message);
+        } finally {
+            setBusy(false);
+        }
+    };
+
+    // Follow the queued files until none is pending or processing.
+    useEffect(() => {
+        if (!batch?.id) return undefined;
+        const counts = batch.counts || {};
+        if (!counts.pending && !counts.processing) return undefined;
+        const timer = setTimeout(async () => {
+            const res = await fetch(`/api/premium/batch?id=${batch.id}`);
+            if (res.ok) {
+                const data = await res.json();
+                setBatch({ id: batch.id, counts: data.counts || {} });
+            }
+        }, 3000);
+        return () => clearTimeout(timer);
+    }, [batch]);
+
+    const canCheck = sourceType === 'container' ? !!file || !!url.trim() : !!url.trim();
+    const counts = batch?.counts || {};
+    const total = quote?.file_count || 0;
+    const settled = (counts.done || 0) + (counts.failed || 0);
+
+    return (
+        <Box sx={{ mt: 2.5 }}>
+            <Divider sx={{ mb: 2 }} />
+            <Box sx={{ display: 'flex', alignItems: 'center', gap: 1, mb: 0.5 }}>
+                <FolderZipOutlinedIcon fontSize="small" />
+                <Typography level="title-sm" sx={{ fontWeight: 700 }}>
+                    Folder / Container Host Premium
+                </Typography>
+            </Box>
+            <Typography level="body-xs" color="neutral" sx={{ mb: 1.5 }}>
+                Semua file di folder atau container (DLC/RSDF/CCF) dijadikan request premium sekaligus. Harga dihitung dari total ukuran.
+            </Typography>
+
+            <Box sx={{ display: 'flex', gap: 1, flexWrap: 'wrap', mb: 1 }}>
+                <Select
+                    size="sm"
+                    value={sourceType}
+                    onChange={(_, v) => {
+                        setSourceType(v || 'folder');
+                        setFile(null);
+                        reset();
+                    }}
+                    sx={{ minWidth: 130 }}
+                >
+                    <Option value="folder">Folder</Option>
+                    <Option value="container">Container</Option>
+                </Select>
+                <Input
+                    size="sm"
+                    placeholder={sourceType === 'folder' ? 'Link folder hoster' : 'Link file container'}
+                    value={url}
+                    onChange={(e) => {
+                        setUrl(e.target.value);
+                        reset();
+                    }}
+                    disabled={!!file}
+                    sx={{ flex: 1, minWidth: 220 }}
+                />
+                {sourceType === 'container' && (
+                    <Button size="sm" variant="outlined" component="label">
+                        {file ? file.name : 'Unggah file'}
+                        <input
+                            hidden
+                            type="file"
+                            accept=".dlc,.rsdf,.ccf"
+                            onChange={(e) => {
+                                setFile(e.target.files?.[0] || null);
+                                reset();
+                            }}
+                        />
+                    </Button>
+                )}
+            </Box>
+            <Box sx={{ display: 'flex', gap: 1, flexWrap: 'wrap' }}>
+                <Input size="sm" placeholder="Kode voucher (opsional)" value={voucher} onChange={(e) => setVoucher(e.target.value)} sx={{ flex: 1, minWidth: 180 }} />
+                <Button size="sm" variant="soft" onClick={check} loading={busy && !quote} disabled={!canCheck || busy}>
+                    Cek Estimasi
+                </Button>
+            </Box>
+
+            {error && (
+                <Alert color="danger" variant="soft" sx={{ mt: 1.5 }}>
+                    {error}
+                </Alert>
+            )}
+
+            {quote && (
+                <Box sx={{ mt: 1.5, display: 'grid', gap: 0.5 }}>
+                    <Typography level="body-sm">
+                        {quote.file_count} file · {quote.total_size_gb} · <strong>{formatIDR(quote.price)}</strong>
+                        {Number(quote.discount_amount || 0) > 0 && ` (voucher -${formatIDR(quote.discount_amount)})`}
+                    </Typography>
+                    {(quote.skipped || []).length > 0 && (
+                        <Typography level="body-xs" color="warning">
+                            {quote.skipped.length} file dilewati: {quote.skipped.map((s) => s.reason).filter((r, i, a) => a.indexOf(r) === i).join(', ')}
+                        </Typography>
+                    )}
+                    {!batch ? (
+                        <Button size="sm" onClick={submit} loading={busy} sx={{ justifySelf: 'start', mt: 0.5 }}>
+                            Proses {quote.file_count} file
+                        </Button>
+                    ) : (
+                        <Box sx={{ mt: 0.5 }}>
+                            <Typography level="body-xs" color="neutral" sx={{ mb: 0.5 }}>
+                                Batch #{batch.id}: {counts.done || 0} selesai, {counts.failed || 0} gagal, {(counts.pending || 0) + (counts.processing || 0)} antri. Hasil tiap file ada di riwayat Host Premium.
+                            </Typography>
+                            <LinearProgress determinate value={total ? (settled / total) * 100 : 0} />
+                        </Box>
+                    )}
+                </Box>
+            )}
+        </Box>
+    );
+}
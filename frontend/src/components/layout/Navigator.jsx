@@ -15,6 +15,7 @@ import AdminPanelSettingsIcon from '@mui/icons-material/AdminPanelSettings';
 import NewspaperIcon from '@mui/icons-material/Newspaper';
 import ForumIcon from '@mui/icons-material/Forum';
 import InsightsIcon from '@mui/icons-material/Insights';
+import WorkspacePremiumIcon from '@mui/icons-material/WorkspacePremium';
 import { useAuth } from '../../App';
 
 const item = {
@@ -74,6 +75,11 @@ export default function Navigator(props) {
                     icon: <AccountBalanceWalletIcon />,
                     path: '/balance',
                 },
+                {
+                    id: 'Paket Langganan',
+                    icon: <WorkspacePremiumIcon />,
+                    path: '/plans',
+                },
             ],
         },
         ...(user?.role === 'admin'
@@ -40,6 +40,7 @@ import AttachMoneyIcon from '@mui/icons-material/AttachMoney';
 import DeleteOutlineIcon from '@mui/icons-material/DeleteOutline';
 import PaymentIcon from '@mui/icons-material/Payments';
 import PersonAddAlt1Icon from '@mui/icons-material/PersonAddAlt1';
+import { readApiError } from '../utils/apiError';
 
 export default function AdminPage() {
     const [activeTab, setActiveTab] = useState(0);
@@ -215,8 +216,7 @@ export default function AdminPage() {
                 body: JSON.stringify({ id, status, reason: reason || '' }),
             });
             if (!res.ok) {
-                const t = await res.text();
-                throw new Error(t || 'Gagal memproses topup');
+                throw new Error(await readApiError(res, 'Gagal memproses topup'));
             }
             setMessage(status === 'approved' ? 'Topup disetujui.' : 'Topup ditolak.');
             closeTopupDecision();
@@ -279,8 +279,7 @@ export default function AdminPage() {
                 body: JSON.stringify(payload),
             });
             if (!res.ok) {
-                const t = await res.text();
-                setMessage(t || 'Gagal membuat voucher');
+                setMessage(await readApiError(res, 'Gagal membuat voucher'));
                 return false;
             }
             setMessage('Voucher berhasil dibuat');
@@ -328,8 +327,7 @@ export default function AdminPage() {
                 body: JSON.stringify(payload),
             });
             if (!res.ok) {
-                const t = await res.text();
-                setMessage(t || 'Gagal update voucher');
+                setMessage(await readApiError(res, 'Gagal update voucher'));
                 return;
             }
             setMessage('Voucher berhasil diupdate');
@@ -344,8 +342,7 @@ export default function AdminPage() {
         try {
             const res = await fetch(`/api/admin/vouchers?id=${id}`, { method: 'DELETE' });
             if (!res.ok) {
-                const t = await res.text();
-                setMessage(t || 'Gagal hapus voucher');
+                setMessage(await readApiError(res, 'Gagal hapus voucher'));
                 return;
             }
             setMessage('Voucher berhasil dihapus');
@@ -467,8 +464,7 @@ export default function AdminPage() {
                 fetchStats();
                 return true;
             } else {
-                const t = await res.text();
-                setMessage(t || 'Gagal update saldo');
+                setMessage(await readApiError(res, 'Gagal update saldo'));
                 return false;
             }
         } catch (err) {
@@ -529,8 +525,7 @@ export default function AdminPage() {
                     body: JSON.stringify({ user_id: userEditTarget.id, is_active: userEditActive }),
                 });
                 if (!res.ok) {
-                    const t = await res.text();
-                    setMessage(t || 'Gagal update status user');
+                    setMessage(await readApiError(res, 'Gagal update status user'));
                     return;
                 }
                 changed = true;
@@ -566,8 +561,7 @@ export default function AdminPage() {
                 setAdminIdentifier('');
                 fetchUsers();
             } else {
-                const t = await res.text();
-                setMessage(t || 'Gagal menjadikan admin');
+                setMessage(await readApiError(res, 'Gagal menjadikan admin'));
             }
         } catch (err) {
             setMessage('Error: ' + err.message);
@@ -1727,6 +1721,7 @@ export default function AdminPage() {
                                         <TableCell sx={{ fontWeight: 600 }}>Nominal</TableCell>
                                         <TableCell sx={{ fontWeight: 600 }}>Metode</TableCell>
                                         <TableCell sx={{ fontWeight: 600 }}>Status</TableCell>
+                                        <TableCell sx={{ fontWeight: 600 }}>Bukti</TableCell>
                                         <TableCell sx={{ fontWeight: 600 }}>Alasan</TableCell>
                                         <TableCell sx={{ fontWeight: 600, width: 180 }}>Aksi</TableCell>
                                     </TableRow>
@@ -1773,6 +1768,20 @@ export default function AdminPage() {
                                                     <Chip size="small" label="pending" color="warning" variant="outlined" />
                                                 )}
                                             </TableCell>
+                                            <TableCell>
+                                                {t.proof_image ? (
+                                                    <a href={`/api/topups/proof?id=${t.id}`} target="_blank" rel="noreferrer">
+                                                        <Box
+                                                            component="img"
+                                                            src={`/api/topups/proof?id=${t.id}`}
+                                                            alt={`Bukti ${t.serial || t.id}`}
+                                                            sx={{ width: 48, height: 48, objectFit: 'cover', borderRadius: 1, border: '1px solid', borderColor: 'divider', display: 'block' }}
+                                                        />
+                                                    </a>
+                                                ) : (
+                                                    <Typography variant="caption" color="text.disabled">-</Typography>
+                                                )}
+                                            </TableCell>
                                             <TableCell>
                                                 <Typography variant="caption" color="text.secondary">
                                                     {t.admin_reason || '-'}
@@ -1811,7 +1820,7 @@ export default function AdminPage() {
 
                                     {topupRequests.length === 0 && (
                                         <TableRow>
-                                            <TableCell colSpan={9} sx={{ textAlign: 'center', py: 4 }}>
+                                            <TableCell colSpan={10} sx={{ textAlign: 'center', py: 4 }}>
                                                 <Typography variant="body2" color="text.secondary">
                                                     Belum ada permintaan top up.
                                                 </Typography>
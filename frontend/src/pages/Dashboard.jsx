@@ -1,4 +1,5 @@
 import React, { useEffect, useState, useCallback } from 'react';
+import { readApiError } from '../utils/apiError';
 
 export default function Dashboard() {
     const [files, setFiles] = useState([]);
@@ -175,8 +176,7 @@ export default function Dashboard() {
             const dirHandle = await window.showDirectoryPicker({ mode: 'readwrite' });
             const res = await fetch(`/api/folder/manifest?folder_id=${file.id}&folder_name=${encodeURIComponent(file.name)}&format=json`);
             if (!res.ok) {
-                const text = await res.text();
-                throw new Error(text || `HTTP ${res.status}`);
+                throw new Error(await readApiError(res, `HTTP ${res.status}`));
             }
 
             const data = await res.json();
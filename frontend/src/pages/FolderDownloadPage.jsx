@@ -12,6 +12,7 @@ import ArrowBackIcon from '@mui/icons-material/ArrowBack';
 import FolderOpenIcon from '@mui/icons-material/FolderOpen';
 import DownloadingIcon from '@mui/icons-material/Downloading';
 import CheckCircleOutlineIcon from '@mui/icons-material/CheckCircleOutline';
+import { readApiError } from '../utils/apiError';
 
 function formatBytes(bytes) {
     if (!Number.isFinite(bytes) || bytes < 0) return '-';
@@ -83,8 +84,7 @@ export default function FolderDownloadPage() {
 
             const res = await fetch(`/api/folder/manifest?folder_id=${folderId}&folder_name=${encodeURIComponent(folderName)}&format=json`);
             if (!res.ok) {
-                const text = await res.text();
-                throw new Error(text || `HTTP ${res.status}`);
+                throw new Error(await readApiError(res, `HTTP ${res.status}`));
             }
 
             const data = await res.json();
@@ -11,6 +11,7 @@ import CircularProgress from '@mui/material/CircularProgress';
 import CampaignIcon from '@mui/icons-material/Campaign';
 import NewReleasesIcon from '@mui/icons-material/NewReleases';
 import AccessTimeIcon from '@mui/icons-material/AccessTime';
+import { readApiError } from '../utils/apiError';
 
 const postTypeConfig = {
     info: { color: 'info', icon: <CampaignIcon fontSize="small" />, label: 'Info' },
@@ -38,7 +39,7 @@ export default function InformasiPostPage() {
             setLoading(true);
             try {
                 const res = await fetch(`/api/posts/official?id=${encodeURIComponent(id)}`);
-                if (!res.ok) throw new Error(await res.text());
+                if (!res.ok) throw new Error(await readApiError(res));
                 const data = await res.json();
                 if (!alive) return;
                 setPost(data || null);
@@ -13,6 +13,7 @@ import Alert from '@mui/joy/Alert';
 import Divider from '@mui/joy/Divider';
 import DragDropInput from '../components/DragDropInput';
 import PreviewModal from '../components/PreviewModal';
+import PremiumBatchForm from '../components/PremiumBatchForm';
 import { useAuth } from '../App';
 import DownloadIcon from '@mui/icons-material/Download';
 
@@ -52,6 +53,19 @@ export default function InputLinkPage() {
         }
     };
 
+    // Automatic premium requests are queued on the server; poll until the job settles.
+    const waitPremiumJob = async (id, timeoutMs = 90000) => {
+        const started = Date.now();
+        while (Date.now() - started < timeoutMs) {
+            await new Promise((resolve) => setTimeout(resolve, 2000));
+            const res = await fetch(`/api/premium/request?id=${id}`);
+            if (!res.ok) continue;
+            const job = await parseResponse(res);
+            if (job.status === 'done' || job.status === 'failed') return job;
+        }
+        return null;
+    };
+
     const handleCheck = async (url, mode, voucher = '', options = {}) => {
         const normalizedVoucher = String(voucher || '').trim().toUpperCase();
         const estimatedSizeGb = Number(options?.estimatedSizeGb || 0);
@@ -84,13 +98,32 @@ export default function InputLinkPage() {
                     return;
                 }
 
-                if (data?.mode === 'automatic' && data?.download_url) {
+                if (data?.mode === 'automatic') {
                     if (refreshUser) await refreshUser();
-                    openPremiumDialog({
-                        status: 'success',
-                        data,
-                        message: data.message || 'Link premium valid dan siap diunduh',
-                    });
+                    const job = data.status === 'pending' || data.status === 'processing'
+                        ? await waitPremiumJob(data.id)
+                        : data;
+                    if (refreshUser) await refreshUser();
+                    if (job?.status === 'done') {
+                        openPremiumDialog({
+                            status: 'success',
+                            data: { ...data, ...job },
+                            message: job.message || 'Link premium valid dan siap diunduh',
+                        });
+                    } else if (job?.status === 'failed') {
+                        openPremiumDialog({
+                            status: 'danger',
+                            data: { ...data, ...job },
+                            message: job.message || 'Link premium gagal diproses',
+                            error: job.error || '',
+                        });
+                    } else {
+                        openPremiumDialog({
+                            status: 'warning',
+                            data,
+                            message: 'Link premium masih dalam antrian. Hasilnya akan muncul di riwayat dan notifikasi.',
+                        });
+                    }
                 } else {
                     openPremiumDialog({
                         status: 'warning',
@@ -159,6 +192,7 @@ export default function InputLinkPage() {
                     Tempel link torrent/magnet atau host premium, lalu proses.
                 </Typography>
                 <DragDropInput onCheck={handleCheck} loading={checking} />
+                <PremiumBatchForm />
             </Sheet>
             <PreviewModal preview={preview} onConfirm={handleConfirm} onCancel={handleCancelTask} />
 
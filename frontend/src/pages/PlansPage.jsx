@@ -0,0 +1,218 @@
+import React, { useEffect, useState } from 'react';
+import { useNavigate } from 'react-router-dom';
+import Box from '@mui/material/Box';
+import Paper from '@mui/material/Paper';
+import Typography from '@mui/material/Typography';
+import Divider from '@mui/material/Divider';
+import Button from '@mui/material/Button';
+import Chip from '@mui/material/Chip';
+import Alert from '@mui/material/Alert';
+import Switch from '@mui/material/Switch';
+import FormControlLabel from '@mui/material/FormControlLabel';
+import LinearProgress from '@mui/material/LinearProgress';
+import Dialog from '@mui/material/Dialog';
+import DialogTitle from '@mui/material/DialogTitle';
+import DialogContent from '@mui/material/DialogContent';
+import DialogActions from '@mui/material/DialogActions';
+import { readApiError } from '../utils/apiError';
+
+const rupiah = (n) => `Rp ${Number(n || 0).toLocaleString('id-ID')}`;
+const formatDate = (s) => new Date(s).toLocaleDateString('id-ID', { day: 'numeric', month: 'long', year: 'numeric' });
+
+function QuotaBar({ label, used, total }) {
+    if (!total) return null;
+    return (
+        <Box sx={{ mb: 1.5 }}>
+            <Box sx={{ display: 'flex', justifyContent: 'space-between', mb: 0.5 }}>
+                <Typography variant="body2">{label}</Typography>
+                <Typography variant="body2" color="text.secondary">
+                    {used} / {total} GB
+                </Typography>
+            </Box>
+            <LinearProgress variant="determinate" value={Math.min(100, (used / total) * 100)} />
+        </Box>
+    );
+}
+
+export default function PlansPage() {
+    const navigate = useNavigate();
+    const [plans, setPlans] = useState([]);
+    const [current, setCurrent] = useState(null);
+    const [usage, setUsage] = useState([]);
+    const [loading, setLoading] = useState(true);
+    const [buying, setBuying] = useState(null);
+    const [submitting, setSubmitting] = useState(false);
+    const [flash, setFlash] = useState(null);
+
+    const refresh = async () => {
+        setLoading(true);
+        try {
+            const [plansRes, subRes] = await Promise.all([fetch('/api/plans'), fetch('/api/subscription')]);
+            const plansData = await plansRes.json();
+            const subData = await subRes.json();
+            setPlans(Array.isArray(plansData) ? plansData : []);
+            setCurrent(subData?.subscription || null);
+            setUsage(Array.isArray(subData?.usage) ? subData.usage : []);
+        } catch (err) {
+            console.error(err);
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    useEffect(() => {
+        refresh();
+    }, []);
+
+    const buy = async () => {
+        if (!buying) return;
+        setSubmitting(true);
+        try {
+            const res = await fetch('/api/subscription', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ plan_id: buying.id, auto_renew: true }),
+            });
+            if (!res.ok) {
+                setFlash({ severity: 'error', text: await readApiError(res, 'Gagal membeli paket') });
+                return;
+            }
+            setFlash({ severity: 'success', text: `Paket ${buying.name} aktif.` });
+            await refresh();
+        } finally {
+            setSubmitting(false);
+            setBuying(null);
+        }
+    };
+
+    const toggleAutoRenew = async (autoRenew) => {
+        const res = await fetch('/api/subscription', {
+            method: 'PATCH',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ auto_renew: autoRenew }),
+        });
+        if (!res.ok) {
+            setFlash({ severity: 'error', text: await readApiError(res, 'Gagal mengubah paket') });
+            return;
+        }
+        setCurrent((s) => (s ? { ...s, auto_renew: autoRenew } : s));
+    };
+
+    return (
+        <Box sx={{ maxWidth: 720, mx: 'auto' }}>
+            {flash && (
+                <Alert severity={flash.severity} onClose={() => setFlash(null)} sx={{ mb: 2 }}>
+                    {flash.text}
+                </Alert>
+            )}
+
+            {current && (
+                <Paper variant="outlined" sx={{ p: 2.5, mb: 2 }}>
+                    <Box sx={{ display: 'flex', alignItems: 'center', gap: 1, mb: 0.5 }}>
+                        <Typography variant="subtitle1" fontWeight={800}>
+                            Paket {current.plan_name}
+                        </Typography>
+                        <Chip size="small" color="success" label="Aktif" />
+                    </Box>
+                    <Typography variant="body2" color="text.secondary" sx={{ mb: 2 }}>
+                        Berlaku sampai {formatDate(current.period_end)}. Unduhan memakai kuota lebih dulu, sisanya dari saldo.
+                    </Typography>
+                    <QuotaBar label="Torrent/Magnet" used={current.torrent_used_gb} total={current.torrent_gb} />
+                    <QuotaBar label="Premium Host" used={current.premium_used_gb} total={current.premium_gb} />
+                    <FormControlLabel
+                        control={<Switch checked={!!current.auto_renew} onChange={(e) => toggleAutoRenew(e.target.checked)} />}
+                        label={`Perpanjang otomatis dari saldo (${rupiah(current.price)})`}
+                    />
+                    {usage.length > 0 && (
+                        <>
+                            <Divider sx={{ my: 1.5 }} />
+                            <Typography variant="body2" fontWeight={700} sx={{ mb: 1 }}>
+                                Pemakaian kuota
+                            </Typography>
+                            {usage.map((u) => (
+                                <Box key={u.id} sx={{ display: 'flex', justifyContent: 'space-between', gap: 2, py: 0.5 }}>
+                                    <Typography variant="body2" noWrap sx={{ minWidth: 0 }}>
+                                        {u.description || u.service_type}
+                                    </Typography>
+                                    <Typography variant="body2" color="text.secondary" sx={{ flexShrink: 0 }}>
+                                        {u.gb} GB
+                                    </Typography>
+                                </Box>
+                            ))}
+                        </>
+                    )}
+                </Paper>
+            )}
+
+            <Paper variant="outlined" sx={{ p: 2.5 }}>
+                <Typography variant="subtitle1" fontWeight={800} sx={{ mb: 0.5 }}>
+                    Paket langganan
+                </Typography>
+                <Typography variant="body2" color="text.secondary" sx={{ mb: 2 }}>
+                    Dibayar dari saldo. Kuota GB berlaku per periode dan tidak diakumulasi.
+                </Typography>
+                <Divider sx={{ mb: 2 }} />
+
+                {loading ? (
+                    <Typography variant="body2" color="text.secondary">
+                        Memuat...
+                    </Typography>
+                ) : plans.length === 0 ? (
+                    <Typography variant="body2" color="text.secondary">
+                        Belum ada paket tersedia
+                    </Typography>
+                ) : (
+                    plans.map((p) => (
+                        <Box key={p.id} sx={{ display: 'flex', alignItems: 'center', gap: 2, py: 1.5, borderBottom: 1, borderColor: 'divider' }}>
+                            <Box sx={{ flex: 1, minWidth: 0 }}>
+                                <Typography variant="body1" fontWeight={700}>
+                                    {p.name} · {rupiah(p.price)}/{p.period_months > 1 ? `${p.period_months} bulan` : 'bulan'}
+                                </Typography>
+                                <Typography variant="body2" color="text.secondary">
+                                    {[
+                                        p.torrent_gb ? `Torrent ${p.torrent_gb} GB` : '',
+                                        p.premium_gb ? `Premium ${p.premium_gb} GB` : '',
+                                        p.storage_gb ? `Penyimpanan ${p.storage_gb} GB` : '',
+                                        p.retention_days ? `File disimpan ${p.retention_days} hari` : '',
+                                        p.priority > 0 ? 'Antrian prioritas' : '',
+                                    ]
+                                        .filter(Boolean)
+                                        .join(' · ')}
+                                </Typography>
+                                {p.description && (
+                                    <Typography variant="caption" color="text.secondary">
+                                        {p.description}
+                                    </Typography>
+                                )}
+                            </Box>
+                            <Button variant="contained" size="small" disabled={!!current} onClick={() => setBuying(p)} sx={{ textTransform: 'none' }}>
+                                Beli
+                            </Button>
+                        </Box>
+                    ))
+                )}
+
+                <Button size="small" onClick={() => navigate('/balance')} sx={{ mt: 2, textTransform: 'none' }}>
+                    Lihat saldo & top up
+                </Button>
+            </Paper>
+
+            <Dialog open={!!buying} onClose={() => !submitting && setBuying(null)}>
+                <DialogTitle>Beli paket {buying?.name}?</DialogTitle>
+                <DialogContent>
+                    <Typography variant="body2">
+                        {rupiah(buying?.price)} dipotong dari saldo sekarang. Paket diperpanjang otomatis tiap periode selama saldo cukup; bisa dimatikan kapan saja.
+                    </Typography>
+                </DialogContent>
+                <DialogActions>
+                    <Button onClick={() => setBuying(null)} disabled={submitting}>
+                        Batal
+                    </Button>
+                    <Button variant="contained" onClick={buy} disabled={submitting}>
+                        Beli
+                    </Button>
+                </DialogActions>
+            </Dialog>
+        </Box>
+    );
+}
@@ -1,6 +1,7 @@
 import React, { useState, useEffect, useCallback } from 'react';
 import { useNavigate } from 'react-router-dom';
 import FileListTable from '../components/FileListTable';
+import DebridTorrentList from '../components/DebridTorrentList';
 import Box from '@mui/material/Box';
 import Paper from '@mui/material/Paper';
 import IconButton from '@mui/material/IconButton';
@@ -44,6 +45,7 @@ export default function TasksPage() {
     const [premiumTotal, setPremiumTotal] = useState(0);
     const [deletingPremiumId, setDeletingPremiumId] = useState(null);
     const [deletePremiumTarget, setDeletePremiumTarget] = useState(null);
+    const [refreshingPremiumId, setRefreshingPremiumId] = useState(null);
     const [showInfo, setShowInfo] = useState(false);
     const [downloadTab, setDownloadTab] = useState(0);
     const navigate = useNavigate();
@@ -158,6 +160,28 @@ export default function TasksPage() {
         }
     };
 
+    const handleRefreshPremiumLink = async (item) => {
+        if (!item?.id) return;
+        setRefreshingPremiumId(item.id);
+        try {
+            const res = await fetch('/api/premium/request', {
+                method: 'PATCH',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ id: item.id, action: 'refresh' }),
+            });
+            const data = await parseResponse(res, {});
+            if (!res.ok) {
+                alert(data?.message || 'Gagal memperbarui link.');
+                return;
+            }
+            loadPremiumHistory();
+        } catch (e) {
+            alert('Error: ' + e.message);
+        } finally {
+            setRefreshingPremiumId(null);
+        }
+    };
+
     const formatDateTime = (dateStr) => {
         if (!dateStr) return '-';
         const d = new Date(dateStr);
@@ -336,6 +360,7 @@ export default function TasksPage() {
                                 onFolderDownload={startFolderDownload}
                             />
                         </Box>
+                        <DebridTorrentList />
                     </>
                 ) : (
                     <Box sx={{ p: 2 }}>
@@ -385,6 +410,22 @@ export default function TasksPage() {
                                                         Streaming
                                                     </Button>
                                                 ) : null}
+                                                {item.status === 'done' ? (
+                                                    <Tooltip title="Link direct bisa kedaluwarsa. Perbarui tanpa biaya tambahan.">
+                                                        <span>
+                                                            <Button
+                                                                size="small"
+                                                                variant="text"
+                                                                startIcon={<RefreshIcon fontSize="small" />}
+                                                                disabled={refreshingPremiumId === item.id}
+                                                                onClick={() => handleRefreshPremiumLink(item)}
+                                                                sx={{ textTransform: 'none' }}
+                                                            >
+                                                                {refreshingPremiumId === item.id ? 'Memperbarui...' : 'Refresh Link'}
+                                                            </Button>
+                                                        </span>
+                                                    </Tooltip>
+                                                ) : null}
                                                 <Button
                                                     size="small"
                                                     variant="text"
@@ -24,6 +24,10 @@ import RemoveIcon from '@mui/icons-material/Remove';
 import IconButton from '@mui/material/IconButton';
 import ChevronLeftIcon from '@mui/icons-material/ChevronLeft';
 import ChevronRightIcon from '@mui/icons-material/ChevronRight';
+import ReceiptLongIcon from '@mui/icons-material/ReceiptLong';
+import TextField from '@mui/material/TextField';
+import Tooltip from '@mui/material/Tooltip';
+import MenuItem from '@mui/material/MenuItem';
 
 export default function TopUpPage() {
     const location = useLocation();
@@ -40,8 +44,29 @@ export default function TopUpPage() {
     const [topupTotalPages, setTopupTotalPages] = useState(1);
     const [topupTotal, setTopupTotal] = useState(0);
     const [historyTab, setHistoryTab] = useState(0);
+    const [statementMonth, setStatementMonth] = useState(() => new Date().toISOString().slice(0, 7));
+    const [txType, setTxType] = useState('');
+    const [txFrom, setTxFrom] = useState('');
+    const [txTo, setTxTo] = useState('');
+    const [txSearch, setTxSearch] = useState('');
+    const [txQuery, setTxQuery] = useState('');
     const [flash, setFlash] = useState(null);
 
+    const txFilterParams = () => {
+        const params = new URLSearchParams();
+        if (txType) params.set('type', txType);
+        if (txFrom) params.set('from', txFrom);
+        if (txTo) params.set('to', txTo);
+        if (txQuery) params.set('q', txQuery);
+        return params;
+    };
+
+    const txExportHref = () => {
+        const params = txFilterParams();
+        params.set('format', 'csv');
+        return `/api/transactions?${params}`;
+    };
+
     useEffect(() => {
         const incoming = location?.state?.flash;
         if (incoming?.text) {
@@ -64,9 +89,21 @@ export default function TopUpPage() {
             .catch(console.error);
     }, []);
 
+    useEffect(() => {
+        const t = setTimeout(() => setTxQuery(txSearch.trim()), 400);
+        return () => clearTimeout(t);
+    }, [txSearch]);
+
+    useEffect(() => {
+        setTxPage(1);
+    }, [txType, txFrom, txTo, txQuery]);
+
     useEffect(() => {
         setLoadingTransactions(true);
-        fetch(`/api/transactions?page=${txPage}&page_size=10`)
+        const params = txFilterParams();
+        params.set('page', txPage);
+        params.set('page_size', 10);
+        fetch(`/api/transactions?${params}`)
             .then((res) => res.json())
             .then((data) => {
                 if (Array.isArray(data)) {
@@ -89,7 +126,7 @@ export default function TopUpPage() {
             })
             .catch(console.error)
             .finally(() => setLoadingTransactions(false));
-    }, [txPage]);
+    }, [txPage, txType, txFrom, txTo, txQuery]);
 
     useEffect(() => {
         setLoadingTopups(true);
@@ -344,6 +381,76 @@ export default function TopUpPage() {
                     </>
                 ) : (
                     <>
+                        <Box sx={{ display: 'flex', alignItems: 'center', gap: 1, px: 1, pb: 1.5, flexWrap: 'wrap' }}>
+                            <TextField
+                                size="small"
+                                type="month"
+                                label="Laporan bulanan"
+                                value={statementMonth}
+                                onChange={(e) => setStatementMonth(e.target.value)}
+                                InputLabelProps={{ shrink: true }}
+                            />
+                            <Button
+                                variant="outlined"
+                                size="small"
+                                startIcon={<ReceiptLongIcon fontSize="small" />}
+                                href={`/api/transactions/statement?month=${encodeURIComponent(statementMonth)}`}
+                                target="_blank"
+                                rel="noopener"
+                                disabled={!statementMonth}
+                                sx={{ textTransform: 'none' }}
+                            >
+                                Unduh PDF
+                            </Button>
+                        </Box>
+                        <Box sx={{ display: 'flex', alignItems: 'center', gap: 1, px: 1, pb: 1.5, flexWrap: 'wrap' }}>
+                            <TextField
+                                select
+                                size="small"
+                                label="Jenis"
+                                value={txType}
+                                onChange={(e) => setTxType(e.target.value)}
+                                sx={{ minWidth: 130 }}
+                            >
+                                <MenuItem value="">Semua</MenuItem>
+                                <MenuItem value="topup,topup_bonus">Top up</MenuItem>
+                                <MenuItem value="download">Download</MenuItem>
+                                <MenuItem value="subscription">Paket</MenuItem>
+                                <MenuItem value="refund">Refund</MenuItem>
+                                <MenuItem value="adjustment">Penyesuaian</MenuItem>
+                            </TextField>
+                            <TextField
+                                size="small"
+                                type="date"
+                                label="Dari"
+                                value={txFrom}
+                                onChange={(e) => setTxFrom(e.target.value)}
+                                InputLabelProps={{ shrink: true }}
+                            />
+                            <TextField
+                                size="small"
+                                type="date"
+                                label="Sampai"
+                                value={txTo}
+                                onChange={(e) => setTxTo(e.target.value)}
+                                InputLabelProps={{ shrink: true }}
+                            />
+                            <TextField
+                                size="small"
+                                label="Cari"
+                                placeholder="Deskripsi / no. invoice"
+                                value={txSearch}
+                                onChange={(e) => setTxSearch(e.target.value)}
+                            />
+                            <Button
+                                variant="outlined"
+                                size="small"
+                                href={txExportHref()}
+                                sx={{ textTransform: 'none' }}
+                            >
+                                Ekspor CSV
+                            </Button>
+                        </Box>
                         {loadingTransactions ? (
                             <Typography variant="body2" color="text.secondary" sx={{ textAlign: 'center', py: 2 }}>
                                 Memuat...
@@ -358,13 +465,28 @@ export default function TopUpPage() {
                                     <React.Fragment key={tx.id}>
                                         <ListItem
                                             secondaryAction={
-                                                <Typography
-                                                    variant="body2"
-                                                    fontWeight={500}
-                                                    color={tx.amount > 0 ? 'success.main' : 'error.main'}
-                                                >
-                                                    {tx.amount > 0 ? '+' : ''} {formatIDRNumber(Math.abs(tx.amount || 0))}
-                                                </Typography>
+                                                <Box sx={{ display: 'flex', alignItems: 'center', gap: 0.5 }}>
+                                                    <Typography
+                                                        variant="body2"
+                                                        fontWeight={500}
+                                                        color={tx.amount > 0 ? 'success.main' : 'error.main'}
+                                                    >
+                                                        {tx.amount > 0 ? '+' : ''} {formatIDRNumber(Math.abs(tx.amount || 0))}
+                                                    </Typography>
+                                                    {tx.invoice_no ? (
+                                                        <Tooltip title={`Invoice ${tx.invoice_no}`}>
+                                                            <IconButton
+                                                                size="small"
+                                                                component="a"
+                                                                href={`/api/transactions/${tx.id}/receipt`}
+                                                                target="_blank"
+                                                                rel="noopener"
+                                                            >
+                                                                <ReceiptLongIcon fontSize="small" />
+                                                            </IconButton>
+                                                        </Tooltip>
+                                                    ) : null}
+                                                </Box>
                                             }
                                         >
                                             <ListItemAvatar>
@@ -381,7 +503,7 @@ export default function TopUpPage() {
                                             </ListItemAvatar>
                                             <ListItemText
                                                 primary={tx.description}
-                                                secondary={formatDate(tx.created_at)}
+                                                secondary={tx.invoice_no ? `${formatDate(tx.created_at)} · ${tx.invoice_no}` : formatDate(tx.created_at)}
                                                 primaryTypographyProps={{ variant: 'body2', fontWeight: 500 }}
                                                 secondaryTypographyProps={{ variant: 'caption' }}
                                             />
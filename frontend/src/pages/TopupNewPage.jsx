@@ -1,4 +1,4 @@
-import React, { useMemo, useState } from 'react';
+import React, { useEffect, useMemo, useState } from 'react';
 import { useNavigate } from 'react-router-dom';
 import Box from '@mui/material/Box';
 import Paper from '@mui/material/Paper';
@@ -13,17 +13,13 @@ import DialogTitle from '@mui/material/DialogTitle';
 import DialogContent from '@mui/material/DialogContent';
 import DialogActions from '@mui/material/DialogActions';
 import CircularProgress from '@mui/material/CircularProgress';
-
-const PAYMENT_OPTIONS = [
-    { value: 'gopay', label: 'GoPay', account: '085778135021', logo: '/logo-pembayaran/gopay.png' },
-    { value: 'bri', label: 'BRI', account: '162901006178537', logo: '/logo-pembayaran/bri.svg' },
-    { value: 'bank_jago', label: 'Bank Jago', account: '103325280390', logo: '/logo-pembayaran/bank_jago.png' },
-    { value: 'crypto_usdt', label: 'Crypto (USDT)', account: 'SEGERA', logo: '/logo-pembayaran/usdt.png' },
-];
+import { readApiError } from '../utils/apiError';
+import { usePaymentMethods } from '../utils/paymentMethods';
 
 export default function TopupNewPage() {
     const navigate = useNavigate();
-    const [paymentMethod, setPaymentMethod] = useState('gopay');
+    const { methods: paymentOptions, loading: methodsLoading } = usePaymentMethods();
+    const [paymentMethod, setPaymentMethod] = useState('');
     const [amount, setAmount] = useState('');
     const [confirmOpen, setConfirmOpen] = useState(false);
     const [activePaymentOpen, setActivePaymentOpen] = useState(false);
@@ -31,19 +27,56 @@ export default function TopupNewPage() {
     const [submitting, setSubmitting] = useState(false);
 
     const selectedPayment = useMemo(() => {
-        return PAYMENT_OPTIONS.find((p) => p.value === paymentMethod) || PAYMENT_OPTIONS[0];
-    }, [paymentMethod]);
+        return paymentOptions.find((p) => p.code === paymentMethod) || paymentOptions[0] || null;
+    }, [paymentOptions, paymentMethod]);
+
+    const minAmount = Number(selectedPayment?.min_amount || 5000);
+    const maxAmount = Number(selectedPayment?.max_amount || 0);
+    const fee = Number(selectedPayment?.fee || 0);
+    const isGateway = !!selectedPayment?.gateway;
+    const amountHint = maxAmount
+        ? `Top up Rp ${minAmount.toLocaleString('id-ID')} – Rp ${maxAmount.toLocaleString('id-ID')}`
+        : `Minimal top up Rp ${minAmount.toLocaleString('id-ID')}`;
 
     const nominal = useMemo(() => {
         const n = parseInt(String(amount).replace(/[^0-9]/g, ''), 10);
         return Number.isFinite(n) ? n : 0;
     }, [amount]);
 
-    const canConfirm = nominal >= 5000;
+    // Bonus preview from the running top up promos; the server quotes it again on create.
+    const [promoPreview, setPromoPreview] = useState({ promos: [], promo: null, bonus: 0 });
+    useEffect(() => {
+        let cancelled = false;
+        const timer = setTimeout(() => {
+            fetch(`/api/topups/promos${nominal > 0 ? `?amount=${nominal}` : ''}`)
+                .then((res) => (res.ok ? res.json() : null))
+                .then((data) => {
+                    if (!cancelled && data) {
+                        setPromoPreview({
+                            promos: Array.isArray(data.promos) ? data.promos : [],
+                            promo: data.promo || null,
+                            bonus: Number(data.bonus || 0),
+                        });
+                    }
+                })
+                .catch(() => {});
+        }, 300);
+        return () => {
+            cancelled = true;
+            clearTimeout(timer);
+        };
+    }, [nominal]);
+
+    const describeTier = (tier) =>
+        tier.bonus_type === 'fixed'
+            ? `Rp ${Number(tier.bonus_value).toLocaleString('id-ID')}`
+            : `${tier.bonus_value}%${tier.max_bonus ? ` (maks Rp ${Number(tier.max_bonus).toLocaleString('id-ID')})` : ''}`;
+
+    const canConfirm = !!selectedPayment && nominal >= minAmount && (!maxAmount || nominal <= maxAmount);
 
     const doCreateTopup = async () => {
         if (!canConfirm) {
-            alert('Minimal top up Rp 5.000');
+            alert(amountHint);
             return { status: 'error' };
         }
 
@@ -53,7 +86,7 @@ export default function TopupNewPage() {
             const res = await fetch('/api/topups', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ amount: nominal, payment_method: paymentMethod }),
+                body: JSON.stringify({ amount: nominal, payment_method: selectedPayment.code }),
             });
 
             if (res.status === 409) {
@@ -70,8 +103,7 @@ export default function TopupNewPage() {
             }
 
             if (!res.ok) {
-                const t = await res.text();
-                throw new Error(t || 'Gagal membuat top up');
+                throw new Error(await readApiError(res, 'Gagal membuat top up'));
             }
             const created = await res.json();
             navigate(`/topup?id=${encodeURIComponent(String(created.id))}`);
@@ -86,7 +118,7 @@ export default function TopupNewPage() {
 
     const handleConfirmClick = () => {
         if (!canConfirm) {
-            alert('Minimal top up Rp 5.000');
+            alert(amountHint);
             return;
         }
         setConfirmOpen(true);
@@ -105,8 +137,8 @@ export default function TopupNewPage() {
     const activePaymentLabel = useMemo(() => {
         const method = activePayment?.payment_method;
         if (!method) return '';
-        return PAYMENT_OPTIONS.find((p) => p.value === method)?.label || String(method);
-    }, [activePayment]);
+        return paymentOptions.find((p) => p.code === method)?.label || String(method);
+    }, [activePayment, paymentOptions]);
 
     const getAccountColor = (account) => {
         return account === 'SEGERA' ? 'warning' : 'default';
@@ -123,7 +155,9 @@ export default function TopupNewPage() {
                     Pilih metode pembayaran
                 </Typography>
                 <Typography variant="body2" color="text.secondary" sx={{ mb: 2 }}>
-                    Minimal top up <strong>Rp 5.000</strong>. Semua top up perlu konfirmasi admin.
+                    {isGateway
+                        ? 'Bayar lewat QRIS / Virtual Account, saldo masuk otomatis.'
+                        : 'Top up transfer manual perlu konfirmasi admin.'}
                 </Typography>
 
                 <Divider sx={{ mb: 2 }} />
@@ -133,13 +167,16 @@ export default function TopupNewPage() {
                         select
                         size="small"
                         label="Metode Pembayaran"
-                        value={paymentMethod}
+                        value={selectedPayment?.code || ''}
                         onChange={(e) => setPaymentMethod(e.target.value)}
+                        disabled={methodsLoading || paymentOptions.length === 0}
                     >
-                        {PAYMENT_OPTIONS.map((opt) => (
-                            <MenuItem key={opt.value} value={opt.value}>
+                        {paymentOptions.map((opt) => (
+                            <MenuItem key={opt.code} value={opt.code}>
                                 <Box sx={{ display: 'inline-flex', alignItems: 'center', gap: 1 }}>
-                                    <Box component="img" src={opt.logo} alt={opt.label} sx={{ width: 32, height: 16, objectFit: 'contain' }} />
+                                    {opt.logo_url ? (
+                                        <Box component="img" src={opt.logo_url} alt={opt.label} sx={{ width: 32, height: 16, objectFit: 'contain' }} />
+                                    ) : null}
                                     {opt.label}
                                 </Box>
                             </MenuItem>
@@ -153,22 +190,63 @@ export default function TopupNewPage() {
                         onChange={(e) => setAmount(e.target.value)}
                         placeholder="contoh: 5000"
                         inputProps={{ inputMode: 'numeric' }}
-                        helperText="Minimal Rp 5.000"
+                        helperText={fee > 0 ? `${amountHint} · biaya Rp ${fee.toLocaleString('id-ID')}` : amountHint}
                     />
                 </Box>
 
-                <Alert severity="info" sx={{ mt: 2 }}>
-                    <Box sx={{ display: 'flex', flexDirection: { xs: 'column', sm: 'row' }, alignItems: { xs: 'flex-start', sm: 'center' }, gap: { xs: 1, sm: 0.75 } }}>
-                        <Box sx={{ display: 'flex', alignItems: 'center', gap: 0.75, flexShrink: 0 }}>
-                            <Box component="img" src={selectedPayment.logo} alt={selectedPayment.label} sx={{ width: 32, height: 16, objectFit: 'contain' }} />
-                            <span>Tujuan pembayaran untuk <strong>{selectedPayment.label}</strong>:</span>
-                        </Box>
-                        <Box component="span" sx={{ fontWeight: 'bold', color: getAccountTextColor(selectedPayment.account) }}>{selectedPayment.account}</Box>
-                    </Box>
-                    <Box sx={{ mt: 1 }}>
-                        Nama penerima: <strong>Narangga Khoirul Utama</strong>
-                    </Box>
-                </Alert>
+                {promoPreview.bonus > 0 ? (
+                    <Alert severity="success" sx={{ mt: 2 }}>
+                        Bonus <strong>{promoPreview.promo?.name}</strong>: <strong>Rp {promoPreview.bonus.toLocaleString('id-ID')}</strong> ditambahkan setelah top up disetujui.
+                    </Alert>
+                ) : promoPreview.promos.length > 0 ? (
+                    <Alert severity="info" sx={{ mt: 2 }}>
+                        {promoPreview.promos.map((promo) => (
+                            <Box key={promo.id}>
+                                <strong>{promo.name}</strong>:{' '}
+                                {(promo.tiers || [])
+                                    .map((tier) => `top up ≥ Rp ${Number(tier.min_amount).toLocaleString('id-ID')} bonus ${describeTier(tier)}`)
+                                    .join(' · ')}
+                                {promo.first_topup_only ? ' (khusus top up pertama)' : ''}
+                            </Box>
+                        ))}
+                    </Alert>
+                ) : null}
+
+                {!methodsLoading && !selectedPayment ? (
+                    <Alert severity="warning" sx={{ mt: 2 }}>
+                        Belum ada metode pembayaran yang aktif. Silakan hubungi admin.
+                    </Alert>
+                ) : null}
+
+                {selectedPayment ? (
+                    <Alert severity="info" sx={{ mt: 2 }}>
+                        {isGateway ? (
+                            <span>
+                                Kode pembayaran <strong>{selectedPayment.label}</strong> dibuat setelah konfirmasi.
+                            </span>
+                        ) : (
+                            <>
+                                <Box sx={{ display: 'flex', flexDirection: { xs: 'column', sm: 'row' }, alignItems: { xs: 'flex-start', sm: 'center' }, gap: { xs: 1, sm: 0.75 } }}>
+                                    <Box sx={{ display: 'flex', alignItems: 'center', gap: 0.75, flexShrink: 0 }}>
+                                        {selectedPayment.logo_url ? (
+                                            <Box component="img" src={selectedPayment.logo_url} alt={selectedPayment.label} sx={{ width: 32, height: 16, objectFit: 'contain' }} />
+                                        ) : null}
+                                        <span>Tujuan pembayaran untuk <strong>{selectedPayment.label}</strong>:</span>
+                                    </Box>
+                                    <Box component="span" sx={{ fontWeight: 'bold', color: getAccountTextColor(selectedPayment.account) }}>{selectedPayment.account}</Box>
+                                </Box>
+                                {selectedPayment.account_name ? (
+                                    <Box sx={{ mt: 1 }}>
+                                        Nama penerima: <strong>{selectedPayment.account_name}</strong>
+                                    </Box>
+                                ) : null}
+                            </>
+                        )}
+                        {selectedPayment.instructions ? (
+                            <Box sx={{ mt: 1, whiteSpace: 'pre-line' }}>{selectedPayment.instructions}</Box>
+                        ) : null}
+                    </Alert>
+                ) : null}
 
                 <Box sx={{ display: 'flex', justifyContent: 'space-between', gap: 1.5, mt: 2.5, flexWrap: 'wrap' }}>
                     <Button variant="outlined" onClick={() => navigate('/balance')} sx={{ textTransform: 'none' }}>
@@ -189,17 +267,31 @@ export default function TopupNewPage() {
                         <Alert severity="info">
                             <Box sx={{ display: 'flex', flexDirection: 'column', gap: 0.75 }}>
                                 <Box>
-                                    Metode: <strong>{selectedPayment.label}</strong>
-                                </Box>
-                                <Box>
-                                    Tujuan: <Box component="span" sx={{ fontWeight: 'bold', color: getAccountTextColor(selectedPayment.account) }}>{selectedPayment.account}</Box>
+                                    Metode: <strong>{selectedPayment?.label}</strong>
                                 </Box>
+                                {!isGateway ? (
+                                    <Box>
+                                        Tujuan: <Box component="span" sx={{ fontWeight: 'bold', color: getAccountTextColor(selectedPayment?.account) }}>{selectedPayment?.account}</Box>
+                                    </Box>
+                                ) : null}
                                 <Box>
                                     Nominal: <strong>Rp {Number(nominal || 0).toLocaleString('id-ID')}</strong>
                                 </Box>
-                                <Box>
-                                    Atas nama: <strong>Narangga Khoirul Utama</strong>
-                                </Box>
+                                {fee > 0 ? (
+                                    <Box>
+                                        Total bayar (termasuk biaya): <strong>Rp {Number(nominal + fee).toLocaleString('id-ID')}</strong>
+                                    </Box>
+                                ) : null}
+                                {promoPreview.bonus > 0 ? (
+                                    <Box>
+                                        Bonus promo: <strong>Rp {promoPreview.bonus.toLocaleString('id-ID')}</strong>
+                                    </Box>
+                                ) : null}
+                                {!isGateway && selectedPayment?.account_name ? (
+                                    <Box>
+                                        Atas nama: <strong>{selectedPayment.account_name}</strong>
+                                    </Box>
+                                ) : null}
                             </Box>
                         </Alert>
                     </DialogContent>
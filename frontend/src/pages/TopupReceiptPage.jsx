@@ -12,13 +12,13 @@ import Dialog from '@mui/material/Dialog';
 import DialogTitle from '@mui/material/DialogTitle';
 import DialogContent from '@mui/material/DialogContent';
 import DialogActions from '@mui/material/DialogActions';
+import TextField from '@mui/material/TextField';
+import { readApiError } from '../utils/apiError';
+import { usePaymentMethods } from '../utils/paymentMethods';
+import { compressImage, blobToFile } from '../utils/imageCompress';
 
-const PAYMENT_OPTIONS = [
-    { value: 'gopay', label: 'GoPay', account: '085778135021', logo: '/logo-pembayaran/gopay.png' },
-    { value: 'bri', label: 'BRI', account: '162901006178537', logo: '/logo-pembayaran/bri.svg' },
-    { value: 'bank_jago', label: 'Bank Jago', account: '103325280390', logo: '/logo-pembayaran/bank_jago.png' },
-    { value: 'crypto_usdt', label: 'Crypto (USDT)', account: 'SEGERA', logo: '/logo-pembayaran/usdt.png' },
-];
+// Must match topupProofMaxSize on the server.
+const PROOF_MAX_BYTES = 2 * 1024 * 1024;
 
 function useQuery() {
     const { search } = useLocation();
@@ -42,7 +42,10 @@ export default function TopupReceiptPage() {
     const [now, setNow] = useState(Date.now());
     const [submitting, setSubmitting] = useState(false);
     const [paidConfirmOpen, setPaidConfirmOpen] = useState(false);
+    const [proofFile, setProofFile] = useState(null);
     const [errorText, setErrorText] = useState('');
+    const [txHash, setTxHash] = useState('');
+    const [usdt, setUsdt] = useState(null);
 
     const refresh = async () => {
         if (!id) {
@@ -70,12 +73,79 @@ export default function TopupReceiptPage() {
         // eslint-disable-next-line react-hooks/exhaustive-deps
     }, [id]);
 
+    const { methods: paymentOptions } = usePaymentMethods();
     const selected = useMemo(() => {
-        const method = topup?.payment_method || 'gopay';
-        return PAYMENT_OPTIONS.find((p) => p.value === method) || PAYMENT_OPTIONS[0];
-    }, [topup?.payment_method]);
+        const method = topup?.payment_method || '';
+        const found = paymentOptions.find((p) => p.code === method);
+        return {
+            label: found?.label || method || '-',
+            // The top up keeps the account it was created with.
+            account: topup?.payment_account || found?.account || '-',
+            accountName: found?.account_name || '',
+            logo: found?.logo_url || '',
+        };
+    }, [paymentOptions, topup?.payment_method, topup?.payment_account]);
+
+    // Gateway top ups (QRIS / virtual account) are confirmed by the payment webhook.
+    const isGateway = !!topup?.gateway;
+    // USDT top ups are confirmed by verifying the submitted transaction hash on-chain.
+    const isCrypto = !!topup?.crypto_amount;
+    const deposit = usdt?.deposit || null;
+    const networkLabel = String(usdt?.network || '').toUpperCase();
+
+    const applyUsdtStatus = (data) => {
+        setUsdt(data);
+        if (data?.topup) setTopup(data.topup);
+        if (data?.rejected_reason) setErrorText(`Transaksi ditolak: ${data.rejected_reason}`);
+    };
+
+    // Poll while a submitted transaction waits for confirmations.
+    useEffect(() => {
+        if (!isCrypto || !id) return undefined;
+        let cancelled = false;
+        const load = async () => {
+            try {
+                const res = await fetch(`/api/topups/usdt?id=${id}`);
+                if (res.ok && !cancelled) applyUsdtStatus(await res.json());
+            } catch {
+                // keep the last known status
+            }
+        };
+        load();
+        if (topup?.status !== 'pending') return () => { cancelled = true; };
+        const interval = setInterval(load, 15000);
+        return () => {
+            cancelled = true;
+            clearInterval(interval);
+        };
+        // eslint-disable-next-line react-hooks/exhaustive-deps
+    }, [isCrypto, id, topup?.status]);
+
+    const submitTxHash = async () => {
+        setSubmitting(true);
+        setErrorText('');
+        try {
+            const res = await fetch('/api/topups/usdt', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ id, tx_hash: txHash.trim() }),
+            });
+            if (!res.ok) {
+                throw new Error(await readApiError(res, 'Gagal mengirim hash transaksi'));
+            }
+            applyUsdtStatus(await res.json());
+        } catch (e) {
+            setErrorText(e.message || 'Terjadi kesalahan');
+        } finally {
+            setSubmitting(false);
+        }
+    };
 
     const amount = Number(topup?.amount || 0);
+    const fee = Number(topup?.fee || 0);
+    const uniqueCode = Number(topup?.unique_code || 0);
+    const total = amount + fee + uniqueCode;
+    const bonus = Number(topup?.bonus || 0);
     const expiresAtMs = topup?.expires_at ? new Date(topup.expires_at).getTime() : 0;
     const remainingMs = expiresAtMs ? Math.max(0, expiresAtMs - now) : 0;
     const isExpired = !!expiresAtMs && remainingMs <= 0;
@@ -91,21 +161,33 @@ export default function TopupReceiptPage() {
         return topup.status;
     }, [topup?.status]);
 
-    const canPaid = topup?.status === 'awaiting_payment' && !isExpired && amount >= 5000;
+    const canPaid = topup?.status === 'awaiting_payment' && !isExpired && amount >= 5000 && !isGateway && !isCrypto;
     const canCancel = topup?.status === 'awaiting_payment' && !isExpired;
 
     const patchAction = async (action) => {
         setSubmitting(true);
         setErrorText('');
         try {
-            const res = await fetch('/api/topups', {
-                method: 'PATCH',
-                headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ id, action }),
-            });
+            let res;
+            if (action === 'paid' && proofFile) {
+                let file = proofFile;
+                if (file.size > PROOF_MAX_BYTES) {
+                    file = blobToFile(await compressImage(file, 1024), file.name);
+                }
+                const formData = new FormData();
+                formData.append('id', String(id));
+                formData.append('action', action);
+                formData.append('proof', file);
+                res = await fetch('/api/topups', { method: 'PATCH', body: formData });
+            } else {
+                res = await fetch('/api/topups', {
+                    method: 'PATCH',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ id, action }),
+                });
+            }
             if (!res.ok) {
-                const t = await res.text();
-                throw new Error(t || 'Gagal memproses');
+                throw new Error(await readApiError(res, 'Gagal memproses'));
             }
             await refresh();
             if (action === 'paid') {
@@ -215,31 +297,100 @@ export default function TopupReceiptPage() {
                             <Typography variant="caption" color="text.secondary">
                                 Kirim
                             </Typography>
-                            <Typography variant="h5" fontWeight={900}>
-                                Rp {Number(amount || 0).toLocaleString('id-ID')}
-                            </Typography>
+                            {isCrypto ? (
+                                <>
+                                    <Typography variant="h5" fontWeight={900}>
+                                        {topup.crypto_amount} USDT{networkLabel ? ` (${networkLabel})` : ''}
+                                    </Typography>
+                                    <Typography variant="caption" color="text.secondary" sx={{ display: 'block' }}>
+                                        Kirim <strong>tepat</strong> jumlah ini, setelah potongan biaya penarikan. Senilai Rp {Number(total || 0).toLocaleString('id-ID')} dengan kurs Rp {Number(topup.crypto_rate || 0).toLocaleString('id-ID')}/USDT.
+                                    </Typography>
+                                </>
+                            ) : (
+                                <Typography variant="h5" fontWeight={900}>
+                                    Rp {Number(total || 0).toLocaleString('id-ID')}
+                                </Typography>
+                            )}
+                            {uniqueCode > 0 ? (
+                                <Typography variant="caption" color="text.secondary" sx={{ display: 'block' }}>
+                                    Transfer <strong>tepat</strong> sampai 3 digit terakhir. Kode unik Rp {uniqueCode.toLocaleString('id-ID')} ikut masuk ke saldo.
+                                </Typography>
+                            ) : null}
+                            {fee > 0 ? (
+                                <Typography variant="caption" color="text.secondary" sx={{ display: 'block' }}>
+                                    Termasuk biaya Rp {fee.toLocaleString('id-ID')}. Saldo masuk Rp {(amount + uniqueCode).toLocaleString('id-ID')}.
+                                </Typography>
+                            ) : null}
+                            {bonus > 0 ? (
+                                <Typography variant="caption" color="success.main" sx={{ display: 'block', fontWeight: 700 }}>
+                                    {topup.status === 'approved'
+                                        ? `Bonus promo Rp ${bonus.toLocaleString('id-ID')} sudah ditambahkan ke saldo.`
+                                        : `Bonus promo Rp ${bonus.toLocaleString('id-ID')} ditambahkan setelah top up disetujui.`}
+                                </Typography>
+                            ) : null}
                         </Box>
 
-                        <Box>
-                            <Typography variant="caption" color="text.secondary">
-                                Ke
-                            </Typography>
-                            <Box sx={{ display: 'flex', alignItems: 'center', gap: 1 }}>
-                                <Box component="img" src={selected.logo} alt={selected.label} sx={{ width: 24, height: 20, objectFit: 'contain' }} />
-                                <Typography variant="body1" fontWeight={800}>
-                                    {selected.label} — {selected.account}
+                        {isCrypto ? (
+                            <Box>
+                                <Typography variant="caption" color="text.secondary">
+                                    Alamat {selected.label}
+                                </Typography>
+                                <Typography
+                                    variant="body1"
+                                    fontWeight={800}
+                                    sx={{ fontFamily: 'ui-monospace, SFMono-Regular, Menlo, Monaco, Consolas, monospace', wordBreak: 'break-all' }}
+                                >
+                                    {selected.account}
+                                </Typography>
+                                <Typography variant="caption" color="error.main" sx={{ display: 'block' }}>
+                                    Hanya kirim USDT lewat jaringan {networkLabel || selected.label}. Jaringan lain tidak bisa dipulihkan.
                                 </Typography>
                             </Box>
-                        </Box>
+                        ) : isGateway ? (
+                            <Box>
+                                <Typography variant="caption" color="text.secondary">
+                                    {topup.payment_method === 'qris' ? 'Scan QRIS' : `Nomor ${selected.label}`}
+                                </Typography>
+                                {topup.payment_method === 'qris' && topup.payment_url ? (
+                                    <Box component="img" src={topup.payment_url} alt="QRIS" sx={{ display: 'block', width: 220, height: 220, mt: 0.5 }} />
+                                ) : (
+                                    <Typography
+                                        variant="body1"
+                                        fontWeight={800}
+                                        sx={{ fontFamily: 'ui-monospace, SFMono-Regular, Menlo, Monaco, Consolas, monospace', wordBreak: 'break-all' }}
+                                    >
+                                        {topup.payment_code || '-'}
+                                    </Typography>
+                                )}
+                            </Box>
+                        ) : (
+                            <>
+                                <Box>
+                                    <Typography variant="caption" color="text.secondary">
+                                        Ke
+                                    </Typography>
+                                    <Box sx={{ display: 'flex', alignItems: 'center', gap: 1 }}>
+                                        {selected.logo ? (
+                                            <Box component="img" src={selected.logo} alt={selected.label} sx={{ width: 24, height: 20, objectFit: 'contain' }} />
+                                        ) : null}
+                                        <Typography variant="body1" fontWeight={800}>
+                                            {selected.label} — {selected.account}
+                                        </Typography>
+                                    </Box>
+                                </Box>
 
-                        <Box>
-                            <Typography variant="caption" color="text.secondary">
-                                Atas nama
-                            </Typography>
-                            <Typography variant="body1" fontWeight={800}>
-                                Narangga Khoirul Utama
-                            </Typography>
-                        </Box>
+                                {selected.accountName ? (
+                                    <Box>
+                                        <Typography variant="caption" color="text.secondary">
+                                            Atas nama
+                                        </Typography>
+                                        <Typography variant="body1" fontWeight={800}>
+                                            {selected.accountName}
+                                        </Typography>
+                                    </Box>
+                                ) : null}
+                            </>
+                        )}
 
                         <Box>
                             <Typography variant="caption" color="text.secondary">
@@ -262,7 +413,47 @@ export default function TopupReceiptPage() {
                             </Alert>
                         )}
 
-                        {topup.status === 'pending' && (
+                        {isGateway && topup.status === 'awaiting_payment' && !isExpired && (
+                            <Alert severity="info">
+                                Saldo masuk otomatis setelah pembayaran diterima. Tidak perlu konfirmasi manual.
+                            </Alert>
+                        )}
+
+                        {isCrypto && topup.status === 'awaiting_payment' && !isExpired && (
+                            <Box sx={{ display: 'flex', gap: 1, alignItems: 'flex-start', flexWrap: 'wrap' }}>
+                                <TextField
+                                    size="small"
+                                    label="Hash transaksi (TxID)"
+                                    value={txHash}
+                                    onChange={(e) => setTxHash(e.target.value)}
+                                    disabled={submitting}
+                                    sx={{ flex: 1, minWidth: 240 }}
+                                />
+                                <Button
+                                    variant="contained"
+                                    onClick={submitTxHash}
+                                    disabled={submitting || !txHash.trim()}
+                                    sx={{ textTransform: 'none', fontWeight: 900 }}
+                                >
+                                    {submitting ? <CircularProgress size={20} color="inherit" /> : 'Verifikasi'}
+                                </Button>
+                            </Box>
+                        )}
+
+                        {isCrypto && deposit && (
+                            <Alert severity={deposit.status === 'confirmed' ? 'success' : 'info'}>
+                                Tx{' '}
+                                <Box component="span" sx={{ fontFamily: 'ui-monospace, SFMono-Regular, Menlo, Monaco, Consolas, monospace', wordBreak: 'break-all' }}>
+                                    {deposit.tx_hash}
+                                </Box>
+                                <br />
+                                {deposit.status === 'confirmed'
+                                    ? `Terverifikasi: ${deposit.amount} USDT (Rp ${Number(deposit.amount_idr || 0).toLocaleString('id-ID')}).`
+                                    : `Menunggu konfirmasi jaringan: ${deposit.confirmations || 0}/${usdt?.min_confirmations || '-'}. ${deposit.last_error || ''}`}
+                            </Alert>
+                        )}
+
+                        {topup.status === 'pending' && !isCrypto && (
                             <Alert severity="info">
                                 Konfirmasi sudah terkirim. Jika ada masalah, silakan hubungi admin.
                             </Alert>
@@ -311,12 +502,45 @@ export default function TopupReceiptPage() {
                             Kamu yakin sudah transfer sesuai struk ini?
                         </Typography>
                         <Alert severity="warning">
-                            Nominal: <strong>Rp {Number(amount || 0).toLocaleString('id-ID')}</strong>
+                            Nominal: <strong>Rp {Number(total || 0).toLocaleString('id-ID')}</strong>
                             <br />
                             Tujuan: <strong>{selected.label} — {selected.account}</strong>
                             <br />
                             Serial: <strong>{String(topup?.serial || '').trim() ? topup.serial : `TOPUP-${id}`}</strong>
                         </Alert>
+                        <Box sx={{ mt: 2 }}>
+                            <Typography variant="body2" fontWeight={700} sx={{ mb: 0.5 }}>
+                                Bukti transfer
+                            </Typography>
+                            <Button component="label" variant="outlined" size="small" disabled={submitting} sx={{ textTransform: 'none' }}>
+                                {proofFile ? 'Ganti gambar' : 'Pilih gambar'}
+                                <input
+                                    type="file"
+                                    accept="image/jpeg,image/png,image/gif"
+                                    hidden
+                                    onChange={(e) => {
+                                        const file = e.target.files?.[0];
+                                        e.target.value = '';
+                                        if (!file) return;
+                                        if (!file.type.startsWith('image/')) {
+                                            setErrorText('Bukti transfer harus berupa gambar');
+                                            return;
+                                        }
+                                        setProofFile(file);
+                                    }}
+                                />
+                            </Button>
+                            <Typography variant="caption" color="text.secondary" sx={{ display: 'block', mt: 0.5 }}>
+                                {proofFile
+                                    ? `${proofFile.name} (${Math.round(proofFile.size / 1024)}KB)`
+                                    : 'Screenshot bukti transfer (JPG/PNG, maks. 2MB) mempercepat verifikasi admin.'}
+                            </Typography>
+                        </Box>
+                        {errorText ? (
+                            <Alert severity="error" sx={{ mt: 1.5 }}>
+                                {errorText}
+                            </Alert>
+                        ) : null}
                     </DialogContent>
                     <DialogActions sx={{ px: 3, pb: 2.5 }}>
                         <Button variant="outlined" onClick={closePaidConfirm} disabled={submitting} sx={{ textTransform: 'none' }}>
@@ -325,8 +549,8 @@ export default function TopupReceiptPage() {
                         <Button
                             variant="contained"
                             onClick={async () => {
+                                // Stays open on failure so the error and chosen proof remain visible.
                                 await patchAction('paid');
-                                setPaidConfirmOpen(false);
                             }}
                             disabled={submitting || !canPaid}
                             sx={{ textTransform: 'none', fontWeight: 900 }}
@@ -18,6 +18,7 @@ import SendIcon from '@mui/icons-material/Send';
 import BuildIcon from '@mui/icons-material/Build';
 
 import { useAuth } from '../App';
+import { readApiError } from '../utils/apiError';
 
 export default function UnggahanPostPage() {
     const { user } = useAuth();
@@ -58,7 +59,7 @@ export default function UnggahanPostPage() {
                 fetch(`/api/posts/user/replies?post_id=${encodeURIComponent(String(id))}`),
             ]);
 
-            if (!postRes.ok) throw new Error(await postRes.text());
+            if (!postRes.ok) throw new Error(await readApiError(postRes));
             const postData = await postRes.json();
             setPost(postData || null);
 
@@ -101,7 +102,7 @@ export default function UnggahanPostPage() {
         if (!post?.id) return;
         try {
             const res = await fetch(`/api/posts/user?id=${encodeURIComponent(String(post.id))}`, { method: 'DELETE' });
-            if (!res.ok) throw new Error(await res.text());
+            if (!res.ok) throw new Error(await readApiError(res));
             navigate('/unggahan');
         } catch (e) {
             setErrorText(e?.message || 'Gagal menghapus post');
@@ -142,7 +143,7 @@ export default function UnggahanPostPage() {
         setErrorText('');
         try {
             const res = await fetch(`/api/posts/user/replies?id=${encodeURIComponent(String(replyId))}`, { method: 'DELETE' });
-            if (!res.ok) throw new Error(await res.text());
+            if (!res.ok) throw new Error(await readApiError(res));
             setReplies((prev) => prev.filter((r) => r.id !== replyId));
         } catch (e) {
             setErrorText(e?.message || 'Gagal menghapus balasan');
@@ -0,0 +1,13 @@
+// readApiError returns the user message of a failed API response. The server
+// answers errors with {"code", "message", "error"}; older or non-JSON bodies
+// are returned as plain text.
+export async function readApiError(res, fallback = '') {
+    const text = await res.text();
+    if (!text) return fallback || `HTTP ${res.status}`;
+    try {
+        const data = JSON.parse(text);
+        return data?.message || data?.error || fallback || text;
+    } catch {
+        return text;
+    }
+}
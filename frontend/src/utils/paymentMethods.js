@@ -0,0 +1,28 @@
+import { useEffect, useState } from 'react';
+
+// usePaymentMethods loads the top up methods users can pick, as configured by
+// the admin (GET /api/payment-methods).
+export function usePaymentMethods() {
+    const [methods, setMethods] = useState([]);
+    const [loading, setLoading] = useState(true);
+
+    useEffect(() => {
+        let cancelled = false;
+        fetch('/api/payment-methods')
+            .then((res) => (res.ok ? res.json() : []))
+            .then((data) => {
+                if (!cancelled) setMethods(Array.isArray(data) ? data : []);
+            })
+            .catch(() => {
+                if (!cancelled) setMethods([]);
+            })
+            .finally(() => {
+                if (!cancelled) setLoading(false);
+            });
+        return () => {
+            cancelled = true;
+        };
+    }, []);
+
+    return { methods, loading };
+}
@@ -0,0 +1,239 @@
+package alldebrid
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/youming-ai/pikpak-downloader/internal/apierror"
+)
+
+// Client is the AllDebrid API (v4) client
+type Client struct {
+	APIKey     string
+	Agent      string
+	HTTPClient *http.Client
+	BaseURL    string
+}
+
+// NewClient creates a new AllDebrid client
+func NewClient(apiKey string) *Client {
+	return &Client{
+		APIKey:  apiKey,
+		Agent:   "azifypage",
+		BaseURL: "https://api.alldebrid.com/v4",
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// APIError is an {"status":"error"} response. Code is one of the documented
+// string codes, e.g. AUTH_BAD_APIKEY, LINK_HOST_NOT_SUPPORTED.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Category   apierror.Category
+	Retryable  bool
+}
+
+func newAPIError(status int, code, message string) *APIError {
+	e := &APIError{StatusCode: status, Code: code, Message: message}
+	e.Category = categoryOf(status, code)
+	e.Retryable = apierror.RetryableStatus(status) ||
+		e.Category == apierror.CategoryRateLimit || e.Category == apierror.CategoryUnavailable
+	return e
+}
+
+func categoryOf(status int, code string) apierror.Category {
+	code = strings.ToUpper(code)
+	switch code {
+	case "AUTH_BLOCKED", "NO_SERVER":
+		return apierror.CategoryForbidden
+	case "LINK_HOST_NOT_SUPPORTED", "LINK_NOT_SUPPORTED":
+		return apierror.CategoryUnsupported
+	case "LINK_HOST_UNAVAILABLE", "LINK_HOST_FULL", "LINK_TEMPORARY_UNAVAILABLE":
+		return apierror.CategoryUnavailable
+	case "LINK_HOST_LIMIT_REACHED", "LINK_TOO_MANY_DOWNLOADS", "MUST_BE_PREMIUM", "FREE_TRIAL_LIMIT_REACHED":
+		return apierror.CategoryQuota
+	case "LINK_DOWN", "DELAYED_FAILED":
+		return apierror.CategoryNotFound
+	case "LINK_IS_MISSING", "LINK_PASS_PROTECTED":
+		return apierror.CategoryInvalid
+	}
+	switch {
+	case strings.HasPrefix(code, "AUTH_"):
+		return apierror.CategoryAuth
+	case status == http.StatusTooManyRequests:
+		return apierror.CategoryRateLimit
+	case status >= 500:
+		return apierror.CategoryUnavailable
+	}
+	return apierror.CategoryUnknown
+}
+
+func (e *APIError) ErrorCategory() apierror.Category { return e.Category }
+func (e *APIError) IsRetryable() bool                { return e.Retryable }
+func (e *APIError) HTTPStatus() int                  { return e.StatusCode }
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("alldebrid error %s: %s", e.Code, e.Message)
+}
+
+// LinkInfo is one entry of /link/infos.
+type LinkInfo struct {
+	Link     string `json:"link"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	Host     string `json:"host"`
+}
+
+// Stream is one transcoded variant offered by /link/unlock.
+type Stream struct {
+	ID      string `json:"id"`
+	Ext     string `json:"ext"`
+	Quality any    `json:"quality"`
+}
+
+// UnlockResult is the response of /link/unlock.
+type UnlockResult struct {
+	ID       string   `json:"id"`
+	Link     string   `json:"link"`
+	Filename string   `json:"filename"`
+	Filesize int64    `json:"filesize"`
+	Host     string   `json:"host"`
+	Streams  []Stream `json:"streams"`
+	Delayed  int64    `json:"delayed"`
+}
+
+// Host is one entry of /hosts.
+type Host struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Domains []string `json:"domains"`
+	Status  bool     `json:"status"`
+}
+
+// get calls endpoint with query params and decodes the "data" field into out.
+func (c *Client) get(endpoint string, params url.Values, out any) error {
+	if strings.TrimSpace(c.APIKey) == "" {
+		return fmt.Errorf("ALLDEBRID_API_KEY belum diatur")
+	}
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("agent", c.Agent)
+
+	req, err := http.NewRequest("GET", c.BaseURL+endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	var envelope struct {
+		Status string          `json:"status"`
+		Data   json.RawMessage `json:"data"`
+		Error  struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return newAPIError(resp.StatusCode, "HTTP_ERROR", strings.TrimSpace(string(body)))
+		}
+		return err
+	}
+	if envelope.Status != "success" {
+		return newAPIError(resp.StatusCode, envelope.Error.Code, envelope.Error.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
+
+// LinkInfos returns file name, size and host of a link without unlocking it.
+func (c *Client) LinkInfos(link string) (LinkInfo, error) {
+	var out struct {
+		Infos []struct {
+			LinkInfo
+			Error *struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"infos"`
+	}
+	if err := c.get("/link/infos", url.Values{"link[]": []string{strings.TrimSpace(link)}}, &out); err != nil {
+		return LinkInfo{}, err
+	}
+	if len(out.Infos) == 0 {
+		return LinkInfo{}, fmt.Errorf("info link kosong")
+	}
+	info := out.Infos[0]
+	if info.Error != nil {
+		return LinkInfo{}, newAPIError(http.StatusOK, info.Error.Code, info.Error.Message)
+	}
+	return info.LinkInfo, nil
+}
+
+// UnlockLink converts a hoster link into a direct download link. Links that
+// AllDebrid has to fetch first ("delayed") are polled for up to a minute.
+func (c *Client) UnlockLink(link string) (UnlockResult, error) {
+	var out UnlockResult
+	if err := c.get("/link/unlock", url.Values{"link": []string{strings.TrimSpace(link)}}, &out); err != nil {
+		return UnlockResult{}, err
+	}
+	if out.Link == "" && out.Delayed != 0 {
+		for i := 0; i < 12 && out.Link == ""; i++ {
+			time.Sleep(5 * time.Second)
+			var delayed struct {
+				Status int    `json:"status"` // 1 processing, 2 ready, 3 error
+				Link   string `json:"link"`
+			}
+			if err := c.get("/link/delayed", url.Values{"id": []string{fmt.Sprint(out.Delayed)}}, &delayed); err != nil {
+				return UnlockResult{}, err
+			}
+			if delayed.Status == 3 {
+				return UnlockResult{}, newAPIError(http.StatusOK, "DELAYED_FAILED", "delayed link gagal")
+			}
+			out.Link = delayed.Link
+		}
+	}
+	if out.Link == "" {
+		return UnlockResult{}, fmt.Errorf("link direct download tidak tersedia")
+	}
+	return out, nil
+}
+
+// StreamingLink returns the URL of one stream variant of an unlocked link.
+func (c *Client) StreamingLink(id, streamID string) (string, error) {
+	var out struct {
+		Link string `json:"link"`
+	}
+	err := c.get("/link/streaming", url.Values{"id": []string{id}, "stream": []string{streamID}}, &out)
+	return out.Link, err
+}
+
+// Hosts returns the supported hosters keyed by AllDebrid host name.
+func (c *Client) Hosts() (map[string]Host, error) {
+	var out struct {
+		Hosts map[string]Host `json:"hosts"`
+	}
+	if err := c.get("/user/hosts", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Hosts, nil
+}
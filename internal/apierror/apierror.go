@@ -0,0 +1,71 @@
+// Package apierror holds the error categories shared by the upstream API
+// clients (PikPak, Real-Debrid, AllDebrid), so callers can branch on an error
+// with errors.As instead of matching response bodies.
+package apierror
+
+import (
+	"errors"
+	"net"
+	"net/url"
+)
+
+// Category groups provider errors by what the caller should do about them.
+type Category string
+
+const (
+	CategoryUnknown     Category = "unknown"
+	CategoryAuth        Category = "auth"        // token invalid/expired, captcha
+	CategoryForbidden   Category = "forbidden"   // IP or account blocked
+	CategoryQuota       Category = "quota"       // storage, traffic or task limit reached
+	CategoryRateLimit   Category = "rate_limit"  // too many requests, retry later
+	CategoryNotFound    Category = "not_found"   // file, folder or task does not exist
+	CategoryUnsupported Category = "unsupported" // host or link not supported
+	CategoryInvalid     Category = "invalid"     // bad parameter or link
+	CategoryUnavailable Category = "unavailable" // provider or host down, 5xx, network
+)
+
+// Classified is implemented by the typed errors of the client packages.
+type Classified interface {
+	error
+	ErrorCategory() Category
+	IsRetryable() bool
+	HTTPStatus() int
+}
+
+// CategoryOf returns the category of err. Network errors are unavailable.
+func CategoryOf(err error) Category {
+	if err == nil {
+		return CategoryUnknown
+	}
+	var c Classified
+	if errors.As(err, &c) {
+		return c.ErrorCategory()
+	}
+	if isNetworkError(err) {
+		return CategoryUnavailable
+	}
+	return CategoryUnknown
+}
+
+// Retryable reports whether repeating the call later may succeed.
+func Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var c Classified
+	if errors.As(err, &c) {
+		return c.IsRetryable()
+	}
+	return isNetworkError(err)
+}
+
+// RetryableStatus reports whether an HTTP status is worth retrying.
+func RetryableStatus(status int) bool {
+	return status == 408 || status == 429 || status >= 500
+}
+
+func isNetworkError(err error) bool {
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr)
+}
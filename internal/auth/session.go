@@ -121,7 +121,7 @@ func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 		if session == nil {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			json.NewEncoder(w).Encode(map[string]string{"code": "unauthorized", "message": "Silakan login terlebih dahulu", "error": "unauthorized"})
 			return
 		}
 		next(w, r)
@@ -135,13 +135,13 @@ func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
 		if session == nil {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			json.NewEncoder(w).Encode(map[string]string{"code": "unauthorized", "message": "Silakan login terlebih dahulu", "error": "unauthorized"})
 			return
 		}
 		if session.Role != "admin" {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusForbidden)
-			json.NewEncoder(w).Encode(map[string]string{"error": "forbidden: admin access required"})
+			json.NewEncoder(w).Encode(map[string]string{"code": "forbidden", "message": "Akses khusus admin", "error": "forbidden: admin access required"})
 			return
 		}
 		next(w, r)
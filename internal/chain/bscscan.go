@@ -0,0 +1,152 @@
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// transferTopic is keccak256("Transfer(address,address,uint256)").
+const transferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// BscScan reads BEP20 transfers through the Etherscan-compatible proxy API
+// (Etherscan V2 with chainid=56 by default).
+type BscScan struct {
+	APIKey     string
+	BaseURL    string // query string may already carry chainid
+	HTTPClient *http.Client
+}
+
+// NewBscScan creates a BNB Smart Chain explorer.
+func NewBscScan(apiKey string) *BscScan {
+	return &BscScan{
+		APIKey:     apiKey,
+		BaseURL:    "https://api.etherscan.io/v2/api?chainid=56",
+		HTTPClient: &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+func (b *BscScan) Name() string    { return "bscscan" }
+func (b *BscScan) Network() string { return NetworkBEP20 }
+
+// proxy calls module=proxy and decodes the JSON-RPC result. A null result is
+// reported as ErrTxNotFound.
+func (b *BscScan) proxy(params url.Values, out any) error {
+	params.Set("module", "proxy")
+	params.Set("apikey", b.APIKey)
+	sep := "?"
+	if strings.Contains(b.BaseURL, "?") {
+		sep = "&"
+	}
+	resp, err := b.HTTPClient.Get(b.BaseURL + sep + params.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("bscscan: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var env struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &env); err != nil {
+		return fmt.Errorf("bscscan: %w", err)
+	}
+	if env.Error != nil {
+		return fmt.Errorf("bscscan: %s", env.Error.Message)
+	}
+	if len(env.Result) == 0 || string(env.Result) == "null" {
+		return ErrTxNotFound
+	}
+	// API errors (bad key, rate limit) come back as a plain string result.
+	if _, wantString := out.(*string); !wantString && env.Result[0] == '"' {
+		var msg string
+		json.Unmarshal(env.Result, &msg)
+		return fmt.Errorf("bscscan: %s", msg)
+	}
+	return json.Unmarshal(env.Result, out)
+}
+
+func parseHexInt(s string) (int64, error) {
+	return strconv.ParseInt(strings.TrimPrefix(s, "0x"), 16, 64)
+}
+
+// GetTx reads the receipt, the latest block and the block time.
+func (b *BscScan) GetTx(hash string) (Tx, error) {
+	var receipt struct {
+		BlockNumber string `json:"blockNumber"`
+		Status      string `json:"status"`
+		Logs        []struct {
+			Address string   `json:"address"`
+			Topics  []string `json:"topics"`
+			Data    string   `json:"data"`
+		} `json:"logs"`
+	}
+	if err := b.proxy(url.Values{"action": {"eth_getTransactionReceipt"}, "txhash": {hash}}, &receipt); err != nil {
+		return Tx{}, err
+	}
+	block, err := parseHexInt(receipt.BlockNumber)
+	if err != nil {
+		return Tx{}, fmt.Errorf("bscscan: blockNumber %q tidak valid", receipt.BlockNumber)
+	}
+
+	var latestHex string
+	if err := b.proxy(url.Values{"action": {"eth_blockNumber"}}, &latestHex); err != nil {
+		return Tx{}, err
+	}
+	latest, err := parseHexInt(latestHex)
+	if err != nil {
+		return Tx{}, fmt.Errorf("bscscan: eth_blockNumber %q tidak valid", latestHex)
+	}
+
+	var header struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if err := b.proxy(url.Values{"action": {"eth_getBlockByNumber"}, "tag": {receipt.BlockNumber}, "boolean": {"false"}}, &header); err != nil {
+		return Tx{}, err
+	}
+	ts, _ := parseHexInt(header.Timestamp)
+
+	tx := Tx{
+		Hash:          hash,
+		Success:       receipt.Status == "0x1",
+		Confirmations: latest - block + 1,
+		Time:          time.Unix(ts, 0),
+	}
+	for _, l := range receipt.Logs {
+		if len(l.Topics) != 3 || !strings.EqualFold(l.Topics[0], transferTopic) {
+			continue
+		}
+		amount, ok := new(big.Int).SetString(strings.TrimPrefix(l.Data, "0x"), 16)
+		if !ok {
+			continue
+		}
+		tx.Transfers = append(tx.Transfers, Transfer{
+			Contract: l.Address,
+			From:     topicAddress(l.Topics[1]),
+			To:       topicAddress(l.Topics[2]),
+			Amount:   amount,
+		})
+	}
+	return tx, nil
+}
+
+// topicAddress takes the last 20 bytes of a 32-byte indexed topic.
+func topicAddress(topic string) string {
+	t := strings.TrimPrefix(topic, "0x")
+	if len(t) < 40 {
+		return ""
+	}
+	return "0x" + t[len(t)-40:]
+}
@@ -0,0 +1,115 @@
+// Package chain looks up token transfers on public blockchains through
+// explorer APIs, so USDT top ups can be verified from a transaction hash.
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Supported networks.
+const (
+	NetworkTRC20 = "trc20" // Tron
+	NetworkBEP20 = "bep20" // BNB Smart Chain
+)
+
+// ErrTxNotFound is returned when the explorer does not know the hash (yet).
+var ErrTxNotFound = errors.New("transaksi tidak ditemukan")
+
+// Token is a token contract on one network.
+type Token struct {
+	Contract string
+	Decimals int
+}
+
+// USDT lists the official USDT contracts.
+var USDT = map[string]Token{
+	NetworkTRC20: {Contract: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", Decimals: 6},
+	NetworkBEP20: {Contract: "0x55d398326f99059fF775485246999027B3197955", Decimals: 18},
+}
+
+// Transfer is one token transfer inside a transaction.
+type Transfer struct {
+	Contract string   `json:"contract"`
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Amount   *big.Int `json:"amount"` // in the token's smallest unit
+}
+
+// Tx is a transaction as seen by an explorer.
+type Tx struct {
+	Hash          string     `json:"hash"`
+	Success       bool       `json:"success"`
+	Confirmations int64      `json:"confirmations"`
+	Time          time.Time  `json:"time"`
+	Transfers     []Transfer `json:"transfers"`
+}
+
+// Explorer fetches transactions of one network.
+type Explorer interface {
+	Name() string
+	Network() string
+	GetTx(hash string) (Tx, error)
+}
+
+// NormalizeHash trims a user-entered hash; EVM hashes get a lowercase 0x
+// prefix and Tron hashes are 64 lowercase hex characters.
+func NormalizeHash(network, hash string) (string, error) {
+	h := strings.ToLower(strings.TrimSpace(hash))
+	h = strings.TrimPrefix(h, "0x")
+	if len(h) != 64 || strings.Trim(h, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("hash transaksi tidak valid")
+	}
+	if network == NetworkBEP20 {
+		return "0x" + h, nil
+	}
+	return h, nil
+}
+
+// SameAddress compares addresses; EVM addresses are case-insensitive, Tron
+// base58 addresses are not.
+func SameAddress(network, a, b string) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if network == NetworkBEP20 {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// ParseUnits converts a decimal string such as "3.2701" to the token's
+// smallest unit.
+func ParseUnits(s string, decimals int) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || len(frac) > decimals || strings.Trim(whole+frac, "0123456789") != "" {
+		return nil, fmt.Errorf("jumlah %q tidak valid", s)
+	}
+	n, ok := new(big.Int).SetString(whole+frac+strings.Repeat("0", decimals-len(frac)), 10)
+	if !ok {
+		return nil, fmt.Errorf("jumlah %q tidak valid", s)
+	}
+	return n, nil
+}
+
+// FormatUnits converts an amount in the smallest unit back to a decimal
+// string without trailing zeros.
+func FormatUnits(n *big.Int, decimals int) string {
+	if n == nil {
+		return "0"
+	}
+	s := new(big.Int).Abs(n).String()
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	whole, frac := s[:len(s)-decimals], strings.TrimRight(s[len(s)-decimals:], "0")
+	if n.Sign() < 0 {
+		whole = "-" + whole
+	}
+	if frac == "" {
+		return whole
+	}
+	return whole + "." + frac
+}
@@ -0,0 +1,91 @@
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Tronscan reads TRC20 transfers from the Tronscan API.
+type Tronscan struct {
+	APIKey     string // optional TRON-PRO-API-KEY, raises the rate limit
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewTronscan creates a Tronscan explorer for Tron mainnet.
+func NewTronscan(apiKey string) *Tronscan {
+	return &Tronscan{
+		APIKey:     apiKey,
+		BaseURL:    "https://apilist.tronscanapi.com",
+		HTTPClient: &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+func (t *Tronscan) Name() string    { return "tronscan" }
+func (t *Tronscan) Network() string { return NetworkTRC20 }
+
+type tronscanTx struct {
+	Hash          string `json:"hash"`
+	Timestamp     int64  `json:"timestamp"` // ms
+	Confirmations int64  `json:"confirmations"`
+	ContractRet   string `json:"contractRet"`
+	Transfers     []struct {
+		Contract string `json:"contract_address"`
+		From     string `json:"from_address"`
+		To       string `json:"to_address"`
+		Amount   string `json:"amount_str"`
+	} `json:"trc20TransferInfo"`
+}
+
+// GetTx fetches /api/transaction-info. Unknown hashes come back as an empty
+// object.
+func (t *Tronscan) GetTx(hash string) (Tx, error) {
+	req, err := http.NewRequest(http.MethodGet, t.BaseURL+"/api/transaction-info?hash="+url.QueryEscape(hash), nil)
+	if err != nil {
+		return Tx{}, err
+	}
+	if t.APIKey != "" {
+		req.Header.Set("TRON-PRO-API-KEY", t.APIKey)
+	}
+	resp, err := t.HTTPClient.Do(req)
+	if err != nil {
+		return Tx{}, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode == http.StatusNotFound {
+		return Tx{}, ErrTxNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Tx{}, fmt.Errorf("tronscan: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var raw tronscanTx
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return Tx{}, fmt.Errorf("tronscan: %w", err)
+	}
+	if raw.Hash == "" {
+		return Tx{}, ErrTxNotFound
+	}
+
+	tx := Tx{
+		Hash:          raw.Hash,
+		Success:       raw.ContractRet == "SUCCESS",
+		Confirmations: raw.Confirmations,
+		Time:          time.UnixMilli(raw.Timestamp),
+	}
+	for _, tr := range raw.Transfers {
+		amount, ok := new(big.Int).SetString(tr.Amount, 10)
+		if !ok {
+			continue
+		}
+		tx.Transfers = append(tx.Transfers, Transfer{Contract: tr.Contract, From: tr.From, To: tr.To, Amount: amount})
+	}
+	return tx, nil
+}
@@ -81,22 +81,55 @@ func AutoMigrate() error {
 		&User{},
 		&Transaction{},
 		&TopUpRequest{},
+		&PaymentMethod{},
+		&PaymentEvent{},
+		&CryptoDeposit{},
 		&Notification{},
 		&PremiumRequest{},
+		&PremiumBatch{},
+		&DebridTorrent{},
 		&Pricing{},
-			&Voucher{},
-			&VoucherUsage{},
+		&Voucher{},
+		&VoucherUsage{},
+		&TopupPromo{},
+		&TopupPromoTier{},
+		&TopupPromoUsage{},
+		&Plan{},
+		&Subscription{},
+		&SubscriptionUsage{},
 		&Banner{},
 		&OfficialPost{},
 		&UserPost{},
 		&UserPostReply{},
 		&UserUsage{},
 		&HostAvailability{},
+		&HostStatusHistory{},
+		&DebridAccountHealth{},
+		&InvoiceCounter{},
+		&InvoiceSettings{},
+		&ScheduledJob{},
+		&JobRun{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to auto-migrate: %w", err)
 	}
 
+	// Admin balance increases used to be logged as top ups.
+	if err := DB.Model(&Transaction{}).
+		Where("type = ? AND description LIKE ?", "topup", "Admin set balance:%").
+		Update("type", "adjustment").Error; err != nil {
+		return fmt.Errorf("failed to relabel admin adjustments: %w", err)
+	}
+
+	// Premium requests from before the job queue have no mode and got the
+	// 'manual' default. Those finished synchronously through Real-Debrid;
+	// manual completions always record who finished them and when.
+	if err := DB.Model(&PremiumRequest{}).
+		Where("mode = ? AND status = ? AND finished_at IS NULL AND (claimed_by IS NULL OR claimed_by = '')", "manual", "done").
+		Updates(map[string]any{"mode": "automatic", "provider": "realdebrid"}).Error; err != nil {
+		return fmt.Errorf("failed to backfill premium request mode: %w", err)
+	}
+
 	log.Println("✅ Database migration completed")
 	return nil
 }
@@ -199,6 +232,55 @@ func SeedDefaultPricing() error {
 	return nil
 }
 
+// SeedDefaultPaymentMethods creates the original top up destinations if none
+// exist. Gateway methods start inactive until a payment gateway is configured.
+func SeedDefaultPaymentMethods() error {
+	var count int64
+	DB.Model(&PaymentMethod{}).Count(&count)
+	if count > 0 {
+		// The old USDT placeholder had no address; make it the on-chain TRC20 method.
+		DB.Model(&PaymentMethod{}).
+			Where("code = ? AND (network = '' OR network IS NULL) AND (account = '' OR account IS NULL)", "crypto_usdt").
+			Update("network", "trc20")
+		return nil
+	}
+
+	methods := []PaymentMethod{
+		{Code: "gopay", Label: "GoPay", Account: "085778135021", AccountName: "Narangga Khoirul Utama", LogoURL: "/logo-pembayaran/gopay.png", SerialPrefix: "GOP", MinAmount: 5000, IsActive: true, SortOrder: 10},
+		{Code: "bri", Label: "BRI", Account: "162901006178537", AccountName: "Narangga Khoirul Utama", LogoURL: "/logo-pembayaran/bri.svg", SerialPrefix: "BRI", MinAmount: 5000, IsActive: true, SortOrder: 20},
+		{Code: "bank_jago", Label: "Bank Jago", Account: "103325280390", AccountName: "Narangga Khoirul Utama", LogoURL: "/logo-pembayaran/bank_jago.png", SerialPrefix: "JGO", MinAmount: 5000, IsActive: true, SortOrder: 30},
+		{Code: "crypto_usdt", Label: "USDT (TRC20)", LogoURL: "/logo-pembayaran/usdt.png", SerialPrefix: "USD", Network: "trc20", MinAmount: 50000, SortOrder: 40},
+		{Code: "crypto_usdt_bep20", Label: "USDT (BEP20)", LogoURL: "/logo-pembayaran/usdt.png", SerialPrefix: "USB", Network: "bep20", MinAmount: 50000, SortOrder: 45},
+		{Code: "qris", Label: "QRIS", SerialPrefix: "QRS", Gateway: "qris", MinAmount: 5000, SortOrder: 50},
+		{Code: "va_bca", Label: "Virtual Account BCA", SerialPrefix: "VBC", Gateway: "va", Bank: "bca", MinAmount: 10000, SortOrder: 60},
+		{Code: "va_bni", Label: "Virtual Account BNI", SerialPrefix: "VBN", Gateway: "va", Bank: "bni", MinAmount: 10000, SortOrder: 70},
+		{Code: "va_bri", Label: "Virtual Account BRI", SerialPrefix: "VBR", Gateway: "va", Bank: "bri", MinAmount: 10000, SortOrder: 80},
+	}
+	if err := DB.Create(&methods).Error; err != nil {
+		return err
+	}
+
+	log.Println("✅ Default payment methods created")
+	return nil
+}
+
+// SeedDefaultInvoiceSettings creates the invoice settings row if missing.
+func SeedDefaultInvoiceSettings() error {
+	var count int64
+	DB.Model(&InvoiceSettings{}).Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	settings := InvoiceSettings{ID: 1, Prefix: "INV", CompanyName: "AzifyPage", TaxName: "PPN"}
+	if err := DB.Create(&settings).Error; err != nil {
+		return err
+	}
+
+	log.Println("✅ Default invoice settings created")
+	return nil
+}
+
 // GetPricing retrieves pricing by service type
 func GetPricing(serviceType string) (*Pricing, error) {
 	var pricing Pricing
@@ -36,6 +36,11 @@ type Transaction struct {
 	Amount      int64     `gorm:"not null" json:"amount"` // Positive for topup, negative for download
 	Type        string    `gorm:"not null" json:"type"`   // "topup" or "download"
 	Description string    `json:"description"`
+	InvoiceNo   *string   `gorm:"size:32;uniqueIndex" json:"invoice_no"` // set for approved top ups and charges
+	TopUpID     uint      `gorm:"index;not null;default:0" json:"topup_id,omitempty"`
+	GrossAmount int64     `gorm:"not null;default:0" json:"gross_amount,omitempty"` // charge before voucher discount
+	Discount    int64     `gorm:"not null;default:0" json:"discount,omitempty"`
+	VoucherCode string    `gorm:"size:64" json:"voucher_code,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -55,10 +60,91 @@ type TopUpRequest struct {
 	CancelledAt    *time.Time `json:"cancelled_at"`
 	AdminReason    string     `json:"admin_reason"`
 	DecidedAt      *time.Time `json:"decided_at"`
+	Fee            int64      `gorm:"not null;default:0" json:"fee"`               // payment method fee
+	UniqueCode     int64      `gorm:"not null;default:0" json:"unique_code"`       // small offset that makes manual transfers unambiguous
+	Gateway        string     `gorm:"size:32" json:"gateway,omitempty"`            // payment gateway that issued the charge, empty for manual transfer
+	GatewayRef     string     `gorm:"size:128;index" json:"gateway_ref,omitempty"` // gateway transaction id
+	PaymentCode    string     `gorm:"type:text" json:"payment_code,omitempty"`     // QRIS payload or VA number
+	PaymentURL     string     `json:"payment_url,omitempty"`                       // hosted QR image, when offered
+	ProofImage     string     `json:"proof_image,omitempty"`                       // transfer proof file in uploads/topup-proofs, served by /api/topups/proof
+	CryptoAmount   string     `gorm:"size:32" json:"crypto_amount,omitempty"`      // exact USDT amount to send, unique per deposit address
+	CryptoRate     int64      `json:"crypto_rate,omitempty"`                       // IDR per USDT when the quote was made
+	CodeKey        *string    `gorm:"size:100;uniqueIndex" json:"-"`               // payable amount this top up holds; cleared once it may be reused
+	PromoID        uint       `gorm:"not null;default:0" json:"promo_id"`          // TopupPromo quoted at creation, 0 = none
+	Bonus          int64      `gorm:"not null;default:0" json:"bonus"`             // promo bonus quoted at creation, then the bonus actually credited
 	CreatedAt      time.Time  `json:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at"`
 }
 
+// PaymentMethod is a top up destination offered to users: a manual transfer
+// account, or a payment gateway method (QRIS / virtual account).
+type PaymentMethod struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Code         string    `gorm:"size:32;uniqueIndex;not null" json:"code"` // gopay, bri, qris, va_bca, ...
+	Label        string    `gorm:"not null" json:"label"`
+	Account      string    `json:"account"`      // number shown to the user; filled by the gateway for gateway methods
+	AccountName  string    `json:"account_name"` // "atas nama"
+	Instructions string    `gorm:"type:text" json:"instructions"`
+	LogoURL      string    `json:"logo_url"`
+	SerialPrefix string    `gorm:"size:3;not null" json:"serial_prefix"` // first 3 chars of the top up serial
+	Gateway      string    `gorm:"size:16" json:"gateway"`               // qris or va for payment gateway charges, empty for manual transfer
+	Bank         string    `gorm:"size:32" json:"bank"`                  // VA bank when Gateway is va
+	Network      string    `gorm:"size:16" json:"network"`               // trc20 or bep20 for USDT verified on-chain; Account is the deposit address
+	Rate         int64     `gorm:"not null;default:0" json:"rate"`       // IDR per 1 USDT for on-chain methods
+	MinAmount    int64     `gorm:"not null;default:5000" json:"min_amount"`
+	MaxAmount    int64     `gorm:"not null;default:0" json:"max_amount"` // 0 = unlimited
+	Fee          int64     `gorm:"not null;default:0" json:"fee"`        // flat fee the user pays on top of the amount
+	IsActive     bool      `gorm:"not null;index" json:"is_active"`
+	SortOrder    int       `gorm:"not null;default:0" json:"sort_order"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// PaymentEvent records every verified payment gateway webhook so redelivered
+// notifications are applied only once.
+type PaymentEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Gateway   string    `gorm:"size:32;not null;uniqueIndex:idx_payment_event" json:"gateway"`
+	EventID   string    `gorm:"size:191;not null;uniqueIndex:idx_payment_event" json:"event_id"`
+	OrderID   string    `gorm:"size:64;index" json:"order_id"` // TopUpRequest.Serial
+	Status    string    `gorm:"size:32" json:"status"`
+	Amount    int64     `json:"amount"`
+	TopUpID   uint      `gorm:"index" json:"topup_id"`
+	Payload   string    `gorm:"type:text" json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CryptoDeposit is the on-chain transaction a user submitted for a USDT top
+// up. Each hash can be used once; rows that fail verification are removed so
+// the user can submit another hash.
+type CryptoDeposit struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	TopUpID       uint       `gorm:"uniqueIndex;not null" json:"topup_id"`
+	Network       string     `gorm:"size:16;not null;uniqueIndex:idx_crypto_deposit_tx" json:"network"`
+	TxHash        string     `gorm:"size:100;not null;uniqueIndex:idx_crypto_deposit_tx" json:"tx_hash"`
+	Status        string     `gorm:"size:16;not null;default:'pending';index" json:"status"` // pending, confirmed
+	Amount        string     `gorm:"size:40" json:"amount"`                                  // USDT received
+	AmountIDR     int64      `gorm:"not null;default:0" json:"amount_idr"`                   // Amount at the top up's rate
+	FromAddress   string     `json:"from_address"`
+	Confirmations int64      `gorm:"not null;default:0" json:"confirmations"`
+	LastError     string     `json:"last_error"`
+	CheckedAt     *time.Time `json:"checked_at"`
+	ConfirmedAt   *time.Time `json:"confirmed_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// PayableAmount is what the user has to transfer: Amount + Fee + UniqueCode.
+func (t *TopUpRequest) PayableAmount() int64 {
+	return t.Amount + t.Fee + t.UniqueCode
+}
+
+// CreditAmount is what approval adds to the balance. The unique code is the
+// user's money too, so it is credited.
+func (t *TopUpRequest) CreditAmount() int64 {
+	return t.Amount + t.UniqueCode
+}
+
 // Notification represents a notification for a user
 type Notification struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
@@ -71,16 +157,79 @@ type Notification struct {
 
 // PremiumRequest represents a premium host download request (Real-Debrid)
 type PremiumRequest struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	UserID    uint   `gorm:"not null" json:"user_id"`
+	URL       string `gorm:"not null" json:"url"`
+	Filename  string `json:"filename"`
+	Host      string `json:"host"`
+	SizeBytes int64  `gorm:"default:0" json:"size_bytes"`
+	Price     int64  `gorm:"default:0" json:"price"`
+	Status    string `gorm:"default:'pending'" json:"status"` // pending, processing, done, failed
+	ResultURL string `json:"result_url"`                      // Direct link download
+	StreamURL string `json:"stream_url"`                      // Optional streaming URL
+
+	// Queue bookkeeping for automatic (debrid provider) requests. The price is held in
+	// ReservedAmount while the job waits and is charged or returned when it ends.
+	Mode            string     `gorm:"default:'manual';index" json:"mode"` // automatic, manual
+	Provider        string     `gorm:"index" json:"provider"`              // debrid provider that checked/unrestricted the link
+	BatchID         *uint      `gorm:"index" json:"batch_id"`              // set for files expanded from a folder/container
+	ReservedAmount  int64      `gorm:"default:0" json:"reserved_amount"`
+	QuotedPrice     int64      `gorm:"default:0" json:"quoted_price"` // price reserved at request time, before re-pricing on the final size
+	OriginalPrice   int64      `gorm:"default:0" json:"original_price"`
+	VoucherCode     string     `json:"voucher_code"`
+	VoucherDiscount int64      `gorm:"default:0" json:"discount_amount"`
+	ChargedGB       int        `gorm:"default:0" json:"charged_gb"`
+	SubscriptionID  uint       `gorm:"not null;default:0" json:"subscription_id,omitempty"`
+	QuotaGB         int        `gorm:"not null;default:0" json:"quota_gb"` // GB of ChargedGB covered by the subscription quota
+	Priority        int        `gorm:"not null;default:0" json:"priority"` // from the subscription; the queue takes higher first
+	Attempts        int        `gorm:"default:0" json:"attempts"`
+	Error           string     `json:"error"`
+	NextAttemptAt   *time.Time `json:"next_attempt_at"`
+	StartedAt       *time.Time `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at"`
+	LinkRefreshedAt *time.Time `json:"link_refreshed_at"` // last free re-unrestrict of ResultURL
+	RefreshCount    int        `gorm:"default:0" json:"refresh_count"`
+
+	// Manual fulfillment by an admin (no Real-Debrid key).
+	ClaimedBy   string     `json:"claimed_by"` // "admin:<email>" or "telegram:<chat id>"
+	ClaimedAt   *time.Time `json:"claimed_at"`
+	AdminReason string     `json:"admin_reason"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PremiumBatch groups the PremiumRequests expanded from one folder or container
+// link. The total is quoted once and split over the files by size.
+type PremiumBatch struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	UserID          uint      `gorm:"index;not null" json:"user_id"`
+	Source          string    `json:"source"`      // folder/container URL, or uploaded file name
+	SourceType      string    `json:"source_type"` // folder, container
+	FileCount       int       `json:"file_count"`
+	TotalSize       int64     `json:"total_size"`
+	Price           int64     `json:"price"`
+	OriginalPrice   int64     `json:"original_price"`
+	VoucherCode     string    `json:"voucher_code"`
+	VoucherDiscount int64     `json:"discount_amount"`
+	ChargedGB       int       `json:"charged_gb"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// DebridTorrent is a torrent served by Real-Debrid instead of PikPak. It is
+// charged when submitted, like a PikPak offline task.
+type DebridTorrent struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserID    uint      `gorm:"not null" json:"user_id"`
-	URL       string    `gorm:"not null" json:"url"`
-	Filename  string    `json:"filename"`
-	Host      string    `json:"host"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	RemoteID  string    `gorm:"index;not null" json:"remote_id"` // Real-Debrid torrent id
+	Hash      string    `gorm:"index" json:"hash"`
+	Magnet    string    `gorm:"type:text" json:"magnet"`
+	Name      string    `json:"name"`
 	SizeBytes int64     `gorm:"default:0" json:"size_bytes"`
 	Price     int64     `gorm:"default:0" json:"price"`
-	Status    string    `gorm:"default:'pending'" json:"status"` // pending, processing, done, failed
-	ResultURL string    `json:"result_url"`                      // Direct link download
-	StreamURL string    `json:"stream_url"`                      // Optional streaming URL
+	Status    string    `gorm:"default:'queued'" json:"status"` // last Real-Debrid status
+	Progress  float64   `gorm:"default:0" json:"progress"`
+	Reason    string    `json:"reason"` // why PikPak was skipped: policy, cached, pikpak_unavailable
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -144,6 +293,98 @@ type Voucher struct {
 	UpdatedAt         time.Time  `json:"updated_at"`
 }
 
+// TopupPromo is a top up bonus campaign. Its tiers are checked against the
+// top up amount; the highest tier reached decides the bonus.
+type TopupPromo struct {
+	ID             uint             `gorm:"primaryKey" json:"id"`
+	Name           string           `gorm:"not null" json:"name"`
+	Description    string           `json:"description"`
+	Tiers          []TopupPromoTier `gorm:"foreignKey:PromoID" json:"tiers"`
+	PerUserLimit   int              `gorm:"not null;default:0" json:"per_user_limit"` // bonuses per user, 0 = unlimited
+	FirstTopupOnly bool             `gorm:"not null;default:false" json:"first_topup_only"`
+	StartsAt       *time.Time       `json:"starts_at"`
+	EndsAt         *time.Time       `json:"ends_at"`
+	IsActive       bool             `gorm:"not null" json:"is_active"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+// TopupPromoTier is one bonus step of a TopupPromo.
+type TopupPromoTier struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	PromoID    uint   `gorm:"index;not null" json:"promo_id"`
+	MinAmount  int64  `gorm:"not null;default:0" json:"min_amount"`
+	BonusType  string `gorm:"size:16;not null;default:'percentage'" json:"bonus_type"` // percentage or fixed
+	BonusValue int64  `gorm:"not null;default:0" json:"bonus_value"`
+	MaxBonus   int64  `gorm:"not null;default:0" json:"max_bonus"` // cap for percentage, 0 = no cap
+}
+
+// TopupPromoUsage records a bonus credited for a top up, for the per-user
+// limit and campaign reports.
+type TopupPromoUsage struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	PromoID   uint      `gorm:"index;not null" json:"promo_id"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	TopUpID   uint      `gorm:"uniqueIndex;not null" json:"topup_id"`
+	Bonus     int64     `gorm:"not null" json:"bonus"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Plan is a prepaid package bought from the balance. Each period includes GB
+// for torrent and premium downloads that are used before the balance.
+type Plan struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Name          string    `gorm:"not null" json:"name"`
+	Description   string    `json:"description"`
+	Price         int64     `gorm:"not null" json:"price"`
+	PeriodMonths  int       `gorm:"not null;default:1" json:"period_months"`
+	TorrentGB     int       `gorm:"not null;default:0" json:"torrent_gb"`
+	PremiumGB     int       `gorm:"not null;default:0" json:"premium_gb"`
+	StorageGB     int       `gorm:"not null;default:0" json:"storage_gb"`     // PikPak storage allowance, 0 = not stated
+	RetentionDays int       `gorm:"not null;default:0" json:"retention_days"` // how long files are kept, 0 = not stated
+	Priority      int       `gorm:"not null;default:0" json:"priority"`       // premium queue priority, higher first
+	SortOrder     int       `gorm:"not null;default:0" json:"sort_order"`
+	IsActive      bool      `gorm:"not null" json:"is_active"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Subscription is one paid period of a Plan. The plan's quotas are copied in
+// so later plan edits do not change a running period; renewing creates the
+// next row.
+type Subscription struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	UserID        uint      `gorm:"index;not null" json:"user_id"`
+	PlanID        uint      `gorm:"index;not null" json:"plan_id"`
+	PlanName      string    `json:"plan_name"`
+	Status        string    `gorm:"size:16;index;not null;default:'active'" json:"status"` // active, expired
+	AutoRenew     bool      `gorm:"not null" json:"auto_renew"`
+	Price         int64     `gorm:"not null" json:"price"`
+	PeriodStart   time.Time `json:"period_start"`
+	PeriodEnd     time.Time `gorm:"index" json:"period_end"`
+	TorrentGB     int       `gorm:"not null;default:0" json:"torrent_gb"`
+	PremiumGB     int       `gorm:"not null;default:0" json:"premium_gb"`
+	TorrentUsedGB int       `gorm:"not null;default:0" json:"torrent_used_gb"`
+	PremiumUsedGB int       `gorm:"not null;default:0" json:"premium_used_gb"`
+	StorageGB     int       `gorm:"not null;default:0" json:"storage_gb"`
+	RetentionDays int       `gorm:"not null;default:0" json:"retention_days"`
+	Priority      int       `gorm:"not null;default:0" json:"priority"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// SubscriptionUsage records GB taken from a period's quota.
+type SubscriptionUsage struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	SubscriptionID   uint      `gorm:"index;not null" json:"subscription_id"`
+	UserID           uint      `gorm:"index;not null" json:"user_id"`
+	ServiceType      string    `gorm:"size:16;not null" json:"service_type"` // torrent, premium
+	GB               int       `gorm:"not null" json:"gb"`
+	Description      string    `json:"description"`
+	PremiumRequestID uint      `gorm:"index;not null;default:0" json:"premium_request_id,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
 // VoucherUsage stores voucher usage entries to support per-user quota checks.
 type VoucherUsage struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
@@ -212,10 +453,88 @@ type UserUsage struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
-// HostAvailability represents admin-controlled host availability toggle
+// HostAvailability represents admin-controlled host availability toggle.
+// Rows with Source "sync" are created from the debrid providers' status feed;
+// AdminOverride keeps the admin's IsAvailable when the feed disagrees.
 type HostAvailability struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Name          string     `gorm:"uniqueIndex;not null" json:"name"`
+	IsAvailable   bool       `gorm:"not null" json:"is_available"`
+	Domains       string     `gorm:"type:text" json:"domains"`       // comma separated, lower case
+	Source        string     `gorm:"default:'manual'" json:"source"` // manual, sync
+	FeedStatus    string     `json:"feed_status"`                    // up, down, missing (last sync)
+	Providers     string     `json:"providers"`                      // providers that reported the host
+	AdminOverride bool       `gorm:"default:false" json:"admin_override"`
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// HostStatusHistory records every availability change of a host.
+type HostStatusHistory struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
-	Name        string    `gorm:"uniqueIndex;not null" json:"name"`
-	IsAvailable bool      `gorm:"default:true" json:"is_available"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	HostID      uint      `gorm:"index;not null" json:"host_id"`
+	IsAvailable bool      `json:"is_available"`
+	FeedStatus  string    `json:"feed_status"`
+	Source      string    `json:"source"` // sync, admin
+	Note        string    `json:"note"`
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`
+}
+
+// DebridAccountHealth is the last health check of a debrid provider account.
+// Traffic holds the per-host remaining traffic as JSON (domain -> traffic).
+type DebridAccountHealth struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	Provider     string     `gorm:"uniqueIndex;size:32;not null" json:"provider"`
+	Username     string     `json:"username"`
+	AccountType  string     `json:"account_type"` // premium, free
+	PremiumUntil *time.Time `json:"premium_until"`
+	Status       string     `gorm:"default:'ok'" json:"status"` // ok, expiring, expired, exhausted, error
+	Reason       string     `json:"reason"`
+	Traffic      string     `gorm:"type:text" json:"traffic"`
+	CheckedAt    time.Time  `json:"checked_at"`
+}
+
+// InvoiceCounter hands out sequential invoice numbers, restarting each year.
+type InvoiceCounter struct {
+	Year int   `gorm:"primaryKey;autoIncrement:false" json:"year"`
+	Last int64 `gorm:"not null;default:0" json:"last"`
+}
+
+// InvoiceSettings holds the seller details printed on receipts and
+// statements. There is a single row with ID 1.
+type InvoiceSettings struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Prefix         string    `gorm:"size:8;not null;default:'INV'" json:"prefix"` // invoice numbers look like INV-2026-000001
+	CompanyName    string    `json:"company_name"`
+	CompanyAddress string    `gorm:"type:text" json:"company_address"`
+	CompanyEmail   string    `json:"company_email"`
+	CompanyPhone   string    `json:"company_phone"`
+	TaxID          string    `json:"tax_id"` // NPWP
+	TaxName        string    `gorm:"size:32;not null;default:'PPN'" json:"tax_name"`
+	TaxPercent     float64   `gorm:"not null;default:0" json:"tax_percent"` // included in prices; 0 = no tax line
+	Footer         string    `gorm:"type:text" json:"footer"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ScheduledJob is the lock row of a scheduler job. Only the instance holding
+// LockedBy until LockedUntil runs the job, and LastSlot makes every scheduled
+// time run once across instances.
+type ScheduledJob struct {
+	Name        string     `gorm:"primaryKey;size:64" json:"name"`
+	LockedBy    string     `gorm:"size:128" json:"locked_by"`
+	LockedUntil *time.Time `json:"locked_until"`
+	LastSlot    *time.Time `json:"last_slot"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// JobRun is one execution of a scheduler job.
+type JobRun struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Job        string     `gorm:"size:64;index;not null" json:"job"`
+	Trigger    string     `gorm:"size:16;not null" json:"trigger"` // schedule, manual
+	Status     string     `gorm:"size:16;not null" json:"status"`  // running, ok, error
+	Output     string     `gorm:"type:text" json:"output"`
+	Error      string     `gorm:"type:text" json:"error"`
+	StartedAt  time.Time  `gorm:"index" json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
 }
@@ -0,0 +1,121 @@
+package debrid
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/youming-ai/pikpak-downloader/internal/alldebrid"
+)
+
+type allDebridProvider struct {
+	client *alldebrid.Client
+}
+
+// NewAllDebrid wraps an AllDebrid client as a Provider.
+func NewAllDebrid(c *alldebrid.Client) Provider {
+	return &allDebridProvider{client: c}
+}
+
+func (p *allDebridProvider) Name() string { return "alldebrid" }
+
+func (p *allDebridProvider) CheckLink(link string) (LinkInfo, error) {
+	res, err := p.client.LinkInfos(link)
+	if err != nil {
+		if KindOf(err) == KindUnsupported {
+			return LinkInfo{Supported: false}, nil
+		}
+		return LinkInfo{}, wrap(p, err)
+	}
+	return LinkInfo{
+		Filename:  res.Filename,
+		Filesize:  res.Size,
+		Host:      res.Host,
+		Supported: true,
+	}, nil
+}
+
+func (p *allDebridProvider) Unrestrict(link string) (Unrestricted, error) {
+	res, err := p.client.UnlockLink(link)
+	if err != nil {
+		return Unrestricted{}, wrap(p, err)
+	}
+	ref := ""
+	if len(res.Streams) > 0 && res.ID != "" {
+		ref = res.ID + "|" + res.Streams[0].ID
+	}
+	return Unrestricted{
+		Filename:  res.Filename,
+		Filesize:  res.Filesize,
+		Host:      res.Host,
+		Download:  res.Link,
+		StreamRef: ref,
+	}, nil
+}
+
+func (p *allDebridProvider) StreamingLink(ref string) (string, error) {
+	id, streamID, ok := strings.Cut(ref, "|")
+	if !ok {
+		return "", nil
+	}
+	s, err := p.client.StreamingLink(id, streamID)
+	return s, wrap(p, err)
+}
+
+func (p *allDebridProvider) Hosts() ([]Host, error) {
+	hosts, err := p.client.Hosts()
+	if err != nil {
+		return nil, wrap(p, err)
+	}
+	out := make([]Host, 0, len(hosts))
+	for key, h := range hosts {
+		domains := make([]string, 0, len(h.Domains))
+		for _, d := range h.Domains {
+			domains = append(domains, strings.ToLower(d))
+		}
+		if len(domains) == 0 {
+			continue
+		}
+		out = append(out, Host{Name: firstNonEmpty(h.Name, key), Domains: domains, Up: h.Status})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (p *allDebridProvider) Classify(err error) ErrorKind {
+	return KindOf(err)
+}
+
+func classifyAllDebrid(e *alldebrid.APIError) ErrorKind {
+	code := strings.ToUpper(e.Code)
+	switch code {
+	case "AUTH_BLOCKED", "NO_SERVER":
+		return KindForbidden
+	case "LINK_HOST_NOT_SUPPORTED", "LINK_NOT_SUPPORTED":
+		return KindUnsupported
+	case "LINK_HOST_UNAVAILABLE", "LINK_HOST_FULL", "LINK_TEMPORARY_UNAVAILABLE":
+		return KindHostDown
+	case "LINK_HOST_LIMIT_REACHED", "LINK_TOO_MANY_DOWNLOADS", "MUST_BE_PREMIUM", "FREE_TRIAL_LIMIT_REACHED":
+		return KindQuota
+	case "LINK_DOWN", "LINK_PASS_PROTECTED", "DELAYED_FAILED":
+		return KindFileUnavailable
+	}
+	switch {
+	case strings.HasPrefix(code, "AUTH_"):
+		return KindAuth
+	case e.StatusCode == http.StatusTooManyRequests:
+		return KindRateLimit
+	case e.StatusCode >= 500:
+		return KindTemporary
+	}
+	return KindUnknown
+}
@@ -0,0 +1,173 @@
+// Package debrid puts the premium-host providers (Real-Debrid, AllDebrid, ...)
+// behind one interface and picks a provider per host, falling back to the next
+// one when a provider reports the host down or runs out of quota.
+package debrid
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/youming-ai/pikpak-downloader/internal/alldebrid"
+	"github.com/youming-ai/pikpak-downloader/internal/realdebrid"
+)
+
+// LinkInfo is the result of checking a link before it is unrestricted.
+type LinkInfo struct {
+	Filename  string `json:"filename"`
+	Filesize  int64  `json:"filesize"`
+	Host      string `json:"host"`
+	Supported bool   `json:"supported"`
+}
+
+// Unrestricted is a direct download link. StreamRef is opaque and only meant
+// for StreamingLink of the same provider.
+type Unrestricted struct {
+	Filename  string `json:"filename"`
+	Filesize  int64  `json:"filesize"`
+	Host      string `json:"host"`
+	Download  string `json:"download"`
+	StreamRef string `json:"-"`
+}
+
+// Host is one hoster in a provider's status feed.
+type Host struct {
+	Name    string   `json:"name"`
+	Domains []string `json:"domains"` // lower case, first one is the main domain
+	Up      bool     `json:"up"`
+}
+
+// Provider is one debrid service.
+type Provider interface {
+	Name() string
+	CheckLink(link string) (LinkInfo, error)
+	Unrestrict(link string) (Unrestricted, error)
+	StreamingLink(ref string) (string, error)
+	// Hosts returns the provider's supported hosters and whether each is up right now.
+	Hosts() ([]Host, error)
+	Classify(err error) ErrorKind
+}
+
+// ErrorKind is the provider-neutral class of a provider error.
+type ErrorKind int
+
+const (
+	KindUnknown         ErrorKind = iota
+	KindAuth                      // bad or expired API key
+	KindForbidden                 // IP or server blocked by the provider
+	KindRateLimit                 // too many API calls
+	KindUnsupported               // host or link not supported
+	KindHostDown                  // host in maintenance or temporarily unavailable
+	KindQuota                     // traffic, host limit or plan exhausted
+	KindFileUnavailable           // file removed, password protected, infringing
+	KindTemporary                 // network error, timeout, provider 5xx
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindAuth:
+		return "auth"
+	case KindForbidden:
+		return "forbidden"
+	case KindRateLimit:
+		return "rate_limit"
+	case KindUnsupported:
+		return "unsupported"
+	case KindHostDown:
+		return "host_down"
+	case KindQuota:
+		return "quota"
+	case KindFileUnavailable:
+		return "file_unavailable"
+	case KindTemporary:
+		return "temporary"
+	}
+	return "unknown"
+}
+
+// Fallback reports whether another provider should be tried after an error of this kind.
+func (k ErrorKind) Fallback() bool {
+	return k == KindHostDown || k == KindQuota || k == KindUnsupported
+}
+
+// Error is a provider error annotated with its kind.
+type Error struct {
+	Provider string
+	Kind     ErrorKind
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Provider + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// ErrUnsupported is returned by CheckLink callers when a provider answers but
+// does not support the link.
+var ErrUnsupported = errors.New("host/link tidak didukung")
+
+// ErrNoProvider is returned when no provider is configured.
+var ErrNoProvider = errors.New("tidak ada provider debrid yang aktif")
+
+// KindOf classifies any error returned by this package or the provider clients.
+func KindOf(err error) ErrorKind {
+	if err == nil {
+		return KindUnknown
+	}
+	var de *Error
+	if errors.As(err, &de) {
+		return de.Kind
+	}
+	if errors.Is(err, ErrUnsupported) {
+		return KindUnsupported
+	}
+	var rdErr *realdebrid.APIError
+	if errors.As(err, &rdErr) {
+		return classifyRealDebrid(rdErr)
+	}
+	var adErr *alldebrid.APIError
+	if errors.As(err, &adErr) {
+		return classifyAllDebrid(adErr)
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return KindTemporary
+	}
+	return KindUnknown
+}
+
+// ProviderOf returns the provider name recorded on err, or "".
+func ProviderOf(err error) string {
+	var de *Error
+	if errors.As(err, &de) {
+		return de.Provider
+	}
+	return ""
+}
+
+func wrap(p Provider, err error) error {
+	if err == nil {
+		return nil
+	}
+	var de *Error
+	if errors.As(err, &de) {
+		return err
+	}
+	return &Error{Provider: p.Name(), Kind: p.Classify(err), Err: err}
+}
+
+// HostOf returns the lower-case host of a link without a leading "www.".
+func HostOf(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// MatchesDomain reports whether host is domain or one of its subdomains.
+func MatchesDomain(host, domain string) bool {
+	host, domain = strings.ToLower(host), strings.ToLower(domain)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
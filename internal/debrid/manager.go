@@ -0,0 +1,259 @@
+package debrid
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultStatusTTL is how long a provider's host status feed is reused.
+const DefaultStatusTTL = 5 * time.Minute
+
+type cachedStatus struct {
+	hosts     map[string]bool
+	fetchedAt time.Time
+}
+
+// Manager holds the enabled providers in priority order and routes each link
+// to the providers configured for its host.
+type Manager struct {
+	providers []Provider
+	routes    map[string][]string // host domain -> provider names
+	StatusTTL time.Duration
+
+	mu        sync.Mutex
+	status    map[string]cachedStatus    // provider name -> host status
+	disabled  map[string]string          // provider name -> reason, from account health checks
+	exhausted map[string]map[string]bool // provider name -> host domains without traffic left
+}
+
+// NewManager creates a Manager. providers are tried in the given order unless a
+// route for the link's host says otherwise.
+func NewManager(providers []Provider, routes map[string][]string) *Manager {
+	return &Manager{
+		providers: providers,
+		routes:    routes,
+		StatusTTL: DefaultStatusTTL,
+		status:    make(map[string]cachedStatus),
+		disabled:  make(map[string]string),
+		exhausted: make(map[string]map[string]bool),
+	}
+}
+
+// ParseRoutes parses "rapidgator.net=alldebrid,realdebrid;mega.nz=realdebrid".
+func ParseRoutes(spec string) map[string][]string {
+	routes := make(map[string][]string)
+	for _, part := range strings.Split(spec, ";") {
+		host, names, ok := strings.Cut(part, "=")
+		host = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(host)), "www.")
+		if !ok || host == "" {
+			continue
+		}
+		for _, n := range strings.Split(names, ",") {
+			if n = strings.ToLower(strings.TrimSpace(n)); n != "" {
+				routes[host] = append(routes[host], n)
+			}
+		}
+	}
+	return routes
+}
+
+// Enabled reports whether at least one provider is configured.
+func (m *Manager) Enabled() bool {
+	return m != nil && len(m.providers) > 0
+}
+
+// Available reports whether at least one provider is configured and not disabled.
+func (m *Manager) Available() bool {
+	return m.AvailableFor("")
+}
+
+// AvailableFor reports whether at least one provider is configured, not
+// disabled and still has traffic for link's host. An empty link skips the
+// traffic check.
+func (m *Manager) AvailableFor(link string) bool {
+	if !m.Enabled() {
+		return false
+	}
+	host := HostOf(link)
+	for _, p := range m.providers {
+		if m.usable(p.Name(), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// usable reports whether the provider is not disabled and, when host is set,
+// has traffic left for it.
+func (m *Manager) usable(name, host string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, off := m.disabled[name]; off {
+		return false
+	}
+	if host == "" {
+		return true
+	}
+	_, exhausted := lookupHost(m.exhausted[name], host)
+	return !exhausted
+}
+
+// SetDisabled takes a provider out of Candidates, e.g. when its account
+// expired. An empty reason enables it again.
+func (m *Manager) SetDisabled(name, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if reason == "" {
+		delete(m.disabled, name)
+	} else {
+		m.disabled[name] = reason
+	}
+}
+
+// Disabled returns why the provider is disabled, if it is.
+func (m *Manager) Disabled(name string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reason, ok := m.disabled[name]
+	return reason, ok
+}
+
+// SetExhaustedHosts records the host domains the provider has no traffic left
+// for; Candidates leaves the provider out for those hosts.
+func (m *Manager) SetExhaustedHosts(name string, domains []string) {
+	hosts := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		hosts[strings.TrimPrefix(strings.ToLower(d), "www.")] = true
+	}
+	m.mu.Lock()
+	m.exhausted[name] = hosts
+	m.mu.Unlock()
+}
+
+// Providers returns the enabled providers in priority order.
+func (m *Manager) Providers() []Provider {
+	return append([]Provider(nil), m.providers...)
+}
+
+// Provider returns the enabled provider with the given name, or nil.
+func (m *Manager) Provider(name string) Provider {
+	for _, p := range m.providers {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// lookupHost matches host against a domain map, also trying parent domains
+// (cdn.rapidgator.net -> rapidgator.net).
+func lookupHost[T any](m map[string]T, host string) (T, bool) {
+	for h := host; h != ""; {
+		if v, ok := m[h]; ok {
+			return v, true
+		}
+		_, rest, found := strings.Cut(h, ".")
+		if !found || !strings.Contains(rest, ".") {
+			break
+		}
+		h = rest
+	}
+	var zero T
+	return zero, false
+}
+
+// HostStatus returns the provider's cached host status feed, refreshing it when stale.
+func (m *Manager) HostStatus(p Provider) map[string]bool {
+	m.mu.Lock()
+	cached, ok := m.status[p.Name()]
+	m.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < m.StatusTTL {
+		return cached.hosts
+	}
+
+	hosts := cached.hosts // keep the stale feed rather than nothing on error
+	if feed, err := p.Hosts(); err != nil {
+		log.Printf("debrid: status host %s gagal: %v", p.Name(), err)
+	} else {
+		hosts = make(map[string]bool)
+		for _, h := range feed {
+			for _, d := range h.Domains {
+				hosts[d] = h.Up
+			}
+		}
+	}
+	m.mu.Lock()
+	m.status[p.Name()] = cachedStatus{hosts: hosts, fetchedAt: time.Now()}
+	m.mu.Unlock()
+	return hosts
+}
+
+// HostDown reports whether the provider's status feed lists host as down.
+// Unknown hosts are not considered down.
+func (m *Manager) HostDown(p Provider, host string) bool {
+	up, known := lookupHost(m.HostStatus(p), host)
+	return known && !up
+}
+
+// Candidates lists the providers to try for link: prefer first, then the
+// providers routed for the host, then the rest by priority. Providers that
+// report the host down are moved to the end; disabled providers and those
+// without traffic left for the host are left out.
+func (m *Manager) Candidates(link, prefer string) []Provider {
+	host := HostOf(link)
+	var order []string
+	if prefer != "" {
+		order = append(order, prefer)
+	}
+	if routed, ok := lookupHost(m.routes, host); ok {
+		order = append(order, routed...)
+	}
+	for _, p := range m.providers {
+		order = append(order, p.Name())
+	}
+
+	seen := make(map[string]bool)
+	var up, down []Provider
+	for _, name := range order {
+		p := m.Provider(name)
+		if p == nil || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if !m.usable(name, host) {
+			continue
+		}
+		if host != "" && m.HostDown(p, host) {
+			down = append(down, p)
+		} else {
+			up = append(up, p)
+		}
+	}
+	return append(up, down...)
+}
+
+// Do calls fn with each candidate provider until one succeeds or fails with an
+// error that does not warrant a fallback. It returns the provider of the last attempt.
+func (m *Manager) Do(link, prefer string, fn func(Provider) error) (Provider, error) {
+	candidates := m.Candidates(link, prefer)
+	if len(candidates) == 0 {
+		return nil, ErrNoProvider
+	}
+	var last Provider
+	var lastErr error
+	for _, p := range candidates {
+		err := fn(p)
+		if err == nil {
+			return p, nil
+		}
+		last, lastErr = p, wrap(p, err)
+		kind := KindOf(lastErr)
+		if !kind.Fallback() {
+			break
+		}
+		log.Printf("debrid: %s gagal (%s) untuk %s, coba provider berikutnya", p.Name(), kind, HostOf(link))
+	}
+	return last, lastErr
+}
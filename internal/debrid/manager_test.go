@@ -0,0 +1,79 @@
+package debrid
+
+import "testing"
+
+type fakeProvider struct {
+	name  string
+	hosts []Host
+}
+
+func (f fakeProvider) Name() string                            { return f.name }
+func (f fakeProvider) CheckLink(string) (LinkInfo, error)      { return LinkInfo{}, nil }
+func (f fakeProvider) Unrestrict(string) (Unrestricted, error) { return Unrestricted{}, nil }
+func (f fakeProvider) StreamingLink(string) (string, error)    { return "", nil }
+func (f fakeProvider) Hosts() ([]Host, error)                  { return f.hosts, nil }
+func (f fakeProvider) Classify(error) ErrorKind                { return KindUnknown }
+
+func candidateNames(ps []Provider) []string {
+	names := make([]string, 0, len(ps))
+	for _, p := range ps {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+func TestCandidatesSkipExhaustedHosts(t *testing.T) {
+	rd := fakeProvider{name: "realdebrid"}
+	ad := fakeProvider{name: "alldebrid", hosts: []Host{{Domains: []string{"mega.nz"}, Up: false}}}
+
+	tests := []struct {
+		name      string
+		providers []Provider
+		exhausted []string
+		link      string
+		want      []string
+	}{
+		{"only provider, host exhausted", []Provider{rd}, []string{"rapidgator.net"}, "https://rapidgator.net/file/1", nil},
+		{"subdomain of an exhausted host", []Provider{rd}, []string{"rapidgator.net"}, "https://cdn.rapidgator.net/file/1", nil},
+		{"other host still served", []Provider{rd}, []string{"rapidgator.net"}, "https://mega.nz/file/1", []string{"realdebrid"}},
+		{"falls back to the other provider", []Provider{rd, ad}, []string{"rapidgator.net"}, "https://rapidgator.net/file/1", []string{"alldebrid"}},
+		{"host down is only demoted", []Provider{ad, rd}, nil, "https://mega.nz/file/1", []string{"realdebrid", "alldebrid"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(tt.providers, nil)
+			m.SetExhaustedHosts("realdebrid", tt.exhausted)
+
+			got := candidateNames(m.Candidates(tt.link, ""))
+			if len(got) != len(tt.want) {
+				t.Fatalf("Candidates = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Candidates = %v, want %v", got, tt.want)
+				}
+			}
+			if avail := m.AvailableFor(tt.link); avail != (len(tt.want) > 0) {
+				t.Errorf("AvailableFor = %v, want %v", avail, len(tt.want) > 0)
+			}
+			if !m.Available() {
+				t.Error("Available = false; exhausted hosts must not disable the provider")
+			}
+		})
+	}
+}
+
+func TestDisabledProviderNotAvailable(t *testing.T) {
+	m := NewManager([]Provider{fakeProvider{name: "realdebrid"}}, nil)
+	m.SetDisabled("realdebrid", "expired")
+	if m.Available() || m.AvailableFor("https://mega.nz/file/1") {
+		t.Fatal("disabled provider reported as available")
+	}
+	if got := m.Candidates("https://mega.nz/file/1", "realdebrid"); len(got) != 0 {
+		t.Fatalf("Candidates = %v, want none", candidateNames(got))
+	}
+	m.SetDisabled("realdebrid", "")
+	if !m.AvailableFor("https://mega.nz/file/1") {
+		t.Fatal("provider still unavailable after re-enabling")
+	}
+}
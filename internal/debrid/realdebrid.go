@@ -0,0 +1,115 @@
+package debrid
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/youming-ai/pikpak-downloader/internal/realdebrid"
+)
+
+type realDebridProvider struct {
+	client *realdebrid.Client
+}
+
+// NewRealDebrid wraps a Real-Debrid client as a Provider.
+func NewRealDebrid(c *realdebrid.Client) Provider {
+	return &realDebridProvider{client: c}
+}
+
+func (p *realDebridProvider) Name() string { return "realdebrid" }
+
+func (p *realDebridProvider) CheckLink(link string) (LinkInfo, error) {
+	res, err := p.client.CheckLink(link)
+	if err != nil {
+		return LinkInfo{}, wrap(p, err)
+	}
+	return LinkInfo(res), nil
+}
+
+func (p *realDebridProvider) Unrestrict(link string) (Unrestricted, error) {
+	res, err := p.client.UnrestrictLink(link)
+	if err != nil {
+		return Unrestricted{}, wrap(p, err)
+	}
+	return Unrestricted{
+		Filename:  res.Filename,
+		Filesize:  res.Filesize,
+		Host:      res.Host,
+		Download:  res.Download,
+		StreamRef: res.ID,
+	}, nil
+}
+
+func (p *realDebridProvider) StreamingLink(ref string) (string, error) {
+	s, err := p.client.GetStreamingLink(ref)
+	return s, wrap(p, err)
+}
+
+func (p *realDebridProvider) Hosts() ([]Host, error) {
+	status, err := p.client.GetHostsStatus()
+	if err != nil {
+		return nil, wrap(p, err)
+	}
+	// The feed is keyed by domain; group the domains of one hoster by name.
+	byName := make(map[string]*Host)
+	var names []string
+	for domain, h := range status {
+		if h.Status == "unsupported" {
+			continue
+		}
+		name := strings.TrimSpace(h.Name)
+		if name == "" {
+			name = domain
+		}
+		host, ok := byName[name]
+		if !ok {
+			host = &Host{Name: name}
+			byName[name] = host
+			names = append(names, name)
+		}
+		host.Domains = append(host.Domains, strings.ToLower(domain))
+		host.Up = host.Up || h.Status == "up"
+	}
+	sort.Strings(names)
+	out := make([]Host, 0, len(names))
+	for _, name := range names {
+		h := byName[name]
+		sort.Strings(h.Domains)
+		out = append(out, *h)
+	}
+	return out, nil
+}
+
+func (p *realDebridProvider) Classify(err error) ErrorKind {
+	return KindOf(err)
+}
+
+func classifyRealDebrid(e *realdebrid.APIError) ErrorKind {
+	switch e.Code {
+	case realdebrid.ErrCodeBadToken, realdebrid.ErrCodePermissionDenied:
+		return KindAuth
+	case realdebrid.ErrCodeIPNotAllowed:
+		return KindForbidden
+	case realdebrid.ErrCodeTooManyRequests:
+		return KindRateLimit
+	case realdebrid.ErrCodeHosterUnsupported:
+		return KindUnsupported
+	case realdebrid.ErrCodeHosterMaintenance, realdebrid.ErrCodeHosterUnavailable:
+		return KindHostDown
+	case realdebrid.ErrCodeHosterLimit, realdebrid.ErrCodeHosterPremiumOnly, realdebrid.ErrCodeTooManyActive,
+		realdebrid.ErrCodeTrafficExhausted, realdebrid.ErrCodeFairUsageLimit:
+		return KindQuota
+	case realdebrid.ErrCodeFileUnavailable, realdebrid.ErrCodeInfringingFile:
+		return KindFileUnavailable
+	}
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return KindAuth
+	case e.StatusCode == http.StatusTooManyRequests:
+		return KindRateLimit
+	case e.StatusCode >= 500:
+		return KindTemporary
+	}
+	return KindUnknown
+}
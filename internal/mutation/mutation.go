@@ -0,0 +1,382 @@
+// Package mutation parses bank mutation / statement CSV exports (BRI, Bank
+// Jago, GoPay) into incoming transfers that can be matched to top ups.
+package mutation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported formats. FormatAuto picks the format whose columns best match the
+// header.
+const (
+	FormatAuto  = "auto"
+	FormatBRI   = "bri"
+	FormatJago  = "jago"
+	FormatGoPay = "gopay"
+)
+
+// ErrNoHeader is returned when no row looks like the header of a supported
+// format.
+var ErrNoHeader = errors.New("header CSV mutasi tidak dikenali")
+
+// WIB is the time zone bank exports are written in.
+var WIB = time.FixedZone("WIB", 7*3600)
+
+// Row is one incoming (credit) transfer.
+type Row struct {
+	Line        int       `json:"line"` // 1-based line in the file
+	Time        time.Time `json:"time"`
+	DateOnly    bool      `json:"date_only"` // the export had no time of day
+	Description string    `json:"description"`
+	Amount      int64     `json:"amount"` // IDR, always > 0
+}
+
+// Result is a parsed export.
+type Result struct {
+	Format  string `json:"format"`
+	Rows    []Row  `json:"rows"`
+	Debits  int    `json:"debits"`  // outgoing rows, ignored
+	Invalid []int  `json:"invalid"` // lines that could not be parsed
+}
+
+// layout lists the header names (lowercase) a format uses for each column.
+type layout struct {
+	name   string
+	date   []string
+	time   []string // separate time column, optional
+	desc   []string
+	credit []string // credit/debit in separate columns...
+	debit  []string
+	amount []string // ...or one signed amount column
+	kind   []string // optional credit/debit marker next to amount
+}
+
+var layouts = []layout{
+	{
+		name:   FormatBRI,
+		date:   []string{"tanggal transaksi", "tgl transaksi", "tanggal", "tgl"},
+		desc:   []string{"uraian transaksi", "uraian", "keterangan", "deskripsi"},
+		credit: []string{"kredit", "credit", "cr"},
+		debit:  []string{"debet", "debit", "db"},
+	},
+	{
+		name:   FormatJago,
+		date:   []string{"tanggal & waktu", "date & time", "tanggal dan waktu", "tanggal"},
+		desc:   []string{"rincian transaksi", "transaction details", "sumber/tujuan", "source/destination", "catatan", "notes"},
+		amount: []string{"jumlah", "amount", "nominal"},
+	},
+	{
+		name:   FormatGoPay,
+		date:   []string{"tanggal transaksi", "transaction time", "waktu transaksi", "tanggal", "date"},
+		time:   []string{"waktu", "jam", "time"},
+		desc:   []string{"deskripsi", "description", "keterangan", "detail"},
+		amount: []string{"nominal", "amount", "jumlah"},
+		kind:   []string{"tipe", "type", "jenis", "arus dana"},
+	},
+}
+
+// columns maps a layout onto one header row; -1 means absent.
+type columns struct {
+	date, time, desc, credit, debit, amount, kind int
+}
+
+func findColumn(header []string, names []string) int {
+	for _, name := range names {
+		for i, h := range header {
+			if h == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// match maps the layout onto header. score counts the columns found so auto
+// detection can prefer the most specific layout.
+func (l layout) match(header []string) (c columns, score int, ok bool) {
+	c = columns{
+		date:   findColumn(header, l.date),
+		time:   findColumn(header, l.time),
+		desc:   findColumn(header, l.desc),
+		credit: findColumn(header, l.credit),
+		debit:  findColumn(header, l.debit),
+		amount: findColumn(header, l.amount),
+		kind:   findColumn(header, l.kind),
+	}
+	if c.time == c.date {
+		c.time = -1
+	}
+	for _, i := range []int{c.date, c.time, c.desc, c.credit, c.debit, c.amount, c.kind} {
+		if i >= 0 {
+			score++
+		}
+	}
+	ok = c.date >= 0 && (c.credit >= 0 || c.amount >= 0)
+	return c, score, ok
+}
+
+// Parse reads a CSV export. format is FormatAuto or one of the supported
+// formats. Preamble lines before the header (account number, period, ...) and
+// outgoing transfers are skipped.
+func Parse(r io.Reader, format string) (Result, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = FormatAuto
+	}
+	var candidates []layout
+	for _, l := range layouts {
+		if format == FormatAuto || l.name == format {
+			candidates = append(candidates, l)
+		}
+	}
+	if len(candidates) == 0 {
+		return Result{}, fmt.Errorf("format mutasi %q tidak didukung", format)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 BOM from Excel
+
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.Comma = detectDelimiter(data)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.TrimLeadingSpace = true
+
+	var (
+		res  Result
+		cols columns
+		line int
+	)
+	found := false
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			if found {
+				res.Invalid = append(res.Invalid, line)
+			}
+			continue
+		}
+		if !found {
+			header := make([]string, len(record))
+			for i, h := range record {
+				header[i] = strings.ToLower(strings.TrimSpace(h))
+			}
+			best := 0
+			for _, l := range candidates {
+				if c, score, ok := l.match(header); ok && score > best {
+					res.Format, cols, found, best = l.name, c, true, score
+				}
+			}
+			continue
+		}
+		if isBlank(record) {
+			continue
+		}
+
+		row, credit, ok := parseRecord(record, cols)
+		switch {
+		case !ok:
+			res.Invalid = append(res.Invalid, line)
+		case !credit:
+			res.Debits++
+		default:
+			row.Line = line
+			res.Rows = append(res.Rows, row)
+		}
+	}
+	if !found {
+		return Result{}, ErrNoHeader
+	}
+	return res, nil
+}
+
+func parseRecord(record []string, c columns) (Row, bool, bool) {
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	raw := field(c.date)
+	if t := field(c.time); t != "" {
+		raw += " " + t
+	}
+	ts, dateOnly, err := ParseTime(raw)
+	if err != nil {
+		return Row{}, false, false
+	}
+	row := Row{Time: ts, DateOnly: dateOnly, Description: field(c.desc)}
+
+	if c.credit >= 0 {
+		credit, cErr := ParseAmount(field(c.credit))
+		debit, _ := ParseAmount(field(c.debit))
+		if cErr != nil && debit == 0 {
+			return Row{}, false, false
+		}
+		if credit <= 0 {
+			return row, false, true
+		}
+		row.Amount = credit
+		return row, true, true
+	}
+
+	amount, err := ParseAmount(field(c.amount))
+	if err != nil {
+		return Row{}, false, false
+	}
+	if kind := strings.ToLower(field(c.kind)); kind != "" {
+		if isDebitKind(kind) {
+			return row, false, true
+		}
+		if amount < 0 {
+			amount = -amount
+		}
+	}
+	if amount <= 0 {
+		return row, false, true
+	}
+	row.Amount = amount
+	return row, true, true
+}
+
+func isDebitKind(kind string) bool {
+	for _, k := range []string{"debit", "debet", "db", "keluar", "out", "kirim", "bayar", "payment"} {
+		if kind == k || strings.HasPrefix(kind, k+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func isBlank(record []string) bool {
+	for _, f := range record {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// detectDelimiter picks ';' for exports from Indonesian-locale Excel and ','
+// otherwise, by counting both in the first lines.
+func detectDelimiter(data []byte) rune {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	commas, semis := 0, 0
+	for i := 0; i < 10 && sc.Scan(); i++ {
+		commas += strings.Count(sc.Text(), ",")
+		semis += strings.Count(sc.Text(), ";")
+	}
+	if semis > commas {
+		return ';'
+	}
+	return ','
+}
+
+// ParseAmount parses IDR amounts in either notation: "50,123.00",
+// "50.123,00", "Rp 50.123", "+50123", "-10.000" or "(10,000.00)".
+func ParseAmount(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = strings.Trim(s, "()")
+	}
+	s = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "Rp"), "IDR"))
+	s = strings.ReplaceAll(strings.ReplaceAll(s, " ", ""), "\u00a0", "")
+	if strings.HasPrefix(s, "-") {
+		negative = !negative
+		s = s[1:]
+	}
+	s = strings.TrimPrefix(s, "+")
+	s = strings.TrimSpace(strings.TrimPrefix(s, "Rp"))
+	if s == "" || s == "-" {
+		return 0, nil
+	}
+
+	// The last separator is decimal when 1-2 digits follow it.
+	integer := s
+	if i := strings.LastIndexAny(s, ".,"); i >= 0 && len(s)-i-1 <= 2 {
+		integer = s[:i]
+	}
+	integer = strings.NewReplacer(".", "", ",", "").Replace(integer)
+	n, err := strconv.ParseInt(integer, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("nominal %q tidak valid", s)
+	}
+	if negative {
+		n = -n
+	}
+	return n, nil
+}
+
+var timeLayouts = []string{
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02/01/06 15:04:05",
+	"02/01/06 15:04",
+	"02-01-2006 15:04:05",
+	"02-01-2006 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"02 Jan 2006 15:04:05",
+	"02 Jan 2006 15:04",
+	"02 Jan 2006, 15:04",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006 15:04",
+	"2 Jan 2006, 15:04",
+}
+
+var dateLayouts = []string{
+	"02/01/2006",
+	"02/01/06",
+	"02-01-2006",
+	"2006-01-02",
+	"02 Jan 2006",
+	"2 Jan 2006",
+}
+
+// indonesianMonths maps short Indonesian month names that differ from English.
+var indonesianMonths = strings.NewReplacer(
+	"Mei", "May", "Agu", "Aug", "Agt", "Aug", "Okt", "Oct", "Des", "Dec",
+)
+
+// ParseTime parses a transaction date in WIB. dateOnly is true when the value
+// has no time of day.
+func ParseTime(s string) (time.Time, bool, error) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "WIB"))
+	if s == "" {
+		return time.Time{}, false, errors.New("tanggal kosong")
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+	s = indonesianMonths.Replace(s)
+	for _, l := range timeLayouts {
+		if t, err := time.ParseInLocation(l, s, WIB); err == nil {
+			return t, false, nil
+		}
+	}
+	for _, l := range dateLayouts {
+		if t, err := time.ParseInLocation(l, s, WIB); err == nil {
+			return t, true, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("tanggal %q tidak dikenali", s)
+}
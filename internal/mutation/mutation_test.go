@@ -0,0 +1,135 @@
+package mutation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"50,123.00", 50123},
+		{"50.123,00", 50123},
+		{"Rp 50.123", 50123},
+		{"Rp50.123", 50123},
+		{"IDR 1.000.000", 1000000},
+		{"+50123", 50123},
+		{"-10.000", -10000},
+		{"(10,000.00)", -10000},
+		{"50,5", 50},
+		{"1 000 000", 1000000},
+		{"", 0},
+		{"-", 0},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseAmount(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"abc", "12a", "Rp 5x.000"} {
+		if _, err := ParseAmount(bad); err == nil {
+			t.Errorf("ParseAmount(%q) accepted", bad)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     time.Time
+		dateOnly bool
+	}{
+		{"19/10/2026 10:15:32", time.Date(2026, 10, 19, 10, 15, 32, 0, WIB), false},
+		{"19/10/26 10:15", time.Date(2026, 10, 19, 10, 15, 0, 0, WIB), false},
+		{"2026-10-19 10:15:00 WIB", time.Date(2026, 10, 19, 10, 15, 0, 0, WIB), false},
+		{"19 Okt 2026 10:15", time.Date(2026, 10, 19, 10, 15, 0, 0, WIB), false},
+		{"5 Mei 2026, 08:00", time.Date(2026, 5, 5, 8, 0, 0, 0, WIB), false},
+		{"2026-10-19T03:15:00Z", time.Date(2026, 10, 19, 3, 15, 0, 0, time.UTC), false},
+		{"19/10/2026", time.Date(2026, 10, 19, 0, 0, 0, 0, WIB), true},
+		{"19 Des 2026", time.Date(2026, 12, 19, 0, 0, 0, 0, WIB), true},
+	}
+	for _, tt := range tests {
+		got, dateOnly, err := ParseTime(tt.in)
+		if err != nil || !got.Equal(tt.want) || dateOnly != tt.dateOnly {
+			t.Errorf("ParseTime(%q) = %v, %v, %v; want %v, %v", tt.in, got, dateOnly, err, tt.want, tt.dateOnly)
+		}
+	}
+	for _, bad := range []string{"", "kemarin", "32/13/2026"} {
+		if _, _, err := ParseTime(bad); err == nil {
+			t.Errorf("ParseTime(%q) accepted", bad)
+		}
+	}
+}
+
+const (
+	sampleBRI = "Nomor Rekening : 0123-01-000123-30-1\n" +
+		"Periode : 01/10/2026 - 19/10/2026\n" +
+		"\n" +
+		"Tanggal Transaksi,Uraian Transaksi,Teller,Debet,Kredit,Saldo\n" +
+		"19/10/2026 10:15:32,TRANSFER DARI BUDI,8888,0.00,\"50,123.00\",\"1,050,123.00\"\n" +
+		"19/10/2026 11:00:00,BIAYA ADM,8888,\"5,000.00\",0.00,\"1,045,123.00\"\n" +
+		"bukan tanggal,RUSAK,8888,0.00,\"1,000.00\",0.00\n"
+
+	sampleJago = "\xef\xbb\xbfTanggal & Waktu;Sumber/Tujuan;Rincian Transaksi;Catatan;Jumlah\n" +
+		"19 Okt 2026 10:15;BUDI SANTOSO;Transfer Masuk;TU-123;+50.123\n" +
+		"19 Okt 2026 12:00;TOKO;Pembayaran QRIS;;-25.000\n"
+
+	sampleGoPay = "Tanggal,Waktu,Deskripsi,Tipe,Nominal\n" +
+		"2026-10-19,10:15:00,Transfer dari BUDI,Masuk,Rp50.123\n" +
+		"2026-10-19,12:00:00,Bayar Merchant,Keluar,Rp25.000\n" +
+		",,,,\n"
+)
+
+func TestParseSamples(t *testing.T) {
+	tests := []struct {
+		name, data, format string
+		wantFormat         string
+		wantDesc           string
+		wantTime           time.Time
+		wantDebits         int
+		wantInvalid        int
+	}{
+		{"bri", sampleBRI, FormatAuto, FormatBRI, "TRANSFER DARI BUDI", time.Date(2026, 10, 19, 10, 15, 32, 0, WIB), 1, 1},
+		{"bri forced", sampleBRI, FormatBRI, FormatBRI, "TRANSFER DARI BUDI", time.Date(2026, 10, 19, 10, 15, 32, 0, WIB), 1, 1},
+		{"jago", sampleJago, FormatAuto, FormatJago, "Transfer Masuk", time.Date(2026, 10, 19, 10, 15, 0, 0, WIB), 1, 0},
+		{"gopay", sampleGoPay, FormatAuto, FormatGoPay, "Transfer dari BUDI", time.Date(2026, 10, 19, 10, 15, 0, 0, WIB), 1, 0},
+	}
+	for _, tt := range tests {
+		res, err := Parse(strings.NewReader(tt.data), tt.format)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if res.Format != tt.wantFormat {
+			t.Errorf("%s: detected %q, want %q", tt.name, res.Format, tt.wantFormat)
+		}
+		if len(res.Rows) != 1 {
+			t.Errorf("%s: %d credit rows, want 1: %+v", tt.name, len(res.Rows), res.Rows)
+			continue
+		}
+		row := res.Rows[0]
+		if row.Amount != 50123 || row.Description != tt.wantDesc || !row.Time.Equal(tt.wantTime) || row.DateOnly {
+			t.Errorf("%s: row %+v", tt.name, row)
+		}
+		if res.Debits != tt.wantDebits || len(res.Invalid) != tt.wantInvalid {
+			t.Errorf("%s: %d debits, invalid %v; want %d, %d", tt.name, res.Debits, res.Invalid, tt.wantDebits, tt.wantInvalid)
+		}
+	}
+}
+
+func TestParseHeaderErrors(t *testing.T) {
+	if _, err := Parse(strings.NewReader("a,b,c\n1,2,3\n"), FormatAuto); !errors.Is(err, ErrNoHeader) {
+		t.Errorf("unknown header: err %v, want ErrNoHeader", err)
+	}
+	if _, err := Parse(strings.NewReader(sampleJago), FormatBRI); !errors.Is(err, ErrNoHeader) {
+		t.Errorf("Jago export read as BRI: err %v, want ErrNoHeader", err)
+	}
+	if _, err := Parse(strings.NewReader(sampleBRI), "bca"); err == nil || errors.Is(err, ErrNoHeader) {
+		t.Errorf("unsupported format: err %v", err)
+	}
+}
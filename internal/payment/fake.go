@@ -0,0 +1,120 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeSignatureHeader carries the HMAC-SHA256 of the body in fake webhooks.
+const FakeSignatureHeader = "X-Fake-Signature"
+
+// Fake is a local stand-in gateway for development and tests. Charges are
+// kept in memory and payments are simulated with Pay, which returns a webhook
+// body signed like a real gateway would.
+type Fake struct {
+	Secret string
+
+	mu      sync.Mutex
+	seq     int
+	charges map[string]Charge // order id -> charge
+	amounts map[string]int64
+}
+
+// NewFake creates a fake gateway signing webhooks with secret.
+func NewFake(secret string) *Fake {
+	return &Fake{Secret: secret, charges: make(map[string]Charge), amounts: make(map[string]int64)}
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) CreateCharge(req ChargeRequest) (Charge, error) {
+	if req.Method != MethodQRIS && req.Method != MethodVA {
+		return Charge{}, fmt.Errorf("metode pembayaran %q tidak didukung", req.Method)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	charge := Charge{
+		Reference: fmt.Sprintf("FAKE-%d-%d", time.Now().Unix(), f.seq),
+		OrderID:   req.OrderID,
+		Method:    req.Method,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if req.Method == MethodQRIS {
+		charge.QRString = fmt.Sprintf("FAKEQRIS|%s|%d", req.OrderID, req.Amount)
+	} else {
+		charge.Bank = strings.ToLower(req.Bank)
+		charge.VANumber = fmt.Sprintf("8808%010d", f.seq)
+	}
+	f.charges[req.OrderID] = charge
+	f.amounts[req.OrderID] = req.Amount
+	return charge, nil
+}
+
+type fakeNotification struct {
+	EventID   string `json:"event_id"`
+	OrderID   string `json:"order_id"`
+	Reference string `json:"reference"`
+	Status    string `json:"status"`
+	Amount    int64  `json:"amount"`
+}
+
+// Sign returns the signature header value for body.
+func (f *Fake) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(f.Secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Pay simulates the user paying orderID and returns the signed webhook body
+// and signature. amount 0 pays the charged amount.
+func (f *Fake) Pay(orderID string, amount int64) ([]byte, string, error) {
+	f.mu.Lock()
+	charge, ok := f.charges[orderID]
+	if amount == 0 {
+		amount = f.amounts[orderID]
+	}
+	f.mu.Unlock()
+	if !ok {
+		// Charges are in memory; after a restart pay with a synthetic reference.
+		charge.Reference = "FAKE-" + orderID
+	}
+	body, _ := json.Marshal(fakeNotification{
+		EventID:   charge.Reference + ":paid",
+		OrderID:   orderID,
+		Reference: charge.Reference,
+		Status:    StatusPaid,
+		Amount:    amount,
+	})
+	return body, f.Sign(body), nil
+}
+
+func (f *Fake) ParseWebhook(r *http.Request) (Event, error) {
+	raw, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return Event{}, err
+	}
+	if !hmac.Equal([]byte(f.Sign(raw)), []byte(strings.ToLower(r.Header.Get(FakeSignatureHeader)))) {
+		return Event{}, ErrInvalidSignature
+	}
+	var n fakeNotification
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return Event{}, fmt.Errorf("notifikasi tidak valid: %w", err)
+	}
+	return Event{
+		ID:        n.EventID,
+		OrderID:   n.OrderID,
+		Reference: n.Reference,
+		Status:    n.Status,
+		Amount:    n.Amount,
+		Raw:       raw,
+	}, nil
+}
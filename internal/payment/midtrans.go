@@ -0,0 +1,206 @@
+package payment
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Midtrans is the Midtrans Core API gateway (QRIS and bank transfer VA).
+type Midtrans struct {
+	ServerKey  string
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewMidtrans creates a Midtrans gateway for the sandbox or production API.
+func NewMidtrans(serverKey string, production bool) *Midtrans {
+	base := "https://api.sandbox.midtrans.com"
+	if production {
+		base = "https://api.midtrans.com"
+	}
+	return &Midtrans{
+		ServerKey:  serverKey,
+		BaseURL:    base,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (m *Midtrans) Name() string { return "midtrans" }
+
+// midtransTimeLayout is used by expiry_time, in WIB.
+const midtransTimeLayout = "2006-01-02 15:04:05"
+
+var wib = time.FixedZone("WIB", 7*3600)
+
+type midtransChargeResponse struct {
+	StatusCode        string `json:"status_code"`
+	StatusMessage     string `json:"status_message"`
+	TransactionID     string `json:"transaction_id"`
+	OrderID           string `json:"order_id"`
+	TransactionStatus string `json:"transaction_status"`
+	QRString          string `json:"qr_string"`
+	ExpiryTime        string `json:"expiry_time"`
+	PermataVANumber   string `json:"permata_va_number"`
+	VANumbers         []struct {
+		Bank     string `json:"bank"`
+		VANumber string `json:"va_number"`
+	} `json:"va_numbers"`
+	Actions []struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"actions"`
+}
+
+// CreateCharge creates a QRIS or VA charge through /v2/charge.
+func (m *Midtrans) CreateCharge(req ChargeRequest) (Charge, error) {
+	body := map[string]any{
+		"transaction_details": map[string]any{
+			"order_id":     req.OrderID,
+			"gross_amount": req.Amount,
+		},
+		"customer_details": map[string]any{
+			"first_name": req.Name,
+			"email":      req.Email,
+		},
+	}
+	if !req.ExpiresAt.IsZero() {
+		minutes := int(math.Ceil(time.Until(req.ExpiresAt).Minutes()))
+		if minutes < 1 {
+			minutes = 1
+		}
+		body["custom_expiry"] = map[string]any{"expiry_duration": minutes, "unit": "minute"}
+	}
+	bank := strings.ToLower(strings.TrimSpace(req.Bank))
+	switch req.Method {
+	case MethodQRIS:
+		body["payment_type"] = "qris"
+	case MethodVA:
+		if bank == "" {
+			return Charge{}, fmt.Errorf("bank VA wajib diisi")
+		}
+		body["payment_type"] = "bank_transfer"
+		body["bank_transfer"] = map[string]any{"bank": bank}
+	default:
+		return Charge{}, fmt.Errorf("metode pembayaran %q tidak didukung midtrans", req.Method)
+	}
+
+	raw, _ := json.Marshal(body)
+	httpReq, err := http.NewRequest(http.MethodPost, m.BaseURL+"/v2/charge", bytes.NewReader(raw))
+	if err != nil {
+		return Charge{}, err
+	}
+	httpReq.SetBasicAuth(m.ServerKey, "")
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+
+	resp, err := m.HTTPClient.Do(httpReq)
+	if err != nil {
+		return Charge{}, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	var out midtransChargeResponse
+	if err := json.Unmarshal(respBody, &out); err != nil {
+		return Charge{}, fmt.Errorf("midtrans charge failed: status %d, body: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	// Midtrans reports errors in status_code even with HTTP 200.
+	if out.StatusCode != "201" && out.StatusCode != "200" {
+		return Charge{}, fmt.Errorf("midtrans charge failed: %s %s", out.StatusCode, out.StatusMessage)
+	}
+
+	charge := Charge{
+		Reference: out.TransactionID,
+		OrderID:   out.OrderID,
+		Method:    req.Method,
+		QRString:  out.QRString,
+	}
+	for _, a := range out.Actions {
+		if a.Name == "generate-qr-code" {
+			charge.QRURL = a.URL
+		}
+	}
+	if req.Method == MethodVA {
+		charge.Bank = bank
+		charge.VANumber = out.PermataVANumber
+		for _, va := range out.VANumbers {
+			if charge.VANumber == "" || va.Bank == bank {
+				charge.VANumber = va.VANumber
+			}
+		}
+	}
+	if t, err := time.ParseInLocation(midtransTimeLayout, out.ExpiryTime, wib); err == nil {
+		charge.ExpiresAt = t
+	}
+	return charge, nil
+}
+
+type midtransNotification struct {
+	TransactionID     string `json:"transaction_id"`
+	OrderID           string `json:"order_id"`
+	StatusCode        string `json:"status_code"`
+	GrossAmount       string `json:"gross_amount"`
+	SignatureKey      string `json:"signature_key"`
+	TransactionStatus string `json:"transaction_status"`
+	FraudStatus       string `json:"fraud_status"`
+}
+
+// ParseWebhook verifies signature_key = SHA512(order_id + status_code +
+// gross_amount + server key) and maps transaction_status to a Status.
+func (m *Midtrans) ParseWebhook(r *http.Request) (Event, error) {
+	raw, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return Event{}, err
+	}
+	var n midtransNotification
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return Event{}, fmt.Errorf("notifikasi midtrans tidak valid: %w", err)
+	}
+
+	sum := sha512.Sum512([]byte(n.OrderID + n.StatusCode + n.GrossAmount + m.ServerKey))
+	expected := hex.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(n.SignatureKey))) != 1 {
+		return Event{}, ErrInvalidSignature
+	}
+
+	amount, _ := strconv.ParseFloat(n.GrossAmount, 64)
+	ev := Event{
+		ID:        n.TransactionID + ":" + n.TransactionStatus,
+		OrderID:   n.OrderID,
+		Reference: n.TransactionID,
+		Amount:    int64(math.Round(amount)),
+		Raw:       raw,
+	}
+	// Only a 200 status code confirms the money arrived; Midtrans sends 201
+	// for charges that are still waiting.
+	paid := n.StatusCode == "200"
+	switch n.TransactionStatus {
+	case "settlement":
+		ev.Status = StatusPending
+		if paid {
+			ev.Status = StatusPaid
+		}
+	case "capture":
+		ev.Status = StatusPending
+		if paid && (n.FraudStatus == "" || n.FraudStatus == "accept") {
+			ev.Status = StatusPaid
+		}
+	case "expire":
+		ev.Status = StatusExpired
+	case "cancel", "deny", "failure":
+		ev.Status = StatusFailed
+	default:
+		ev.Status = StatusPending
+	}
+	return ev, nil
+}
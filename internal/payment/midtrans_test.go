@@ -0,0 +1,67 @@
+package payment
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func midtransBody(orderID, statusCode, gross, status, signature string) string {
+	return fmt.Sprintf(`{"transaction_id":"tx-1","order_id":%q,"status_code":%q,"gross_amount":%q,"signature_key":%q,"transaction_status":%q}`,
+		orderID, statusCode, gross, signature, status)
+}
+
+func midtransSignature(orderID, statusCode, gross, serverKey string) string {
+	sum := sha512.Sum512([]byte(orderID + statusCode + gross + serverKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestMidtransParseWebhook(t *testing.T) {
+	const key = "SB-Mid-server-test"
+	m := NewMidtrans(key, false)
+	good := midtransSignature("TU-1", "200", "50123.00", key)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantErr    error
+		wantStatus string
+	}{
+		{"settlement", midtransBody("TU-1", "200", "50123.00", "settlement", good), nil, StatusPaid},
+		{"uppercase signature", midtransBody("TU-1", "200", "50123.00", "settlement", strings.ToUpper(good)), nil, StatusPaid},
+		{"expire", midtransBody("TU-1", "200", "50123.00", "expire", good), nil, StatusExpired},
+		{"deny", midtransBody("TU-1", "200", "50123.00", "deny", good), nil, StatusFailed},
+		{"pending", midtransBody("TU-1", "200", "50123.00", "pending", good), nil, StatusPending},
+		{"capture", midtransBody("TU-1", "200", "50123.00", "capture", good), nil, StatusPaid},
+		{"settlement without 200", midtransBody("TU-1", "201", "50123.00", "settlement", midtransSignature("TU-1", "201", "50123.00", key)), nil, StatusPending},
+		{"capture without 200", midtransBody("TU-1", "201", "50123.00", "capture", midtransSignature("TU-1", "201", "50123.00", key)), nil, StatusPending},
+		{"amount changed", midtransBody("TU-1", "200", "99999.00", "settlement", good), ErrInvalidSignature, ""},
+		{"order changed", midtransBody("TU-2", "200", "50123.00", "settlement", good), ErrInvalidSignature, ""},
+		{"other server key", midtransBody("TU-1", "200", "50123.00", "settlement", midtransSignature("TU-1", "200", "50123.00", "other")), ErrInvalidSignature, ""},
+		{"no signature", midtransBody("TU-1", "200", "50123.00", "settlement", ""), ErrInvalidSignature, ""},
+	}
+	for _, tt := range tests {
+		ev, err := m.ParseWebhook(httptest.NewRequest("POST", "/api/payments/webhook", strings.NewReader(tt.body)))
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: err %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if ev.Status != tt.wantStatus || ev.OrderID != "TU-1" || ev.Amount != 50123 {
+			t.Errorf("%s: got %+v", tt.name, ev)
+		}
+	}
+
+	if _, err := m.ParseWebhook(httptest.NewRequest("POST", "/", strings.NewReader("not json"))); err == nil {
+		t.Error("malformed body accepted")
+	}
+}
@@ -0,0 +1,68 @@
+// Package payment creates top-up charges with a payment gateway (QRIS and
+// virtual accounts) and verifies the gateway's payment notifications.
+package payment
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Payment methods a gateway can charge with.
+const (
+	MethodQRIS = "qris"
+	MethodVA   = "va" // virtual account; ChargeRequest.Bank picks the bank
+)
+
+// Status of a charge as reported by a webhook.
+const (
+	StatusPending = "pending"
+	StatusPaid    = "paid"
+	StatusExpired = "expired"
+	StatusFailed  = "failed"
+)
+
+// ErrInvalidSignature is returned by ParseWebhook when the notification is not
+// signed by the gateway.
+var ErrInvalidSignature = errors.New("signature webhook tidak valid")
+
+// ChargeRequest asks the gateway for a new charge.
+type ChargeRequest struct {
+	OrderID   string // our reference, the top-up serial
+	Amount    int64  // IDR
+	Method    string // MethodQRIS or MethodVA
+	Bank      string // for MethodVA: bca, bni, bri, permata, ...
+	Name      string
+	Email     string
+	ExpiresAt time.Time
+}
+
+// Charge is what the user needs to pay a charge.
+type Charge struct {
+	Reference string    // gateway transaction id
+	OrderID   string    // echo of ChargeRequest.OrderID
+	Method    string    // MethodQRIS or MethodVA
+	Bank      string    // for MethodVA
+	QRString  string    // for MethodQRIS: QR payload to render
+	QRURL     string    // for MethodQRIS: hosted QR image, when offered
+	VANumber  string    // for MethodVA
+	ExpiresAt time.Time // zero when the gateway did not say
+}
+
+// Event is a verified payment notification.
+type Event struct {
+	ID        string // unique per notification state; used for idempotency
+	OrderID   string
+	Reference string
+	Status    string // StatusPending, StatusPaid, StatusExpired or StatusFailed
+	Amount    int64
+	Raw       []byte
+}
+
+// Gateway is a payment provider.
+type Gateway interface {
+	Name() string
+	CreateCharge(req ChargeRequest) (Charge, error)
+	// ParseWebhook verifies and decodes a notification sent to our webhook.
+	ParseWebhook(r *http.Request) (Event, error)
+}
@@ -5,9 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/url"
 	"net/http"
-	"path"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -23,6 +22,17 @@ type Client struct {
 	HTTPClient   *http.Client
 	DeviceID     string
 	UserID       string
+
+	// ListingCacheTTL controls how long folder listings are reused by the
+	// walkers; zero means DefaultListingCacheTTL.
+	ListingCacheTTL time.Duration
+	// RunningListingCacheTTL replaces ListingCacheTTL for folders with an
+	// offline task still running; zero means DefaultRunningListingCacheTTL.
+	RunningListingCacheTTL time.Duration
+	// WalkOptions bounds WalkFolder, WalkFolderFiles and WalkFolderManifest.
+	WalkOptions WalkOptions
+
+	listings listingCache
 }
 
 // AuthResponse structure for login response
@@ -45,6 +55,9 @@ type File struct {
 	MimeType       string    `json:"mime_type"`
 	Thumbnail      string    `json:"thumbnail_link"`
 	WebContentLink string    `json:"web_content_link"`
+	Hash           string    `json:"hash"`         // PikPak/Thunder GCID of the content
+	GCID           string    `json:"gcid"`         // Some endpoints return the GCID under this name
+	MD5Checksum    string    `json:"md5_checksum"` // Often empty for older uploads
 	Created        time.Time `json:"created_time"`
 	Modified       time.Time `json:"modified_time"`
 }
@@ -142,7 +155,7 @@ func (c *Client) CaptchaInit(action string, meta map[string]any) (string, error)
 
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("captcha init failed: %s", string(body))
+		return "", newAPIError("captcha init", resp.StatusCode, body)
 	}
 
 	var rResp AuthResponse
@@ -159,7 +172,7 @@ func (c *Client) GetDownloadUrl(fileID string) (string, error) {
 	// 1. Get Captcha Token for this action
 	captchaToken, err := c.CaptchaInit(action, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to init captcha for download: %v", err)
+		return "", fmt.Errorf("failed to init captcha for download: %w", err)
 	}
 
 	// 2. Get File Details with Captcha Token
@@ -182,7 +195,7 @@ func (c *Client) GetDownloadUrl(fileID string) (string, error) {
 
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("get file info failed: %s", string(body))
+		return "", newAPIError("get file info", resp.StatusCode, body)
 	}
 
 	var fileResp map[string]any
@@ -225,7 +238,7 @@ func (c *Client) CreateFolder(name string, parentID string) (string, error) {
 
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("create folder failed: %s", string(body))
+		return "", newAPIError("create folder", resp.StatusCode, body)
 	}
 
 	var result map[string]any
@@ -284,7 +297,7 @@ func (c *Client) AddOfflineTaskToFolder(fileURL string, parentFolderID string) (
 
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("add task failed: %s", string(body))
+		return nil, newAPIError("add task", resp.StatusCode, body)
 	}
 
 	// Typically returns the file/task object
@@ -294,8 +307,23 @@ func (c *Client) AddOfflineTaskToFolder(fileURL string, parentFolderID string) (
 	}
 
 	// Check for explicit error in body even if 200 OK (PikPak sometimes does this)
-	if errCode, ok := taskResp["error_code"]; ok && errCode != 0 {
-		return nil, fmt.Errorf("pikpak error: %v - %v", errCode, taskResp["error_description"])
+	if apiErr := newAPIError("add task", resp.StatusCode, body); apiErr.Code != 0 {
+		return nil, apiErr
+	}
+
+	// Cached (instant) tasks land in the folder right away; running ones are
+	// tracked until their file shows up in a listing
+	if parentFolderID != "" {
+		c.InvalidateListing(parentFolderID)
+	} else {
+		c.InvalidateAllListings()
+	}
+	if task, ok := taskResp["task"].(map[string]any); ok {
+		fileID, _ := task["file_id"].(string)
+		phase, _ := task["phase"].(string)
+		if fileID != "" && phase != "PHASE_TYPE_COMPLETE" {
+			c.trackRunningTask(fileID, parentFolderID)
+		}
 	}
 
 	return taskResp, nil
@@ -323,9 +351,12 @@ func (c *Client) DeleteTasks(taskIDs []string) error {
 
 	if resp.StatusCode != 200 && resp.StatusCode != 204 {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("delete failed: %d %s", resp.StatusCode, string(body))
+		return newAPIError("delete", resp.StatusCode, body)
 	}
 
+	// Deleting a task can remove its files too; we don't know where they live
+	c.InvalidateAllListings()
+
 	return nil
 }
 
@@ -334,7 +365,7 @@ func (c *Client) DeleteFile(fileID string) error {
 	action := "POST:/drive/v1/files:batchDelete"
 	captchaToken, err := c.CaptchaInit(action, nil)
 	if err != nil {
-		return fmt.Errorf("failed to init captcha for delete: %v", err)
+		return fmt.Errorf("failed to init captcha for delete: %w", err)
 	}
 
 	url := "https://api-drive.mypikpak.com/drive/v1/files:batchDelete"
@@ -358,9 +389,11 @@ func (c *Client) DeleteFile(fileID string) error {
 	body, _ := io.ReadAll(resp.Body)
 
 	if resp.StatusCode != 200 && resp.StatusCode != 204 {
-		return fmt.Errorf("batch delete failed: %d %s", resp.StatusCode, string(body))
+		return newAPIError("batch delete", resp.StatusCode, body)
 	}
 
+	c.InvalidateListing(fileID)
+
 	return nil
 }
 
@@ -441,7 +474,7 @@ func (c *Client) Login(username, password string) error {
 
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("login failed: %s", string(body))
+		return newAPIError("login", resp.StatusCode, body)
 	}
 
 	var authResp AuthResponse
@@ -493,7 +526,7 @@ func (c *Client) RefreshAccessToken() error {
 
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("auth failed: status %d, body: %s", resp.StatusCode, string(body))
+		return newAPIError("auth", resp.StatusCode, body)
 	}
 
 	var authResp AuthResponse
@@ -550,7 +583,7 @@ func (c *Client) listFilesPage(parentID, pageToken string, allowRefresh bool) (F
 				return c.listFilesPage(parentID, pageToken, false)
 			}
 		}
-		return emptyResp, fmt.Errorf("list files failed: status %d, body: %s", resp.StatusCode, string(body))
+		return emptyResp, newAPIError("list files", resp.StatusCode, body)
 	}
 
 	var listResp FileListResponse
@@ -571,6 +604,7 @@ func (c *Client) ListFilesPage(parentID, pageToken string) ([]File, string, erro
 }
 
 // ListAllFiles lists all files in a specific folder (handles pagination via next_page_token).
+// The result always comes from PikPak and refreshes the walker's listing cache.
 func (c *Client) ListAllFiles(parentID string) ([]File, error) {
 	var allFiles []File
 	pageToken := ""
@@ -588,6 +622,7 @@ func (c *Client) ListAllFiles(parentID string) ([]File, error) {
 		pageToken = nextPageToken
 	}
 
+	c.storeListing(parentID, allFiles)
 	return allFiles, nil
 }
 
@@ -598,125 +633,33 @@ func (c *Client) ListFiles(parentID string) ([]File, error) {
 
 // WalkFolder recursively lists all files in a folder and returns plain download links
 func (c *Client) WalkFolder(parentID string) ([]string, error) {
-	var links []string
-
-	files, err := c.ListAllFiles(parentID)
+	files, err := c.collectFolderManifest(parentID)
 	if err != nil {
 		return nil, err
 	}
 
+	links := make([]string, 0, len(files))
 	for _, f := range files {
-		if f.Kind == "drive#folder" {
-			// Recurse
-			subLinks, err := c.WalkFolder(f.ID)
-			if err != nil {
-				// Log error but continue? Or fail? Best to continue for partial results or fail hard.
-				// Let's return error to be safe.
-				return nil, err
-			}
-			links = append(links, subLinks...)
-		} else {
-			// It's a file
-			if f.WebContentLink != "" {
-				links = append(links, f.WebContentLink)
-			} else {
-				// Try to get link explicitly if missing (expensive fallback)
-				// But usually ListFiles returns it.
-				// If strictly missing, we might need a separate call.
-				// For now, assume it's there or skip. Can add expensive fallback if user complains.
-				l, _ := c.GetDownloadUrl(f.ID)
-				if l != "" {
-					links = append(links, l)
-				}
-			}
-		}
+		links = append(links, f.WebContentLink)
 	}
-
 	return links, nil
 }
 
 // WalkFolderFiles recursively lists all files in a folder and returns File objects
 func (c *Client) WalkFolderFiles(parentID string) ([]File, error) {
-	var allFiles []File
-
-	files, err := c.ListAllFiles(parentID)
+	files, err := c.collectFolderManifest(parentID)
 	if err != nil {
 		return nil, err
 	}
 
+	allFiles := make([]File, 0, len(files))
 	for _, f := range files {
-		if f.Kind == "drive#folder" {
-			// Recurse
-			subFiles, err := c.WalkFolderFiles(f.ID)
-			if err != nil {
-				return nil, err
-			}
-			allFiles = append(allFiles, subFiles...)
-		} else {
-			// It's a file
-			if f.WebContentLink == "" {
-				l, _ := c.GetDownloadUrl(f.ID)
-				f.WebContentLink = l
-			}
-			if f.WebContentLink != "" {
-				allFiles = append(allFiles, f)
-			}
-		}
+		allFiles = append(allFiles, f.File)
 	}
-
 	return allFiles, nil
 }
 
 // WalkFolderManifest recursively lists all files in a folder and returns metadata with relative paths.
 func (c *Client) WalkFolderManifest(parentID string) ([]ManifestFile, error) {
-	var allFiles []ManifestFile
-
-	var walk func(currentID, currentPath string) error
-	walk = func(currentID, currentPath string) error {
-		files, err := c.ListAllFiles(currentID)
-		if err != nil {
-			return err
-		}
-
-		for _, f := range files {
-			if f.Kind == "drive#folder" {
-				nextPath := f.Name
-				if currentPath != "" {
-					nextPath = path.Join(currentPath, f.Name)
-				}
-				if err := walk(f.ID, nextPath); err != nil {
-					return err
-				}
-				continue
-			}
-
-			if f.WebContentLink == "" {
-				l, _ := c.GetDownloadUrl(f.ID)
-				f.WebContentLink = l
-			}
-			if f.WebContentLink == "" {
-				continue
-			}
-
-			relPath := f.Name
-			folderPath := currentPath
-			if currentPath != "" {
-				relPath = path.Join(currentPath, f.Name)
-			}
-
-			allFiles = append(allFiles, ManifestFile{
-				File:         f,
-				RelativePath: relPath,
-				FolderPath:   folderPath,
-			})
-		}
-
-		return nil
-	}
-
-	if err := walk(parentID, ""); err != nil {
-		return nil, err
-	}
-
-	return allFiles, nil
+	return c.collectFolderManifest(parentID)
 }
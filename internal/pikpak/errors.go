@@ -0,0 +1,106 @@
+package pikpak
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/youming-ai/pikpak-downloader/internal/apierror"
+)
+
+// APIError is an error response from the PikPak API. PikPak answers with
+// {"error":"file_not_found","error_code":9,"error_description":"..."}.
+type APIError struct {
+	Op          string // e.g. "add task", "list files"
+	StatusCode  int
+	Code        int    // error_code, 0 when absent
+	Reason      string // error, e.g. "file_space_not_enough"
+	Description string // error_description
+	Body        string
+	Category    apierror.Category
+	Retryable   bool
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s failed: status %d, body: %s", e.Op, e.StatusCode, e.Body)
+}
+
+func (e *APIError) ErrorCategory() apierror.Category { return e.Category }
+func (e *APIError) IsRetryable() bool                { return e.Retryable }
+func (e *APIError) HTTPStatus() int                  { return e.StatusCode }
+
+func newAPIError(op string, status int, body []byte) *APIError {
+	e := &APIError{Op: op, StatusCode: status, Body: strings.TrimSpace(string(body))}
+	var parsed struct {
+		Error       string `json:"error"`
+		ErrorCode   int    `json:"error_code"`
+		Description string `json:"error_description"`
+	}
+	if json.Unmarshal(body, &parsed) == nil {
+		e.Code = parsed.ErrorCode
+		e.Reason = parsed.Error
+		e.Description = parsed.Description
+	}
+	e.Category = categoryOf(status, e.Reason, e.Description)
+	e.Retryable = apierror.RetryableStatus(status) ||
+		e.Category == apierror.CategoryRateLimit || e.Category == apierror.CategoryUnavailable
+	return e
+}
+
+func categoryOf(status int, reason, description string) apierror.Category {
+	text := strings.ToLower(reason + " " + description)
+	has := func(subs ...string) bool {
+		for _, s := range subs {
+			if strings.Contains(text, s) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case has("unauthenticated", "unauthorized", "invalid_grant", "token", "captcha"):
+		return apierror.CategoryAuth
+	case has("permission_denied", "account_banned", "forbidden"):
+		return apierror.CategoryForbidden
+	case has("too_frequent", "too many", "frequent", "rate_limit"):
+		return apierror.CategoryRateLimit
+	case has("space", "quota", "capacity", "limit", "exhausted"):
+		return apierror.CategoryQuota
+	case has("not_found", "not found"):
+		return apierror.CategoryNotFound
+	case has("unsupported", "not_support"):
+		return apierror.CategoryUnsupported
+	case has("invalid", "empty", "argument"):
+		return apierror.CategoryInvalid
+	}
+	switch {
+	case status == 401:
+		return apierror.CategoryAuth
+	case status == 403:
+		return apierror.CategoryForbidden
+	case status == 404:
+		return apierror.CategoryNotFound
+	case status == 429:
+		return apierror.CategoryRateLimit
+	case status >= 500:
+		return apierror.CategoryUnavailable
+	case status == 400:
+		return apierror.CategoryInvalid
+	}
+	return apierror.CategoryUnknown
+}
+
+// IsNotFound reports whether err says the file or folder does not exist,
+// including an invalid parent_id.
+func IsNotFound(err error) bool {
+	var e *APIError
+	if !errors.As(err, &e) {
+		return false
+	}
+	if e.Category == apierror.CategoryNotFound {
+		return true
+	}
+	text := strings.ToLower(e.Reason + " " + e.Description)
+	return strings.Contains(text, "parent") && e.Category == apierror.CategoryInvalid
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"strconv"
 	"strings"
 	"time"
@@ -130,3 +131,60 @@ func BuildCustomUserAgent(deviceID, userID string) string {
 
 	return strings.Join(parts, " ")
 }
+
+// GCIDBlockSize returns the block size PikPak uses to compute the GCID of a file with the given size.
+func GCIDBlockSize(size int64) int64 {
+	var blockSize int64 = 0x40000
+	for float64(size)/float64(blockSize) > 0x200 && blockSize < 0x200000 {
+		blockSize <<= 1
+	}
+	return blockSize
+}
+
+// GCIDHasher computes the PikPak GCID (SHA1 over the SHA1 of every block) incrementally,
+// so it can be fed while a download is streaming.
+type GCIDHasher struct {
+	blockSize int64
+	filled    int64
+	block     hash.Hash
+	total     hash.Hash
+}
+
+// NewGCIDHasher creates a hasher for a file of the given total size.
+func NewGCIDHasher(size int64) *GCIDHasher {
+	return &GCIDHasher{
+		blockSize: GCIDBlockSize(size),
+		block:     sha1.New(),
+		total:     sha1.New(),
+	}
+}
+
+func (g *GCIDHasher) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		chunk := p
+		if room := g.blockSize - g.filled; int64(len(chunk)) > room {
+			chunk = p[:room]
+		}
+		g.block.Write(chunk)
+		g.filled += int64(len(chunk))
+		p = p[len(chunk):]
+		if g.filled == g.blockSize {
+			g.total.Write(g.block.Sum(nil))
+			g.block.Reset()
+			g.filled = 0
+		}
+	}
+	return n, nil
+}
+
+// HexSum flushes the last partial block and returns the uppercase hex GCID.
+// It must only be called once, after all data has been written.
+func (g *GCIDHasher) HexSum() string {
+	if g.filled > 0 {
+		g.total.Write(g.block.Sum(nil))
+		g.block.Reset()
+		g.filled = 0
+	}
+	return strings.ToUpper(hex.EncodeToString(g.total.Sum(nil)))
+}
@@ -0,0 +1,103 @@
+package pikpak
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGCIDBlockSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want int64
+	}{
+		{0, 0x40000},
+		{11, 0x40000},
+		{0x200 * 0x40000, 0x40000},
+		{0x200*0x40000 + 1, 0x80000},
+		{0x200 * 0x100000, 0x100000},
+		{0x200*0x100000 + 1, 0x200000},
+		{1 << 40, 0x200000},
+	}
+	for _, tt := range tests {
+		if got := GCIDBlockSize(tt.size); got != tt.want {
+			t.Errorf("GCIDBlockSize(%d) = %#x, want %#x", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestGCIDHasher(t *testing.T) {
+	multiBlock := make([]byte, 1<<20+123)
+	for i := range multiBlock {
+		multiBlock[i] = byte(i % 251)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		// A one-block file: SHA1 of SHA1("hello world").
+		{"hello world", []byte("hello world"), "67BECF85308ACF0261750DA1075681EE5C412F05"},
+		{"five blocks", multiBlock, "F7250F8C449B326B404FB0E38C90AE1B1084EF07"},
+	}
+	for _, tt := range tests {
+		// Odd write sizes make blocks span writes, like a streaming download.
+		h := NewGCIDHasher(int64(len(tt.data)))
+		r := bytes.NewReader(tt.data)
+		buf := make([]byte, 100_003)
+		for {
+			n, _ := r.Read(buf)
+			if n == 0 {
+				break
+			}
+			h.Write(buf[:n])
+		}
+		if got := h.HexSum(); got != tt.want || got != referenceGCID(tt.data) {
+			t.Errorf("%s: GCID = %s, want %s (reference %s)", tt.name, got, tt.want, referenceGCID(tt.data))
+		}
+	}
+}
+
+// referenceGCID is the GCID written out from its definition: SHA1 over the
+// SHA1 of every block, in one pass over data held in memory.
+func referenceGCID(data []byte) string {
+	blockSize := int(GCIDBlockSize(int64(len(data))))
+	outer := sha1.New()
+	for start := 0; start < len(data); start += blockSize {
+		sum := sha1.Sum(data[start:min(start+blockSize, len(data))])
+		outer.Write(sum[:])
+	}
+	return strings.ToUpper(hex.EncodeToString(outer.Sum(nil)))
+}
+
+// TestGCIDMatchesPikPak checks the hasher against the hash PikPak shows for a
+// file it stores: PIKPAK_GCID_SAMPLE=<local copy of the file>:<GCID from PikPak>.
+func TestGCIDMatchesPikPak(t *testing.T) {
+	sample := os.Getenv("PIKPAK_GCID_SAMPLE")
+	i := strings.LastIndex(sample, ":")
+	if i < 0 {
+		t.Skip("PIKPAK_GCID_SAMPLE not set")
+	}
+	path, want := sample[:i], sample[i+1:]
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewGCIDHasher(fi.Size())
+	if _, err := io.Copy(h, f); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.HexSum(); !strings.EqualFold(got, want) {
+		t.Fatalf("GCID of %s = %s, PikPak reports %s", path, got, want)
+	}
+}
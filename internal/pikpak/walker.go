@@ -0,0 +1,290 @@
+package pikpak
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrWalkLimitExceeded is returned when a folder walk goes past WalkOptions.MaxDepth
+// or WalkOptions.MaxEntries.
+var ErrWalkLimitExceeded = errors.New("folder walk limit exceeded")
+
+// DefaultListingCacheTTL is used when Client.ListingCacheTTL is zero.
+const DefaultListingCacheTTL = 2 * time.Minute
+
+// DefaultRunningListingCacheTTL is used when Client.RunningListingCacheTTL is
+// zero. It applies to folders that still wait for an offline task.
+const DefaultRunningListingCacheTTL = 10 * time.Second
+
+// runningTaskWindow is how long an offline task is tracked. A task whose file
+// never shows up (failed, deleted) stops shortening the cache after this.
+const runningTaskWindow = 6 * time.Hour
+
+// WalkOptions bounds a recursive folder walk. Zero fields fall back to DefaultWalkOptions.
+type WalkOptions struct {
+	Concurrency int // folders listed in parallel
+	MaxDepth    int // nesting below the root folder
+	MaxEntries  int // files and folders seen in total
+}
+
+var DefaultWalkOptions = WalkOptions{
+	Concurrency: 4,
+	MaxDepth:    32,
+	MaxEntries:  20000,
+}
+
+func (o WalkOptions) withDefaults() WalkOptions {
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultWalkOptions.Concurrency
+	}
+	if o.MaxDepth <= 0 {
+		o.MaxDepth = DefaultWalkOptions.MaxDepth
+	}
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = DefaultWalkOptions.MaxEntries
+	}
+	return o
+}
+
+type cachedListing struct {
+	files     []File
+	expiresAt time.Time
+}
+
+// runningTask is an offline task whose file has not shown up in a listing yet.
+type runningTask struct {
+	folderID string // "" when PikPak picked the folder (default DOWNLOAD folder)
+	until    time.Time
+}
+
+type listingCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedListing
+	running map[string]runningTask // task file ID -> task
+}
+
+func (c *Client) listingTTL() time.Duration {
+	if c.ListingCacheTTL > 0 {
+		return c.ListingCacheTTL
+	}
+	return DefaultListingCacheTTL
+}
+
+func (c *Client) runningListingTTL() time.Duration {
+	if c.RunningListingCacheTTL > 0 {
+		return c.RunningListingCacheTTL
+	}
+	return DefaultRunningListingCacheTTL
+}
+
+// trackRunningTask keeps listings of folderID short-lived until fileID shows
+// up in one, which is when the offline task finished.
+func (c *Client) trackRunningTask(fileID, folderID string) {
+	c.listings.mu.Lock()
+	defer c.listings.mu.Unlock()
+	if c.listings.running == nil {
+		c.listings.running = make(map[string]runningTask)
+	}
+	c.listings.running[fileID] = runningTask{folderID: folderID, until: time.Now().Add(runningTaskWindow)}
+}
+
+func (c *Client) storeListing(parentID string, files []File) {
+	c.listings.mu.Lock()
+	defer c.listings.mu.Unlock()
+	if c.listings.entries == nil {
+		c.listings.entries = make(map[string]cachedListing)
+	}
+	now := time.Now()
+	for k, v := range c.listings.entries {
+		if now.After(v.expiresAt) {
+			delete(c.listings.entries, k)
+		}
+	}
+
+	// A task's file appearing here means the task finished: stop tracking it
+	// and drop cached listings that were taken while it was running.
+	for _, f := range files {
+		if _, ok := c.listings.running[f.ID]; ok {
+			delete(c.listings.running, f.ID)
+			c.invalidateLocked(parentID)
+		}
+	}
+	ttl := c.listingTTL()
+	for id, task := range c.listings.running {
+		if now.After(task.until) {
+			delete(c.listings.running, id)
+		} else if task.folderID == "" || task.folderID == parentID {
+			ttl = min(ttl, c.runningListingTTL())
+		}
+	}
+
+	c.listings.entries[parentID] = cachedListing{
+		files:     append([]File(nil), files...),
+		expiresAt: now.Add(ttl),
+	}
+}
+
+// cachedListAllFiles serves a folder listing from the cache, or lists it (and caches it) on a miss.
+func (c *Client) cachedListAllFiles(parentID string) ([]File, error) {
+	c.listings.mu.Lock()
+	cached, ok := c.listings.entries[parentID]
+	c.listings.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return append([]File(nil), cached.files...), nil
+	}
+	return c.ListAllFiles(parentID)
+}
+
+// InvalidateListing drops the cached listing of a folder, plus any cached
+// listing that contains it, so the next walk sees the change.
+func (c *Client) InvalidateListing(id string) {
+	c.listings.mu.Lock()
+	defer c.listings.mu.Unlock()
+	c.invalidateLocked(id)
+}
+
+func (c *Client) invalidateLocked(id string) {
+	delete(c.listings.entries, id)
+	for parentID, listing := range c.listings.entries {
+		for _, f := range listing.files {
+			if f.ID == id {
+				delete(c.listings.entries, parentID)
+				break
+			}
+		}
+	}
+}
+
+// InvalidateAllListings clears the whole listing cache.
+func (c *Client) InvalidateAllListings() {
+	c.listings.mu.Lock()
+	c.listings.entries = nil
+	c.listings.mu.Unlock()
+}
+
+// StreamFolderManifest walks a folder tree with bounded concurrency and sends
+// every downloadable file on the returned channel. The error channel receives
+// exactly one value (nil on success) after the file channel is closed.
+// Cancel ctx to stop the walk early.
+func (c *Client) StreamFolderManifest(ctx context.Context, parentID string, opts WalkOptions) (<-chan ManifestFile, <-chan error) {
+	opts = opts.withDefaults()
+	out := make(chan ManifestFile, 64)
+	errc := make(chan error, 1)
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(parent)
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	var seen int64
+	var firstErr error
+	var errOnce sync.Once
+
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	var walk func(folderID, folderPath string, depth int)
+	walk = func(folderID, folderPath string, depth int) {
+		defer wg.Done()
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		files, err := c.cachedListAllFiles(folderID)
+		<-sem
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		if n := atomic.AddInt64(&seen, int64(len(files))); n > int64(opts.MaxEntries) {
+			fail(fmt.Errorf("%w: more than %d entries", ErrWalkLimitExceeded, opts.MaxEntries))
+			return
+		}
+
+		for _, f := range files {
+			if ctx.Err() != nil {
+				return
+			}
+
+			relPath := f.Name
+			if folderPath != "" {
+				relPath = path.Join(folderPath, f.Name)
+			}
+
+			if f.Kind == "drive#folder" {
+				if depth+1 > opts.MaxDepth {
+					fail(fmt.Errorf("%w: deeper than %d levels", ErrWalkLimitExceeded, opts.MaxDepth))
+					return
+				}
+				wg.Add(1)
+				go walk(f.ID, relPath, depth+1)
+				continue
+			}
+
+			if f.WebContentLink == "" {
+				// Expensive fallback (captcha + API call), so it shares the concurrency limit
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				f.WebContentLink, _ = c.GetDownloadUrl(f.ID)
+				<-sem
+			}
+			if f.WebContentLink == "" {
+				continue
+			}
+
+			select {
+			case out <- ManifestFile{File: f, RelativePath: relPath, FolderPath: folderPath}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	wg.Add(1)
+	go walk(parentID, "", 0)
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(out)
+		if firstErr == nil {
+			firstErr = parent.Err()
+		}
+		errc <- firstErr
+	}()
+
+	return out, errc
+}
+
+// collectFolderManifest drains StreamFolderManifest into a slice sorted by relative path.
+func (c *Client) collectFolderManifest(parentID string) ([]ManifestFile, error) {
+	stream, errc := c.StreamFolderManifest(context.Background(), parentID, c.WalkOptions)
+
+	var files []ManifestFile
+	for f := range stream {
+		files = append(files, f)
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].RelativePath < files[j].RelativePath
+	})
+	return files, nil
+}
@@ -0,0 +1,86 @@
+package pikpak
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func listingTTLLeft(c *Client, folderID string) time.Duration {
+	c.listings.mu.Lock()
+	defer c.listings.mu.Unlock()
+	entry, ok := c.listings.entries[folderID]
+	if !ok {
+		return 0
+	}
+	return time.Until(entry.expiresAt)
+}
+
+func TestListingTTLWhileTaskRuns(t *testing.T) {
+	c := &Client{ListingCacheTTL: time.Hour, RunningListingCacheTTL: time.Minute}
+
+	c.trackRunningTask("task-file", "downloads")
+	c.storeListing("downloads", []File{{ID: "old"}})
+	c.storeListing("other", []File{{ID: "x"}})
+	if left := listingTTLLeft(c, "downloads"); left > time.Minute {
+		t.Fatalf("folder with a running task cached for %v, want at most 1m", left)
+	}
+	if left := listingTTLLeft(c, "other"); left < 59*time.Minute {
+		t.Fatalf("unrelated folder cached for %v, want the normal TTL", left)
+	}
+
+	// The task's file shows up: the task is done and the normal TTL applies.
+	c.storeListing("downloads", []File{{ID: "old"}, {ID: "task-file"}})
+	if left := listingTTLLeft(c, "downloads"); left < 59*time.Minute {
+		t.Fatalf("folder cached for %v after the task finished, want the normal TTL", left)
+	}
+	if len(c.listings.running) != 0 {
+		t.Fatalf("%d tasks still tracked", len(c.listings.running))
+	}
+}
+
+func TestListingTTLForTaskWithoutFolder(t *testing.T) {
+	c := &Client{ListingCacheTTL: time.Hour, RunningListingCacheTTL: time.Minute}
+	c.trackRunningTask("task-file", "")
+	c.storeListing("anywhere", nil)
+	if left := listingTTLLeft(c, "anywhere"); left > time.Minute {
+		t.Fatalf("listing cached for %v while a task runs in an unknown folder", left)
+	}
+
+	c.listings.running["task-file"] = runningTask{until: time.Now().Add(-time.Second)}
+	c.storeListing("anywhere", nil)
+	if left := listingTTLLeft(c, "anywhere"); left < 59*time.Minute {
+		t.Fatalf("listing cached for %v after the task window passed", left)
+	}
+}
+
+func TestAddOfflineTaskTracksRunningTasks(t *testing.T) {
+	tests := []struct {
+		phase   string
+		tracked bool
+	}{
+		{"PHASE_TYPE_RUNNING", true},
+		{"PHASE_TYPE_PENDING", true},
+		{"PHASE_TYPE_COMPLETE", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.phase, func(t *testing.T) {
+			body := `{"task":{"id":"t1","file_id":"f1","phase":"` + tt.phase + `"}}`
+			c := &Client{HTTPClient: &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+			})}}
+			if _, err := c.AddOfflineTaskToFolder("magnet:?xt=urn:btih:abc", "folder"); err != nil {
+				t.Fatalf("AddOfflineTaskToFolder: %v", err)
+			}
+			if _, ok := c.listings.running["f1"]; ok != tt.tracked {
+				t.Fatalf("tracked = %v, want %v", ok, tt.tracked)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package realdebrid
+
+import (
+	"net/http"
+	"time"
+)
+
+// User is the response of /user.
+type User struct {
+	ID         int    `json:"id"`
+	Username   string `json:"username"`
+	Email      string `json:"email"`
+	Points     int    `json:"points"`
+	Locale     string `json:"locale"`
+	Avatar     string `json:"avatar"`
+	Type       string `json:"type"`       // "premium" or "free"
+	Premium    int64  `json:"premium"`    // seconds of premium left
+	Expiration string `json:"expiration"` // RFC 3339
+}
+
+// IsPremium reports whether the account still has premium time left.
+func (u User) IsPremium() bool {
+	return u.Type == "premium" && u.Premium > 0
+}
+
+// ExpiresAt returns the premium expiration date, or nil when unknown.
+func (u User) ExpiresAt() *time.Time {
+	if u.Expiration == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, u.Expiration)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// HostTraffic is the traffic left on one limited host, from /traffic.
+type HostTraffic struct {
+	Left  int64  `json:"left"`  // links or bytes left, depending on Type
+	Bytes int64  `json:"bytes"` // bytes downloaded in the current period
+	Links int    `json:"links"` // links unrestricted in the current period
+	Limit int64  `json:"limit"`
+	Type  string `json:"type"`  // "links", "gigabytes" or "bytes"
+	Extra int64  `json:"extra"` // additional traffic bought
+	Reset string `json:"reset"` // "daily", "weekly" or "monthly"
+}
+
+// Exhausted reports whether nothing is left for the host, extra traffic included.
+func (t HostTraffic) Exhausted() bool {
+	return t.Left <= 0 && t.Extra <= 0
+}
+
+// GetUser returns the account of the API key.
+func (c *Client) GetUser() (User, error) {
+	var u User
+	err := c.doJSON(http.MethodGet, "/user", nil, "", &u)
+	return u, err
+}
+
+// GetTraffic returns the remaining traffic of limited hosts, keyed by domain.
+func (c *Client) GetTraffic() (map[string]HostTraffic, error) {
+	var traffic map[string]HostTraffic
+	if err := c.doJSON(http.MethodGet, "/traffic", nil, "", &traffic); err != nil {
+		return nil, err
+	}
+	return traffic, nil
+}
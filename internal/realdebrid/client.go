@@ -64,7 +64,7 @@ func (c *Client) GetHostsStatus() (map[string]HostStatus, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError(resp.StatusCode, body)
 	}
 
 	var hosts map[string]HostStatus
@@ -154,7 +154,7 @@ func (c *Client) postForm(endpoint string, form url.Values) (map[string]any, err
 
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		return nil, newAPIError(resp.StatusCode, body)
 	}
 
 	var out map[string]any
@@ -200,7 +200,7 @@ func parseBoolAny(v any) bool {
 // CheckLink checks URL validity and returns filename/filesize when available.
 func (c *Client) CheckLink(link string) (LinkCheckResult, error) {
 	if strings.TrimSpace(c.APIKey) == "" {
-		return LinkCheckResult{}, fmt.Errorf("REALDEBRID_API_KEY belum diatur")
+		return LinkCheckResult{}, ErrNoAPIKey
 	}
 	out, err := c.postForm("/unrestrict/check", url.Values{"link": []string{strings.TrimSpace(link)}})
 	if err != nil {
@@ -222,7 +222,7 @@ func (c *Client) CheckLink(link string) (LinkCheckResult, error) {
 // UnrestrictLink converts a premium host link into direct downloadable link.
 func (c *Client) UnrestrictLink(link string) (UnrestrictedLinkResult, error) {
 	if strings.TrimSpace(c.APIKey) == "" {
-		return UnrestrictedLinkResult{}, fmt.Errorf("REALDEBRID_API_KEY belum diatur")
+		return UnrestrictedLinkResult{}, ErrNoAPIKey
 	}
 	out, err := c.postForm("/unrestrict/link", url.Values{"link": []string{strings.TrimSpace(link)}})
 	if err != nil {
@@ -263,7 +263,7 @@ func (c *Client) GetStreamingLink(fileID string) (string, error) {
 	defer resp.Body.Close()
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("API error %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		return "", newAPIError(resp.StatusCode, body)
 	}
 
 	var out map[string]any
@@ -289,3 +289,76 @@ func (c *Client) GetStreamingLink(fileID string) (string, error) {
 
 	return "", nil
 }
+
+// doLinkList sends req and decodes the JSON array of links returned by the
+// folder and container endpoints.
+func (c *Client) doLinkList(req *http.Request) ([]string, error) {
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	var raw []string
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&raw); err != nil {
+		return nil, err
+	}
+	links := make([]string, 0, len(raw))
+	for _, l := range raw {
+		if l = strings.TrimSpace(l); l != "" {
+			links = append(links, l)
+		}
+	}
+	return links, nil
+}
+
+// UnrestrictFolder expands a hoster folder link into the links of its files.
+func (c *Client) UnrestrictFolder(link string) ([]string, error) {
+	if strings.TrimSpace(c.APIKey) == "" {
+		return nil, ErrNoAPIKey
+	}
+	form := url.Values{"link": []string{strings.TrimSpace(link)}}
+	req, err := http.NewRequest("POST", c.BaseURL+"/unrestrict/folder", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.doLinkList(req)
+}
+
+// UnrestrictContainerFile decrypts an uploaded container file (DLC, RSDF, CCF, ...)
+// and returns the links inside it.
+func (c *Client) UnrestrictContainerFile(data []byte) ([]string, error) {
+	if strings.TrimSpace(c.APIKey) == "" {
+		return nil, ErrNoAPIKey
+	}
+	req, err := http.NewRequest("PUT", c.BaseURL+"/unrestrict/containerFile", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	return c.doLinkList(req)
+}
+
+// UnrestrictContainerLink decrypts a container file hosted at a URL.
+func (c *Client) UnrestrictContainerLink(link string) ([]string, error) {
+	if strings.TrimSpace(c.APIKey) == "" {
+		return nil, ErrNoAPIKey
+	}
+	form := url.Values{"link": []string{strings.TrimSpace(link)}}
+	req, err := http.NewRequest("POST", c.BaseURL+"/unrestrict/containerLink", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.doLinkList(req)
+}
@@ -0,0 +1,102 @@
+package realdebrid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/youming-ai/pikpak-downloader/internal/apierror"
+)
+
+// Error codes from https://api.real-debrid.com/#api_error_codes used by callers.
+const (
+	ErrCodeBadParameter       = 2
+	ErrCodeResourceNotFound   = 7
+	ErrCodeBadToken           = 8
+	ErrCodePermissionDenied   = 9
+	ErrCodeHosterUnsupported  = 16
+	ErrCodeHosterMaintenance  = 17
+	ErrCodeHosterLimit        = 18
+	ErrCodeHosterUnavailable  = 19
+	ErrCodeHosterPremiumOnly  = 20
+	ErrCodeTooManyActive      = 21
+	ErrCodeIPNotAllowed       = 22
+	ErrCodeTrafficExhausted   = 23
+	ErrCodeFileUnavailable    = 24
+	ErrCodeServiceUnavailable = 25
+	ErrCodeTooManyRequests    = 34
+	ErrCodeInfringingFile     = 35
+	ErrCodeFairUsageLimit     = 36
+)
+
+// ErrNoAPIKey is returned by calls that need an API key when none is set.
+var ErrNoAPIKey = errors.New("REALDEBRID_API_KEY belum diatur")
+
+// APIError is a non-2xx response from the Real-Debrid API.
+type APIError struct {
+	StatusCode int
+	Code       int    // error_code from the body, 0 when absent
+	Message    string // error from the body
+	Body       string
+	Category   apierror.Category
+	Retryable  bool
+}
+
+func (e *APIError) ErrorCategory() apierror.Category { return e.Category }
+func (e *APIError) IsRetryable() bool                { return e.Retryable }
+func (e *APIError) HTTPStatus() int                  { return e.StatusCode }
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error %d: %s", e.StatusCode, e.Body)
+}
+
+func newAPIError(status int, body []byte) *APIError {
+	e := &APIError{StatusCode: status, Body: strings.TrimSpace(string(body))}
+	var parsed struct {
+		Error     string `json:"error"`
+		ErrorCode int    `json:"error_code"`
+	}
+	if json.Unmarshal(body, &parsed) == nil {
+		e.Code = parsed.ErrorCode
+		e.Message = parsed.Error
+	}
+	e.Category = categoryOf(e.StatusCode, e.Code)
+	e.Retryable = apierror.RetryableStatus(e.StatusCode) ||
+		e.Category == apierror.CategoryRateLimit || e.Category == apierror.CategoryUnavailable
+	return e
+}
+
+func categoryOf(status, code int) apierror.Category {
+	switch code {
+	case ErrCodeBadToken, ErrCodePermissionDenied:
+		return apierror.CategoryAuth
+	case ErrCodeIPNotAllowed:
+		return apierror.CategoryForbidden
+	case ErrCodeTooManyRequests:
+		return apierror.CategoryRateLimit
+	case ErrCodeHosterUnsupported:
+		return apierror.CategoryUnsupported
+	case ErrCodeHosterMaintenance, ErrCodeHosterUnavailable, ErrCodeServiceUnavailable:
+		return apierror.CategoryUnavailable
+	case ErrCodeHosterLimit, ErrCodeHosterPremiumOnly, ErrCodeTooManyActive, ErrCodeTrafficExhausted, ErrCodeFairUsageLimit:
+		return apierror.CategoryQuota
+	case ErrCodeResourceNotFound, ErrCodeFileUnavailable, ErrCodeInfringingFile:
+		return apierror.CategoryNotFound
+	case ErrCodeBadParameter:
+		return apierror.CategoryInvalid
+	}
+	switch {
+	case status == 401:
+		return apierror.CategoryAuth
+	case status == 403:
+		return apierror.CategoryForbidden
+	case status == 404:
+		return apierror.CategoryNotFound
+	case status == 429:
+		return apierror.CategoryRateLimit
+	case status >= 500:
+		return apierror.CategoryUnavailable
+	}
+	return apierror.CategoryUnknown
+}
@@ -0,0 +1,156 @@
+package realdebrid
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TorrentFile is one file inside a Real-Debrid torrent.
+type TorrentFile struct {
+	ID       int    `json:"id"`
+	Path     string `json:"path"`
+	Bytes    int64  `json:"bytes"`
+	Selected int    `json:"selected"`
+}
+
+// TorrentInfo is the response of /torrents/info/{id}.
+// Status is one of magnet_error, magnet_conversion, waiting_files_selection,
+// queued, downloading, downloaded, error, virus, compressing, uploading, dead.
+type TorrentInfo struct {
+	ID               string        `json:"id"`
+	Filename         string        `json:"filename"`
+	OriginalFilename string        `json:"original_filename"`
+	Hash             string        `json:"hash"`
+	Bytes            int64         `json:"bytes"`
+	OriginalBytes    int64         `json:"original_bytes"`
+	Host             string        `json:"host"`
+	Progress         float64       `json:"progress"`
+	Status           string        `json:"status"`
+	Added            string        `json:"added"`
+	Files            []TorrentFile `json:"files"`
+	Links            []string      `json:"links"`
+	Ended            string        `json:"ended,omitempty"`
+	Speed            int64         `json:"speed,omitempty"`
+	Seeders          int           `json:"seeders,omitempty"`
+}
+
+// Finished reports whether the torrent is ready to be unrestricted.
+func (t TorrentInfo) Finished() bool {
+	return t.Status == "downloaded"
+}
+
+// Failed reports whether Real-Debrid gave up on the torrent.
+func (t TorrentInfo) Failed() bool {
+	switch t.Status {
+	case "magnet_error", "error", "virus", "dead":
+		return true
+	}
+	return false
+}
+
+// AddedTorrent is the response of /torrents/addMagnet.
+type AddedTorrent struct {
+	ID  string `json:"id"`
+	URI string `json:"uri"`
+}
+
+func (c *Client) doJSON(method, endpoint string, body io.Reader, contentType string, out any) error {
+	if strings.TrimSpace(c.APIKey) == "" {
+		return ErrNoAPIKey
+	}
+	req, err := http.NewRequest(method, c.BaseURL+endpoint, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newAPIError(resp.StatusCode, raw)
+	}
+	if out == nil || len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// AddMagnet adds a magnet link to the Real-Debrid torrent list.
+func (c *Client) AddMagnet(magnet string) (AddedTorrent, error) {
+	form := url.Values{"magnet": []string{strings.TrimSpace(magnet)}}
+	var out AddedTorrent
+	err := c.doJSON("POST", "/torrents/addMagnet", strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", &out)
+	if err == nil && out.ID == "" {
+		err = fmt.Errorf("torrent id kosong")
+	}
+	return out, err
+}
+
+// SelectFiles starts the torrent. files is a comma separated list of file ids, or "all".
+func (c *Client) SelectFiles(torrentID, files string) error {
+	if strings.TrimSpace(files) == "" {
+		files = "all"
+	}
+	form := url.Values{"files": []string{files}}
+	return c.doJSON("POST", "/torrents/selectFiles/"+url.PathEscape(torrentID), strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", nil)
+}
+
+// TorrentInfo returns the current state of a torrent.
+func (c *Client) TorrentInfo(torrentID string) (TorrentInfo, error) {
+	var out TorrentInfo
+	err := c.doJSON("GET", "/torrents/info/"+url.PathEscape(torrentID), nil, "", &out)
+	return out, err
+}
+
+// DeleteTorrent removes a torrent from the Real-Debrid torrent list.
+func (c *Client) DeleteTorrent(torrentID string) error {
+	return c.doJSON("DELETE", "/torrents/delete/"+url.PathEscape(torrentID), nil, "", nil)
+}
+
+// InstantAvailability reports which of the given info hashes Real-Debrid can
+// serve without downloading. Hashes are compared in lower case.
+func (c *Client) InstantAvailability(hashes ...string) (map[string]bool, error) {
+	result := make(map[string]bool, len(hashes))
+	clean := make([]string, 0, len(hashes))
+	for _, h := range hashes {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			clean = append(clean, h)
+			result[h] = false
+		}
+	}
+	if len(clean) == 0 {
+		return result, nil
+	}
+
+	// Unavailable hashes come back as [] instead of an object, so decode loosely
+	var out map[string]json.RawMessage
+	if err := c.doJSON("GET", "/torrents/instantAvailability/"+strings.Join(clean, "/"), nil, "", &out); err != nil {
+		return nil, err
+	}
+	for h, raw := range out {
+		var hosts map[string][]json.RawMessage
+		if json.Unmarshal(raw, &hosts) != nil {
+			continue
+		}
+		for _, variants := range hosts {
+			if len(variants) > 0 {
+				result[strings.ToLower(h)] = true
+				break
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,236 @@
+// Package scheduler runs periodic jobs inside the server process. A Store
+// provides the lock that lets only one server instance run a job at a time,
+// and keeps the run history.
+package scheduler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Run triggers.
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Run statuses.
+const (
+	StatusRunning = "running"
+	StatusOK      = "ok"
+	StatusError   = "error"
+)
+
+var (
+	ErrUnknownJob = errors.New("job tidak dikenal")
+	ErrLocked     = errors.New("job sedang berjalan")
+)
+
+// Func does the work of a job. The returned text is kept in the run history.
+type Func func() (string, error)
+
+// Run is one execution of a job.
+type Run struct {
+	ID         uint      `json:"id"`
+	Job        string    `json:"job"`
+	Trigger    string    `json:"trigger"`
+	Status     string    `json:"status"`
+	Output     string    `json:"output"`
+	Error      string    `json:"error"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Store persists locks and runs.
+type Store interface {
+	// Acquire locks job for owner until until. A non-zero slot is the
+	// scheduled time being run; a slot already run by any instance is refused.
+	Acquire(job, owner string, slot, until time.Time) (bool, error)
+	Release(job, owner string) error
+	// SaveRun inserts run when its ID is 0 and updates it otherwise.
+	SaveRun(run *Run) error
+}
+
+// JobInfo describes a registered job.
+type JobInfo struct {
+	Name    string    `json:"name"`
+	Spec    string    `json:"spec"`
+	Timeout string    `json:"timeout"`
+	NextRun time.Time `json:"next_run"`
+}
+
+type job struct {
+	name     string
+	spec     string
+	schedule Schedule
+	timeout  time.Duration
+	fn       Func
+	next     time.Time
+}
+
+// Scheduler runs registered jobs on their schedules.
+type Scheduler struct {
+	store Store
+	owner string
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	started bool
+	wake    chan struct{}
+}
+
+// New creates a scheduler. The owner id written to locks is the host name
+// plus a random suffix.
+func New(store Store) *Scheduler {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return &Scheduler{
+		store: store,
+		owner: fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b)),
+		jobs:  make(map[string]*job),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Add registers a job. timeout bounds how long the lock is held if the
+// process dies mid-run; the job itself is not interrupted.
+func (s *Scheduler) Add(name, spec string, timeout time.Duration, fn Func) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[name] = &job{name: name, spec: spec, schedule: schedule, timeout: timeout, fn: fn, next: schedule.Next(time.Now())}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Jobs lists the registered jobs by name.
+func (s *Scheduler) Jobs() []JobInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]JobInfo, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		out = append(out, JobInfo{Name: j.name, Spec: j.spec, Timeout: j.timeout.String(), NextRun: j.next})
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Name < out[b].Name })
+	return out
+}
+
+// Start runs due jobs in the background until the process exits.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = true
+	s.mu.Unlock()
+
+	go func() {
+		for {
+			now := time.Now()
+			wait := time.Minute // re-evaluate at least every minute (clock changes)
+			var due []*job
+			var slots []time.Time
+
+			s.mu.Lock()
+			for _, j := range s.jobs {
+				if j.next.IsZero() {
+					continue
+				}
+				if !j.next.After(now) {
+					due = append(due, j)
+					slots = append(slots, j.next)
+					j.next = j.schedule.Next(now)
+				}
+				if d := j.next.Sub(now); d < wait {
+					wait = d
+				}
+			}
+			s.mu.Unlock()
+
+			for i, j := range due {
+				go s.run(j, TriggerSchedule, slots[i])
+			}
+			if wait < 0 {
+				wait = 0
+			}
+			select {
+			case <-time.After(wait):
+			case <-s.wake:
+			}
+		}
+	}()
+}
+
+// Trigger runs a job now and waits for it. It returns ErrLocked if the job is
+// already running on any instance.
+func (s *Scheduler) Trigger(name string) (Run, error) {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return Run{}, ErrUnknownJob
+	}
+	return s.run(j, TriggerManual, time.Time{})
+}
+
+func (s *Scheduler) run(j *job, trigger string, slot time.Time) (Run, error) {
+	ok, err := s.store.Acquire(j.name, s.owner, slot, time.Now().Add(j.timeout))
+	if err != nil {
+		log.Printf("scheduler: lock %s gagal: %v", j.name, err)
+		return Run{}, err
+	}
+	if !ok {
+		return Run{}, ErrLocked
+	}
+	defer func() {
+		if err := s.store.Release(j.name, s.owner); err != nil {
+			log.Printf("scheduler: lepas lock %s gagal: %v", j.name, err)
+		}
+	}()
+
+	run := Run{Job: j.name, Trigger: trigger, Status: StatusRunning, StartedAt: time.Now()}
+	if err := s.store.SaveRun(&run); err != nil {
+		log.Printf("scheduler: simpan run %s gagal: %v", j.name, err)
+	}
+
+	output, jobErr := safeCall(j.fn)
+	run.Output = output
+	run.FinishedAt = time.Now()
+	run.Status = StatusOK
+	if jobErr != nil {
+		run.Status = StatusError
+		run.Error = jobErr.Error()
+		log.Printf("scheduler: job %s gagal: %v", j.name, jobErr)
+	}
+	if err := s.store.SaveRun(&run); err != nil {
+		log.Printf("scheduler: simpan run %s gagal: %v", j.name, err)
+	}
+	return run, nil
+}
+
+func safeCall(fn Func) (output string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
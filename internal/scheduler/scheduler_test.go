@@ -0,0 +1,162 @@
+package scheduler
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore is an in-process Store with the same lock rules as the database one.
+type memStore struct {
+	mu     sync.Mutex
+	owner  map[string]string
+	until  map[string]time.Time
+	slot   map[string]time.Time
+	runs   []Run
+	nextID uint
+}
+
+func newMemStore() *memStore {
+	return &memStore{owner: map[string]string{}, until: map[string]time.Time{}, slot: map[string]time.Time{}}
+}
+
+func (m *memStore) Acquire(job, owner string, slot, until time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if u, ok := m.until[job]; ok && u.After(time.Now()) {
+		return false, nil
+	}
+	if !slot.IsZero() {
+		if last, ok := m.slot[job]; ok && !last.Before(slot) {
+			return false, nil
+		}
+		m.slot[job] = slot
+	}
+	m.owner[job], m.until[job] = owner, until
+	return true, nil
+}
+
+func (m *memStore) Release(job, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.owner[job] == owner {
+		delete(m.owner, job)
+		delete(m.until, job)
+	}
+	return nil
+}
+
+func (m *memStore) SaveRun(run *Run) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if run.ID == 0 {
+		m.nextID++
+		run.ID = m.nextID
+		m.runs = append(m.runs, *run)
+		return nil
+	}
+	m.runs[run.ID-1] = *run
+	return nil
+}
+
+func TestTrigger(t *testing.T) {
+	store := newMemStore()
+	s := New(store)
+	if err := s.Add("ok", "@daily", time.Minute, func() (string, error) { return "done", nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("fails", "@daily", time.Minute, func() (string, error) { return "", errors.New("boom") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("panics", "@daily", time.Minute, func() (string, error) { panic("oops") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("bad", "every day", time.Minute, nil); err == nil {
+		t.Fatal("Add accepted an invalid spec")
+	}
+
+	tests := []struct {
+		job, status, output, err string
+	}{
+		{"ok", StatusOK, "done", ""},
+		{"fails", StatusError, "", "boom"},
+		{"panics", StatusError, "", "panic: oops"},
+	}
+	for _, tt := range tests {
+		run, err := s.Trigger(tt.job)
+		if err != nil {
+			t.Fatalf("Trigger(%s): %v", tt.job, err)
+		}
+		if run.Status != tt.status || run.Output != tt.output || run.Error != tt.err || run.Trigger != TriggerManual {
+			t.Errorf("Trigger(%s) = %+v", tt.job, run)
+		}
+		if store.owner[tt.job] != "" {
+			t.Errorf("lock of %s not released", tt.job)
+		}
+	}
+	if len(store.runs) != 3 {
+		t.Errorf("%d runs saved, want 3", len(store.runs))
+	}
+	if _, err := s.Trigger("missing"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Trigger(missing) err = %v, want ErrUnknownJob", err)
+	}
+}
+
+func TestTriggerWhileRunning(t *testing.T) {
+	store := newMemStore()
+	s := New(store)
+	started, finish := make(chan struct{}), make(chan struct{})
+	s.Add("slow", "@daily", time.Minute, func() (string, error) {
+		close(started)
+		<-finish
+		return "", nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Trigger("slow")
+		done <- err
+	}()
+	<-started
+	if _, err := s.Trigger("slow"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Trigger err = %v, want ErrLocked", err)
+	}
+	close(finish)
+	if err := <-done; err != nil {
+		t.Fatalf("first Trigger: %v", err)
+	}
+	if owner := store.owner["slow"]; owner != "" {
+		t.Fatalf("lock still held by %s after the run", owner)
+	}
+}
+
+func TestScheduledSlotRunsOnce(t *testing.T) {
+	store := newMemStore()
+	var mu sync.Mutex
+	runs := 0
+	fn := func() (string, error) {
+		mu.Lock()
+		runs++
+		mu.Unlock()
+		return "", nil
+	}
+
+	// Two instances sharing the store reach the same slot.
+	a, b := New(store), New(store)
+	a.Add("tick", "* * * * *", time.Minute, fn)
+	b.Add("tick", "* * * * *", time.Minute, fn)
+	slot := time.Now().Truncate(time.Minute)
+	if _, err := a.run(a.jobs["tick"], TriggerSchedule, slot); err != nil {
+		t.Fatalf("first instance: %v", err)
+	}
+	if _, err := b.run(b.jobs["tick"], TriggerSchedule, slot); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second instance err = %v, want ErrLocked", err)
+	}
+	if _, err := b.run(b.jobs["tick"], TriggerSchedule, slot.Add(time.Minute)); err != nil {
+		t.Fatalf("next slot: %v", err)
+	}
+	if runs != 2 {
+		t.Fatalf("job ran %d times, want 2", runs)
+	}
+}
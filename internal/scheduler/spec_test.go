@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{
+		"* * * * *",
+		"*/5 * * * *",
+		"0-30/5 9-17 * * 1-5",
+		"1,15,45 0 1,15 * *",
+		"0 0 * * 7",
+		"0 0 29 2 *",
+		"  @hourly  ",
+		"@daily",
+		"@midnight",
+		"@weekly",
+		"@monthly",
+		"@every 30s",
+		"@every 1h30m",
+	}
+	for _, spec := range valid {
+		if _, err := Parse(spec); err != nil {
+			t.Errorf("Parse(%q): %v", spec, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"0 0 30 2 *",
+		"0 0 31 4,6,9,11 *",
+		"@yearly",
+		"@every",
+		"@every 500ms",
+		"@every soon",
+	}
+	for _, spec := range invalid {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) accepted an invalid spec", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04:05", s)
+		if err != nil {
+			t.Fatalf("bad time %q: %v", s, err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		spec string
+		from string
+		want string
+	}{
+		{"* * * * *", "2026-03-10 10:15:30", "2026-03-10 10:16:00"},
+		{"* * * * *", "2026-03-10 10:15:00", "2026-03-10 10:16:00"}, // strictly after
+		{"*/10 * * * *", "2026-03-10 10:15:00", "2026-03-10 10:20:00"},
+		{"*/10 * * * *", "2026-03-10 10:55:00", "2026-03-10 11:00:00"},
+		{"0-30/15 * * * *", "2026-03-10 10:31:00", "2026-03-10 11:00:00"},
+		{"0 3 * * *", "2026-03-10 03:00:00", "2026-03-11 03:00:00"},
+		{"30 3 * * *", "2026-12-31 04:00:00", "2027-01-01 03:30:00"},
+		{"@hourly", "2026-03-10 10:59:59", "2026-03-10 11:00:00"},
+		{"@daily", "2026-03-10 00:00:00", "2026-03-11 00:00:00"},
+		{"@weekly", "2026-03-10 12:00:00", "2026-03-15 00:00:00"}, // Tuesday -> Sunday
+		{"@monthly", "2026-01-31 12:00:00", "2026-02-01 00:00:00"},
+		{"0 0 * * 7", "2026-03-10 12:00:00", "2026-03-15 00:00:00"},   // 7 is Sunday
+		{"0 9 * * 1-5", "2026-03-13 10:00:00", "2026-03-16 09:00:00"}, // Friday -> Monday
+		{"0 0 31 * *", "2026-04-01 00:00:00", "2026-05-31 00:00:00"},  // skips 30-day months
+		{"0 0 29 2 *", "2026-03-01 00:00:00", "2028-02-29 00:00:00"},  // next leap day
+		// Both day fields restricted: either one matches.
+		{"0 0 12 * 5", "2026-03-10 00:00:00", "2026-03-12 00:00:00"}, // Thursday the 12th
+		{"0 0 1 * 1", "2026-03-10 00:00:00", "2026-03-16 00:00:00"},  // Monday
+		{"@every 30s", "2026-03-10 10:15:10", "2026-03-10 10:15:30"},
+		{"@every 30s", "2026-03-10 10:15:30", "2026-03-10 10:16:00"},
+		{"@every 1h", "2026-03-10 10:15:00", "2026-03-10 11:00:00"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.spec, err)
+		}
+		if got := s.Next(at(tt.from)); !got.Equal(at(tt.want)) {
+			t.Errorf("%q after %s = %s, want %s", tt.spec, tt.from, got.Format("2006-01-02 15:04:05 Mon"), tt.want)
+		}
+	}
+}